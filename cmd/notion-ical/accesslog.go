@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Access log formats.
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+)
+
+// accessEntry is a line of the access log. The query is never logged, as it
+// may contain API keys.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Protocol  string    `json:"protocol"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	Feed      string    `json:"feed,omitempty"`
+}
+
+type accessEntryKey struct{}
+
+// setAccessFeed records the name of the feed served by a request in the
+// access log.
+func setAccessFeed(r *http.Request, name string) {
+	if entry, ok := r.Context().Value(accessEntryKey{}).(*accessEntry); ok {
+		entry.Feed = name
+	}
+}
+
+// accessRecorder records the status and size of a response.
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush streams.
+func (w *accessRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack takes over the connection, such as for WebSocket.
+func (w *accessRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// orDash replaces empty fields of the combined format with a dash.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// accessLogHandler logs each request to stdout in format.
+func accessLogHandler(next http.Handler, format string) (http.Handler, error) {
+	var write func(*accessEntry)
+	logger := log.New(os.Stdout, "", 0)
+	switch format {
+	case AccessLogJSON:
+		write = func(entry *accessEntry) {
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return
+			}
+			logger.Print(string(b))
+		}
+	case AccessLogCombined:
+		write = func(entry *accessEntry) {
+			logger.Printf("%s - - [%s] %q %d %d %q %q",
+				entry.Remote,
+				entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+				entry.Method+" "+entry.Path+" "+entry.Protocol,
+				entry.Status,
+				entry.Bytes,
+				orDash(entry.Referer),
+				orDash(entry.UserAgent),
+			)
+		}
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		entry := &accessEntry{
+			Time:      time.Now(),
+			Remote:    remote,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Protocol:  r.Proto,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		rec := &accessRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+		entry.Status = rec.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = rec.bytes
+		entry.Duration = float64(time.Since(entry.Time).Microseconds()) / 1000
+		write(entry)
+	}), nil
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arran4/golang-ical"
+)
+
+const (
+	nsDAV          = "DAV:"
+	nsCalDAV       = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServ = "http://calendarserver.org/ns/"
+
+	caldavRoot = "/caldav/"
+)
+
+// caldavObject is a single event exposed as a CalDAV calendar object
+// resource.
+type caldavObject struct {
+	uid   string
+	name  string
+	href  string
+	data  []byte
+	etag  string
+	start time.Time
+	end   time.Time
+	// recurring objects can have occurrences after end
+	recurring bool
+	// component is VEVENT or VTODO
+	component string
+}
+
+// caldavObjectsOnce holds the CalDAV objects of a feed, split once.
+type caldavObjectsOnce struct {
+	once    sync.Once
+	objects []caldavObject
+}
+
+// caldavObjects returns one calendar object per event or task of the feed,
+// with hrefs inside the collection at prefix. The calendar is split once
+// per feed.
+func (f *feed) caldavObjects(prefix string) []caldavObject {
+	f.objects.once.Do(func() {
+		f.objects.objects = splitCaldavObjects(f.calendar)
+	})
+	objects := make([]caldavObject, len(f.objects.objects))
+	for i, object := range f.objects.objects {
+		object.href = prefix + object.name
+		objects[i] = object
+	}
+	return objects
+}
+
+// splitCaldavObjects splits a calendar into one calendar object per event
+// or task, without hrefs.
+func splitCaldavObjects(calendar *ics.Calendar) []caldavObject {
+	// Timezones are included in every object that could refer to them
+	var timezones []ics.Component
+	for _, component := range calendar.Components {
+		if _, ok := component.(*ics.VTimezone); ok {
+			timezones = append(timezones, component)
+		}
+	}
+
+	// Objects in calendar collections must not have a METHOD (RFC 4791)
+	var properties []ics.CalendarProperty
+	for _, property := range calendar.CalendarProperties {
+		if property.IANAToken != string(ics.PropertyMethod) {
+			properties = append(properties, property)
+		}
+	}
+
+	zones := newCaldavZones(calendar)
+
+	var objects []caldavObject
+	for _, component := range calendar.Components {
+		var base *ics.ComponentBase
+		var componentType ics.ComponentType
+		switch c := component.(type) {
+		case *ics.VEvent:
+			base, componentType = &c.ComponentBase, ics.ComponentVEvent
+		case *ics.VTodo:
+			base, componentType = &c.ComponentBase, ics.ComponentVTodo
+		default:
+			continue
+		}
+
+		single := &ics.Calendar{
+			CalendarProperties: properties,
+			Components:         append(append([]ics.Component{}, timezones...), component),
+		}
+		data := []byte(single.Serialize())
+
+		start, _ := caldavEventTime(base, ics.ComponentPropertyDtStart, zones)
+		end, ok := caldavEventTime(base, ics.ComponentPropertyDtEnd, zones)
+		if !ok {
+			end, _ = caldavEventTime(base, ics.ComponentProperty(ics.PropertyDue), zones)
+		}
+		if start.IsZero() {
+			start = end
+		}
+
+		var uid string
+		if p := base.GetProperty(ics.ComponentPropertyUniqueId); p != nil {
+			uid = p.Value
+		}
+
+		name := caldavObjectName(uid)
+		objects = append(objects, caldavObject{
+			uid:       uid,
+			name:      name,
+			data:      data,
+			etag:      hashETag(data),
+			start:     start,
+			end:       end,
+			recurring: base.GetProperty(ics.ComponentPropertyRrule) != nil,
+			component: string(componentType),
+		})
+	}
+	return objects
+}
+
+// caldavObjectName derives a URL-safe resource name from an event UID.
+func caldavObjectName(uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return hex.EncodeToString(sum[:16]) + ".ics"
+}
+
+// caldavEventTime parses DATE and DATE-TIME values of an event or task
+// property, in the zone of their TZID, or the zone of the calendar for
+// floating times and dates.
+func caldavEventTime(component *ics.ComponentBase, property ics.ComponentProperty, zones *caldavZones) (time.Time, bool) {
+	p := component.GetProperty(property)
+	if p == nil {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse("20060102T150405Z", p.Value); err == nil {
+		return t, true
+	}
+	var tzid string
+	if values := p.ICalParameters[string(ics.ParameterTzid)]; len(values) > 0 {
+		tzid = values[0]
+	}
+	zone := zones.zone(tzid)
+	for _, layout := range []string{"20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, p.Value, zone); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// caldavZones resolves the TZIDs of the times of a feed, loading each zone
+// once. Floating times are in the zone of the calendar, from X-WR-TIMEZONE,
+// or UTC.
+type caldavZones struct {
+	floating *time.Location
+	loaded   map[string]*time.Location
+}
+
+func newCaldavZones(calendar *ics.Calendar) *caldavZones {
+	z := &caldavZones{floating: time.UTC, loaded: make(map[string]*time.Location)}
+	for _, property := range calendar.CalendarProperties {
+		if property.IANAToken == string(ics.PropertyXWRTimezone) {
+			z.floating = z.zone(property.Value)
+		}
+	}
+	return z
+}
+
+// zone returns the zone of a TZID, which are IANA names as emitted by the
+// converter, or the floating zone when it is empty or unknown.
+func (z *caldavZones) zone(tzid string) *time.Location {
+	if tzid == "" {
+		return z.floating
+	}
+	if zone, ok := z.loaded[tzid]; ok {
+		return zone
+	}
+	zone, err := time.LoadLocation(tzid)
+	if err != nil {
+		zone = z.floating
+	}
+	z.loaded[tzid] = zone
+	return zone
+}
+
+// caldavHref is the path of the feed's CalDAV calendar collection, escaped
+// for hrefs.
+func (s *server) caldavHref() string {
+	return caldavRoot + url.PathEscape(s.name) + "/"
+}
+
+// caldavPath is caldavHref unescaped, to match the paths of requests.
+func (s *server) caldavPath() string {
+	return caldavRoot + s.name + "/"
+}
+
+// handleCalDAVRoot serves the principal and calendar home, which contains a
+// calendar collection for each feed.
+func (rt *router) handleCalDAVRoot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", "OPTIONS, PROPFIND")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		req, err := readDAVRequest(r)
+		if err != nil {
+			http.Error(w, "invalid PROPFIND body", http.StatusBadRequest)
+			return
+		}
+
+		var ms davMultistatus
+		ms.add(caldavRoot, caldavRootProps(), req)
+		if r.Header.Get("Depth") != "0" {
+			for _, s := range rt.servers() {
+				f, err := s.get(r.Context())
+				if err != nil {
+					log.Printf("failed to refresh feed %s: %v", s.name, err)
+					ms.addStatus(s.caldavHref(), http.StatusInternalServerError)
+					continue
+				}
+				ms.add(s.caldavHref(), s.caldavCalendarProps(f), req)
+			}
+		}
+		ms.write(w)
+	case http.MethodGet, http.MethodHead:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "read-only calendar", http.StatusForbidden)
+	}
+}
+
+// handleCalDAV serves the feed as a read-only CalDAV collection.
+func (s *server) handleCalDAV(w http.ResponseWriter, r *http.Request) {
+	setAccessFeed(r, s.name)
+
+	f, err := s.get(r.Context())
+	if err != nil {
+		log.Printf("failed to refresh feed: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	if f.failed != nil {
+		w.Header().Set("Warning", staleWarning)
+	}
+	setCacheHeaders(w, f)
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		s.caldavGet(w, r, f)
+	case "PROPFIND":
+		s.caldavPropfind(w, r, f)
+	case "REPORT":
+		s.caldavReport(w, r, f)
+	case http.MethodPut, http.MethodDelete, "PROPPATCH", "MKCOL", "MKCALENDAR", "MOVE", "COPY":
+		http.Error(w, "read-only calendar", http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) caldavGet(w http.ResponseWriter, r *http.Request, f *feed) {
+	if r.URL.Path == s.caldavPath() {
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("ETag", f.etag)
+		http.ServeContent(w, r, "", f.refreshed, bytes.NewReader(f.ics))
+		return
+	}
+
+	for _, object := range f.caldavObjects(s.caldavHref()) {
+		if s.caldavPath()+object.name == r.URL.Path {
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			w.Header().Set("ETag", object.etag)
+			http.ServeContent(w, r, "", f.refreshed, bytes.NewReader(object.data))
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// davPropRequest is the body of PROPFIND and REPORT requests.
+type davPropRequest struct {
+	XMLName xml.Name
+	AllProp *struct{} `xml:"DAV: allprop"`
+	Prop    struct {
+		Names []davName `xml:",any"`
+	} `xml:"DAV: prop"`
+	Hrefs  []string `xml:"DAV: href"`
+	Filter struct {
+		CompFilter struct {
+			CompFilter struct {
+				Name      string `xml:"name,attr"`
+				TimeRange *struct {
+					Start string `xml:"start,attr"`
+					End   string `xml:"end,attr"`
+				} `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+			} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type davName struct {
+	XMLName xml.Name
+}
+
+func readDAVRequest(r *http.Request) (davPropRequest, error) {
+	var req davPropRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return req, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		req.AllProp = &struct{}{}
+		return req, nil
+	}
+	err = xml.Unmarshal(body, &req)
+	return req, err
+}
+
+func (req davPropRequest) names() []xml.Name {
+	var names []xml.Name
+	for _, n := range req.Prop.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+func (s *server) caldavPropfind(w http.ResponseWriter, r *http.Request, f *feed) {
+	req, err := readDAVRequest(r)
+	if err != nil {
+		http.Error(w, "invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+
+	depth := r.Header.Get("Depth")
+	objects := f.caldavObjects(s.caldavHref())
+
+	var ms davMultistatus
+	switch r.URL.Path {
+	case s.caldavPath():
+		ms.add(s.caldavHref(), s.caldavCalendarProps(f), req)
+		if depth != "0" {
+			for _, object := range objects {
+				ms.add(object.href, caldavObjectProps(object, false), req)
+			}
+		}
+	default:
+		found := false
+		for _, object := range objects {
+			if s.caldavPath()+object.name == r.URL.Path {
+				ms.add(object.href, caldavObjectProps(object, false), req)
+				found = true
+			}
+		}
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	ms.write(w)
+}
+
+func (s *server) caldavReport(w http.ResponseWriter, r *http.Request, f *feed) {
+	req, err := readDAVRequest(r)
+	if err != nil {
+		http.Error(w, "invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+
+	objects := f.caldavObjects(s.caldavHref())
+
+	var ms davMultistatus
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		var start, end time.Time
+		if tr := req.Filter.CompFilter.CompFilter.TimeRange; tr != nil {
+			start, _ = time.Parse("20060102T150405Z", tr.Start)
+			end, _ = time.Parse("20060102T150405Z", tr.End)
+		}
+		component := req.Filter.CompFilter.CompFilter.Name
+		for _, object := range objects {
+			if component != "" && component != object.component {
+				continue
+			}
+			// Events overlap the range when they end after its start
+			// (RFC 4791 section 9.9)
+			if !start.IsZero() && !object.end.IsZero() && !object.end.After(start) && !object.recurring {
+				continue
+			}
+			if !end.IsZero() && !object.start.IsZero() && !object.start.Before(end) {
+				continue
+			}
+			ms.add(object.href, caldavObjectProps(object, true), req)
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			hrefPath := href
+			if u, err := url.Parse(href); err == nil {
+				hrefPath = u.Path
+			}
+			found := false
+			for _, object := range objects {
+				if s.caldavPath()+object.name == path.Clean(hrefPath) {
+					ms.add(object.href, caldavObjectProps(object, true), req)
+					found = true
+				}
+			}
+			if !found {
+				ms.addStatus(href, http.StatusNotFound)
+			}
+		}
+	default:
+		http.Error(w, "unsupported report", http.StatusForbidden)
+		return
+	}
+
+	ms.write(w)
+}
+
+func caldavRootProps() map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                 "<collection/>",
+		{Space: nsDAV, Local: "displayname"}:                  "notion-ical",
+		{Space: nsDAV, Local: "current-user-principal"}:       "<href>" + caldavRoot + "</href>",
+		{Space: nsDAV, Local: "principal-URL"}:                "<href>" + caldavRoot + "</href>",
+		{Space: nsCalDAV, Local: "calendar-home-set"}:         `<href xmlns="DAV:">` + caldavRoot + "</href>",
+		{Space: nsCalDAV, Local: "calendar-user-address-set"}: "",
+	}
+}
+
+func (s *server) caldavCalendarProps(f *feed) map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        `<collection/><calendar xmlns="` + nsCalDAV + `"/>`,
+		{Space: nsDAV, Local: "displayname"}:                         xmlEscape(s.source.Name()),
+		{Space: nsDAV, Local: "current-user-principal"}:              "<href>" + caldavRoot + "</href>",
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          "<privilege><read/></privilege>",
+		{Space: nsDAV, Local: "getetag"}:                             xmlEscape(f.etag),
+		{Space: nsCalendarServ, Local: "getctag"}:                    xmlEscape(f.etag),
+		{Space: nsDAV, Local: "supported-report-set"}:                `<supported-report><report><calendar-query xmlns="` + nsCalDAV + `"/></report></supported-report><supported-report><report><calendar-multiget xmlns="` + nsCalDAV + `"/></report></supported-report>`,
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<comp name="VEVENT"/><comp name="VTODO"/>`,
+	}
+}
+
+func caldavObjectProps(object caldavObject, withData bool) map[xml.Name]string {
+	props := map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:   "",
+		{Space: nsDAV, Local: "getetag"}:        xmlEscape(object.etag),
+		{Space: nsDAV, Local: "getcontenttype"}: "text/calendar; charset=utf-8",
+	}
+	if withData {
+		props[xml.Name{Space: nsCalDAV, Local: "calendar-data"}] = xmlEscape(string(object.data))
+	}
+	return props
+}
+
+// davMultistatus builds a multistatus response.
+type davMultistatus struct {
+	buf bytes.Buffer
+}
+
+// add adds a response for href with the requested properties, reporting
+// unknown properties as not found.
+func (ms *davMultistatus) add(href string, props map[xml.Name]string, req davPropRequest) {
+	names := req.names()
+	if req.AllProp != nil || len(names) == 0 {
+		for name := range props {
+			if name.Local != "calendar-data" || req.XMLName.Space == nsCalDAV {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var found, missing strings.Builder
+	for _, name := range names {
+		value, ok := props[name]
+		if ok {
+			writeDAVProp(&found, name, value)
+		} else {
+			writeDAVProp(&missing, name, "")
+		}
+	}
+
+	ms.buf.WriteString("<response><href>" + xmlEscape(href) + "</href>")
+	if found.Len() > 0 {
+		ms.buf.WriteString("<propstat><prop>" + found.String() + "</prop><status>HTTP/1.1 200 OK</status></propstat>")
+	}
+	if missing.Len() > 0 {
+		ms.buf.WriteString("<propstat><prop>" + missing.String() + "</prop><status>HTTP/1.1 404 Not Found</status></propstat>")
+	}
+	ms.buf.WriteString("</response>")
+}
+
+func (ms *davMultistatus) addStatus(href string, status int) {
+	ms.buf.WriteString("<response><href>" + xmlEscape(href) + "</href><status>" + fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status)) + "</status></response>")
+}
+
+func (ms *davMultistatus) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header+`<multistatus xmlns="DAV:">`)
+	w.Write(ms.buf.Bytes())
+	io.WriteString(w, "</multistatus>")
+}
+
+func writeDAVProp(b *strings.Builder, name xml.Name, value string) {
+	b.WriteString("<" + name.Local + ` xmlns="` + xmlEscape(name.Space) + `">` + value + "</" + name.Local + ">")
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/arran4/golang-ical"
+	"github.com/serverwentdown/notion-ical"
+	"github.com/serverwentdown/notion-ical/notionicaltest"
+)
+
+// testCalDAVSource is a calendar with a timed and an all-day event, with
+// the IDs of pages.
+func testCalDAVSource() *notionicaltest.Source {
+	return notionicaltest.NewSource("Team",
+		notion_ical.Event{
+			ID:    "review@notion-ical",
+			Title: "Review",
+			Start: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+			End:   time.Date(2024, 1, 8, 9, 30, 0, 0, time.UTC),
+		},
+		notion_ical.Event{
+			ID:     "offsite@notion-ical",
+			Title:  "Offsite",
+			Start:  time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+			End:    time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+			AllDay: true,
+		},
+	)
+}
+
+// newCalDAVRouter serves source over CalDAV as the feed name.
+func newCalDAVRouter(t *testing.T, name string, source notion_ical.Source, opts ...notion_ical.ConvertOption) (*router, *server) {
+	t.Helper()
+	rt := newRouter(time.Hour, true)
+	s := newServer(name, feedConfig{Name: name}, source, time.Hour, opts)
+	rt.feeds[name] = s
+	return rt, s
+}
+
+func serveCalDAV(rt *router, method, target, depth, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if depth != "" {
+		r.Header.Set("Depth", depth)
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+func TestCalDAV(t *testing.T) {
+	rt, s := newCalDAVRouter(t, "team", testCalDAVSource())
+	f, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := f.caldavObjects(s.caldavHref())
+	if len(objects) != 2 {
+		t.Fatalf("%d objects, want 2", len(objects))
+	}
+	object := objects[0]
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		depth  string
+		want   int
+	}{
+		{"options", http.MethodOptions, "/caldav/team/", "", http.StatusOK},
+		{"get collection", http.MethodGet, "/caldav/team/", "", http.StatusOK},
+		{"get object", http.MethodGet, object.href, "", http.StatusOK},
+		{"propfind root", "PROPFIND", caldavRoot, "1", http.StatusMultiStatus},
+		{"propfind collection", "PROPFIND", "/caldav/team/", "1", http.StatusMultiStatus},
+		{"propfind object", "PROPFIND", object.href, "0", http.StatusMultiStatus},
+		{"unknown object", http.MethodGet, "/caldav/team/missing.ics", "", http.StatusNotFound},
+		{"unknown feed", "PROPFIND", "/caldav/other/", "1", http.StatusNotFound},
+		{"put", http.MethodPut, object.href, "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serveCalDAV(rt, test.method, test.target, test.depth, "")
+			if w.Code != test.want {
+				t.Errorf("%s %s: status = %d, want %d", test.method, test.target, w.Code, test.want)
+			}
+		})
+	}
+
+	t.Run("get object data", func(t *testing.T) {
+		w := serveCalDAV(rt, http.MethodGet, object.href, "", "")
+		if body := w.Body.String(); !strings.Contains(body, "SUMMARY:Review") || strings.Contains(body, "Offsite") {
+			t.Errorf("object is not the single event:\n%s", body)
+		}
+		if etag := w.Header().Get("ETag"); etag != object.etag {
+			t.Errorf("ETag = %q, want %q", etag, object.etag)
+		}
+	})
+
+	t.Run("multiget", func(t *testing.T) {
+		body := `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/></D:prop>
+<D:href>` + object.href + `</D:href>
+<D:href>/caldav/team/missing.ics</D:href>
+</C:calendar-multiget>`
+		w := serveCalDAV(rt, "REPORT", "/caldav/team/", "1", body)
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusMultiStatus)
+		}
+		if got := strings.Count(w.Body.String(), "<response>"); got != 2 {
+			t.Errorf("%d responses, want 2:\n%s", got, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), "404 Not Found</status></response>") {
+			t.Errorf("missing object not reported as not found:\n%s", w.Body)
+		}
+	})
+}
+
+func TestCalDAVEscapedName(t *testing.T) {
+	rt, s := newCalDAVRouter(t, "Team Events", testCalDAVSource())
+	f, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := f.caldavObjects(s.caldavHref())[0]
+	if !strings.HasPrefix(object.href, "/caldav/Team%20Events/") {
+		t.Fatalf("href = %q, want it escaped", object.href)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		depth  string
+		want   int
+	}{
+		{"get collection", http.MethodGet, "/caldav/Team%20Events/", "", http.StatusOK},
+		{"get object", http.MethodGet, object.href, "", http.StatusOK},
+		{"propfind collection", "PROPFIND", "/caldav/Team%20Events/", "1", http.StatusMultiStatus},
+		{"propfind object", "PROPFIND", object.href, "0", http.StatusMultiStatus},
+		{"unknown object", http.MethodGet, "/caldav/Team%20Events/missing.ics", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serveCalDAV(rt, test.method, test.target, test.depth, "")
+			if w.Code != test.want {
+				t.Errorf("%s %s: status = %d, want %d", test.method, test.target, w.Code, test.want)
+			}
+		})
+	}
+
+	t.Run("multiget", func(t *testing.T) {
+		body := `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/></D:prop>
+<D:href>` + object.href + `</D:href>
+</C:calendar-multiget>`
+		w := serveCalDAV(rt, "REPORT", "/caldav/Team%20Events/", "1", body)
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusMultiStatus)
+		}
+		if strings.Contains(w.Body.String(), "404") {
+			t.Errorf("object not found in multiget:\n%s", w.Body)
+		}
+	})
+}
+
+func TestCalDAVObjectsSplitOnce(t *testing.T) {
+	_, s := newCalDAVRouter(t, "team", testCalDAVSource())
+	f, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects := f.caldavObjects("/caldav/team/")
+	other := again.caldavObjects("")
+	if &objects[0].data[0] != &other[0].data[0] {
+		t.Errorf("calendar split again for the same feed")
+	}
+	if objects[0].href != "/caldav/team/"+objects[0].name || other[0].href != other[0].name {
+		t.Errorf("hrefs = %q, %q, want them inside their collections", objects[0].href, other[0].href)
+	}
+}
+
+func TestCalDAVTimeRange(t *testing.T) {
+	rt, _ := newCalDAVRouter(t, "team", testCalDAVSource())
+
+	tests := []struct {
+		name       string
+		start, end string
+		want       []string
+	}{
+		{"during the event", "20240108T084500Z", "20240108T091500Z", []string{"Review"}},
+		{"before the events", "20240107T000000Z", "20240108T000000Z", nil},
+		{"ending at the start of the event", "20240108T080000Z", "20240108T090000Z", nil},
+		{"starting at the end of the event", "20240108T093000Z", "20240108T100000Z", nil},
+		{"all-day event", "20240110T120000Z", "20240110T130000Z", []string{"Offsite"}},
+		{"both", "20240101T000000Z", "20240201T000000Z", []string{"Review", "Offsite"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><C:calendar-data/></D:prop>
+<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+<C:time-range start="` + test.start + `" end="` + test.end + `"/>
+</C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+			w := serveCalDAV(rt, "REPORT", "/caldav/team/", "1", body)
+			if w.Code != http.StatusMultiStatus {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusMultiStatus)
+			}
+			var got []string
+			for _, title := range []string{"Review", "Offsite"} {
+				if strings.Contains(w.Body.String(), "SUMMARY:"+title) {
+					got = append(got, title)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("matched %v, want %v:\n%s", got, test.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCalDAVTimeRangeTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 09:00 UTC is 18:00 in Tokyo, written with TZID=Asia/Tokyo
+	source := notionicaltest.NewSource("Team", notion_ical.Event{
+		ID:    "review@notion-ical",
+		Title: "Review",
+		Start: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 1, 8, 9, 30, 0, 0, time.UTC),
+	})
+	rt, _ := newCalDAVRouter(t, "team", source, notion_ical.WithTimezone(tokyo))
+
+	tests := []struct {
+		name       string
+		start, end string
+		want       bool
+	}{
+		{"during the event", "20240108T084500Z", "20240108T091500Z", true},
+		{"at the time of day in the zone, as UTC", "20240108T174500Z", "20240108T181500Z", false},
+		{"before the event", "20240108T070000Z", "20240108T080000Z", false},
+		{"after the event", "20240108T100000Z", "20240108T110000Z", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/></D:prop>
+<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+<C:time-range start="` + test.start + `" end="` + test.end + `"/>
+</C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+			w := serveCalDAV(rt, "REPORT", "/caldav/team/", "1", body)
+			if w.Code != http.StatusMultiStatus {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusMultiStatus)
+			}
+			if got := strings.Contains(w.Body.String(), "<response>"); got != test.want {
+				t.Errorf("event matched = %v, want %v:\n%s", got, test.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCalDAVEventTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		line     string
+		floating string
+		want     time.Time
+		ok       bool
+	}{
+		{"utc", "DTSTART:20240108T090000Z", "", time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC), true},
+		{"tzid", "DTSTART;TZID=Europe/Berlin:20240108T100000", "", time.Date(2024, 1, 8, 10, 0, 0, 0, berlin), true},
+		{"floating", "DTSTART:20240108T100000", "", time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC), true},
+		{"floating in calendar zone", "DTSTART:20240108T100000", "Europe/Berlin", time.Date(2024, 1, 8, 10, 0, 0, 0, berlin), true},
+		{"date", "DTSTART;VALUE=DATE:20240108", "Europe/Berlin", time.Date(2024, 1, 8, 0, 0, 0, 0, berlin), true},
+		{"unknown tzid", "DTSTART;TZID=Nowhere/Else:20240108T100000", "", time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC), true},
+		{"invalid", "DTSTART:tomorrow", "", time.Time{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var header string
+			if test.floating != "" {
+				header = "X-WR-TIMEZONE:" + test.floating + "\r\n"
+			}
+			calendar, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + header +
+				"BEGIN:VEVENT\r\nUID:1\r\n" + test.line + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := calendar.Events()[0]
+			got, ok := caldavEventTime(&event.ComponentBase, "DTSTART", newCaldavZones(calendar))
+			if ok != test.ok || !got.Equal(test.want) {
+				t.Errorf("caldavEventTime() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestReadDAVRequest(t *testing.T) {
+	getetag := xml.Name{Space: nsDAV, Local: "getetag"}
+	calendarData := xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantName  xml.Name
+		allProp   bool
+		props     []xml.Name
+		hrefs     []string
+		component string
+		timeRange [2]string
+		wantErr   bool
+	}{
+		{
+			name:    "empty body",
+			body:    "  \n",
+			allProp: true,
+		},
+		{
+			name:     "allprop",
+			body:     `<propfind xmlns="DAV:"><allprop/></propfind>`,
+			wantName: xml.Name{Space: nsDAV, Local: "propfind"},
+			allProp:  true,
+		},
+		{
+			name:     "prop",
+			body:     `<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/><C:calendar-data/></D:prop></D:propfind>`,
+			wantName: xml.Name{Space: nsDAV, Local: "propfind"},
+			props:    []xml.Name{getetag, calendarData},
+		},
+		{
+			name: "calendar-query",
+			body: `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/></D:prop>
+<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO">
+<C:time-range start="20240101T000000Z" end="20240201T000000Z"/>
+</C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`,
+			wantName:  xml.Name{Space: nsCalDAV, Local: "calendar-query"},
+			props:     []xml.Name{getetag},
+			component: "VTODO",
+			timeRange: [2]string{"20240101T000000Z", "20240201T000000Z"},
+		},
+		{
+			name: "calendar-multiget",
+			body: `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><C:calendar-data/></D:prop>
+<D:href>/caldav/team/a.ics</D:href>
+<D:href>/caldav/team/b.ics</D:href>
+</C:calendar-multiget>`,
+			wantName: xml.Name{Space: nsCalDAV, Local: "calendar-multiget"},
+			props:    []xml.Name{calendarData},
+			hrefs:    []string{"/caldav/team/a.ics", "/caldav/team/b.ics"},
+		},
+		{
+			name:    "invalid XML",
+			body:    `<propfind xmlns="DAV:"><prop>`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PROPFIND", "/caldav/team/", strings.NewReader(test.body))
+			req, err := readDAVRequest(r)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("readDAVRequest() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readDAVRequest() = %v", err)
+			}
+			if req.XMLName != test.wantName {
+				t.Errorf("name = %v, want %v", req.XMLName, test.wantName)
+			}
+			if (req.AllProp != nil) != test.allProp {
+				t.Errorf("allprop = %v, want %v", req.AllProp != nil, test.allProp)
+			}
+			if got := req.names(); fmt.Sprint(got) != fmt.Sprint(test.props) {
+				t.Errorf("props = %v, want %v", got, test.props)
+			}
+			if fmt.Sprint(req.Hrefs) != fmt.Sprint(test.hrefs) {
+				t.Errorf("hrefs = %v, want %v", req.Hrefs, test.hrefs)
+			}
+			filter := req.Filter.CompFilter.CompFilter
+			if filter.Name != test.component {
+				t.Errorf("component = %q, want %q", filter.Name, test.component)
+			}
+			var timeRange [2]string
+			if filter.TimeRange != nil {
+				timeRange = [2]string{filter.TimeRange.Start, filter.TimeRange.End}
+			}
+			if timeRange != test.timeRange {
+				t.Errorf("time range = %v, want %v", timeRange, test.timeRange)
+			}
+		})
+	}
+}
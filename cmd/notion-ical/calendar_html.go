@@ -0,0 +1,310 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arran4/golang-ical"
+)
+
+// htmlEvent is an event or task shown in the HTML calendar.
+type htmlEvent struct {
+	Title  string
+	URL    string
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+}
+
+// lastDay is the date of the last day the event covers.
+func (e htmlEvent) lastDay() time.Time {
+	if e.AllDay {
+		return e.End.AddDate(0, 0, -1)
+	}
+	if e.End.After(e.Start) {
+		return e.End.Add(-time.Nanosecond)
+	}
+	return e.Start
+}
+
+// htmlDay is a day in the month grid of the HTML calendar.
+type htmlDay struct {
+	Date    time.Time
+	InMonth bool
+	Today   bool
+	Events  []htmlEvent
+}
+
+// htmlCalendar is a month of events, shown as a grid of weeks and an agenda.
+type htmlCalendar struct {
+	Name   string
+	Zone   string
+	Month  time.Time
+	Prev   string
+	Next   string
+	Weeks  [][]htmlDay
+	Agenda []htmlEvent
+}
+
+// htmlEvents reads the events and tasks of a converted calendar, in the
+// timezone of the calendar when it has one.
+func htmlEvents(calendar *ics.Calendar, zone *time.Location) []htmlEvent {
+	var events []htmlEvent
+	for _, component := range calendar.Components {
+		var base *ics.ComponentBase
+		switch c := component.(type) {
+		case *ics.VEvent:
+			base = &c.ComponentBase
+		case *ics.VTodo:
+			base = &c.ComponentBase
+		default:
+			continue
+		}
+
+		start, allDay, ok := htmlEventTime(base, ics.ComponentPropertyDtStart, zone)
+		end, _, hasEnd := htmlEventTime(base, ics.ComponentPropertyDtEnd, zone)
+		if !hasEnd {
+			end, _, hasEnd = htmlEventTime(base, ics.ComponentProperty(ics.PropertyDue), zone)
+		}
+		if !ok {
+			if !hasEnd {
+				continue
+			}
+			start = end
+		}
+		if !hasEnd {
+			end = start
+			if allDay {
+				end = start.AddDate(0, 0, 1)
+			}
+		}
+
+		event := htmlEvent{Start: start, End: end, AllDay: allDay}
+		if p := base.GetProperty(ics.ComponentPropertySummary); p != nil {
+			event.Title = icsText(p.Value)
+		}
+		if p := base.GetProperty(ics.ComponentPropertyUrl); p != nil {
+			event.URL = p.Value
+		}
+		events = append(events, event)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	return events
+}
+
+// htmlEventTime parses DATE and DATE-TIME values of an event or task
+// property into zone, and reports whether the value is a date.
+func htmlEventTime(component *ics.ComponentBase, property ics.ComponentProperty, zone *time.Location) (time.Time, bool, bool) {
+	p := component.GetProperty(property)
+	if p == nil {
+		return time.Time{}, false, false
+	}
+	if t, err := time.ParseInLocation("20060102", p.Value, zone); err == nil {
+		return t, true, true
+	}
+	if t, err := time.Parse("20060102T150405Z", p.Value); err == nil {
+		return t.In(zone), false, true
+	}
+	// Floating and zoned times are in the timezone of the calendar
+	if t, err := time.ParseInLocation("20060102T150405", p.Value, zone); err == nil {
+		return t, false, true
+	}
+	return time.Time{}, false, false
+}
+
+// icsText unescapes a TEXT value.
+func icsText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// calendarZone is the timezone of a converted calendar, or UTC when it has
+// none.
+func calendarZone(calendar *ics.Calendar) *time.Location {
+	for _, p := range calendar.CalendarProperties {
+		if p.IANAToken != string(ics.PropertyXWRTimezone) {
+			continue
+		}
+		if zone, err := time.LoadLocation(p.Value); err == nil {
+			return zone
+		}
+	}
+	return time.UTC
+}
+
+// newHTMLCalendar lays out the events of a month, in weeks from Monday.
+func newHTMLCalendar(name string, calendar *ics.Calendar, month, now time.Time) htmlCalendar {
+	zone := calendarZone(calendar)
+	now = now.In(zone)
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, zone)
+	nextMonth := month.AddDate(0, 1, 0)
+
+	c := htmlCalendar{
+		Name:  name,
+		Zone:  zone.String(),
+		Month: month,
+		Prev:  month.AddDate(0, -1, 0).Format("2006-01"),
+		Next:  nextMonth.Format("2006-01"),
+	}
+
+	events := htmlEvents(calendar, zone)
+	for _, event := range events {
+		if event.Start.Before(nextMonth) && !event.lastDay().Before(month) {
+			c.Agenda = append(c.Agenda, event)
+		}
+	}
+
+	day := month.AddDate(0, 0, -((int(month.Weekday()) + 6) % 7))
+	for day.Before(nextMonth) {
+		week := make([]htmlDay, 7)
+		for i := range week {
+			week[i] = htmlDay{
+				Date:    day,
+				InMonth: day.Month() == month.Month(),
+				Today:   sameDay(day, now),
+			}
+			for _, event := range c.Agenda {
+				if !day.Before(startOfDay(event.Start)) && !day.After(event.lastDay()) {
+					week[i].Events = append(week[i].Events, event)
+				}
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		c.Weeks = append(c.Weeks, week)
+	}
+	return c
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// writeHTMLCalendar writes a month of the feed as an HTML page.
+func writeHTMLCalendar(w io.Writer, name string, f *feed, month, now time.Time) error {
+	return calendarHTMLTemplate.Execute(w, newHTMLCalendar(name, f.calendar, month, now))
+}
+
+// handleHTML serves a month of the feed as an HTML page, the current month
+// unless the month query parameter is set, such as "2024-05".
+func (s *server) handleHTML(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	setAccessFeed(r, s.name)
+
+	now := time.Now()
+	month := now
+	if q := r.URL.Query().Get("month"); q != "" {
+		t, err := time.Parse("2006-01", q)
+		if err != nil {
+			http.Error(w, "invalid month: expected a month such as \"2024-05\"", http.StatusBadRequest)
+			return
+		}
+		month = t
+	}
+
+	f, err := s.get(r.Context())
+	if err != nil {
+		log.Printf("failed to refresh feed %s: %v", s.name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := writeHTMLCalendar(w, s.source.Name(), f, month, now); err != nil {
+		log.Printf("failed to write calendar page %s: %v", s.name, err)
+	}
+}
+
+// acceptsHTML reports whether the request is from a browser, rather than a
+// calendar client.
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+var calendarHTMLTemplate = template.Must(template.New("calendar").Funcs(template.FuncMap{
+	"when": func(e htmlEvent) string {
+		if e.AllDay {
+			start := e.Start.Format("Mon 2 Jan")
+			if last := e.lastDay(); !sameDay(last, e.Start) {
+				return start + " – " + last.Format("Mon 2 Jan")
+			}
+			return start
+		}
+		start := e.Start.Format("Mon 2 Jan 15:04")
+		switch {
+		case !e.End.After(e.Start):
+			return start
+		case sameDay(e.Start, e.End):
+			return start + " – " + e.End.Format("15:04")
+		}
+		return start + " – " + e.End.Format("Mon 2 Jan 15:04")
+	},
+	"time": func(e htmlEvent) string {
+		if e.AllDay {
+			return ""
+		}
+		return e.Start.Format("15:04") + " "
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} – {{.Month.Format "January 2006"}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; width: 100%; table-layout: fixed; }
+th, td { border: 1px solid #ddd; vertical-align: top; padding: 0.25em; }
+td { height: 6em; font-size: small; }
+td.other { color: #aaa; background: #fafafa; }
+td.today { background: #fff8e0; }
+.date { font-weight: bold; }
+.event { overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.when { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<nav><a href="?month={{.Prev}}">&larr; Previous</a><strong>{{.Month.Format "January 2006"}}</strong> <a href="?month={{.Next}}">Next &rarr;</a></nav>
+<table>
+<tr><th>Mon</th><th>Tue</th><th>Wed</th><th>Thu</th><th>Fri</th><th>Sat</th><th>Sun</th></tr>
+{{range .Weeks}}
+<tr>
+{{range .}}
+<td class="{{if not .InMonth}}other{{end}}{{if .Today}} today{{end}}">
+<div class="date">{{.Date.Day}}</div>
+{{range .Events}}<div class="event" title="{{.Title}}">{{time .}}{{.Title}}</div>{{end}}
+</td>
+{{end}}
+</tr>
+{{end}}
+</table>
+<h2>Agenda</h2>
+{{if .Agenda}}
+<ul>
+{{range .Agenda}}
+<li>{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}<br><span class="when">{{when .}}</span></li>
+{{end}}
+</ul>
+{{else}}
+<p>No events this month.</p>
+{{end}}
+<p class="when">Times are in {{.Zone}}.</p>
+</body>
+</html>
+`))
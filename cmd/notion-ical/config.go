@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/serverwentdown/notion-ical"
+	"github.com/urfave/cli/v2"
+)
+
+// serveConfig is the multi-feed configuration file for serve.
+type serveConfig struct {
+	Integrations []integrationConfig `json:"integrations,omitempty"`
+	Feeds        []feedConfig        `json:"feeds"`
+}
+
+// integrationConfig is a Notion integration, such as of another workspace,
+// whose API key is used by the feeds that name it.
+type integrationConfig struct {
+	Name       string `json:"name"`
+	APIKey     string `json:"api_key,omitempty"`
+	APIKeyFile string `json:"api_key_file,omitempty"`
+	// Databases are served at /db/{database-id}.ics with the API key, like
+	// --allow-database
+	Databases []string `json:"databases,omitempty"`
+}
+
+// databaseKeys maps the databases of integrations to their API keys.
+func (c serveConfig) databaseKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, integration := range c.Integrations {
+		for _, id := range integration.Databases {
+			keys[normalizeDatabaseID(id)] = integration.APIKey
+		}
+	}
+	return keys
+}
+
+// feedConfig configures the source of one feed. The fields mirror the
+// global flags.
+type feedConfig struct {
+	// Name is used in the feed path, /{name}.ics
+	Name string `json:"name"`
+
+	Export             string   `json:"export,omitempty"`
+	ExportTimezone     string   `json:"export_timezone,omitempty"`
+	ExportLocale       string   `json:"export_locale,omitempty"`
+	ExportDateFormats  []string `json:"export_date_formats,omitempty"`
+	ExportTimeFormats  []string `json:"export_time_formats,omitempty"`
+	ExportAllDatabases bool     `json:"export_all_databases,omitempty"`
+
+	APIKey     string `json:"api_key,omitempty"`
+	APIKeyFile string `json:"api_key_file,omitempty"`
+	// Integration names the integration whose API key is used
+	Integration string `json:"integration,omitempty"`
+	DatabaseID  string `json:"database_id,omitempty"`
+
+	DateProperty       string `json:"date_property,omitempty"`
+	TitleProperty      string `json:"title_property,omitempty"`
+	HideProperty       string `json:"hide_property,omitempty"`
+	RecurrenceProperty string `json:"recurrence_property,omitempty"`
+	ExceptionsProperty string `json:"exceptions_property,omitempty"`
+	StatusProperty     string `json:"status_property,omitempty"`
+	LocationProperty   string `json:"location_property,omitempty"`
+	AttendeesProperty  string `json:"attendees_property,omitempty"`
+	CategoriesProperty string `json:"categories_property,omitempty"`
+	IDProperty         string `json:"id_property,omitempty"`
+	IDInTitle          bool   `json:"id_in_title,omitempty"`
+	// Filter is a filter of the Notion API, such as the filter of a view
+	Filter json.RawMessage `json:"filter,omitempty"`
+	Sorts  []string        `json:"sorts,omitempty"`
+
+	// Page content and requests to the API
+	PageSize       int      `json:"page_size,omitempty"`
+	MaxBlockDepth  int      `json:"max_block_depth,omitempty"`
+	SkipBlocks     []string `json:"skip_blocks,omitempty"`
+	ChildDatabases string   `json:"child_databases,omitempty"`
+	// DebugHTTP logs requests to the Notion API, with their bodies when
+	// DebugHTTPBodies is set
+	DebugHTTP       bool `json:"debug_http,omitempty"`
+	DebugHTTPBodies bool `json:"debug_http_bodies,omitempty"`
+	// Record stores the responses of the Notion API in a directory, and
+	// Replay responds with them instead of sending requests, so that no API
+	// key is needed
+	Record string `json:"record,omitempty"`
+	Replay string `json:"replay,omitempty"`
+	// RequestTimeout and ReadTimeout are durations such as "30s" limiting
+	// each request to the Notion API, and whole reads of the database
+	RequestTimeout string `json:"request_timeout,omitempty"`
+	ReadTimeout    string `json:"read_timeout,omitempty"`
+	// ContentCacheDir persists the content of pages across runs
+	ContentCacheDir string `json:"content_cache_dir,omitempty"`
+	// CheckpointDir persists the progress of reads, to resume failed reads
+	CheckpointDir string `json:"checkpoint_dir,omitempty"`
+
+	DropTitles    []string `json:"drop_titles,omitempty"`
+	ReplaceTitles []string `json:"replace_titles,omitempty"`
+	// Alarms are durations such as "15m" before events that they remind of
+	Alarms []string `json:"alarms,omitempty"`
+
+	DTStamp        string `json:"dtstamp,omitempty"`
+	Limit          int    `json:"limit,omitempty"`
+	OutputTimezone string `json:"output_timezone,omitempty"`
+	Todos          bool   `json:"todos,omitempty"`
+	Compat         string `json:"compat,omitempty"`
+	// NoMethod leaves out METHOD:PUBLISH, for tools that only expect
+	// METHOD in invitations
+	NoMethod bool `json:"no_method,omitempty"`
+	// HTMLDescription adds descriptions as HTML for clients like Outlook
+	HTMLDescription bool `json:"html_description,omitempty"`
+	// Validate checks converted calendars against RFC 5545
+	Validate bool `json:"validate,omitempty"`
+	// WarningsHeader counts the warnings of feeds in an X-Warnings header
+	WarningsHeader bool `json:"warnings_header,omitempty"`
+
+	// Cache headers are durations such as "5m", for caches in front of the
+	// server
+	CacheMaxAge               string `json:"cache_max_age,omitempty"`
+	CacheSharedMaxAge         string `json:"cache_shared_max_age,omitempty"`
+	CacheStaleWhileRevalidate string `json:"cache_stale_while_revalidate,omitempty"`
+
+	// Cache is how long the feed is served before requests refresh it, such
+	// as "24h", instead of --cache
+	Cache string `json:"cache,omitempty"`
+	// Refresh refreshes the feed in the background at an interval such as
+	// "15m", or on a cron expression such as "0 6 * * *"
+	Refresh string `json:"refresh,omitempty"`
+}
+
+// readServeConfig reads a multi-feed configuration file. Feeds without an
+// export, API key or integration use the API key from global flags.
+func readServeConfig(path string, defaultAPIKey string) (serveConfig, error) {
+	var config serveConfig
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	integrations := make(map[string]string)
+	databases := make(map[string]string)
+	for i, integration := range config.Integrations {
+		if integration.Name == "" {
+			return config, fmt.Errorf("integration %d in %s has no name", i, path)
+		}
+		if _, ok := integrations[integration.Name]; ok {
+			return config, fmt.Errorf("duplicate integration %q in %s", integration.Name, path)
+		}
+		if integration.APIKey == "" && integration.APIKeyFile != "" {
+			key, err := readSecretFile(integration.APIKeyFile)
+			if err != nil {
+				return config, fmt.Errorf("integration %q: unable to read API key file: %w", integration.Name, err)
+			}
+			config.Integrations[i].APIKey = key
+		}
+		key, err := resolveSecret(context.Background(), config.Integrations[i].APIKey)
+		if err != nil {
+			return config, fmt.Errorf("integration %q: %w", integration.Name, err)
+		}
+		config.Integrations[i].APIKey = key
+		if key == "" {
+			return config, fmt.Errorf("integration %q has no API key", integration.Name)
+		}
+		integrations[integration.Name] = config.Integrations[i].APIKey
+
+		for _, id := range integration.Databases {
+			id = normalizeDatabaseID(id)
+			if other, ok := databases[id]; ok {
+				return config, fmt.Errorf("database %s is in both integrations %q and %q", id, other, integration.Name)
+			}
+			databases[id] = integration.Name
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, feed := range config.Feeds {
+		if feed.Name == "" {
+			return config, fmt.Errorf("feed %d in %s has no name", i, path)
+		}
+		if names[feed.Name] {
+			return config, fmt.Errorf("duplicate feed %q in %s", feed.Name, path)
+		}
+		names[feed.Name] = true
+
+		if _, err := feed.convertOptions(); err != nil {
+			return config, fmt.Errorf("feed %q: %w", feed.Name, err)
+		}
+		if _, _, err := feed.cacheControl(); err != nil {
+			return config, fmt.Errorf("feed %q: %w", feed.Name, err)
+		}
+		if _, err := feed.cacheDuration(0); err != nil {
+			return config, fmt.Errorf("feed %q: %w", feed.Name, err)
+		}
+		if _, err := feed.refreshSchedule(); err != nil {
+			return config, fmt.Errorf("feed %q: %w", feed.Name, err)
+		}
+		if _, _, err := feed.timeouts(); err != nil {
+			return config, fmt.Errorf("feed %q: %w", feed.Name, err)
+		}
+
+		if feed.Integration != "" {
+			key, ok := integrations[feed.Integration]
+			if !ok {
+				return config, fmt.Errorf("feed %q: unknown integration %q", feed.Name, feed.Integration)
+			}
+			if feed.APIKey != "" || feed.APIKeyFile != "" {
+				return config, fmt.Errorf("feed %q: either \"integration\" or \"api_key\" should be set", feed.Name)
+			}
+			config.Feeds[i].APIKey = key
+		} else if feed.APIKey == "" && feed.APIKeyFile != "" {
+			key, err := readSecretFile(feed.APIKeyFile)
+			if err != nil {
+				return config, fmt.Errorf("feed %q: unable to read API key file: %w", feed.Name, err)
+			}
+			config.Feeds[i].APIKey = key
+		} else if feed.Export == "" && feed.APIKey == "" {
+			config.Feeds[i].APIKey = defaultAPIKey
+		}
+		key, err := resolveSecret(context.Background(), config.Feeds[i].APIKey)
+		if err != nil {
+			return config, fmt.Errorf("feed %q: %w", feed.Name, err)
+		}
+		config.Feeds[i].APIKey = key
+	}
+
+	return config, nil
+}
+
+func (c feedConfig) equal(other feedConfig) bool {
+	return reflect.DeepEqual(c, other)
+}
+
+// feedConfigFromFlags reads the source configuration from global flags.
+func feedConfigFromFlags(ctx *cli.Context) feedConfig {
+	return feedConfig{
+		Export:             ctx.Path("export"),
+		ExportTimezone:     ctx.String("export-timezone"),
+		ExportLocale:       ctx.String("export-locale"),
+		ExportDateFormats:  ctx.StringSlice("export-date-format"),
+		ExportTimeFormats:  ctx.StringSlice("export-time-format"),
+		ExportAllDatabases: ctx.Bool("export-all-databases"),
+		APIKey:             ctx.String("api-key"),
+		DatabaseID:         ctx.String("database-id"),
+		DateProperty:       ctx.String("date-property"),
+		TitleProperty:      ctx.String("title-property"),
+		HideProperty:       ctx.String("hide-property"),
+		RecurrenceProperty: ctx.String("recurrence-property"),
+		ExceptionsProperty: ctx.String("exceptions-property"),
+		StatusProperty:     ctx.String("status-property"),
+		LocationProperty:   ctx.String("location-property"),
+		AttendeesProperty:  ctx.String("attendees-property"),
+		CategoriesProperty: ctx.String("categories-property"),
+		IDProperty:         ctx.String("id-property"),
+		IDInTitle:          ctx.Bool("id-in-title"),
+		Filter:             rawJSON(ctx.String("filter")),
+		Sorts:              ctx.StringSlice("sort"),
+		PageSize:           ctx.Int("page-size"),
+		MaxBlockDepth:      ctx.Int("max-block-depth"),
+		SkipBlocks:         ctx.StringSlice("skip-block"),
+		ChildDatabases:     ctx.String("child-databases"),
+		ContentCacheDir:    ctx.Path("content-cache-dir"),
+		CheckpointDir:      ctx.Path("checkpoint-dir"),
+		RequestTimeout:     ctx.String("request-timeout"),
+		ReadTimeout:        ctx.String("read-timeout"),
+		DebugHTTP:          ctx.Bool("debug-http"),
+		DebugHTTPBodies:    ctx.Bool("debug-http-bodies"),
+		Record:             ctx.Path("record"),
+		Replay:             ctx.Path("replay"),
+		DropTitles:         ctx.StringSlice("drop-title"),
+		ReplaceTitles:      ctx.StringSlice("replace-title"),
+		Alarms:             ctx.StringSlice("alarm"),
+		DTStamp:            ctx.String("dtstamp"),
+		Limit:              ctx.Int("limit"),
+		OutputTimezone:     ctx.String("output-timezone"),
+		Todos:              ctx.Bool("todo"),
+		Compat:             ctx.String("compat"),
+		NoMethod:           ctx.Bool("no-method"),
+		HTMLDescription:    ctx.Bool("html-description"),
+		Validate:           ctx.Bool("validate"),
+		WarningsHeader:     ctx.Bool("warnings-header"),
+
+		CacheMaxAge:               ctx.String("cache-max-age"),
+		CacheSharedMaxAge:         ctx.String("cache-shared-max-age"),
+		CacheStaleWhileRevalidate: ctx.String("cache-stale-while-revalidate"),
+	}
+}
+
+// source creates the configured source. When check is false, API sources
+// are opened without checking the date and hide properties.
+func (c feedConfig) source(check bool) (notion_ical.Source, error) {
+	return c.sourceWith(check, nil, nil)
+}
+
+// sourceWith creates the configured source, counting the rows it reads into
+// stats and collecting its warnings when set.
+func (c feedConfig) sourceWith(check bool, stats *notion_ical.ReadStats, warnings *notion_ical.Warnings) (notion_ical.Source, error) {
+	if c.Export != "" && c.usesAPI() {
+		return nil, configError(fmt.Errorf("Either \"export\" or \"api-key\" should be set"))
+	}
+	if c.Export != "" {
+		archive, filename, err := openArchive(c.Export)
+		if err != nil {
+			return nil, configError(fmt.Errorf("error opening archive: %w", err))
+		}
+
+		timezone := c.ExportTimezone
+		if timezone == "" {
+			timezone = "Local"
+		}
+		zone, err := loadLocation(timezone)
+		if err != nil {
+			return nil, configError(fmt.Errorf("error loading timezone: %w", err))
+		}
+
+		return notion_ical.NewSourceExport(notion_ical.ConfigSourceExport{
+			Archive:            archive,
+			Filename:           filename,
+			Zone:               zone,
+			Locale:             c.ExportLocale,
+			DateFormats:        c.ExportDateFormats,
+			TimeFormats:        c.ExportTimeFormats,
+			AllDatabases:       c.ExportAllDatabases,
+			DateProperty:       c.DateProperty,
+			HideProperty:       c.HideProperty,
+			TitleProperty:      c.TitleProperty,
+			RecurrenceProperty: c.RecurrenceProperty,
+			ExceptionsProperty: c.ExceptionsProperty,
+			StatusProperty:     c.StatusProperty,
+			LocationProperty:   c.LocationProperty,
+			AttendeesProperty:  c.AttendeesProperty,
+			CategoriesProperty: c.CategoriesProperty,
+			IDProperty:         c.IDProperty,
+			IDInTitle:          c.IDInTitle,
+			Stats:              stats,
+			Warnings:           warnings,
+		})
+	} else if c.usesAPI() {
+		if c.DatabaseID == "" {
+			return nil, configError(fmt.Errorf("Required flag \"database-id\" not set"))
+		}
+		requestTimeout, readTimeout, err := c.timeouts()
+		if err != nil {
+			return nil, configError(err)
+		}
+		httpClient, err := c.httpClient()
+		if err != nil {
+			return nil, configError(err)
+		}
+		config := notion_ical.ConfigSourceAPI{
+			APIKey:             c.APIKey,
+			DatabaseID:         c.DatabaseID,
+			DateProperty:       c.DateProperty,
+			HideProperty:       c.HideProperty,
+			RecurrenceProperty: c.RecurrenceProperty,
+			ExceptionsProperty: c.ExceptionsProperty,
+			StatusProperty:     c.StatusProperty,
+			LocationProperty:   c.LocationProperty,
+			AttendeesProperty:  c.AttendeesProperty,
+			CategoriesProperty: c.CategoriesProperty,
+			IDProperty:         c.IDProperty,
+			IDInTitle:          c.IDInTitle,
+			Sorts:              databaseSorts(c.Sorts),
+			PageSize:           c.PageSize,
+			MaxBlockDepth:      c.MaxBlockDepth,
+			SkipBlockTypes:     blockTypes(c.SkipBlocks),
+			ChildDatabases:     notion_ical.ChildDatabases(c.ChildDatabases),
+			RequestTimeout:     requestTimeout,
+			ReadTimeout:        readTimeout,
+			ContentCache:       notion_ical.NewMemoryContentCache(),
+			HTTPClient:         httpClient,
+			Stats:              stats,
+			Warnings:           warnings,
+		}
+		if len(c.Filter) > 0 {
+			config.Filter = &notion.DatabaseQueryFilter{}
+			if err := json.Unmarshal(c.Filter, config.Filter); err != nil {
+				return nil, configError(fmt.Errorf("error parsing filter: %w", err))
+			}
+		}
+		if c.ContentCacheDir != "" {
+			cache, err := notion_ical.NewDirContentCache(c.ContentCacheDir)
+			if err != nil {
+				return nil, configError(err)
+			}
+			config.ContentCache = cache
+		}
+		if c.CheckpointDir != "" {
+			checkpoint, err := notion_ical.NewDirReadCheckpoint(c.CheckpointDir)
+			if err != nil {
+				return nil, configError(err)
+			}
+			config.Checkpoint = checkpoint
+		}
+		if !check {
+			return notion_ical.OpenSourceAPI(config)
+		}
+		return notion_ical.NewSourceAPI(config)
+	} else {
+		return nil, configError(fmt.Errorf("One of \"export\" or \"api-key\" should be set"))
+	}
+}
+
+// usesAPI reports whether the source is read with the Notion API, with an
+// API key or from a recording.
+func (c feedConfig) usesAPI() bool {
+	return c.APIKey != "" || c.Replay != ""
+}
+
+// httpClient returns the client of requests to the Notion API, recording,
+// replaying or logging them when configured, or nil for the default client.
+func (c feedConfig) httpClient() (*http.Client, error) {
+	var transport http.RoundTripper
+	switch {
+	case c.Record != "" && c.Replay != "":
+		return nil, fmt.Errorf("Either \"record\" or \"replay\" should be set")
+	case c.Replay != "":
+		transport = notion_ical.NewReplayTransport(c.Replay)
+	case c.Record != "":
+		var err error
+		transport, err = notion_ical.NewRecordTransport(c.Record, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.DebugHTTP || c.DebugHTTPBodies {
+		transport = &notion_ical.DebugTransport{Transport: transport, Bodies: c.DebugHTTPBodies}
+	}
+	if transport == nil {
+		return nil, nil
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// blockTypes converts the names of block types, such as "image".
+func blockTypes(names []string) []notion.BlockType {
+	types := make([]notion.BlockType, len(names))
+	for i, name := range names {
+		types[i] = notion.BlockType(name)
+	}
+	return types
+}
+
+// rawJSON is the JSON in s, or nil when s is empty.
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// databaseSorts converts sorts such as "Date" or "Priority:descending" into
+// sorts by properties, ascending unless stated.
+func databaseSorts(sorts []string) []notion.DatabaseQuerySort {
+	var s []notion.DatabaseQuerySort
+	for _, sort := range sorts {
+		property, direction := sort, notion.SortDirAsc
+		if i := strings.LastIndex(sort, ":"); i >= 0 {
+			switch strings.ToLower(sort[i+1:]) {
+			case "ascending", "asc":
+				property = sort[:i]
+			case "descending", "desc":
+				property, direction = sort[:i], notion.SortDirDesc
+			}
+		}
+		s = append(s, notion.DatabaseQuerySort{Property: property, Direction: direction})
+	}
+	return s
+}
+
+// readSecretFile reads a secret from a file, ignoring surrounding whitespace
+// such as a trailing newline.
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
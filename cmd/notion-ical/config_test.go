@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestDatabaseSorts(t *testing.T) {
+	tests := []struct {
+		sorts []string
+		want  []notion.DatabaseQuerySort
+	}{
+		{nil, nil},
+		{[]string{"Date"}, []notion.DatabaseQuerySort{{Property: "Date", Direction: notion.SortDirAsc}}},
+		{[]string{"Date:ascending"}, []notion.DatabaseQuerySort{{Property: "Date", Direction: notion.SortDirAsc}}},
+		{[]string{"Date:asc"}, []notion.DatabaseQuerySort{{Property: "Date", Direction: notion.SortDirAsc}}},
+		{[]string{"Priority:Descending"}, []notion.DatabaseQuerySort{{Property: "Priority", Direction: notion.SortDirDesc}}},
+		{[]string{"Priority:desc"}, []notion.DatabaseQuerySort{{Property: "Priority", Direction: notion.SortDirDesc}}},
+		{[]string{"Time: Start"}, []notion.DatabaseQuerySort{{Property: "Time: Start", Direction: notion.SortDirAsc}}},
+		{[]string{"Time: Start:desc"}, []notion.DatabaseQuerySort{{Property: "Time: Start", Direction: notion.SortDirDesc}}},
+		{
+			[]string{"Priority:desc", "Date"},
+			[]notion.DatabaseQuerySort{
+				{Property: "Priority", Direction: notion.SortDirDesc},
+				{Property: "Date", Direction: notion.SortDirAsc},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.sorts), func(t *testing.T) {
+			if got := databaseSorts(test.sorts); fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("databaseSorts(%q) = %v, want %v", test.sorts, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFeedConfigInvalidFilter(t *testing.T) {
+	for _, filter := range []string{`{"property":`, `[]`, `"Status"`} {
+		c := feedConfig{APIKey: "secret_test", DatabaseID: "0f1e2d3c4b5a69788796a5b4c3d2e1f0", Filter: rawJSON(filter)}
+		_, err := c.source(false)
+		var exit exitError
+		if !errors.As(err, &exit) || exit.code != ExitConfig {
+			t.Errorf("source() with filter %s = %v, want a config error", filter, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+)
+
+// allowAnyOrigin in the allowed origins allows browsers on any site to fetch
+// feeds.
+const allowAnyOrigin = "*"
+
+// corsHandler allows browsers on the allowed origins to fetch feeds, such as
+// calendar widgets fetching feeds directly.
+func corsHandler(next http.Handler, origins []string) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || (!allowed[origin] && !allowed[allowAnyOrigin]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed[allowAnyOrigin] {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Warning")
+
+		// Preflight requests, as opposed to CalDAV OPTIONS requests
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, If-None-Match, If-Modified-Since")
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
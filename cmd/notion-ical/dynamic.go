@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// dynamicRoot is the path prefix of feeds for databases looked up on demand.
+const dynamicRoot = "/db/"
+
+// allowAnyDatabase in the allowlist allows every database that the
+// integration can access.
+const allowAnyDatabase = "*"
+
+// dynamicFailureTTL is how long a failed lookup of a database is remembered,
+// so that requests for a database that cannot be read do not each query
+// Notion.
+const dynamicFailureTTL = 30 * time.Second
+
+// dynamicFeeds serves allowed databases at /db/{database-id}.ics, creating
+// a server for each database on first request.
+type dynamicFeeds struct {
+	// template configures every feed, except for the database ID
+	template feedConfig
+	allowed  map[string]bool
+	// source opens the source of a database
+	source func(config feedConfig, warnings *notion_ical.Warnings) (notion_ical.Source, error)
+	// newServer creates the server of a database
+	newServer func(name string, config feedConfig, source notion_ical.Source, options []notion_ical.ConvertOption) *server
+
+	mu sync.Mutex
+	// keys are the API keys of databases of integrations, which are allowed
+	// in addition to the allowlist
+	keys    map[string]string
+	servers map[string]*server
+	// lookups are the databases being opened, which other requests for the
+	// same database wait for
+	lookups map[string]*dynamicLookup
+	// failures are the databases that failed to open recently
+	failures map[string]dynamicFailure
+}
+
+// dynamicLookup is a database being opened.
+type dynamicLookup struct {
+	// done is closed when the lookup completes
+	done   chan struct{}
+	server *server
+	err    error
+}
+
+// dynamicFailure is a failed lookup of a database, and when it failed.
+type dynamicFailure struct {
+	err    error
+	failed time.Time
+}
+
+func newDynamicFeeds(rt *router, template feedConfig, allowed []string) *dynamicFeeds {
+	d := &dynamicFeeds{
+		template: template,
+		allowed:  make(map[string]bool),
+		source: func(config feedConfig, warnings *notion_ical.Warnings) (notion_ical.Source, error) {
+			return config.sourceWith(true, nil, warnings)
+		},
+		newServer: rt.newServer,
+		servers:   make(map[string]*server),
+		lookups:   make(map[string]*dynamicLookup),
+		failures:  make(map[string]dynamicFailure),
+	}
+	for _, id := range allowed {
+		d.allowed[normalizeDatabaseID(id)] = true
+	}
+	return d
+}
+
+// normalizeDatabaseID removes dashes and lowercases a database ID, so that
+// the forms in Notion URLs and the API compare equal.
+func normalizeDatabaseID(id string) string {
+	if id == allowAnyDatabase {
+		return id
+	}
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+// server returns the server of a database, or nil when the database is not
+// allowed. A database is opened once by concurrent requests, without
+// blocking requests for other databases, and failures are remembered for
+// dynamicFailureTTL.
+func (d *dynamicFeeds) server(id string) (*server, error) {
+	id = normalizeDatabaseID(id)
+	if id == "" {
+		return nil, nil
+	}
+
+	d.mu.Lock()
+	key, hasKey := d.keys[id]
+	if !hasKey && !d.allowed[id] && !d.allowed[allowAnyDatabase] {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	if s, ok := d.servers[id]; ok {
+		d.mu.Unlock()
+		return s, nil
+	}
+	if failure, ok := d.failures[id]; ok && time.Since(failure.failed) < dynamicFailureTTL {
+		d.mu.Unlock()
+		return nil, failure.err
+	}
+	if lookup, ok := d.lookups[id]; ok {
+		d.mu.Unlock()
+		<-lookup.done
+		return lookup.server, lookup.err
+	}
+	lookup := &dynamicLookup{done: make(chan struct{})}
+	d.lookups[id] = lookup
+	d.mu.Unlock()
+
+	lookup.server, lookup.err = d.open(id, key, hasKey)
+
+	d.mu.Lock()
+	delete(d.lookups, id)
+	// Results of a key replaced while opening are not kept
+	if d.keys[id] == key {
+		if lookup.err != nil {
+			d.failures[id] = dynamicFailure{err: lookup.err, failed: time.Now()}
+		} else {
+			delete(d.failures, id)
+			d.servers[id] = lookup.server
+			log.Printf("Added database feed %s", id)
+		}
+	}
+	d.mu.Unlock()
+	close(lookup.done)
+	return lookup.server, lookup.err
+}
+
+// open creates the server of a database, with the API key of its
+// integration when hasKey is set.
+func (d *dynamicFeeds) open(id, key string, hasKey bool) (*server, error) {
+	config := d.template
+	config.Name = id
+	config.DatabaseID = id
+	if hasKey {
+		config.APIKey = key
+	}
+
+	warnings := &notion_ical.Warnings{}
+	source, err := d.source(config, warnings)
+	if err != nil {
+		return nil, fmt.Errorf("database %s: %w", id, err)
+	}
+	options, err := config.convertOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	s := d.newServer(id, config, source, options)
+	s.warnings = warnings
+	return s, nil
+}
+
+// setKeys replaces the API keys of databases of integrations, removing the
+// servers and failures of databases whose key changed.
+func (d *dynamicFeeds) setKeys(keys map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id := range d.servers {
+		if d.keys[id] != keys[id] {
+			delete(d.servers, id)
+		}
+	}
+	for id := range d.failures {
+		if d.keys[id] != keys[id] {
+			delete(d.failures, id)
+		}
+	}
+	d.keys = keys
+}
+
+// list returns the servers of databases that have been requested.
+func (d *dynamicFeeds) list() []*server {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	servers := make([]*server, 0, len(d.servers))
+	for _, s := range d.servers {
+		servers = append(servers, s)
+	}
+	return servers
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+const testDynamicID = "0f1e2d3c4b5a69788796a5b4c3d2e1f0"
+
+// newTestDynamicFeeds allows every database, opening them by ID with open.
+func newTestDynamicFeeds(open func(id string) (notion_ical.Source, error)) *dynamicFeeds {
+	d := newDynamicFeeds(newRouter(time.Hour, false), feedConfig{}, []string{allowAnyDatabase})
+	d.source = func(config feedConfig, _ *notion_ical.Warnings) (notion_ical.Source, error) {
+		return open(config.DatabaseID)
+	}
+	return d
+}
+
+func TestDynamicFeedsOpenOnce(t *testing.T) {
+	var mu sync.Mutex
+	opened := 0
+	release := make(chan struct{})
+	d := newTestDynamicFeeds(func(id string) (notion_ical.Source, error) {
+		if id != testDynamicID {
+			return testSource(), nil
+		}
+		mu.Lock()
+		opened += 1
+		mu.Unlock()
+		<-release
+		return testSource(), nil
+	})
+
+	servers := make([]*server, 4)
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			servers[i], _ = d.server(testDynamicID)
+		}(i)
+	}
+
+	// Other databases are not blocked by the lookup
+	other, err := d.server("other")
+	if other == nil || err != nil {
+		t.Errorf("server(other) = %v, %v", other, err)
+	}
+
+	close(release)
+	wg.Wait()
+	if opened != 1 {
+		t.Errorf("opened %d times, want 1", opened)
+	}
+	for _, s := range servers {
+		if s == nil || s != servers[0] {
+			t.Fatalf("servers = %v, want the same server", servers)
+		}
+	}
+}
+
+func TestDynamicFeedsFailure(t *testing.T) {
+	opened := 0
+	notFound := errors.New("database not found")
+	d := newTestDynamicFeeds(func(string) (notion_ical.Source, error) {
+		opened += 1
+		return nil, notFound
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.server(testDynamicID); !errors.Is(err, notFound) {
+			t.Fatalf("server() = %v, want %v", err, notFound)
+		}
+	}
+	if opened != 1 {
+		t.Errorf("opened %d times, want 1", opened)
+	}
+
+	// Failures are forgotten after dynamicFailureTTL
+	d.failures[testDynamicID] = dynamicFailure{err: notFound, failed: time.Now().Add(-dynamicFailureTTL)}
+	d.server(testDynamicID)
+	if opened != 2 {
+		t.Errorf("opened %d times after expiry, want 2", opened)
+	}
+
+	// and when the key of the database changes
+	d.setKeys(map[string]string{testDynamicID: "secret_other"})
+	d.server(testDynamicID)
+	if opened != 3 {
+		t.Errorf("opened %d times after the key changed, want 3", opened)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// envPrefix is prepended to flag names to derive environment variables, so
+// that every flag can be set with NOTION_ICAL_{FLAG_NAME}.
+const envPrefix = "NOTION_ICAL_"
+
+// addEnvVars adds a prefixed environment variable to every flag of the app
+// and its commands.
+func addEnvVars(app *cli.App) {
+	addFlagEnvVars(app.Flags)
+	addCommandEnvVars(app.Commands)
+}
+
+func addCommandEnvVars(commands []*cli.Command) {
+	for _, command := range commands {
+		addFlagEnvVars(command.Flags)
+		addCommandEnvVars(command.Subcommands)
+	}
+}
+
+func addFlagEnvVars(flags []cli.Flag) {
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			f.EnvVars = appendEnvVar(f.EnvVars, f.Name)
+		case *cli.PathFlag:
+			f.EnvVars = appendEnvVar(f.EnvVars, f.Name)
+		case *cli.BoolFlag:
+			f.EnvVars = appendEnvVar(f.EnvVars, f.Name)
+		case *cli.IntFlag:
+			f.EnvVars = appendEnvVar(f.EnvVars, f.Name)
+		case *cli.DurationFlag:
+			f.EnvVars = appendEnvVar(f.EnvVars, f.Name)
+		case *cli.StringSliceFlag:
+			f.EnvVars = appendEnvVar(f.EnvVars, f.Name)
+		}
+	}
+}
+
+func appendEnvVar(envVars []string, name string) []string {
+	envVar := envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	for _, existing := range envVars {
+		if existing == envVar {
+			return envVars
+		}
+	}
+	return append(envVars, envVar)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/serverwentdown/notion-ical"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes, so that automation can tell the causes of failures apart.
+const (
+	ExitFailure     = 1
+	ExitConfig      = 2
+	ExitAuth        = 3
+	ExitRateLimited = 4
+	ExitConversion  = 5
+)
+
+// exitCauses names exit codes in errors written as JSON.
+var exitCauses = map[int]string{
+	ExitFailure:     "failure",
+	ExitConfig:      "config",
+	ExitAuth:        "auth",
+	ExitRateLimited: "rate_limited",
+	ExitConversion:  "conversion",
+}
+
+// Error formats.
+const (
+	ErrorFormatText = "text"
+	ErrorFormatJSON = "json"
+)
+
+// exitError sets the exit code of an error.
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// configError marks an error in flags or configuration files.
+func configError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return exitError{err, ExitConfig}
+}
+
+// conversionError marks an error reading or converting events.
+func conversionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return exitError{err, ExitConversion}
+}
+
+// usageError marks errors in command line flags as configuration errors.
+func usageError(ctx *cli.Context, err error, isSubcommand bool) error {
+	return configError(err)
+}
+
+func addUsageErrors(app *cli.App) {
+	app.OnUsageError = usageError
+	addCommandUsageErrors(app.Commands)
+}
+
+func addCommandUsageErrors(commands []*cli.Command) {
+	for _, command := range commands {
+		command.OnUsageError = usageError
+		addCommandUsageErrors(command.Subcommands)
+	}
+}
+
+// exitCode finds the exit code of an error. Errors of the Notion API take
+// precedence over how the error was marked.
+func exitCode(err error) int {
+	var apiErr *notion.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Status == http.StatusUnauthorized, apiErr.Status == http.StatusForbidden,
+			apiErr.Code == "unauthorized", apiErr.Code == "restricted_resource":
+			return ExitAuth
+		case apiErr.Status == http.StatusTooManyRequests, apiErr.Code == "rate_limited":
+			return ExitRateLimited
+		case apiErr.Status == http.StatusNotFound, apiErr.Status == http.StatusBadRequest:
+			// Unknown or unshared databases, and invalid properties
+			return ExitConfig
+		}
+	}
+
+	switch {
+	case errors.Is(err, notion_ical.ErrUnauthorized):
+		return ExitAuth
+	case errors.Is(err, notion_ical.ErrRateLimited):
+		return ExitRateLimited
+	case errors.Is(err, notion_ical.ErrNoDateProperty),
+		errors.Is(err, notion_ical.ErrNoHideProperty),
+		errors.Is(err, notion_ical.ErrNoTitleProperty),
+		errors.Is(err, notion_ical.ErrPropertyNotFound),
+		errors.Is(err, notion_ical.ErrDatabaseNotFound),
+		errors.Is(err, notion_ical.ErrSchemaMismatch):
+		return ExitConfig
+	}
+
+	var e exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return ExitFailure
+}
+
+// errorHint suggests how to fix the cause of an error, or returns an empty
+// string when there is no suggestion.
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, notion_ical.ErrUnauthorized):
+		return "check the API key, and that the database is shared with the integration from the \"Connections\" menu of the database"
+	case errors.Is(err, notion_ical.ErrRateLimited):
+		return "too many requests were made with the API key: try again later, or refresh feeds less often"
+	case errors.Is(err, notion_ical.ErrDatabaseNotFound):
+		return "check the database ID, which the databases command lists, and that the database is shared with the integration"
+	case errors.Is(err, notion_ical.ErrSchemaMismatch),
+		errors.Is(err, notion_ical.ErrNoDateProperty),
+		errors.Is(err, notion_ical.ErrNoHideProperty),
+		errors.Is(err, notion_ical.ErrNoTitleProperty),
+		errors.Is(err, notion_ical.ErrPropertyNotFound):
+		return "check the names and types of properties, which the list-properties command lists"
+	case errors.Is(err, notion_ical.ErrParseDate):
+		return "check the export timezone and locale, or add formats with --export-date-format and --export-time-format"
+	case errors.Is(err, notion_ical.ErrInvalidRecurrence):
+		return "use a repeat setting such as \"Weekly\", or an RRULE such as \"FREQ=WEEKLY;BYDAY=MO\""
+	case errors.Is(err, notion_ical.ErrCSVRead):
+		return "check that the export is a CSV file, or a ZIP file of one, exported from a Notion database"
+	}
+	return ""
+}
+
+// exitWithError writes the error in format and exits with its exit code.
+func exitWithError(err error, format string) {
+	code := exitCode(err)
+	hint := errorHint(err)
+
+	if format == ErrorFormatJSON {
+		b, _ := json.Marshal(struct {
+			Error    string `json:"error"`
+			Cause    string `json:"cause"`
+			Hint     string `json:"hint,omitempty"`
+			ExitCode int    `json:"exit_code"`
+		}{err.Error(), exitCauses[code], hint, code})
+		fmt.Fprintln(os.Stderr, string(b))
+	} else {
+		log.Print(err)
+		if hint != "" {
+			log.Print("hint: " + hint)
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// Files of a generated site
+const (
+	generateCalendarFile = "calendar.ics"
+	generateEventsFile   = "events.json"
+	generateIndexFile    = "index.html"
+)
+
+// generatedEvent is an event in the events.json of a generated site.
+type generatedEvent struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Emoji       string    `json:"emoji,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	AllDay      bool      `json:"all_day,omitempty"`
+	Recurrence  string    `json:"recurrence,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// generateSite writes a directory that can be published on any static host,
+// with the calendar, its events as JSON and an index.html of upcoming
+// events, from a single read of the source.
+func generateSite(ctx context.Context, source notion_ical.Source, dir string, config feedConfig, now time.Time) error {
+	opts, err := config.convertOptions()
+	if err != nil {
+		return configError(err)
+	}
+	mappers, err := config.eventMappers()
+	if err != nil {
+		return configError(err)
+	}
+
+	events, err := notion_ical.ReadAll(ctx, source)
+	if err != nil {
+		return conversionError(err)
+	}
+
+	var calendar bytes.Buffer
+	opts = append(opts, notion_ical.WithCalendarName(source.Name()))
+	if err := notion_ical.ConvertEvents(events, &calendar, opts...); err != nil {
+		return conversionError(err)
+	}
+	if config.Validate {
+		if err := validateCalendar(source.Name(), calendar.Bytes()); err != nil {
+			return conversionError(err)
+		}
+	}
+
+	// Mappers are applied by ConvertEvents, so they are applied to events
+	// separately for the other files
+	events = notion_ical.MapEvents(events, mappers...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	generated := make([]generatedEvent, 0, len(events))
+	var upcoming []generatedEvent
+	for _, event := range events {
+		g := generatedEvent{
+			ID:          event.ID,
+			Title:       event.Title,
+			Emoji:       event.Emoji,
+			URL:         event.URL,
+			Start:       event.Start,
+			End:         event.End,
+			AllDay:      event.AllDay,
+			Recurrence:  event.Recurrence,
+			Description: event.Description(),
+		}
+		generated = append(generated, g)
+		if !event.End.Before(now) {
+			upcoming = append(upcoming, g)
+		}
+	}
+	eventsJSON, err := json.MarshalIndent(generated, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var index bytes.Buffer
+	err = generateIndexTemplate.Execute(&index, struct {
+		Name      string
+		Calendar  string
+		Events    string
+		Upcoming  []generatedEvent
+		Generated time.Time
+	}{source.Name(), generateCalendarFile, generateEventsFile, upcoming, now})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create output directory: %w", err)
+	}
+	for name, b := range map[string][]byte{
+		generateCalendarFile: calendar.Bytes(),
+		generateEventsFile:   eventsJSON,
+		generateIndexFile:    index.Bytes(),
+	} {
+		if err := writeFileAtomic(filepath.Join(dir, name), b); err != nil {
+			return fmt.Errorf("unable to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var generateIndexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"when": func(g generatedEvent) string {
+		return previewWhen(notion_ical.Event{Start: g.Start, End: g.End, AllDay: g.AllDay})
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<link rel="alternate" type="text/calendar" href="{{.Calendar}}">
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 0 auto; padding: 1em; }
+li { margin-bottom: 0.5em; }
+.when { color: #666; }
+footer { color: #666; font-size: small; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p><a href="{{.Calendar}}">Subscribe to the calendar</a> or <a href="{{.Events}}">download events as JSON</a>.</p>
+<h2>Upcoming events</h2>
+{{if .Upcoming}}
+<ul>
+{{range .Upcoming}}
+<li>{{.Emoji}}{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}<br><span class="when">{{when .}}</span></li>
+{{end}}
+</ul>
+{{else}}
+<p>No upcoming events.</p>
+{{end}}
+<footer>Generated {{.Generated.Format "2006-01-02 15:04 MST"}}</footer>
+</body>
+</html>
+`))
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notionAPIURL is requested to check that the Notion API can be reached.
+var notionAPIURL = "https://api.notion.com/v1/users/me"
+
+// notionCheckInterval is how long the result of a connectivity check is
+// reused, so that frequent probes do not each make a request.
+const notionCheckInterval = 30 * time.Second
+
+// notionCheck checks that the Notion API can be reached.
+type notionCheck struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func newNotionCheck() *notionCheck {
+	return &notionCheck{client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// check requests the Notion API without an API key, which is reachable when
+// it responds at all, such as with 401 Unauthorized.
+func (c *notionCheck) check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) < notionCheckInterval {
+		return c.err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, notionAPIURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Do(req)
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode >= 500 {
+			err = fmt.Errorf("Notion API responded with %s", res.Status)
+		}
+	}
+	c.checked = time.Now()
+	c.err = err
+	return err
+}
+
+// ready reports whether the feed has been refreshed successfully, and
+// starts refreshing it in the background when it has not, so that
+// instances become ready without waiting for a request.
+func (s *server) ready() bool {
+	s.statsMu.Lock()
+	refreshed := !s.stats.LastRefresh.IsZero()
+	s.statsMu.Unlock()
+	if refreshed {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startRefresh(&s.feed, s.options)
+	return false
+}
+
+// usesAPI reports whether any feed reads from the Notion API.
+func (rt *router) usesAPI() bool {
+	if rt.dynamic != nil || rt.proxy != nil {
+		return true
+	}
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	for _, s := range rt.feeds {
+		if s.config.APIKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHealth serves the liveness check, which succeeds while the process
+// serves requests.
+func (rt *router) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReady serves the readiness check, which fails until the Notion API
+// can be reached and every configured feed has been refreshed once.
+// Databases served on demand and by the proxy are not checked.
+func (rt *router) handleReady(w http.ResponseWriter, r *http.Request) {
+	var failures []string
+
+	if rt.usesAPI() {
+		if err := rt.notion.check(r.Context()); err != nil {
+			log.Printf("readiness check failed to reach the Notion API: %v", err)
+			failures = append(failures, "notion: unreachable")
+		}
+	}
+
+	rt.mu.RLock()
+	servers := make([]*server, 0, len(rt.feeds))
+	for _, s := range rt.feeds {
+		servers = append(servers, s)
+	}
+	rt.mu.RUnlock()
+	for _, s := range servers {
+		if !s.ready() {
+			failures = append(failures, "feed "+s.name+": not refreshed yet")
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(failures, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
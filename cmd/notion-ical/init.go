@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/serverwentdown/notion-ical"
+)
+
+// wizard asks questions on a terminal for init.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints a question and reads the answer, or def when the answer is
+// empty.
+func (w wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("unable to read answer: %w", err)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// choose lists choices by number and reads the number of one, or -1 for
+// none when optional.
+func (w wizard) choose(question string, choices []string, optional bool) (int, error) {
+	if optional {
+		fmt.Fprintf(w.out, "  0) none\n")
+	}
+	for i, choice := range choices {
+		fmt.Fprintf(w.out, "  %d) %s\n", i+1, choice)
+	}
+	def := "1"
+	if optional {
+		def = "0"
+	}
+	for {
+		answer, err := w.ask(question, def)
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(choices) {
+			return n - 1, nil
+		}
+		if err == nil && n == 0 && optional {
+			return -1, nil
+		}
+		fmt.Fprintf(w.out, "Enter a number from the list.\n")
+	}
+}
+
+// runInit asks for an API key, a database and its properties, and writes a
+// configuration file for serve to path. The API key is only written to the
+// file when it was typed in, rather than set with flags.
+func runInit(ctx context.Context, w wizard, template feedConfig, path string, force bool) error {
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return configError(fmt.Errorf("%s already exists, use \"--force\" to overwrite it", path))
+		}
+	}
+
+	feed := template
+	feed.Export = ""
+	feed.APIKeyFile = ""
+	apiKey := template.APIKey
+	if apiKey == "" {
+		fmt.Fprintf(w.out, "Create an integration at https://www.notion.so/my-integrations and share your database with it.\n")
+		key, err := w.ask("Notion API key", "")
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return configError(fmt.Errorf("an API key is required"))
+		}
+		apiKey = key
+		feed.APIKey = key
+	} else {
+		feed.APIKey = ""
+	}
+
+	httpClient, err := template.httpClient()
+	if err != nil {
+		return configError(err)
+	}
+	databases, err := notion_ical.ListDatabases(ctx, notion_ical.ConfigSourceAPI{
+		APIKey:     apiKey,
+		PageSize:   template.PageSize,
+		HTTPClient: httpClient,
+	})
+	if err != nil {
+		return err
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases are shared with the integration: share a database with it from the \"Connections\" menu of the database")
+	}
+
+	choices := make([]string, len(databases))
+	for i, database := range databases {
+		choices[i] = fmt.Sprintf("%s (%s)", databaseTitle(database), database.ID)
+	}
+	fmt.Fprintf(w.out, "Databases shared with the integration:\n")
+	i, err := w.choose("Database", choices, false)
+	if err != nil {
+		return err
+	}
+	database := databases[i]
+	feed.DatabaseID = database.ID
+
+	dates := propertiesOfType(database.Properties, notion.DBPropTypeDate)
+	switch len(dates) {
+	case 0:
+		return fmt.Errorf("database %q has no date properties for the dates of events", databaseTitle(database))
+	case 1:
+		feed.DateProperty = dates[0]
+	default:
+		fmt.Fprintf(w.out, "Date properties:\n")
+		i, err := w.choose("Date of events", dates, false)
+		if err != nil {
+			return err
+		}
+		feed.DateProperty = dates[i]
+	}
+
+	// Formulas may evaluate to checkboxes, but their result types are not
+	// known until pages are read
+	checkboxes := propertiesOfType(database.Properties, notion.DBPropTypeCheckbox, notion.DBPropTypeFormula)
+	if len(checkboxes) > 0 {
+		fmt.Fprintf(w.out, "Checkbox and formula properties:\n")
+		i, err := w.choose("Hide events with this checkbox set", checkboxes, true)
+		if err != nil {
+			return err
+		}
+		if i >= 0 {
+			feed.HideProperty = checkboxes[i]
+		}
+	}
+
+	name, err := w.ask("Feed name", feedName(databaseTitle(database)))
+	if err != nil {
+		return err
+	}
+	feed.Name = name
+
+	b, err := json.MarshalIndent(serveConfig{Feeds: []feedConfig{feed}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The file may contain the API key
+	if err := os.WriteFile(path, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("unable to write config file: %w", err)
+	}
+
+	fmt.Fprintf(w.out, "Wrote %s. Serve the feed at /%s.ics with:\n", path, name)
+	if feed.APIKey == "" {
+		fmt.Fprintf(w.out, "  notion-ical --api-key ... serve --config %s\n", path)
+	} else {
+		fmt.Fprintf(w.out, "  notion-ical serve --config %s\n", path)
+	}
+	return nil
+}
+
+// databaseTitle is the title of a database, or "Untitled" when it has none.
+func databaseTitle(database notion_ical.Database) string {
+	if database.Title == "" {
+		return "Untitled"
+	}
+	return database.Title
+}
+
+// propertiesOfType lists the names of properties of the types.
+func propertiesOfType(properties []notion_ical.SourceProperty, types ...notion.DatabasePropertyType) []string {
+	var names []string
+	for _, property := range properties {
+		for _, t := range types {
+			if property.Type == string(t) {
+				names = append(names, property.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// feedName suggests a feed name from a title, such as "team-events" for
+// "Team Events".
+func feedName(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	if b.Len() == 0 {
+		return defaultFeedName
+	}
+	return b.String()
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/serverwentdown/notion-ical"
@@ -15,6 +25,20 @@ const (
 	SourceTypeAPI    = "api"
 )
 
+const (
+	FormatICal     = "ical"
+	FormatCSV      = "csv"
+	FormatFreeBusy = "freebusy"
+	FormatHTML     = "html"
+	FormatJSONFeed = "jsonfeed"
+)
+
+// errorFormat is the format of errors that the command exits with.
+var errorFormat = ErrorFormatText
+
+// shutdownTracing flushes traces before exiting, when tracing is enabled.
+var shutdownTracing func(context.Context) error
+
 func main() {
 	app := &cli.App{
 		Name:                 "notion-ical",
@@ -22,22 +46,83 @@ func main() {
 		EnableBashCompletion: true,
 		Suggest:              true,
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "error-format",
+				Usage: "write errors as \"text\" or as \"json\" objects with the cause and exit code",
+				Value: ErrorFormatText,
+			},
 			&cli.PathFlag{
 				Name:    "export",
 				Aliases: []string{"e"},
-				Usage:   "read events from this export ZIP file",
+				Usage:   "read events from this export ZIP file or extracted CSV file, or \"-\" for stdin",
 			},
 			&cli.StringFlag{
 				Name:    "export-timezone",
 				Aliases: []string{"z"},
-				Usage:   "timezone to interpret dates in the export",
+				Usage:   "timezone to interpret dates in the export, such as \"Europe/Berlin\", \"W. Europe Standard Time\" or \"CET\"",
 				Value:   "Local",
 			},
+			&cli.StringFlag{
+				Name:  "export-locale",
+				Usage: "language of the workspace the export was created in, to parse localized month names",
+				Value: "en",
+			},
+			&cli.StringSliceFlag{
+				Name:  "export-date-format",
+				Usage: "additional Go time layout for dates in the export, such as \"02.01.2006\"",
+			},
+			&cli.StringSliceFlag{
+				Name:  "export-time-format",
+				Usage: "additional Go time layout for times in the export, such as \"15.04\"",
+			},
+			&cli.BoolFlag{
+				Name:  "export-all-databases",
+				Usage: "merge events from nested sub-database CSV files in the export",
+			},
+			&cli.StringFlag{
+				Name:  "dtstamp",
+				Usage: "set DTSTAMP to the event \"start\", \"now\", the \"last-edited\" time of the page, or a fixed RFC 3339 time for reproducible output",
+				Value: DTStampStart,
+			},
+			&cli.StringFlag{
+				Name:  "output-timezone",
+				Usage: "write event times in this timezone, such as \"Europe/Berlin\", with a matching VTIMEZONE instead of in UTC",
+			},
+			&cli.StringFlag{
+				Name:  "compat",
+				Usage: "adjust output for the quirks of a calendar client, either \"google\", \"outlook\" or \"apple\"",
+			},
+			&cli.BoolFlag{
+				Name:  "no-method",
+				Usage: "leave out METHOD:PUBLISH, which marks the calendar as published for subscribers rather than an invitation",
+			},
+			&cli.BoolFlag{
+				Name:  "html-description",
+				Usage: "add descriptions with page content as HTML in X-ALT-DESC, for clients such as Outlook",
+			},
+			&cli.BoolFlag{
+				Name:  "todo",
+				Usage: "convert pages into tasks (VTODO) due on the event date, for task databases",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "emit at most this many of the earliest events, after filtering",
+			},
+			&cli.BoolFlag{
+				Name:    "trace",
+				EnvVars: []string{"NOTION_ICAL_TRACE"},
+				Usage:   "export OpenTelemetry traces over OTLP/HTTP, configured with the OTEL_EXPORTER_OTLP_* environment variables",
+			},
 			&cli.StringFlag{
 				Name:    "api-key",
 				Aliases: []string{"k"},
 				EnvVars: []string{"NOTION_API_KEY"},
-				Usage:   "read events from the API using this API key",
+				Usage:   "read events from the API using this API key, or a secret it refers to in Vault (vault://), AWS Secrets Manager (awssm://) or GCP Secret Manager (gcpsm://)",
+			},
+			&cli.PathFlag{
+				Name:    "api-key-file",
+				EnvVars: []string{"NOTION_API_KEY_FILE"},
+				Usage:   "read the API key from this file, such as a mounted secret",
 			},
 			&cli.StringFlag{
 				Name:    "database-id",
@@ -45,42 +130,523 @@ func main() {
 				EnvVars: []string{"NOTION_DATABASE_ID"},
 				Usage:   "read events from this database ID",
 			},
+			&cli.IntFlag{
+				Name:  "page-size",
+				Usage: "fetch this many pages or blocks in each request to the API, up to 100",
+				Value: 100,
+			},
+			&cli.IntFlag{
+				Name:  "max-block-depth",
+				Usage: "read nested blocks of pages, such as toggles, up to this depth into event descriptions",
+				Value: 5,
+			},
+			&cli.StringSliceFlag{
+				Name:  "skip-block",
+				Usage: "leave blocks of this type, such as \"image\", \"file\", \"embed\" or \"code\", out of event descriptions",
+			},
+			&cli.StringFlag{
+				Name:  "child-databases",
+				Usage: "add databases inside event pages, such as agendas, to event descriptions as their \"title\" or a \"table\" of their rows",
+			},
+			&cli.PathFlag{
+				Name:  "content-cache-dir",
+				Usage: "keep the content of pages in this directory, to only read pages edited since the last run",
+			},
+			&cli.BoolFlag{
+				Name:  "debug-http",
+				Usage: "log requests to the Notion API with the status and timing of their responses",
+			},
+			&cli.BoolFlag{
+				Name:  "debug-http-bodies",
+				Usage: "log requests to the Notion API with the bodies of requests and responses, which contain the content of pages",
+			},
+			&cli.PathFlag{
+				Name:  "record",
+				Usage: "store the responses of the Notion API in this directory, such as for bug reports",
+			},
+			&cli.PathFlag{
+				Name:  "replay",
+				Usage: "respond to requests to the Notion API with the responses recorded in this directory, without an API key",
+			},
+			&cli.StringFlag{
+				Name:  "request-timeout",
+				Usage: "limit each request to the Notion API to this duration, such as \"2m\" for large blocks (default: 30s)",
+			},
+			&cli.StringFlag{
+				Name:  "read-timeout",
+				Usage: "limit reading the whole database to this duration, such as \"1m\" to fail fast in CI",
+			},
+			&cli.PathFlag{
+				Name:  "checkpoint-dir",
+				Usage: "keep the progress of reads in this directory, so that a run that failed resumes after the pages already read",
+			},
 			&cli.StringFlag{
 				Name:    "date-property",
 				EnvVars: []string{"NOTION_DATE_PROPERTY"},
 				Usage:   "use this date property for the event date instead of looking for the first date property",
 			},
+			&cli.StringFlag{
+				Name:    "title-property",
+				EnvVars: []string{"NOTION_TITLE_PROPERTY"},
+				Usage:   "use this export column for the event title instead of looking for a name or title column",
+			},
 			&cli.StringFlag{
 				Name:    "hide-property",
 				EnvVars: []string{"NOTION_HIDE_PROPERTY"},
-				Usage:   "hide events that have this checkbox property set",
+				Usage:   "hide events that have this checkbox property, or formula evaluating to a checkbox, set",
+			},
+			&cli.StringFlag{
+				Name:    "recurrence-property",
+				EnvVars: []string{"NOTION_RECURRENCE_PROPERTY"},
+				Usage:   "repeat events using this property, containing a setting such as \"Weekly\" or an RRULE such as \"FREQ=WEEKLY;BYDAY=MO\"",
+			},
+			&cli.StringFlag{
+				Name:    "exceptions-property",
+				EnvVars: []string{"NOTION_EXCEPTIONS_PROPERTY"},
+				Usage:   "skip occurrences of repeating events on the dates in this property",
+			},
+			&cli.StringFlag{
+				Name:    "status-property",
+				EnvVars: []string{"NOTION_STATUS_PROPERTY"},
+				Usage:   "read the status of tasks from this status, select or checkbox property, for --todo, or of events, such as \"Tentative\" or \"Cancelled\"",
+			},
+			&cli.StringFlag{
+				Name:    "location-property",
+				EnvVars: []string{"NOTION_LOCATION_PROPERTY"},
+				Usage:   "read the location of events from this property",
+			},
+			&cli.StringFlag{
+				Name:    "attendees-property",
+				EnvVars: []string{"NOTION_ATTENDEES_PROPERTY"},
+				Usage:   "invite the people in this people, email or text property to events, as attendees with their email addresses",
+			},
+			&cli.StringFlag{
+				Name:    "categories-property",
+				EnvVars: []string{"NOTION_CATEGORIES_PROPERTY"},
+				Usage:   "read the categories of events from this multi-select, select or text property",
+			},
+			&cli.StringFlag{
+				Name:    "id-property",
+				EnvVars: []string{"NOTION_ID_PROPERTY"},
+				Usage:   "use this unique ID property, or export column such as a formula of id(), for event UIDs that stay the same when events are renamed or rescheduled",
+			},
+			&cli.BoolFlag{
+				Name:  "id-in-title",
+				Usage: "prefix event titles with the ID from --id-property, such as \"TASK-123\"",
+			},
+			&cli.StringFlag{
+				Name:  "filter",
+				Usage: "only read pages matching this filter of the Notion API as JSON, such as the filter of a view, combined with --hide-property",
+			},
+			&cli.StringSliceFlag{
+				Name:  "sort",
+				Usage: "sort pages by this property, followed by \":descending\" to reverse, such as to match the sorts of a view",
+			},
+			&cli.StringSliceFlag{
+				Name:  "drop-title",
+				Usage: "drop events with titles matching this regular expression",
+			},
+			&cli.StringSliceFlag{
+				Name:  "replace-title",
+				Usage: "rewrite event titles with a \"PATTERN=>REPLACEMENT\" regular expression rule, such as \"^\\[WIP\\] =>\"",
+			},
+			&cli.StringSliceFlag{
+				Name:  "alarm",
+				Usage: "remind of events this long before they start, such as \"15m\", or \"0s\" at their start",
 			},
 		},
+		Before: func(ctx *cli.Context) error {
+			switch errorFormat = ctx.String("error-format"); errorFormat {
+			case ErrorFormatText, ErrorFormatJSON:
+			default:
+				errorFormat = ErrorFormatText
+				return configError(fmt.Errorf("unknown error format %q", ctx.String("error-format")))
+			}
+
+			if ctx.Path("api-key-file") != "" && ctx.String("api-key") == "" {
+				key, err := readSecretFile(ctx.Path("api-key-file"))
+				if err != nil {
+					return fmt.Errorf("unable to read API key file: %w", err)
+				}
+				if err := ctx.Set("api-key", key); err != nil {
+					return err
+				}
+			}
+			if isSecretReference(ctx.String("api-key")) {
+				key, err := resolveSecret(ctx.Context, ctx.String("api-key"))
+				if err != nil {
+					return configError(err)
+				}
+				if err := ctx.Set("api-key", key); err != nil {
+					return err
+				}
+			}
+
+			if !ctx.Bool("trace") {
+				return nil
+			}
+			shutdown, err := setupTracing(ctx.Context)
+			if err != nil {
+				return fmt.Errorf("unable to set up tracing: %w", err)
+			}
+			shutdownTracing = shutdown
+			return nil
+		},
+		After: func(ctx *cli.Context) error {
+			if shutdownTracing == nil {
+				return nil
+			}
+			return shutdownTracing(context.Background())
+		},
 		Commands: []*cli.Command{
 			{
 				Name:  "save",
 				Usage: "save iCal events to a file",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "output iCal file path, or directory with --split-databases or --split-by",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "output format, either \"ical\", \"csv\", \"freebusy\" for only busy periods without details, \"html\" for a month view of the current month, or \"jsonfeed\" for a JSON Feed",
+						Value:   FormatICal,
+					},
+					&cli.StringSliceFlag{
+						Name:  "csv-property",
+						Usage: "include this property as a column in CSV output",
+					},
+					&cli.BoolFlag{
+						Name:  "split-databases",
+						Usage: "save each database in the export as a separate iCal file in the output directory",
+					},
+					&cli.StringFlag{
+						Name:  "split-by",
+						Usage: "save the events of each \"month\" or \"year\" as a separate iCal file in the output directory, with an index.html linking to them, or each \"event\" as a file named by its UID",
+					},
+					&cli.BoolFlag{
+						Name:  "validate",
+						Usage: "check the saved calendar against RFC 5545 and fail on violations",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "read and convert events without writing the output",
+					},
+					&cli.BoolFlag{
+						Name:  "stats",
+						Usage: "print counts of rows, events, all-day and timed events, property coverage and date parse failures",
+					},
+					&cli.BoolFlag{
+						Name:  "strict",
+						Usage: "fail when reading the source had warnings, such as rows skipped because their date cannot be parsed",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Path("output") == "" && !ctx.Bool("dry-run") {
+						return configError(fmt.Errorf("Required flag \"output\" not set"))
+					}
+
+					var stats *notion_ical.ReadStats
+					if ctx.Bool("stats") {
+						stats = &notion_ical.ReadStats{}
+					}
+					warnings := &notion_ical.Warnings{}
+					source, err := sourceFromFlagsWith(ctx, true, stats, warnings)
+					if err != nil {
+						return err
+					}
+					config := feedConfigFromFlags(ctx)
+					opts, err := config.convertOptions()
+					if err != nil {
+						return configError(err)
+					}
+
+					switch ctx.String("format") {
+					case FormatICal:
+					case FormatFreeBusy:
+						opts = append(opts, notion_ical.WithFreeBusy())
+					case FormatCSV, FormatHTML, FormatJSONFeed:
+						if config.Validate {
+							return configError(fmt.Errorf("\"validate\" requires an iCal format"))
+						}
+					default:
+						return configError(fmt.Errorf("unknown format %q", ctx.String("format")))
+					}
+
+					if ctx.String("split-by") != "" {
+						if ctx.Bool("split-databases") || ctx.String("format") == FormatCSV || ctx.String("format") == FormatHTML || ctx.String("format") == FormatJSONFeed {
+							return configError(fmt.Errorf("\"split-by\" requires an iCal format without \"split-databases\""))
+						}
+					}
+
+					var events *eventStats
+					if stats != nil {
+						events = newEventStats()
+						opts = append(opts, notion_ical.WithEventMapper(events.observe))
+					}
+
+					if err := saveOutput(ctx, source, config.Validate, opts); err != nil {
+						return err
+					}
+					logWarnings(warnings.List())
+					if stats != nil {
+						if err := writeStats(os.Stdout, stats, events); err != nil {
+							return err
+						}
+					}
+					if ctx.Bool("strict") && warnings.Len() > 0 {
+						return conversionError(fmt.Errorf("%d warnings while reading the source", warnings.Len()))
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "generate",
+				Usage: "generate a directory with the calendar, its events as JSON and an index.html of upcoming events, to publish on a static host",
 				Flags: []cli.Flag{
 					&cli.PathFlag{
 						Name:     "output",
 						Aliases:  []string{"o"},
-						Usage:    "output iCal file path",
+						Usage:    "output directory",
 						Required: true,
 					},
 				},
 				Action: func(ctx *cli.Context) error {
-					source, err := sourceFromFlags(ctx)
+					warnings := &notion_ical.Warnings{}
+					source, err := sourceFromFlagsWith(ctx, true, nil, warnings)
+					if err != nil {
+						return err
+					}
+					if err := generateSite(ctx.Context, source, ctx.Path("output"), feedConfigFromFlags(ctx), time.Now()); err != nil {
+						return err
+					}
+					logWarnings(warnings.List())
+					return nil
+				},
+			},
+			{
+				Name:  "init",
+				Usage: "choose a database and its properties, and write a configuration file for serve",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "notion-ical.json",
+						Usage:   "write the configuration to this file",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "overwrite an existing configuration file",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					w := wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+					return runInit(ctx.Context, w, feedConfigFromFlags(ctx), ctx.Path("output"), ctx.Bool("force"))
+				},
+			},
+			{
+				Name:  "databases",
+				Usage: "list the databases shared with the integration of the API key, for --database-id",
+				Action: func(ctx *cli.Context) error {
+					config := feedConfigFromFlags(ctx)
+					if !config.usesAPI() {
+						return configError(fmt.Errorf("Required flag \"api-key\" not set"))
+					}
+
+					requestTimeout, _, err := config.timeouts()
+					if err != nil {
+						return configError(err)
+					}
+					httpClient, err := config.httpClient()
+					if err != nil {
+						return configError(err)
+					}
+					databases, err := notion_ical.ListDatabases(ctx.Context, notion_ical.ConfigSourceAPI{
+						APIKey:         config.APIKey,
+						PageSize:       config.PageSize,
+						RequestTimeout: requestTimeout,
+						HTTPClient:     httpClient,
+					})
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(w, "ID\tTITLE\tLAST EDITED")
+					for _, database := range databases {
+						fmt.Fprintf(w, "%s\t%s\t%s\n", database.ID, databaseTitle(database), database.LastEditedTime.Local().Format("2006-01-02 15:04"))
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:  "list-properties",
+				Usage: "list the properties of the database and their types",
+				Action: func(ctx *cli.Context) error {
+					source, err := sourceFromFlags(ctx, false)
+					if err != nil {
+						return err
+					}
+
+					lister, ok := source.(notion_ical.PropertyLister)
+					if !ok {
+						return fmt.Errorf("source does not support listing properties")
+					}
+
+					properties, err := lister.Properties()
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(w, "NAME\tTYPE")
+					for _, property := range properties {
+						fmt.Fprintf(w, "%s\t%s\n", property.Name, property.Type)
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:  "preview",
+				Usage: "print upcoming events as a table",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "include past events",
+					},
+					&cli.StringSliceFlag{
+						Name:    "property",
+						Aliases: []string{"p"},
+						Usage:   "show this property as a column",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					warnings := &notion_ical.Warnings{}
+					source, err := sourceFromFlagsWith(ctx, true, nil, warnings)
 					if err != nil {
 						return err
 					}
 
-					f, err := os.Create(ctx.String("output"))
+					mappers, err := feedConfigFromFlags(ctx).eventMappers()
+					if err != nil {
+						return configError(err)
+					}
+
+					events, err := source.ReadAll()
+					if err != nil {
+						return conversionError(err)
+					}
+					events = notion_ical.MapEvents(events, mappers...)
+					logWarnings(warnings.List())
+
+					return previewEvents(os.Stdout, events, time.Now(), ctx.Bool("all"), ctx.StringSlice("property"))
+				},
+			},
+			{
+				Name:  "push",
+				Usage: "push iCal events to a remote calendar",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "caldav",
+						Usage: "push events to a CalDAV collection",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "url",
+								Usage:    "URL of the CalDAV calendar collection",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "username",
+								Aliases: []string{"u"},
+								EnvVars: []string{"CALDAV_USERNAME"},
+								Usage:   "CalDAV username",
+							},
+							&cli.StringFlag{
+								Name:    "password",
+								EnvVars: []string{"CALDAV_PASSWORD"},
+								Usage:   "CalDAV password",
+							},
+							&cli.BoolFlag{
+								Name:  "delete",
+								Usage: "delete previously pushed events that are no longer in the source",
+								Value: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							source, err := sourceFromFlags(ctx, true)
+							if err != nil {
+								return err
+							}
+							opts, err := feedConfigFromFlags(ctx).convertOptions()
+							if err != nil {
+								return configError(err)
+							}
+
+							collection, err := url.Parse(ctx.String("url"))
+							if err != nil {
+								return configError(fmt.Errorf("invalid CalDAV URL: %w", err))
+							}
+							if !strings.HasSuffix(collection.Path, "/") {
+								collection.Path += "/"
+							}
+
+							password, err := resolveSecret(ctx.Context, ctx.String("password"))
+							if err != nil {
+								return configError(err)
+							}
+
+							pusher := caldavPusher{
+								client:     http.DefaultClient,
+								collection: collection,
+								username:   ctx.String("username"),
+								password:   password,
+							}
+							return pusher.push(source, ctx.Bool("delete"), opts...)
+						},
+					},
+				},
+			},
+			{
+				Name:  "watch",
+				Usage: "poll for changed events and send notifications",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:    "interval",
+						Aliases: []string{"i"},
+						Usage:   "how often to poll for changes",
+						Value:   5 * time.Minute,
+					},
+					&cli.StringSliceFlag{
+						Name:  "webhook",
+						Usage: "POST a JSON description of changes to this URL",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exec",
+						Usage: "run this shell command with a JSON description of changes on stdin",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					source, err := sourceFromFlags(ctx, true)
 					if err != nil {
-						return fmt.Errorf("unable to open output file: %w", err)
+						return err
+					}
+					mappers, err := feedConfigFromFlags(ctx).eventMappers()
+					if err != nil {
+						return configError(err)
 					}
-					defer f.Close()
 
-					return notion_ical.Convert(source, f)
+					w := &watcher{
+						source:   source,
+						interval: ctx.Duration("interval"),
+						webhooks: ctx.StringSlice("webhook"),
+						commands: ctx.StringSlice("exec"),
+						mappers:  mappers,
+						client:   &http.Client{Timeout: 30 * time.Second},
+					}
+					return w.run()
 				},
 			},
 			{
@@ -99,63 +665,337 @@ func main() {
 						Usage:   "cache duration to limit request rate to Notion API",
 						Value:   30 * time.Second,
 					},
+					&cli.StringSliceFlag{
+						Name:  "cors-origin",
+						Usage: "allow browsers on this origin, such as https://example.com, to fetch feeds, or \"*\" for any origin",
+					},
+					&cli.StringFlag{
+						Name:  "access-log",
+						Usage: "log requests to stdout in this format: json or combined",
+					},
+					&cli.StringFlag{
+						Name:  "cache-max-age",
+						Usage: "allow clients to cache feeds for this duration, with the Cache-Control and Expires headers",
+					},
+					&cli.StringFlag{
+						Name:  "cache-shared-max-age",
+						Usage: "allow caches in front of the server, such as CDNs, to cache feeds for this duration",
+					},
+					&cli.StringFlag{
+						Name:  "cache-stale-while-revalidate",
+						Usage: "allow caches to serve expired feeds for this duration while revalidating them",
+					},
+					&cli.BoolFlag{
+						Name:  "warm",
+						Usage: "refresh feeds in the background before their cache expires, instead of when requested",
+					},
+					&cli.BoolFlag{
+						Name:  "warnings-header",
+						Usage: "count the warnings of the read of feeds by kind in an X-Warnings header",
+					},
+					&cli.PathFlag{
+						Name:  "cache-dir",
+						Usage: "persist the events of feeds in this directory, to serve them immediately after a restart while refreshing",
+					},
+					&cli.PathFlag{
+						Name:  "config",
+						Usage: "serve multiple feeds at /{name}.ics from this JSON file, reloaded on change or SIGHUP",
+					},
+					&cli.StringFlag{
+						Name:    "status-password",
+						EnvVars: []string{"NOTION_ICAL_STATUS_PASSWORD"},
+						Usage:   "serve a status page at /status, protected by HTTP basic authentication with this password",
+					},
+					&cli.StringFlag{
+						Name:    "sentry-dsn",
+						EnvVars: []string{"SENTRY_DSN"},
+						Usage:   "report failures to refresh feeds to Sentry",
+					},
+					&cli.BoolFlag{
+						Name:  "pprof",
+						Usage: "serve runtime profiles at /debug/pprof/, protected by the status password",
+					},
+					&cli.StringSliceFlag{
+						Name:  "allow-database",
+						Usage: "serve this database ID at /db/{database-id}.ics using the global --api-key, or \"*\" for any database shared with the integration",
+					},
+					&cli.BoolFlag{
+						Name:  "proxy",
+						Usage: "convert any database at /proxy/{database-id}.ics with the API key of the request, from basic authentication, a bearer token or the key query parameter",
+					},
+					&cli.BoolFlag{
+						Name:  "caldav",
+						Usage: "also serve events as read-only CalDAV collections at /caldav/{name}/",
+					},
+					&cli.BoolFlag{
+						Name:  "html",
+						Usage: "also serve a month view and agenda of events to browsers at /{name}.html, and at / for a single feed",
+					},
+					&cli.BoolFlag{
+						Name:  "stream",
+						Usage: "also serve changes of events to dashboards at /events/stream?feed={name}, with Server-Sent Events or WebSocket",
+					},
+					&cli.BoolFlag{
+						Name:  "validate",
+						Usage: "check refreshed feeds against RFC 5545, serving the last valid feed on violations",
+					},
 				},
 				Action: func(ctx *cli.Context) error {
-					return nil
+					if _, _, err := feedConfigFromFlags(ctx).cacheControl(); err != nil {
+						return configError(err)
+					}
+
+					rt := newRouter(ctx.Duration("cache"), ctx.Bool("caldav"))
+					statusPassword, err := resolveSecret(ctx.Context, ctx.String("status-password"))
+					if err != nil {
+						return configError(err)
+					}
+					rt.statusPassword = statusPassword
+					rt.html = ctx.Bool("html")
+					if ctx.Bool("stream") {
+						rt.stream = newChangeStream()
+						rt.streamOrigins = ctx.StringSlice("cors-origin")
+					}
+					if dsn := ctx.String("sentry-dsn"); dsn != "" {
+						reporter, err := newSentryReporter(dsn)
+						if err != nil {
+							return configError(err)
+						}
+						rt.reporter = reporter
+					}
+					if ctx.Bool("pprof") {
+						if rt.statusPassword == "" {
+							return configError(fmt.Errorf("\"pprof\" requires \"status-password\" to be set"))
+						}
+						rt.pprof = true
+					}
+					if dir := ctx.Path("cache-dir"); dir != "" {
+						if err := os.MkdirAll(dir, 0o700); err != nil {
+							return fmt.Errorf("unable to create cache directory: %w", err)
+						}
+						rt.cacheDir = dir
+					}
+
+					if allowed := ctx.StringSlice("allow-database"); len(allowed) > 0 {
+						if ctx.String("api-key") == "" {
+							return configError(fmt.Errorf("\"allow-database\" requires \"api-key\" to be set"))
+						}
+						template := feedConfigFromFlags(ctx)
+						template.Export = ""
+						rt.dynamic = newDynamicFeeds(rt, template, allowed)
+					}
+					if ctx.Bool("proxy") {
+						rt.proxy = newProxyConverter(feedConfigFromFlags(ctx))
+					}
+
+					if configPath := ctx.Path("config"); configPath != "" {
+						config, err := readServeConfig(configPath, ctx.String("api-key"))
+						if err != nil {
+							return configError(err)
+						}
+						if rt.dynamic == nil {
+							// Databases of integrations are served at /db/,
+							// including those added on reload
+							template := feedConfigFromFlags(ctx)
+							template.Export = ""
+							rt.dynamic = newDynamicFeeds(rt, template, nil)
+						}
+						if err := rt.load(config); err != nil {
+							return err
+						}
+						go rt.watchConfig(configPath, ctx.String("api-key"))
+						go rt.refreshScheduled()
+					} else if (rt.dynamic == nil && rt.proxy == nil) || ctx.String("database-id") != "" || ctx.Path("export") != "" {
+						warnings := &notion_ical.Warnings{}
+						source, err := sourceFromFlagsWith(ctx, true, nil, warnings)
+						if err != nil {
+							return err
+						}
+						config := feedConfigFromFlags(ctx)
+						opts, err := config.convertOptions()
+						if err != nil {
+							return configError(err)
+						}
+						rt.single = true
+						s := rt.newServer(defaultFeedName, config, source, opts)
+						s.warnings = warnings
+						rt.feeds[defaultFeedName] = s
+					}
+
+					if ctx.Bool("warm") {
+						go rt.warm()
+					}
+
+					var handler http.Handler = rt
+					if origins := ctx.StringSlice("cors-origin"); len(origins) > 0 {
+						handler = corsHandler(handler, origins)
+					}
+					if ctx.Bool("trace") {
+						handler = traceHandler(handler)
+					}
+					if format := ctx.String("access-log"); format != "" {
+						var err error
+						handler, err = accessLogHandler(handler, format)
+						if err != nil {
+							return configError(err)
+						}
+					}
+
+					log.Printf("Listening on %s", ctx.String("listen"))
+					return http.ListenAndServe(ctx.String("listen"), handler)
 				},
 			},
 		},
 	}
 
+	addEnvVars(app)
+	addUsageErrors(app)
+
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		exitWithError(err, errorFormat)
 	}
 }
 
-func sourceFromFlags(ctx *cli.Context) (notion_ical.Source, error) {
-	if ctx.String("export") != "" && ctx.String("api-key") != "" {
+// sourceFromFlags creates the source configured by global flags. When check
+// is false, API sources are opened without checking the date and hide
+// properties.
+func sourceFromFlags(ctx *cli.Context, check bool) (notion_ical.Source, error) {
+	return sourceFromFlagsWith(ctx, check, nil, nil)
+}
+
+// sourceFromFlagsWith is sourceFromFlags, counting the rows read into stats
+// and collecting warnings when set.
+func sourceFromFlagsWith(ctx *cli.Context, check bool, stats *notion_ical.ReadStats, warnings *notion_ical.Warnings) (notion_ical.Source, error) {
+	config := feedConfigFromFlags(ctx)
+	if (config.Export != "") == config.usesAPI() || (config.usesAPI() && config.DatabaseID == "") {
 		err := cli.ShowAppHelp(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
-		return nil, fmt.Errorf("Either \"export\" or \"api-key\" should be set")
 	}
-	if ctx.String("export") != "" {
-		archive, err := os.Open(ctx.Path("export"))
+	return config.sourceWith(check, stats, warnings)
+}
+
+// openArchive opens the export archive at path, or buffers stdin in memory
+// when path is "-" because the ZIP reader requires random access.
+func openArchive(path string) (notion_ical.ReaderAtSeeker, string, error) {
+	if path == "-" {
+		b, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			return nil, fmt.Errorf("error opening archive: %w", err)
+			return nil, "", err
 		}
+		return bytes.NewReader(b), "", nil
+	}
 
-		zone, err := time.LoadLocation(ctx.String("export-timezone"))
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, path, nil
+}
+
+// saveCalendar converts source into w, and checks the calendar when
+// validate is set.
+func saveCalendar(ctx context.Context, source notion_ical.Source, w io.Writer, validate bool, opts []notion_ical.ConvertOption) error {
+	var saved bytes.Buffer
+	if validate {
+		w = io.MultiWriter(w, &saved)
+	}
+	if err := notion_ical.ConvertContext(ctx, source, w, opts...); err != nil {
+		return conversionError(err)
+	}
+	if validate {
+		return conversionError(validateCalendar(source.Name(), saved.Bytes()))
+	}
+	return nil
+}
+
+// saveOutput writes the converted source to the output of save in its
+// format, or only converts it with --dry-run.
+func saveOutput(ctx *cli.Context, source notion_ical.Source, validate bool, opts []notion_ical.ConvertOption) error {
+	if ctx.Bool("dry-run") {
+		return writeFormat(ctx, source, io.Discard, validate, opts)
+	}
+
+	if ctx.String("split-by") != "" {
+		return savePeriods(ctx.Context, source, ctx.Path("output"), ctx.String("split-by"), validate, opts)
+	}
+
+	if ctx.Bool("split-databases") {
+		return saveDatabases(source, ctx.Path("output"), validate, opts)
+	}
+
+	f, err := os.Create(ctx.String("output"))
+	if err != nil {
+		return fmt.Errorf("unable to open output file: %w", err)
+	}
+	defer f.Close()
+
+	return writeFormat(ctx, source, f, validate, opts)
+}
+
+// writeFormat converts the source to w in the format of save.
+func writeFormat(ctx *cli.Context, source notion_ical.Source, w io.Writer, validate bool, opts []notion_ical.ConvertOption) error {
+	switch ctx.String("format") {
+	case FormatCSV:
+		return conversionError(notion_ical.ConvertCSV(source, w, ctx.StringSlice("csv-property"), opts...))
+	case FormatJSONFeed:
+		return conversionError(notion_ical.ConvertJSONFeedContext(ctx.Context, source, w, opts...))
+	case FormatHTML:
+		feed, err := convertFeed(ctx.Context, source, opts...)
 		if err != nil {
-			return nil, fmt.Errorf("error loading timezone: %w", err)
+			return conversionError(err)
 		}
+		now := time.Now()
+		return writeHTMLCalendar(w, source.Name(), feed, now, now)
+	}
+	return saveCalendar(ctx.Context, source, w, validate, opts)
+}
 
-		return notion_ical.NewSourceExport(notion_ical.ConfigSourceExport{
-			Archive:      archive,
-			Zone:         zone,
-			DateProperty: ctx.String("date-property"),
-			HideProperty: ctx.String("hide-property"),
-		})
-	} else if ctx.String("api-key") != "" {
-		if ctx.String("database-id") == "" {
-			err := cli.ShowAppHelp(ctx)
-			if err != nil {
-				log.Fatal(err)
-			}
-			return nil, fmt.Errorf("Required flag \"database-id\" not set")
+// saveDatabases saves each database in an export into its own file in dir.
+func saveDatabases(source notion_ical.Source, dir string, validate bool, opts []notion_ical.ConvertOption) error {
+	export, ok := source.(notion_ical.SourceExport)
+	if !ok {
+		return configError(fmt.Errorf("\"split-databases\" requires \"export\" to be set"))
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create output directory: %w", err)
+	}
+
+	for _, database := range export.Databases() {
+		f, err := os.Create(filepath.Join(dir, calendarFilename(database.Name(), "")))
+		if err != nil {
+			return fmt.Errorf("unable to open output file: %w", err)
 		}
-		return notion_ical.NewSourceAPI(notion_ical.ConfigSourceAPI{
-			APIKey:       ctx.String("api-key"),
-			DatabaseID:   ctx.String("database-id"),
-			DateProperty: ctx.String("date-property"),
-			HideProperty: ctx.String("hide-property"),
-		})
-	} else {
-		err := cli.ShowAppHelp(ctx)
+
+		err = saveCalendar(context.Background(), database, f, validate, opts)
+		f.Close()
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("%s: %w", database.Name(), err)
 		}
-		return nil, fmt.Errorf("One of \"export\" or \"api-key\" should be set")
 	}
+
+	return nil
+}
+
+// calendarFilename names the file of a calendar after the name of its
+// source, with the path and extension of exported CSV files removed. The
+// suffix is added before the extension.
+func calendarFilename(name, suffix string) string {
+	if strings.HasSuffix(name, ".csv") {
+		name = strings.TrimSuffix(path.Base(name), ".csv")
+	}
+	return sanitizeFilename(name+suffix) + ".ics"
+}
+
+// sanitizeFilename replaces characters that are unsafe in file names.
+func sanitizeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
 }
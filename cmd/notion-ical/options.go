@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+const (
+	DTStampStart      = "start"
+	DTStampNow        = "now"
+	DTStampLastEdited = "last-edited"
+)
+
+// replaceSeparator separates the pattern and replacement of a title
+// replacement rule.
+const replaceSeparator = "=>"
+
+// eventMappers creates the event mappers configured by the drop and replace
+// title rules.
+func (c feedConfig) eventMappers() ([]notion_ical.EventMapper, error) {
+	var mappers []notion_ical.EventMapper
+
+	for _, rule := range c.DropTitles {
+		pattern, err := regexp.Compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid drop title pattern %q: %w", rule, err)
+		}
+		mappers = append(mappers, func(event notion_ical.Event) (notion_ical.Event, bool) {
+			return event, !pattern.MatchString(event.Title)
+		})
+	}
+
+	for _, rule := range c.ReplaceTitles {
+		expr, replacement, ok := strings.Cut(rule, replaceSeparator)
+		if !ok {
+			return nil, fmt.Errorf("invalid replace title rule %q: expected PATTERN%sREPLACEMENT", rule, replaceSeparator)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replace title pattern %q: %w", expr, err)
+		}
+		mappers = append(mappers, func(event notion_ical.Event) (notion_ical.Event, bool) {
+			event.Title = pattern.ReplaceAllString(event.Title, replacement)
+			return event, true
+		})
+	}
+
+	if len(c.Alarms) > 0 {
+		alarms := make([]notion_ical.Alarm, 0, len(c.Alarms))
+		for _, value := range c.Alarms {
+			before, err := time.ParseDuration(value)
+			if err != nil || before < 0 {
+				return nil, fmt.Errorf("invalid alarm %q: expected a duration such as \"15m\"", value)
+			}
+			alarms = append(alarms, notion_ical.Alarm{Before: before})
+		}
+		mappers = append(mappers, func(event notion_ical.Event) (notion_ical.Event, bool) {
+			event.Alarms = append(event.Alarms[:len(event.Alarms):len(event.Alarms)], alarms...)
+			return event, true
+		})
+	}
+
+	return mappers, nil
+}
+
+// convertOptions creates the conversion options configured for the feed.
+func (c feedConfig) convertOptions() ([]notion_ical.ConvertOption, error) {
+	mappers, err := c.eventMappers()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []notion_ical.ConvertOption
+	for _, mapper := range mappers {
+		opts = append(opts, notion_ical.WithEventMapper(mapper))
+	}
+
+	switch c.DTStamp {
+	case "", DTStampStart:
+	case DTStampNow:
+		opts = append(opts, notion_ical.WithDTStampNow())
+	case DTStampLastEdited:
+		opts = append(opts, notion_ical.WithDTStampLastEdited())
+	default:
+		t, err := time.Parse(time.RFC3339, c.DTStamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dtstamp %q: expected %q, %q, %q or an RFC 3339 time", c.DTStamp, DTStampStart, DTStampNow, DTStampLastEdited)
+		}
+		opts = append(opts, notion_ical.WithDTStamp(t))
+	}
+
+	if c.OutputTimezone != "" {
+		zone, err := loadLocation(c.OutputTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("error loading output timezone: %w", err)
+		}
+		if zone == time.Local || zone == time.UTC {
+			return nil, fmt.Errorf("output timezone should be an IANA name such as \"Europe/Berlin\", not %q", c.OutputTimezone)
+		}
+		opts = append(opts, notion_ical.WithTimezone(zone))
+	}
+
+	if c.Todos {
+		opts = append(opts, notion_ical.WithTodos())
+	}
+
+	if c.Compat != "" {
+		client, err := notion_ical.ParseClient(c.Compat)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notion_ical.WithCompat(client))
+	}
+
+	if c.HTMLDescription {
+		opts = append(opts, notion_ical.WithHTMLDescription())
+	}
+
+	if c.NoMethod {
+		opts = append(opts, notion_ical.WithMethod(""))
+	}
+
+	if c.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit %d", c.Limit)
+	}
+	if c.Limit > 0 {
+		opts = append(opts, notion_ical.WithLimit(c.Limit))
+	}
+
+	return opts, nil
+}
+
+// cacheControl returns the Cache-Control header of the feed, or an empty
+// string when not configured, and the max age for the Expires header.
+func (c feedConfig) cacheControl() (string, time.Duration, error) {
+	var directives []string
+	var maxAge time.Duration
+	for _, d := range []struct {
+		name  string
+		value string
+		set   *time.Duration
+	}{
+		{"max-age", c.CacheMaxAge, &maxAge},
+		{"s-maxage", c.CacheSharedMaxAge, nil},
+		{"stale-while-revalidate", c.CacheStaleWhileRevalidate, nil},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil || duration < 0 {
+			return "", 0, fmt.Errorf("invalid %s %q: expected a duration such as \"5m\"", d.name, d.value)
+		}
+		directives = append(directives, fmt.Sprintf("%s=%d", d.name, int64(duration/time.Second)))
+		if d.set != nil {
+			*d.set = duration
+		}
+	}
+	if len(directives) == 0 {
+		return "", 0, nil
+	}
+	if c.CacheMaxAge == "" {
+		// Only caches in front of the server may keep the feed
+		directives = append([]string{"max-age=0"}, directives...)
+	}
+	return strings.Join(directives, ", "), maxAge, nil
+}
+
+// cacheDuration returns how long the feed is cached, or def when not
+// configured.
+func (c feedConfig) cacheDuration(def time.Duration) (time.Duration, error) {
+	if c.Cache == "" {
+		return def, nil
+	}
+	duration, err := time.ParseDuration(c.Cache)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid cache %q: expected a duration such as \"5m\"", c.Cache)
+	}
+	return duration, nil
+}
+
+// timeouts returns the timeouts of each request to the Notion API and of
+// whole reads, which are zero when not configured.
+func (c feedConfig) timeouts() (request, read time.Duration, err error) {
+	for _, t := range []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"request_timeout", c.RequestTimeout, &request},
+		{"read_timeout", c.ReadTimeout, &read},
+	} {
+		if t.value == "" {
+			continue
+		}
+		*t.d, err = time.ParseDuration(t.value)
+		if err != nil || *t.d <= 0 {
+			return 0, 0, fmt.Errorf("invalid %s %q: expected a duration such as \"30s\"", t.name, t.value)
+		}
+	}
+	return request, read, nil
+}
+
+// refreshSchedule returns when the feed is refreshed in the background, or
+// nil when not configured.
+func (c feedConfig) refreshSchedule() (schedule, error) {
+	if c.Refresh == "" {
+		return nil, nil
+	}
+	return parseSchedule(c.Refresh)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+	"github.com/serverwentdown/notion-ical/notionicaltest"
+)
+
+var dtstampLine = regexp.MustCompile(`(?m)^DTSTAMP:(\S+)\r$`)
+
+func TestFeedConfigDTStamp(t *testing.T) {
+	source := notionicaltest.NewSource("Team",
+		notion_ical.Event{
+			ID:         "standup@notion-ical",
+			Title:      "Standup",
+			Start:      time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+			End:        time.Date(2024, 1, 8, 9, 15, 0, 0, time.UTC),
+			LastEdited: time.Date(2024, 1, 2, 12, 30, 0, 0, time.UTC),
+		},
+		notion_ical.Event{
+			ID:    "review@notion-ical",
+			Title: "Review",
+			Start: time.Date(2024, 1, 9, 14, 0, 0, 0, time.UTC),
+			End:   time.Date(2024, 1, 9, 15, 0, 0, 0, time.UTC),
+		},
+	)
+
+	tests := []struct {
+		dtstamp string
+		want    []string
+		wantErr bool
+	}{
+		{dtstamp: "", want: []string{"20240108T090000Z", "20240109T140000Z"}},
+		{dtstamp: DTStampStart, want: []string{"20240108T090000Z", "20240109T140000Z"}},
+		{dtstamp: DTStampLastEdited, want: []string{"20240102T123000Z", "20240109T140000Z"}},
+		{dtstamp: "2023-12-31T23:00:00+01:00", want: []string{"20231231T220000Z", "20231231T220000Z"}},
+		{dtstamp: DTStampNow},
+		{dtstamp: "yesterday", wantErr: true},
+		{dtstamp: "2024-01-02", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.dtstamp, func(t *testing.T) {
+			before := time.Now().UTC().Truncate(time.Second)
+			opts, err := feedConfig{DTStamp: test.dtstamp}.convertOptions()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("convertOptions() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertOptions() = %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := notion_ical.Convert(source, &buf, opts...); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, match := range dtstampLine.FindAllStringSubmatch(buf.String(), -1) {
+				got = append(got, match[1])
+			}
+			if len(got) != 2 {
+				t.Fatalf("found %d DTSTAMP lines, want 2:\n%s", len(got), buf.String())
+			}
+
+			if test.dtstamp == DTStampNow {
+				for _, stamp := range got {
+					parsed, err := time.Parse("20060102T150405Z", stamp)
+					if err != nil || parsed.Before(before) || parsed.After(time.Now()) {
+						t.Errorf("DTSTAMP = %s, want the time of conversion", stamp)
+					}
+				}
+				return
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("DTSTAMP of event %d = %s, want %s", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// pprofRoot is the path prefix of the profiling endpoints.
+const pprofRoot = "/debug/pprof/"
+
+// handlePprof serves the runtime profiles of net/http/pprof, such as
+// /debug/pprof/heap and /debug/pprof/profile for CPU profiles.
+func handlePprof(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, pprofRoot) {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// previewEvents prints events as a table sorted by start time. Events that
+// ended before now are omitted unless all is set.
+func previewEvents(w io.Writer, events []notion_ical.Event, now time.Time, all bool, properties []string) error {
+	var upcoming []notion_ical.Event
+	for _, event := range events {
+		if all || !event.End.Before(now) {
+			upcoming = append(upcoming, event)
+		}
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].Start.Before(upcoming[j].Start)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	headers := append([]string{"TITLE", "WHEN"}, properties...)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for _, event := range upcoming {
+		values := make(map[string]string)
+		for _, property := range event.Properties {
+			values[property.NameString()] = property.ValueString()
+		}
+
+		row := []string{event.Emoji + event.Title, previewWhen(event)}
+		for _, name := range properties {
+			row = append(row, strings.ReplaceAll(values[name], "\n", " "))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func previewWhen(event notion_ical.Event) string {
+	if event.AllDay {
+		start := event.Start.Format(time.DateOnly)
+		end := event.End.AddDate(0, 0, -1).Format(time.DateOnly)
+		if start == end {
+			return start
+		}
+		return start + " → " + end
+	}
+
+	start := event.Start.Format("2006-01-02 15:04")
+	if event.End.Equal(event.Start) {
+		return start
+	}
+	if event.End.Format(time.DateOnly) == event.Start.Format(time.DateOnly) {
+		return start + " → " + event.End.Format("15:04")
+	}
+	return start + " → " + event.End.Format("2006-01-02 15:04")
+}
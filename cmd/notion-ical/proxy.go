@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// proxyRoot is the path prefix of databases converted with the API key of
+// each request.
+const proxyRoot = "/proxy/"
+
+// proxyConverter converts databases with the API key of each request, so
+// that one instance can serve many users without storing their secrets.
+// Nothing is cached between requests.
+type proxyConverter struct {
+	// template configures every conversion, except for the API key and
+	// database ID
+	template feedConfig
+}
+
+// newProxyConverter creates a proxyConverter from the configuration of the
+// server. Settings that read from or write to the server, such as exports,
+// recordings, caches and debugging of HTTP bodies, are left out, so that
+// requests can neither read the data of others nor log their secrets.
+func newProxyConverter(template feedConfig) *proxyConverter {
+	template.Export = ""
+	template.APIKey = ""
+	template.Record = ""
+	template.Replay = ""
+	template.ContentCacheDir = ""
+	template.CheckpointDir = ""
+	template.DebugHTTP = false
+	template.DebugHTTPBodies = false
+	return &proxyConverter{template: template}
+}
+
+// requestAPIKey reads the API key from a bearer token, the password of
+// basic authentication, or the key query parameter.
+func requestAPIKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return r.URL.Query().Get("key")
+}
+
+func (p *proxyConverter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, proxyRoot), ".ics")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	setAccessFeed(r, id)
+
+	key := requestAPIKey(r)
+	if key == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="notion-ical", charset="UTF-8"`)
+		http.Error(w, "Notion API key required", http.StatusUnauthorized)
+		return
+	}
+
+	config := p.template
+	config.Name = id
+	config.APIKey = key
+	config.DatabaseID = id
+	query := r.URL.Query()
+	if v := query.Get("date_property"); v != "" {
+		config.DateProperty = v
+	}
+	if v := query.Get("hide_property"); v != "" {
+		config.HideProperty = v
+	}
+
+	source, err := config.source(true)
+	if err != nil {
+		log.Printf("failed to open proxied database %s: %v", id, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	opts, err := config.convertOptions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	setHeaders := func(h http.Header) {
+		h.Set("Content-Type", "text/calendar; charset=utf-8")
+		h.Set("Cache-Control", "private")
+		h.Set("Content-Disposition", contentDisposition(calendarFilename(source.Name(), "")))
+	}
+
+	// Conditional and range requests need the whole calendar for its ETag,
+	// while others are sent as events are read
+	if r.Header.Get("If-None-Match") == "" && r.Header.Get("Range") == "" {
+		cw := &calendarWriter{ResponseWriter: w, setHeaders: setHeaders}
+		err := notion_ical.ConvertContext(r.Context(), source, cw, opts...)
+		if err != nil && !cw.written {
+			log.Printf("failed to convert proxied database %s: %v", id, err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		} else if err != nil {
+			// Abort the response, so that clients do not keep a truncated
+			// calendar
+			log.Printf("failed to convert proxied database %s after sending part of it: %v", id, err)
+			panic(http.ErrAbortHandler)
+		}
+		return
+	}
+
+	f, err := convertFeed(r.Context(), source, opts...)
+	if err != nil {
+		log.Printf("failed to convert proxied database %s: %v", id, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	setHeaders(w.Header())
+	w.Header().Set("ETag", f.etag)
+	http.ServeContent(w, r, "", f.refreshed, bytes.NewReader(f.ics))
+}
+
+// calendarWriter sets the headers of a calendar response with its first
+// write, so that errors before any of the calendar is written can still be
+// sent as errors.
+type calendarWriter struct {
+	http.ResponseWriter
+	setHeaders func(http.Header)
+	written    bool
+}
+
+func (w *calendarWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		w.setHeaders(w.ResponseWriter.Header())
+	}
+	return w.ResponseWriter.Write(b)
+}
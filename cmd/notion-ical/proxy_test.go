@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewProxyConverter(t *testing.T) {
+	tests := []struct {
+		name   string
+		config feedConfig
+	}{
+		{"export", feedConfig{Export: "export.zip"}},
+		{"api key", feedConfig{APIKey: "secret_server"}},
+		{"record", feedConfig{Record: "recordings"}},
+		{"replay", feedConfig{Replay: "recordings"}},
+		{"content cache", feedConfig{ContentCacheDir: "content"}},
+		{"checkpoint", feedConfig{CheckpointDir: "checkpoints"}},
+		{"debug http", feedConfig{DebugHTTP: true}},
+		{"debug http bodies", feedConfig{DebugHTTPBodies: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.DateProperty = "When"
+			p := newProxyConverter(test.config)
+			if want := (feedConfig{DateProperty: "When"}); !reflect.DeepEqual(p.template, want) {
+				t.Errorf("template = %+v, want %+v", p.template, want)
+			}
+		})
+	}
+}
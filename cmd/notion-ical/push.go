@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/arran4/golang-ical"
+	"github.com/serverwentdown/notion-ical"
+)
+
+// caldavPusher uploads events to a remote CalDAV collection.
+type caldavPusher struct {
+	client     *http.Client
+	collection *url.URL
+	username   string
+	password   string
+}
+
+// remoteObject is a calendar object resource on the remote server.
+type remoteObject struct {
+	href string
+	etag string
+	uid  string
+	data string
+}
+
+// push uploads new and changed events, and deletes events that this tool
+// created previously but are no longer in the source when prune is set.
+func (p caldavPusher) push(source notion_ical.Source, prune bool, opts ...notion_ical.ConvertOption) error {
+	f, err := convertFeed(context.Background(), source, opts...)
+	if err != nil {
+		return err
+	}
+
+	remote, err := p.list()
+	if err != nil {
+		return fmt.Errorf("unable to list remote calendar: %w", err)
+	}
+
+	remoteByUID := make(map[string]remoteObject)
+	for _, object := range remote {
+		remoteByUID[object.uid] = object
+	}
+
+	var created, updated, unchanged, deleted int
+
+	local := make(map[string]bool)
+	for _, object := range f.caldavObjects("") {
+		local[object.uid] = true
+
+		existing, ok := remoteByUID[object.uid]
+		if ok && normalizeICS(existing.data) == normalizeICS(string(object.data)) {
+			unchanged += 1
+			continue
+		}
+
+		target := p.collection.ResolveReference(&url.URL{Path: object.name})
+		header := http.Header{}
+		if ok {
+			target = p.collection.ResolveReference(&url.URL{Path: existing.href})
+			if existing.etag != "" {
+				header.Set("If-Match", existing.etag)
+			}
+		} else {
+			header.Set("If-None-Match", "*")
+		}
+		header.Set("Content-Type", "text/calendar; charset=utf-8")
+
+		err := p.do(http.MethodPut, target, header, bytes.NewReader(object.data), http.StatusCreated, http.StatusNoContent, http.StatusOK)
+		if err != nil {
+			return fmt.Errorf("unable to upload %s: %w", object.uid, err)
+		}
+		if ok {
+			updated += 1
+		} else {
+			created += 1
+		}
+	}
+
+	if prune {
+		for _, object := range remote {
+			if local[object.uid] || !isNotionICalUID(object.uid) {
+				continue
+			}
+
+			header := http.Header{}
+			if object.etag != "" {
+				header.Set("If-Match", object.etag)
+			}
+			target := p.collection.ResolveReference(&url.URL{Path: object.href})
+			err := p.do(http.MethodDelete, target, header, nil, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+			if err != nil {
+				return fmt.Errorf("unable to delete %s: %w", object.uid, err)
+			}
+			deleted += 1
+		}
+	}
+
+	log.Printf("Pushed events: %d created, %d updated, %d unchanged, %d deleted", created, updated, unchanged, deleted)
+
+	return nil
+}
+
+const caldavQueryAll = `<?xml version="1.0" encoding="UTF-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"/></C:filter>
+</C:calendar-query>`
+
+type davMultistatusResponse struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ETag         string `xml:"DAV: getetag"`
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// list fetches all events and tasks in the remote collection.
+func (p caldavPusher) list() ([]remoteObject, error) {
+	header := http.Header{}
+	header.Set("Depth", "1")
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	body, err := p.request("REPORT", p.collection, header, strings.NewReader(caldavQueryAll), http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms davMultistatusResponse
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, err
+	}
+
+	var objects []remoteObject
+	for _, response := range ms.Responses {
+		for _, propstat := range response.Propstat {
+			if propstat.Prop.CalendarData == "" {
+				continue
+			}
+
+			calendar, err := ics.ParseCalendar(strings.NewReader(propstat.Prop.CalendarData))
+			if err != nil {
+				log.Printf("skipping unparseable remote object %s: %v", response.Href, err)
+				continue
+			}
+			for _, component := range calendar.Components {
+				var uid *ics.IANAProperty
+				switch c := component.(type) {
+				case *ics.VEvent:
+					uid = c.GetProperty(ics.ComponentPropertyUniqueId)
+				case *ics.VTodo:
+					uid = c.GetProperty(ics.ComponentPropertyUniqueId)
+				}
+				if uid == nil {
+					continue
+				}
+				objects = append(objects, remoteObject{
+					href: response.Href,
+					etag: propstat.Prop.ETag,
+					uid:  uid.Value,
+					data: propstat.Prop.CalendarData,
+				})
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+func (p caldavPusher) do(method string, target *url.URL, header http.Header, body io.Reader, expected ...int) error {
+	_, err := p.request(method, target, header, body, expected...)
+	return err
+}
+
+func (p caldavPusher) request(method string, target *url.URL, header http.Header, body io.Reader, expected ...int) ([]byte, error) {
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	if p.username != "" || p.password != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range expected {
+		if res.StatusCode == status {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s: unexpected status %s", method, target, res.Status)
+}
+
+// isNotionICalUID reports whether the UID was generated by a source in this
+// package, so that other events in a shared calendar are never deleted.
+func isNotionICalUID(uid string) bool {
+	return strings.HasSuffix(uid, "@notion-ical") || strings.HasSuffix(uid, "@notion-ical-export")
+}
+
+// normalizeICS removes line folding and line ending differences.
+func normalizeICS(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\n ", "")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/serverwentdown/notion-ical/notionicaltest"
+)
+
+// fakeCalDAV is a CalDAV collection that checks the preconditions of
+// writes like a server would.
+type fakeCalDAV struct {
+	mu       sync.Mutex
+	objects  map[string]fakeCalDAVObject
+	requests []string
+	version  int
+}
+
+type fakeCalDAVObject struct {
+	etag string
+	data string
+}
+
+func newFakeCalDAV(t *testing.T) (*fakeCalDAV, *url.URL) {
+	t.Helper()
+	fake := &fakeCalDAV{objects: make(map[string]fakeCalDAVObject)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	collection, err := url.Parse(srv.URL + "/calendars/team/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, collection
+}
+
+// add stores an event with uid in the collection, as another client would.
+func (c *fakeCalDAV) add(name, uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.objects["/calendars/team/"+name] = fakeCalDAVObject{
+		etag: fmt.Sprintf(`"%d"`, c.version),
+		data: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + uid + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+	}
+}
+
+func (c *fakeCalDAV) paths() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var paths []string
+	for path := range c.objects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (c *fakeCalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	request := r.Method + " " + r.URL.Path
+	if match := r.Header.Get("If-Match"); match != "" {
+		request += " If-Match:" + match
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		request += " If-None-Match:" + match
+	}
+	c.requests = append(c.requests, request)
+
+	existing, exists := c.objects[r.URL.Path]
+	if match := r.Header.Get("If-Match"); match != "" && (!exists || match != existing.etag) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case "REPORT":
+		var b strings.Builder
+		b.WriteString(`<multistatus xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+		for path, object := range c.objects {
+			b.WriteString("<response><href>" + path + "</href><propstat><prop><getetag>" + xmlEscape(object.etag) + "</getetag>")
+			b.WriteString("<C:calendar-data>" + xmlEscape(object.data) + "</C:calendar-data></prop>")
+			b.WriteString("<status>HTTP/1.1 200 OK</status></propstat></response>")
+		}
+		b.WriteString("</multistatus>")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, b.String())
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		c.version++
+		c.objects[r.URL.Path] = fakeCalDAVObject{etag: fmt.Sprintf(`"%d"`, c.version), data: string(data)}
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodDelete:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		delete(c.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPushCalDAV(t *testing.T) {
+	source := testCalDAVSource()
+	f, err := convertFeed(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := f.caldavObjects("")
+
+	fake, collection := newFakeCalDAV(t)
+	pusher := caldavPusher{client: http.DefaultClient, collection: collection}
+
+	if err := pusher.push(source, true); err != nil {
+		t.Fatalf("push() = %v", err)
+	}
+	want := []string{
+		"REPORT /calendars/team/",
+		"PUT /calendars/team/" + objects[0].name + " If-None-Match:*",
+		"PUT /calendars/team/" + objects[1].name + " If-None-Match:*",
+	}
+	if fmt.Sprint(fake.requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %q, want %q", fake.requests, want)
+	}
+
+	// Pushing again changes nothing
+	fake.requests = nil
+	if err := pusher.push(source, true); err != nil {
+		t.Fatalf("push() = %v", err)
+	}
+	if want := []string{"REPORT /calendars/team/"}; fmt.Sprint(fake.requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %q, want %q", fake.requests, want)
+	}
+}
+
+func TestPushCalDAVUpdate(t *testing.T) {
+	source := testCalDAVSource()
+	fake, collection := newFakeCalDAV(t)
+	// The event was pushed before under another name, and has changed since
+	fake.add("review.ics", "review@notion-ical")
+	etag := fake.objects["/calendars/team/review.ics"].etag
+
+	pusher := caldavPusher{client: http.DefaultClient, collection: collection}
+	if err := pusher.push(source, true); err != nil {
+		t.Fatalf("push() = %v", err)
+	}
+	if got, want := fake.requests[1], "PUT /calendars/team/review.ics If-Match:"+etag; got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+	if data := fake.objects["/calendars/team/review.ics"].data; !strings.Contains(data, "SUMMARY:Review") {
+		t.Errorf("event not updated:\n%s", data)
+	}
+}
+
+func TestPushCalDAVConflict(t *testing.T) {
+	source := testCalDAVSource()
+	fake, collection := newFakeCalDAV(t)
+	fake.add("review.ics", "review@notion-ical")
+
+	// The event changes on the server after it was listed
+	pusher := caldavPusher{client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Method == http.MethodPut {
+			fake.add("review.ics", "review@notion-ical")
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})}, collection: collection}
+
+	err := pusher.push(source, true)
+	if err == nil || !strings.Contains(err.Error(), "412") {
+		t.Errorf("push() = %v, want a precondition failure", err)
+	}
+}
+
+func TestPushCalDAVPrune(t *testing.T) {
+	tests := []struct {
+		name  string
+		prune bool
+		want  []string
+	}{
+		{"prune", true, []string{"/calendars/team/birthday.ics", "/calendars/team/shared.ics"}},
+		{"keep", false, []string{"/calendars/team/birthday.ics", "/calendars/team/old.ics", "/calendars/team/removed.ics", "/calendars/team/shared.ics"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := notionicaltest.NewSource("Team")
+			fake, collection := newFakeCalDAV(t)
+			fake.add("old.ics", "old@notion-ical")
+			fake.add("removed.ics", "removed@notion-ical-export")
+			fake.add("birthday.ics", "birthday@example.com")
+			fake.add("shared.ics", "notion-ical-export@example.com")
+			etag := fake.objects["/calendars/team/old.ics"].etag
+
+			pusher := caldavPusher{client: http.DefaultClient, collection: collection}
+			if err := pusher.push(source, test.prune); err != nil {
+				t.Fatalf("push() = %v", err)
+			}
+			if got := fake.paths(); fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("objects = %q, want %q", got, test.want)
+			}
+			if test.prune {
+				found := false
+				for _, request := range fake.requests {
+					found = found || request == "DELETE /calendars/team/old.ics If-Match:"+etag
+				}
+				if !found {
+					t.Errorf("requests = %q, want a conditional DELETE of old.ics", fake.requests)
+				}
+			}
+		})
+	}
+}
+
+func TestIsNotionICalUID(t *testing.T) {
+	tests := []struct {
+		uid  string
+		want bool
+	}{
+		{"0b4c3a3e-5f0e-4c8e-9d8e-2f2f1e7b8a1c@notion-ical", true},
+		{"team-standup@notion-ical-export", true},
+		{"birthday@example.com", false},
+		{"notion-ical@example.com", false},
+		{"event@notion-ical.example.com", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := isNotionICalUID(test.uid); got != test.want {
+			t.Errorf("isNotionICalUID(%q) = %v, want %v", test.uid, got, test.want)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// errorReporter receives failures to refresh feeds, including background
+// refreshes that no request would see, such as for alerting.
+type errorReporter interface {
+	// ReportError reports that the feed name failed to refresh. It must not
+	// block.
+	ReportError(name string, err error)
+}
+
+// ErrInvalidDSN is returned for Sentry DSNs that cannot be parsed.
+var ErrInvalidDSN = errors.New("invalid Sentry DSN")
+
+// sentryReporter sends errors to Sentry as events, using the envelope
+// endpoint of a DSN such as https://key@o0.ingest.sentry.io/0.
+type sentryReporter struct {
+	dsn      string
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+func newSentryReporter(dsn string) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDSN, err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, ErrInvalidDSN
+	}
+
+	// Sentry hosted under a path keeps the prefix before the project ID
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	endpoint := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   prefix + "/api/" + project + "/envelope/",
+	}
+
+	return &sentryReporter{
+		dsn:      dsn,
+		endpoint: endpoint.String(),
+		key:      u.User.Username(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// sentryEvent is the subset of the Sentry event payload that is sent.
+type sentryEvent struct {
+	EventID    string            `json:"event_id"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Level      string            `json:"level"`
+	Platform   string            `json:"platform"`
+	Logger     string            `json:"logger"`
+	ServerName string            `json:"server_name,omitempty"`
+	Message    string            `json:"message"`
+	Tags       map[string]string `json:"tags"`
+	Exception  struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (r *sentryReporter) ReportError(name string, err error) {
+	go func() {
+		if err := r.send(name, err); err != nil {
+			log.Printf("failed to report error to Sentry: %v", err)
+		}
+	}()
+}
+
+func (r *sentryReporter) send(name string, reported error) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	event := sentryEvent{
+		EventID:   hex.EncodeToString(id),
+		Timestamp: time.Now().UTC(),
+		Level:     "error",
+		Platform:  "go",
+		Logger:    "notion-ical",
+		Message:   fmt.Sprintf("failed to refresh feed %s: %v", name, reported),
+		Tags:      map[string]string{"feed": name},
+	}
+	event.ServerName, _ = os.Hostname()
+	// Group events by the innermost error, such as a sentinel error
+	inner := reported
+	for errors.Unwrap(inner) != nil {
+		inner = errors.Unwrap(inner)
+	}
+	event.Exception.Values = []sentryException{{
+		Type:  fmt.Sprintf("%T", inner),
+		Value: reported.Error(),
+	}}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"dsn":      r.dsn,
+		"sent_at":  event.Timestamp.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteString("\n{\"type\":\"event\"}\n")
+	body.Write(payload)
+	body.WriteString("\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=notion-ical/1.0, sentry_key="+r.key)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
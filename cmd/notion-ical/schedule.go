@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleTick is how often the refresh schedules of feeds are checked.
+const scheduleTick = 5 * time.Second
+
+// schedule is when a feed is refreshed in the background.
+type schedule interface {
+	// next returns the first refresh after t, or the zero time when there
+	// is none.
+	next(t time.Time) time.Time
+}
+
+// parseSchedule parses an interval such as "15m", or a cron expression such
+// as "0 6 * * *".
+func parseSchedule(s string) (schedule, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid refresh %q: interval should be at least 1s", s)
+		}
+		return intervalSchedule(d), nil
+	}
+	c, err := parseCron(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh %q: %w", s, err)
+	}
+	return c, nil
+}
+
+// intervalSchedule refreshes at a fixed interval.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule refreshes at the times matching the minute, hour, day of
+// month, month and day of week fields of a cron expression, in local time.
+// Each field is a set of bits of the values that match.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAll and dowAll are set when the day fields are "*". Like cron,
+	// when both are restricted, days matching either field match.
+	domAll, dowAll bool
+}
+
+// cronDescriptors are the shorthands of cron expressions.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCron(s string) (cronSchedule, error) {
+	var c cronSchedule
+
+	if expr, ok := cronDescriptors[s]; ok {
+		s = expr
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("expected an interval such as \"15m\" or a cron expression such as \"0 6 * * *\"")
+	}
+
+	var err error
+	for _, f := range []struct {
+		field    string
+		min, max int
+		set      *uint64
+	}{
+		{fields[0], 0, 59, &c.minute},
+		{fields[1], 0, 23, &c.hour},
+		{fields[2], 1, 31, &c.dom},
+		{fields[3], 1, 12, &c.month},
+		{fields[4], 0, 7, &c.dow},
+	} {
+		if *f.set, err = parseCronField(f.field, f.min, f.max); err != nil {
+			return c, err
+		}
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAll = fields[2] == "*"
+	c.dowAll = fields[4] == "*"
+
+	if c.next(time.Now()).IsZero() {
+		return c, fmt.Errorf("cron expression %q never matches", s)
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges such as
+// "1-5" and steps such as "*/15" or "0-30/10".
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		r, step, hasStep := strings.Cut(part, "/")
+		every := 1
+		if hasStep {
+			n, err := strconv.Atoi(step)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			every = n
+		}
+
+		lo, hi := min, max
+		if r != "*" {
+			from, to, isRange := strings.Cut(r, "-")
+			var err error
+			lo, err = strconv.Atoi(from)
+			if err != nil {
+				return 0, fmt.Errorf("invalid cron field %q", field)
+			}
+			switch {
+			case isRange:
+				hi, err = strconv.Atoi(to)
+				if err != nil {
+					return 0, fmt.Errorf("invalid cron field %q", field)
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron field %q out of range %d-%d", field, min, max)
+		}
+
+		for v := lo; v <= hi; v += every {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Local()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+
+	// Give up on expressions that never match, such as February 30
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAll && c.dowAll:
+		return true
+	case c.domAll:
+		return dow
+	case c.dowAll:
+		return dom
+	default:
+		return dom || dow
+	}
+}
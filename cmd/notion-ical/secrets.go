@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Schemes of references to secrets in secret managers, which can be given
+// instead of API keys and passwords, such as "vault://secret/data/notion#api_key".
+const (
+	secretSchemeVault = "vault://"
+	secretSchemeAWS   = "awssm://"
+	secretSchemeGCP   = "gcpsm://"
+)
+
+var secretClient = &http.Client{Timeout: 30 * time.Second}
+
+var (
+	// gcpSecretManagerURL and gcpMetadataTokenURL are the endpoints of GCP
+	// Secret Manager and of the tokens of the default service account
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	// awsContainerCredentialsURL and awsMetadataURL are the endpoints of the
+	// credentials of ECS tasks and of the instance metadata of EC2
+	awsContainerCredentialsURL = "http://169.254.170.2"
+	awsMetadataURL             = "http://169.254.169.254"
+)
+
+// isSecretReference reports whether value refers to a secret in a secret
+// manager.
+func isSecretReference(value string) bool {
+	for _, scheme := range []string{secretSchemeVault, secretSchemeAWS, secretSchemeGCP} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecret reads the secret that value refers to, or returns value
+// when it is not a reference. The fragment of a reference selects a field
+// of secrets that are JSON objects, such as "#api_key".
+func resolveSecret(ctx context.Context, value string) (string, error) {
+	if !isSecretReference(value) {
+		return value, nil
+	}
+
+	ref, field, _ := strings.Cut(value, "#")
+	var secret []byte
+	var err error
+	switch {
+	case strings.HasPrefix(ref, secretSchemeVault):
+		secret, err = readVaultSecret(ctx, strings.TrimPrefix(ref, secretSchemeVault), field)
+		field = ""
+	case strings.HasPrefix(ref, secretSchemeAWS):
+		secret, err = readAWSSecret(ctx, strings.TrimPrefix(ref, secretSchemeAWS))
+	case strings.HasPrefix(ref, secretSchemeGCP):
+		secret, err = readGCPSecret(ctx, strings.TrimPrefix(ref, secretSchemeGCP))
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret %s: %w", ref, err)
+	}
+
+	if field == "" {
+		return strings.TrimSpace(string(secret)), nil
+	}
+	s, err := secretField(secret, field)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret %s: %w", ref, err)
+	}
+	return s, nil
+}
+
+// secretField reads a string field of a secret that is a JSON object.
+func secretField(secret []byte, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(secret, &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object for field %q", field)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	return value, nil
+}
+
+// readVaultSecret reads a field of a secret of HashiCorp Vault at path, such
+// as "secret/data/notion" of a KV version 2 engine. The address and token
+// are read like the Vault CLI, from VAULT_ADDR and VAULT_TOKEN or
+// ~/.vault-token. The field may be empty for secrets with one field.
+func readVaultSecret(ctx context.Context, path, field string) ([]byte, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = "https://127.0.0.1:8200"
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("VAULT_TOKEN not set")
+		}
+		b, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err != nil {
+			return nil, fmt.Errorf("VAULT_TOKEN not set")
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	var response struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := doSecretRequest(req, &response); err != nil {
+		return nil, err
+	}
+
+	// KV version 2 nests the fields of the secret in data
+	data := response.Data
+	if nested, ok := data["data"]; ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			return nil, fmt.Errorf("secret has %d fields, choose one such as %s#api_key", len(data), path)
+		}
+		for name := range data {
+			field = name
+		}
+	}
+	var value string
+	if err := json.Unmarshal(data[field], &value); err != nil {
+		return nil, fmt.Errorf("secret has no field %q", field)
+	}
+	return []byte(value), nil
+}
+
+// readAWSSecret reads a secret of AWS Secrets Manager by name or ARN, with
+// the credentials of readAWSCredentials. The region is read from AWS_REGION
+// or AWS_DEFAULT_REGION, the region of an ARN, the AWS config file, or the
+// instance metadata of EC2.
+func readAWSSecret(ctx context.Context, id string) ([]byte, error) {
+	credentials, err := readAWSCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	region := os.Getenv("AWS_REGION")
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = readAWSConfig("config", "profile "+awsProfile())["region"]
+	}
+	if region == "" {
+		region, _ = readAWSMetadata(ctx, "placement/region")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("AWS_REGION not set")
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+	signAWSRequest(req, body, credentials.accessKey, credentials.secretKey, region, "secretsmanager", time.Now())
+
+	var response struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+	}
+	if err := doSecretRequest(req, &response); err != nil {
+		return nil, err
+	}
+	if response.SecretString == "" {
+		return response.SecretBinary, nil
+	}
+	return []byte(response.SecretString), nil
+}
+
+// awsCredentials are the credentials of requests to AWS.
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// readAWSCredentials reads credentials like the default credential chain of
+// the AWS SDKs, from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, the shared credentials file of AWS_PROFILE, the role of
+// an ECS task, or the role of an EC2 instance. Single sign-on, web
+// identities and roles assumed by profiles are not supported.
+func readAWSCredentials(ctx context.Context) (awsCredentials, error) {
+	credentials := awsCredentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.accessKey != "" && credentials.secretKey != "" {
+		return credentials, nil
+	}
+
+	profile := readAWSConfig("credentials", awsProfile())
+	credentials = awsCredentials{
+		accessKey:    profile["aws_access_key_id"],
+		secretKey:    profile["aws_secret_access_key"],
+		sessionToken: profile["aws_session_token"],
+	}
+	if credentials.accessKey != "" && credentials.secretKey != "" {
+		return credentials, nil
+	}
+
+	var response struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	var err error
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		err = readAWSContainerCredentials(ctx, awsContainerCredentialsURL+uri, &response)
+	} else if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		err = readAWSContainerCredentials(ctx, uri, &response)
+	} else {
+		var role string
+		role, err = readAWSMetadata(ctx, "iam/security-credentials/")
+		if err == nil {
+			var b string
+			role, _, _ = strings.Cut(strings.TrimSpace(role), "\n")
+			b, err = readAWSMetadata(ctx, "iam/security-credentials/"+role)
+			if err == nil {
+				err = json.Unmarshal([]byte(b), &response)
+			}
+		}
+	}
+	if err == nil && response.AccessKeyID == "" {
+		err = errors.New("no access key")
+	}
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY not set, no profile %s in the AWS credentials file, and no credentials of an ECS task or EC2 instance: %w", awsProfile(), err)
+	}
+	return awsCredentials{
+		accessKey:    response.AccessKeyID,
+		secretKey:    response.SecretAccessKey,
+		sessionToken: response.Token,
+	}, nil
+}
+
+// awsProfile is the profile of the AWS config and credentials files.
+func awsProfile() string {
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// readAWSConfig reads a section of the AWS config or credentials file in
+// ~/.aws, or at AWS_CONFIG_FILE or AWS_SHARED_CREDENTIALS_FILE. The default
+// profile of the config file is in the section "default" instead of
+// "profile default".
+func readAWSConfig(file, section string) map[string]string {
+	path := os.Getenv("AWS_CONFIG_FILE")
+	if file == "credentials" {
+		path = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, ".aws", file)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if section == "profile default" {
+		section = "default"
+	}
+
+	values := make(map[string]string)
+	current := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && current == section {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// readAWSContainerCredentials reads the credentials of the role of an ECS
+// task, or another container credentials provider.
+func readAWSContainerCredentials(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return doSecretRequest(req, v)
+}
+
+// readAWSMetadata reads a path of the instance metadata of EC2, such as
+// "placement/region", with a session token of IMDSv2. Instances outside of
+// EC2 fail quickly.
+func readAWSMetadata(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, awsMetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "60")
+	token, err := doAWSMetadataRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, awsMetadataURL+"/latest/meta-data/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	return doAWSMetadataRequest(req)
+}
+
+func doAWSMetadataRequest(req *http.Request) (string, error) {
+	res, err := secretClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	return string(b), nil
+}
+
+// signAWSRequest signs a request with AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Headers are signed in order of their names
+	names := []string{"content-type", "host", "x-amz-date"}
+	for _, name := range []string{"x-amz-security-token", "x-amz-target"} {
+		if req.Header.Get(name) != "" {
+			names = append(names, name)
+		}
+	}
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// readGCPSecret reads a version of a secret of GCP Secret Manager, such as
+// "projects/my-project/secrets/notion", which is the latest version unless
+// given, such as ".../versions/3". The access token is read from
+// GOOGLE_OAUTH_ACCESS_TOKEN, or the metadata server of the instance.
+func readGCPSecret(ctx context.Context, name string) ([]byte, error) {
+	name = strings.Trim(name, "/")
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		var response struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := doSecretRequest(req, &response); err != nil {
+			return nil, fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN not set, and unable to get a token from the metadata server: %w", err)
+		}
+		token = response.AccessToken
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretManagerURL+name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var response struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doSecretRequest(req, &response); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response.Payload.Data)
+}
+
+// doSecretRequest sends a request to a secret manager and decodes its JSON
+// response.
+func doSecretRequest(req *http.Request, v any) error {
+	res, err := secretClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Requests and signatures of the AWS Signature Version 4 test suite and
+// documentation, signed with its example credentials.
+func TestSignAWSRequest(t *testing.T) {
+	const (
+		accessKey = "AKIDEXAMPLE"
+		secretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		service     string
+		want        string
+	}{
+		{
+			name:        "post-x-www-form-urlencoded",
+			method:      http.MethodPost,
+			url:         "https://example.amazonaws.com/",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "Param1=value1",
+			service:     "service",
+			want:        "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+		{
+			name:        "iam ListUsers",
+			method:      http.MethodGet,
+			url:         "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			service:     "iam",
+			want:        "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", test.contentType)
+			signAWSRequest(req, []byte(test.body), accessKey, secretKey, "us-east-1", test.service, now)
+
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q, want %q", got, "20150830T123600Z")
+			}
+			if got := req.Header.Get("Authorization"); got != test.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadAWSCredentials(t *testing.T) {
+	// Credentials of ECS tasks and of EC2 instances, which requires a
+	// session token
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/task" && r.Header.Get("Authorization") == "task-token":
+			io.WriteString(w, `{"AccessKeyId":"ASIATASK","SecretAccessKey":"task-secret","Token":"task-session"}`)
+		case r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			io.WriteString(w, "imds-token")
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			io.WriteString(w, "web\n")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/web":
+			io.WriteString(w, `{"AccessKeyId":"ASIAINSTANCE","SecretAccessKey":"instance-secret","Token":"instance-session"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer metadata.Close()
+	defer func(container, instance string) {
+		awsContainerCredentialsURL, awsMetadataURL = container, instance
+	}(awsContainerCredentialsURL, awsMetadataURL)
+	awsContainerCredentialsURL, awsMetadataURL = metadata.URL, metadata.URL
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(credentialsFile, []byte("[default]\naws_access_key_id = AKIADEFAULT\naws_secret_access_key = default-secret\n\n"+
+		"# Work account\n[work]\naws_access_key_id=AKIAWORK\naws_secret_access_key=work-secret\naws_session_token=work-session\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want awsCredentials
+	}{
+		{"environment", map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENV", "AWS_SECRET_ACCESS_KEY": "env-secret"}, awsCredentials{"AKIAENV", "env-secret", ""}},
+		{"default profile", map[string]string{"AWS_SHARED_CREDENTIALS_FILE": credentialsFile}, awsCredentials{"AKIADEFAULT", "default-secret", ""}},
+		{"profile", map[string]string{"AWS_SHARED_CREDENTIALS_FILE": credentialsFile, "AWS_PROFILE": "work"}, awsCredentials{"AKIAWORK", "work-secret", "work-session"}},
+		{"ecs task", map[string]string{"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/task", "AWS_CONTAINER_AUTHORIZATION_TOKEN": "task-token"}, awsCredentials{"ASIATASK", "task-secret", "task-session"}},
+		{"ec2 instance", nil, awsCredentials{"ASIAINSTANCE", "instance-secret", "instance-session"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"} {
+				t.Setenv(name, test.env[name])
+			}
+			got, err := readAWSCredentials(context.Background())
+			if err != nil {
+				t.Fatalf("readAWSCredentials() = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("readAWSCredentials() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadAWSConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte("[default]\nregion = us-east-1\n[profile work]\nregion = eu-west-1\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+
+	for profile, want := range map[string]string{"default": "us-east-1", "work": "eu-west-1", "other": ""} {
+		if got := readAWSConfig("config", "profile "+profile)["region"]; got != want {
+			t.Errorf("region of profile %s = %q, want %q", profile, got, want)
+		}
+	}
+}
@@ -0,0 +1,898 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arran4/golang-ical"
+	"github.com/serverwentdown/notion-ical"
+)
+
+// server serves a source as an iCal feed, converting at most once per cache
+// duration.
+type server struct {
+	name   string
+	config feedConfig
+	source notion_ical.Source
+	// events shares the events read from source between the feed and the
+	// free/busy feed
+	events *notion_ical.CachedSource
+	cache  time.Duration
+	// options are applied when converting the source
+	options []notion_ical.ConvertOption
+	// reporter receives refresh failures when set
+	reporter errorReporter
+	// schedule refreshes the feeds in the background when set
+	schedule schedule
+	// stream receives the changes of refreshed feeds when set
+	stream *changeStream
+	// warnings are collected by the source while it is read, when set
+	warnings *notion_ical.Warnings
+
+	mu       sync.Mutex
+	feed     feedCache
+	freeBusy feedCache
+	// eventsFile persists the events of the feeds across restarts when set
+	eventsFile string
+	// persisted are the events last written to or read from eventsFile,
+	// which feeds are converted from until they are refreshed
+	persisted *persistedEvents
+	// nextRefresh is the next refresh on schedule
+	nextRefresh time.Time
+
+	statsMu sync.Mutex
+	stats   feedStats
+}
+
+// feed is a converted calendar.
+type feed struct {
+	ics       []byte
+	etag      string
+	refreshed time.Time
+	calendar  *ics.Calendar
+	events    int
+	// read are the events that the feed was converted from
+	read []notion_ical.Event
+	// loaded is set when the feed was converted from events read from disk
+	loaded bool
+	// failed is the error of the last refresh when a stale feed is served
+	failed error
+	// duration is how long the conversion of the feed took
+	duration time.Duration
+	// result is how the feed was served from the cache
+	result cacheResult
+	// warnings are the non-fatal issues of the read of the events
+	warnings []notion_ical.Warning
+	// objects are the CalDAV objects of the calendar, split once when first
+	// needed and shared by copies of the feed
+	objects *caldavObjectsOnce
+}
+
+// cacheResult describes how a feed was served from the cache, in the
+// X-Cache header.
+type cacheResult string
+
+const (
+	cacheHit  cacheResult = "HIT"
+	cacheMiss cacheResult = "MISS"
+	// cacheStale is an expired feed, served while refreshing or because the
+	// refresh failed
+	cacheStale cacheResult = "STALE"
+)
+
+// staleWarning is the Warning header of stale feeds served because Notion
+// could not be reached.
+const staleWarning = `111 - "Revalidation Failed"`
+
+// feedCache holds the latest feed of one kind.
+type feedCache struct {
+	feed *feed
+	// refreshing is closed when the refresh of the feed in progress
+	// completes, and is nil when the feed is not being refreshed
+	refreshing chan struct{}
+	// failed is the error of the last refresh, until a refresh succeeds
+	failed error
+}
+
+// served returns a copy of the feed as served with result, marked as stale
+// when the last refresh failed.
+func (c *feedCache) served(result cacheResult) *feed {
+	f := *c.feed
+	f.failed = c.failed
+	f.result = result
+	return &f
+}
+
+func newServer(name string, config feedConfig, source notion_ical.Source, cache time.Duration, options []notion_ical.ConvertOption) *server {
+	events := notion_ical.NewCachedSource(source, cache)
+	return &server{
+		name:    name,
+		config:  config,
+		source:  events,
+		events:  events,
+		cache:   cache,
+		options: options,
+	}
+}
+
+// get returns the cached feed, refreshing it when it has expired.
+func (s *server) get(ctx context.Context) (*feed, error) {
+	return s.cached(ctx, &s.feed, s.options)
+}
+
+// getFreeBusy returns the cached free/busy feed, refreshing it when it has
+// expired.
+func (s *server) getFreeBusy(ctx context.Context) (*feed, error) {
+	return s.cached(ctx, &s.freeBusy, s.freeBusyOptions())
+}
+
+func (s *server) freeBusyOptions() []notion_ical.ConvertOption {
+	return append(append([]notion_ical.ConvertOption{}, s.options...), notion_ical.WithFreeBusy())
+}
+
+// cached returns the feed in c, converting it again with opts when it has
+// expired. A feed converted from events read from disk, already being
+// refreshed, or that failed to refresh is returned immediately while it is
+// refreshed in the background. Otherwise, requests wait for a single
+// refresh without holding s.mu. When a refresh fails, the last feed is
+// returned as stale instead of an error.
+func (s *server) cached(ctx context.Context, c *feedCache, opts []notion_ical.ConvertOption) (*feed, error) {
+	s.mu.Lock()
+	if c.feed == nil && s.persisted != nil {
+		s.loadFeed(c, opts)
+	}
+
+	if c.feed != nil && time.Since(c.feed.refreshed) < s.cache {
+		defer s.mu.Unlock()
+		s.recordCacheResult(cacheHit)
+		return c.served(cacheHit), nil
+	}
+
+	if c.feed != nil && (c.feed.loaded || c.refreshing != nil || c.failed != nil) {
+		defer s.mu.Unlock()
+		s.startRefresh(c, opts)
+		s.recordCacheResult(cacheStale)
+		return c.served(cacheStale), nil
+	}
+
+	done := s.startRefresh(c, opts)
+	s.mu.Unlock()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.failed != nil {
+		if c.feed == nil {
+			return nil, c.failed
+		}
+		s.recordCacheResult(cacheStale)
+		return c.served(cacheStale), nil
+	}
+	s.recordCacheResult(cacheMiss)
+	return c.served(cacheMiss), nil
+}
+
+// startRefresh refreshes the feed in c in the background, unless it is
+// already being refreshed, and returns a channel closed when the refresh
+// completes. s.mu must be held.
+func (s *server) startRefresh(c *feedCache, opts []notion_ical.ConvertOption) chan struct{} {
+	if c.refreshing != nil {
+		return c.refreshing
+	}
+	done := make(chan struct{})
+	c.refreshing = done
+	go s.refreshInBackground(c, opts, done)
+	return done
+}
+
+// warm refreshes feeds in the background when they would expire within
+// interval. The free/busy feed is only kept warm once it has been requested.
+func (s *server) warm(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feedDue := s.feed.feed == nil || time.Since(s.feed.feed.refreshed)+interval >= s.cache
+	freeBusyDue := s.freeBusy.feed != nil && time.Since(s.freeBusy.feed.refreshed)+interval >= s.cache
+	if (feedDue && s.feed.refreshing == nil) || (freeBusyDue && s.freeBusy.refreshing == nil) {
+		// Refresh before the events read for the feeds expire
+		s.events.Expire()
+	}
+
+	if feedDue {
+		s.startRefresh(&s.feed, s.options)
+	}
+	if freeBusyDue {
+		s.startRefresh(&s.freeBusy, s.freeBusyOptions())
+	}
+}
+
+// refreshScheduled refreshes the feeds in the background when their refresh
+// on schedule is due at now. The free/busy feed is only refreshed once it
+// has been requested.
+func (s *server) refreshScheduled(now time.Time) {
+	if s.schedule == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nextRefresh.IsZero() {
+		s.nextRefresh = s.schedule.next(now)
+		return
+	}
+	if now.Before(s.nextRefresh) {
+		return
+	}
+	s.nextRefresh = s.schedule.next(now)
+
+	if s.feed.refreshing == nil || (s.freeBusy.feed != nil && s.freeBusy.refreshing == nil) {
+		// Read the events again instead of the cached events
+		s.events.Expire()
+	}
+	s.startRefresh(&s.feed, s.options)
+	if s.freeBusy.feed != nil {
+		s.startRefresh(&s.freeBusy, s.freeBusyOptions())
+	}
+}
+
+// warmInterval is how long before a cache expires that feeds are refreshed
+// when warming.
+func warmInterval(cache time.Duration) time.Duration {
+	interval := cache / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// refreshInBackground refreshes the feed in c without blocking requests,
+// and closes done when the feed or the error of the refresh is stored.
+func (s *server) refreshInBackground(c *feedCache, opts []notion_ical.ConvertOption, done chan struct{}) {
+	f, err := s.refresh(context.Background(), opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer close(done)
+	c.refreshing = nil
+	if err != nil {
+		log.Printf("failed to refresh feed %s: %v", s.name, err)
+		c.failed = err
+		return
+	}
+	s.store(c, f)
+}
+
+// store replaces the feed in c, and writes its events to disk when
+// persisted. s.mu must be held.
+func (s *server) store(c *feedCache, f *feed) {
+	c.feed = f
+	c.failed = nil
+	if c == &s.feed && s.stream != nil {
+		s.stream.publish(s.name, f)
+	}
+	if s.eventsFile == "" {
+		return
+	}
+	s.persisted = &persistedEvents{events: f.read, read: f.refreshed}
+	b, err := notion_ical.MarshalEvents(f.read)
+	if err == nil {
+		err = writeFileAtomic(s.eventsFile, b)
+	}
+	if err != nil {
+		log.Printf("failed to persist events of feed %s: %v", s.name, err)
+	}
+}
+
+// loadFeed converts the feed in c from the persisted events, to serve it
+// until it is refreshed. s.mu must be held.
+func (s *server) loadFeed(c *feedCache, opts []notion_ical.ConvertOption) {
+	f, err := s.convertEvents(s.persisted.events, s.persisted.read, opts)
+	if err != nil {
+		log.Printf("failed to convert persisted events of feed %s: %v", s.name, err)
+		return
+	}
+	f.loaded = true
+	c.feed = f
+}
+
+func (s *server) refresh(ctx context.Context, opts []notion_ical.ConvertOption) (*feed, error) {
+	start := time.Now()
+	f, err := s.convert(ctx, opts)
+	if err == nil && s.config.Validate {
+		if err = validateCalendar(s.name, f.ics); err != nil {
+			f = nil
+		}
+	}
+	if f != nil {
+		f.duration = time.Since(start)
+		f.warnings = s.warnings.List()
+	}
+	s.recordRefresh(f, err, time.Since(start))
+	if err != nil && s.reporter != nil {
+		s.reporter.ReportError(s.name, err)
+	}
+	return f, err
+}
+
+// persistedEvents are events kept across restarts, and when they were read.
+type persistedEvents struct {
+	events []notion_ical.Event
+	read   time.Time
+}
+
+// persist keeps the events of the feeds in dir across restarts, and loads
+// the events previously written there. Every format of the feed is
+// converted from them until it is refreshed.
+func (s *server) persist(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eventsFile = filepath.Join(dir, sanitizeFilename(s.name)+".events.json")
+	persisted, err := loadEvents(s.eventsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Printf("failed to load persisted events of feed %s: %v", s.name, err)
+		return
+	}
+	s.persisted = persisted
+	s.loadFeed(&s.feed, s.options)
+}
+
+// loadEvents reads persisted events, which were read when they were
+// written.
+func loadEvents(path string) (*persistedEvents, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := notion_ical.UnmarshalEvents(b)
+	if err != nil {
+		return nil, err
+	}
+	return &persistedEvents{events: events, read: info.ModTime()}, nil
+}
+
+// writeFileAtomic writes a file through a temporary file, so that readers
+// never see a partial file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// convertFeed converts the source and parses the result, so that it can be
+// split into individual events.
+func convertFeed(ctx context.Context, source notion_ical.Source, opts ...notion_ical.ConvertOption) (*feed, error) {
+	var buf bytes.Buffer
+	if err := notion_ical.ConvertContext(ctx, source, &buf, opts...); err != nil {
+		return nil, err
+	}
+	return newFeed(buf.Bytes(), time.Now())
+}
+
+// convert reads the events of the source and converts them into a feed.
+func (s *server) convert(ctx context.Context, opts []notion_ical.ConvertOption) (*feed, error) {
+	events, err := notion_ical.ReadAll(ctx, s.source)
+	if err != nil {
+		return nil, err
+	}
+	return s.convertEvents(events, time.Now(), opts)
+}
+
+// convertEvents converts events that were read at refreshed into a feed.
+func (s *server) convertEvents(events []notion_ical.Event, refreshed time.Time, opts []notion_ical.ConvertOption) (*feed, error) {
+	var buf bytes.Buffer
+	opts = append([]notion_ical.ConvertOption{notion_ical.WithCalendarName(s.source.Name())}, opts...)
+	if err := notion_ical.ConvertEvents(events, &buf, opts...); err != nil {
+		return nil, err
+	}
+	f, err := newFeed(buf.Bytes(), refreshed)
+	if err != nil {
+		return nil, err
+	}
+	f.read = events
+	return f, nil
+}
+
+// newFeed parses a converted calendar.
+func newFeed(b []byte, refreshed time.Time) (*feed, error) {
+	calendar, err := ics.ParseCalendar(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return &feed{
+		ics:       b,
+		etag:      hashETag(b),
+		refreshed: refreshed,
+		calendar:  calendar,
+		events:    countEvents(calendar),
+		objects:   &caldavObjectsOnce{},
+	}, nil
+}
+
+// countEvents counts the events and tasks in a calendar.
+func countEvents(calendar *ics.Calendar) int {
+	n := 0
+	for _, component := range calendar.Components {
+		switch component.(type) {
+		case *ics.VEvent, *ics.VTodo:
+			n += 1
+		}
+	}
+	return n
+}
+
+func (s *server) handleICS(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, s.get, "")
+}
+
+func (s *server) handleFreeBusy(w http.ResponseWriter, r *http.Request) {
+	s.serveFeed(w, r, s.getFreeBusy, " Free Busy")
+}
+
+// handleJSONFeed serves the events of the feed as a JSON Feed, from the
+// events the calendar was converted from.
+func (s *server) handleJSONFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	setAccessFeed(r, s.name)
+
+	f, err := s.get(r.Context())
+	if err != nil {
+		log.Printf("failed to refresh feed %s: %v", s.name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	opts := append([]notion_ical.ConvertOption{notion_ical.WithCalendarName(s.source.Name())}, s.options...)
+	if err := notion_ical.ConvertJSONFeedEvents(f.read, &buf, opts...); err != nil {
+		log.Printf("failed to convert feed %s: %v", s.name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json")
+	w.Header().Set("ETag", hashETag(buf.Bytes()))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// serveFeed serves the feed returned by get.
+func (s *server) serveFeed(w http.ResponseWriter, r *http.Request, get func(context.Context) (*feed, error), suffix string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	setAccessFeed(r, s.name)
+
+	f, err := get(r.Context())
+	if err != nil {
+		log.Printf("failed to refresh feed %s: %v", s.name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", f.etag)
+	w.Header().Set("Content-Disposition", contentDisposition(calendarFilename(s.source.Name(), suffix)))
+	if cacheControl, maxAge, err := s.config.cacheControl(); err == nil && cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+	}
+	if f.failed != nil {
+		w.Header().Set("Warning", staleWarning)
+	}
+	if s.config.WarningsHeader && len(f.warnings) > 0 {
+		w.Header().Set("X-Warnings", warningsHeader(f.warnings))
+	}
+	setCacheHeaders(w, f)
+	http.ServeContent(w, r, "", f.refreshed, bytes.NewReader(f.ics))
+}
+
+// setCacheHeaders describes how the feed was served from the cache, to debug
+// caching.
+func setCacheHeaders(w http.ResponseWriter, f *feed) {
+	if f.result != "" {
+		w.Header().Set("X-Cache", string(f.result))
+	}
+	w.Header().Set("X-Cache-Age", strconv.Itoa(int(time.Since(f.refreshed).Seconds())))
+	if f.duration > 0 {
+		w.Header().Set("X-Refresh-Duration", f.duration.Round(time.Microsecond).String())
+	}
+}
+
+// contentDisposition suggests a file name for downloads of a feed.
+func contentDisposition(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+func hashETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// defaultFeedName is the name of the feed when serving global flags instead
+// of a configuration file.
+const defaultFeedName = "calendar"
+
+// router dispatches requests to the servers of each feed. Feeds can be
+// replaced while serving without interrupting in-flight requests.
+type router struct {
+	caldav bool
+	cache  time.Duration
+	// statusPassword enables the status page when set
+	statusPassword string
+	// pprof serves profiles behind the status password when set
+	pprof bool
+	// html serves feeds as HTML calendars to browsers when set
+	html bool
+	// reporter receives refresh failures when set
+	reporter errorReporter
+
+	mu    sync.RWMutex
+	feeds map[string]*server
+	// single is set when serving only the feed from global flags, which is
+	// also served at /
+	single bool
+	// dynamic serves databases looked up on demand when set
+	dynamic *dynamicFeeds
+	// proxy converts databases with the API key of each request when set
+	proxy *proxyConverter
+	// cacheDir persists feeds across restarts when set
+	cacheDir string
+	// notion checks that the Notion API can be reached, for /readyz
+	notion *notionCheck
+	// stream sends the changes of feeds to clients of /events/stream when
+	// set
+	stream *changeStream
+	// streamOrigins are the origins of other sites allowed to follow feeds
+	// with WebSocket
+	streamOrigins []string
+}
+
+func newRouter(cache time.Duration, caldav bool) *router {
+	return &router{
+		caldav: caldav,
+		cache:  cache,
+		feeds:  make(map[string]*server),
+		notion: newNotionCheck(),
+	}
+}
+
+// newServer creates a server for a feed, persisting it in the cache
+// directory and reporting its errors when set.
+func (rt *router) newServer(name string, config feedConfig, source notion_ical.Source, options []notion_ical.ConvertOption) *server {
+	// Configuration files are checked when read
+	cache, err := config.cacheDuration(rt.cache)
+	if err != nil {
+		cache = rt.cache
+	}
+	s := newServer(name, config, source, cache, options)
+	s.schedule, _ = config.refreshSchedule()
+	s.reporter = rt.reporter
+	s.stream = rt.stream
+	if rt.cacheDir != "" {
+		s.persist(rt.cacheDir)
+	}
+	return s
+}
+
+// server looks up the server of a feed.
+func (rt *router) server(name string) *server {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.feeds[name]
+}
+
+// servers lists the servers of all feeds, including requested database
+// feeds, sorted by name.
+func (rt *router) servers() []*server {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	servers := make([]*server, 0, len(rt.feeds))
+	for _, s := range rt.feeds {
+		servers = append(servers, s)
+	}
+	if rt.dynamic != nil {
+		servers = append(servers, rt.dynamic.list()...)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].name < servers[j].name
+	})
+	return servers
+}
+
+// load replaces the served feeds with the configuration. Servers of feeds
+// with unchanged configuration are kept, along with their cache.
+func (rt *router) load(config serveConfig) error {
+	rt.mu.RLock()
+	current := rt.feeds
+	rt.mu.RUnlock()
+
+	feeds := make(map[string]*server, len(config.Feeds))
+	for _, fc := range config.Feeds {
+		if existing, ok := current[fc.Name]; ok && existing.config.equal(fc) {
+			feeds[fc.Name] = existing
+			continue
+		}
+
+		warnings := &notion_ical.Warnings{}
+		source, err := fc.sourceWith(true, nil, warnings)
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", fc.Name, err)
+		}
+		options, err := fc.convertOptions()
+		if err != nil {
+			return fmt.Errorf("feed %s: %w", fc.Name, err)
+		}
+		s := rt.newServer(fc.Name, fc, source, options)
+		s.warnings = warnings
+		feeds[fc.Name] = s
+
+		if _, ok := current[fc.Name]; ok {
+			log.Printf("Modified feed %s", fc.Name)
+		} else {
+			log.Printf("Added feed %s", fc.Name)
+		}
+	}
+	for name := range current {
+		if _, ok := feeds[name]; !ok {
+			log.Printf("Removed feed %s", name)
+			if rt.stream != nil {
+				rt.stream.remove(name)
+			}
+		}
+	}
+
+	rt.mu.Lock()
+	rt.feeds = feeds
+	rt.mu.Unlock()
+
+	if rt.dynamic != nil {
+		rt.dynamic.setKeys(config.databaseKeys())
+	}
+
+	return nil
+}
+
+// warm keeps the feeds of every server fresh in the background, so that
+// requests never wait for a refresh. Proxied databases are not cached, so
+// they are not warmed.
+func (rt *router) warm() {
+	for {
+		wait := warmInterval(rt.cache)
+		for _, s := range rt.servers() {
+			interval := warmInterval(s.cache)
+			s.warm(interval)
+			if interval < wait {
+				wait = interval
+			}
+		}
+		time.Sleep(wait)
+	}
+}
+
+// refreshScheduled refreshes the feeds with a refresh schedule in the
+// background.
+func (rt *router) refreshScheduled() {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, s := range rt.servers() {
+			s.refreshScheduled(now)
+		}
+	}
+}
+
+// watchConfig reloads the configuration file on SIGHUP, or when its
+// modification time changes.
+func (rt *router) watchConfig(path string, defaultAPIKey string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+
+	for {
+		select {
+		case <-hup:
+			log.Printf("Received SIGHUP, reloading %s", path)
+			if info, err := os.Stat(path); err == nil {
+				modified = info.ModTime()
+			}
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			log.Printf("Config file changed, reloading %s", path)
+		}
+
+		config, err := readServeConfig(path, defaultAPIKey)
+		if err != nil {
+			log.Printf("failed to reload config: %v", err)
+			continue
+		}
+		if err := rt.load(config); err != nil {
+			log.Printf("failed to reload config: %v", err)
+		}
+	}
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+
+	switch p {
+	case "/healthz":
+		rt.handleHealth(w, r)
+		return
+	case "/readyz":
+		rt.handleReady(w, r)
+		return
+	}
+
+	if rt.stream != nil && p == streamPath {
+		rt.handleStream(w, r)
+		return
+	}
+
+	if p == "/status" && rt.statusPassword != "" {
+		requirePassword(rt.statusPassword, rt.handleStatus)(w, r)
+		return
+	}
+
+	if rt.pprof && strings.HasPrefix(p, pprofRoot) {
+		requirePassword(rt.statusPassword, handlePprof)(w, r)
+		return
+	}
+
+	if rt.caldav {
+		if p == "/.well-known/caldav" {
+			http.Redirect(w, r, caldavRoot, http.StatusMovedPermanently)
+			return
+		}
+		if p == caldavRoot {
+			rt.handleCalDAVRoot(w, r)
+			return
+		}
+		if strings.HasPrefix(p, caldavRoot) {
+			name, _, _ := strings.Cut(strings.TrimPrefix(p, caldavRoot), "/")
+			if s := rt.server(name); s != nil {
+				s.handleCalDAV(w, r)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	if rt.proxy != nil && strings.HasPrefix(p, proxyRoot) {
+		rt.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	if rt.dynamic != nil && strings.HasPrefix(p, dynamicRoot) {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(p, dynamicRoot), ".ics")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s, err := rt.dynamic.server(id)
+		if err != nil {
+			log.Printf("failed to open database feed: %v", err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		if s == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.handleICS(w, r)
+		return
+	}
+
+	if p == "/" && rt.single {
+		if s := rt.server(defaultFeedName); s != nil {
+			if rt.html && acceptsHTML(r) {
+				s.handleHTML(w, r)
+				return
+			}
+			s.handleICS(w, r)
+			return
+		}
+	}
+	if p == "/feed.json" && rt.single {
+		if s := rt.server(defaultFeedName); s != nil {
+			s.handleJSONFeed(w, r)
+			return
+		}
+	}
+	if p == "/freebusy.ics" && rt.single {
+		if s := rt.server(defaultFeedName); s != nil {
+			s.handleFreeBusy(w, r)
+			return
+		}
+	}
+
+	if name, ok := strings.CutSuffix(strings.TrimPrefix(p, "/"), "/freebusy.ics"); ok {
+		if s := rt.server(name); s != nil {
+			s.handleFreeBusy(w, r)
+			return
+		}
+	}
+
+	if name, ok := strings.CutSuffix(strings.TrimPrefix(p, "/"), ".json"); ok {
+		if s := rt.server(name); s != nil {
+			s.handleJSONFeed(w, r)
+			return
+		}
+	}
+
+	if name, ok := strings.CutSuffix(strings.TrimPrefix(p, "/"), ".html"); ok && rt.html {
+		if s := rt.server(name); s != nil {
+			s.handleHTML(w, r)
+			return
+		}
+	}
+
+	if name, ok := strings.CutSuffix(strings.TrimPrefix(p, "/"), ".ics"); ok {
+		if s := rt.server(name); s != nil {
+			s.handleICS(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+	"github.com/serverwentdown/notion-ical/notionicaltest"
+)
+
+// testSource is a small calendar with a timed, an all-day and a recurring
+// event.
+func testSource() *notionicaltest.Source {
+	standup := notionicaltest.TimedEvent("Standup", time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC), 15*time.Minute)
+	standup.Recurrence = "FREQ=WEEKLY;BYDAY=MO"
+	return notionicaltest.NewSource("Team",
+		standup,
+		notionicaltest.AllDayEvent("Offsite", 2024, time.April, 10, 3),
+		notionicaltest.WithProperties(
+			notionicaltest.TimedEvent("Review", time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Hour),
+			notionicaltest.Property{Name: "Owner", Value: "Ann"},
+		),
+	)
+}
+
+// newTestRouter serves source as the feed "team".
+func newTestRouter(t *testing.T, source notion_ical.Source) *router {
+	t.Helper()
+	rt := newRouter(time.Hour, false)
+	rt.feeds["team"] = rt.newServer("team", feedConfig{Name: "team"}, source, nil)
+	return rt
+}
+
+func serveTest(rt *router, method, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeFeeds(t *testing.T) {
+	tests := []struct {
+		path        string
+		contentType string
+		golden      string
+	}{
+		{"/team.ics", "text/calendar; charset=utf-8", "testdata/team.ics"},
+		{"/team/freebusy.ics", "text/calendar; charset=utf-8", "testdata/team_freebusy.ics"},
+		{"/team.json", "application/feed+json", "testdata/team.json"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rt := newTestRouter(t, testSource())
+
+			w := serveTest(rt, http.MethodGet, test.path, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, test.contentType)
+			}
+			notionicaltest.AssertGolden(t, test.golden, w.Body.Bytes())
+
+			etag := w.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("no ETag")
+			}
+			w = serveTest(rt, http.MethodGet, test.path, http.Header{"If-None-Match": {etag}})
+			if w.Code != http.StatusNotModified {
+				t.Errorf("status with If-None-Match = %d, want %d", w.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
+
+func TestServeCachesReads(t *testing.T) {
+	source := testSource()
+	rt := newTestRouter(t, source)
+
+	for _, path := range []string{"/team.ics", "/team.ics", "/team/freebusy.ics", "/team.json"} {
+		if w := serveTest(rt, http.MethodGet, path, nil); w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", path, w.Code)
+		}
+	}
+	if source.Reads != 1 {
+		t.Errorf("source read %d times, want 1", source.Reads)
+	}
+}
+
+// blockingSource reads source once release is closed, after sending on
+// reading.
+type blockingSource struct {
+	*notionicaltest.Source
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (s blockingSource) ReadAllContext(ctx context.Context) ([]notion_ical.Event, error) {
+	s.reading <- struct{}{}
+	<-s.release
+	return s.Source.ReadAllContext(ctx)
+}
+
+func TestServeConcurrentRefresh(t *testing.T) {
+	source := blockingSource{Source: testSource(), reading: make(chan struct{}, 1), release: make(chan struct{})}
+	s := newServer("team", feedConfig{Name: "team"}, source, time.Hour, nil)
+
+	feeds := make([]*feed, 3)
+	var wg sync.WaitGroup
+	for i := range feeds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			feeds[i], _ = s.get(context.Background())
+		}(i)
+	}
+	<-source.reading
+
+	// The server is not locked while the feed is refreshed
+	if !s.mu.TryLock() {
+		t.Fatal("server locked during refresh")
+	}
+	s.mu.Unlock()
+	// and requests that give up do not wait for the refresh
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.get(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("get() = %v, want %v", err, context.Canceled)
+	}
+
+	close(source.release)
+	wg.Wait()
+	if source.Reads != 1 {
+		t.Errorf("source read %d times, want 1", source.Reads)
+	}
+	for _, f := range feeds {
+		if f == nil || f.etag != feeds[0].etag {
+			t.Fatalf("feeds = %v, want the same feed", feeds)
+		}
+	}
+}
+
+func TestServeHeaders(t *testing.T) {
+	rt := newTestRouter(t, testSource())
+
+	w := serveTest(rt, http.MethodGet, "/team.ics", nil)
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename=Team.ics`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("X-Cache"); got != string(cacheMiss) {
+		t.Errorf("X-Cache = %q, want %q", got, cacheMiss)
+	}
+	w = serveTest(rt, http.MethodGet, "/team.ics", nil)
+	if got := w.Header().Get("X-Cache"); got != string(cacheHit) {
+		t.Errorf("X-Cache of second request = %q, want %q", got, cacheHit)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	failing := notionicaltest.NewSource("Team")
+	failing.Err = errors.New("notion unavailable")
+
+	tests := []struct {
+		name   string
+		source notion_ical.Source
+		method string
+		path   string
+		want   int
+	}{
+		{"unknown feed", testSource(), http.MethodGet, "/other.ics", http.StatusNotFound},
+		{"unknown path", testSource(), http.MethodGet, "/team", http.StatusNotFound},
+		{"post", testSource(), http.MethodPost, "/team.ics", http.StatusMethodNotAllowed},
+		{"post json", testSource(), http.MethodPost, "/team.json", http.StatusMethodNotAllowed},
+		{"failing source", failing, http.MethodGet, "/team.ics", http.StatusInternalServerError},
+		{"failing source json", failing, http.MethodGet, "/team.json", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := newTestRouter(t, test.source)
+			if w := serveTest(rt, test.method, test.path, nil); w.Code != test.want {
+				t.Errorf("%s %s: status = %d, want %d", test.method, test.path, w.Code, test.want)
+			}
+		})
+	}
+}
+
+// newPersistedRouter serves source as the feed "team", persisting its
+// events in dir.
+func newPersistedRouter(t *testing.T, dir string, source notion_ical.Source) *router {
+	t.Helper()
+	rt := newRouter(time.Hour, false)
+	rt.html = true
+	rt.cacheDir = dir
+	rt.feeds["team"] = rt.newServer("team", feedConfig{Name: "team"}, source, nil)
+	return rt
+}
+
+func TestServePersistedEvents(t *testing.T) {
+	dir := t.TempDir()
+	rt := newPersistedRouter(t, dir, testSource())
+	if w := serveTest(rt, http.MethodGet, "/team.ics", nil); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "team.events.json")); err != nil {
+		t.Fatalf("events not persisted: %v", err)
+	}
+
+	// After a restart, every format is served from the persisted events
+	// without reading Notion
+	failing := notionicaltest.NewSource("Team")
+	failing.Err = errors.New("notion unavailable")
+	rt = newPersistedRouter(t, dir, failing)
+
+	tests := []struct {
+		path   string
+		golden string
+	}{
+		{"/team.ics", "testdata/team.ics"},
+		{"/team/freebusy.ics", "testdata/team_freebusy.ics"},
+		{"/team.json", "testdata/team.json"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			w := serveTest(rt, http.MethodGet, test.path, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			notionicaltest.AssertGolden(t, test.golden, w.Body.Bytes())
+		})
+	}
+	t.Run("/team.html", func(t *testing.T) {
+		w := serveTest(rt, http.MethodGet, "/team.html?month=2024-03", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), "Review") {
+			t.Errorf("event missing from calendar page:\n%s", w.Body)
+		}
+	})
+
+	if failing.Reads != 0 {
+		t.Errorf("source read %d times, want 0", failing.Reads)
+	}
+}
+
+func TestServePersistedEventsStale(t *testing.T) {
+	dir := t.TempDir()
+	rt := newPersistedRouter(t, dir, testSource())
+	if w := serveTest(rt, http.MethodGet, "/team.ics", nil); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "team.events.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired events are served while the feed is refreshed
+	failing := notionicaltest.NewSource("Team")
+	failing.Err = errors.New("notion unavailable")
+	rt = newPersistedRouter(t, dir, failing)
+	w := serveTest(rt, http.MethodGet, "/team.ics", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("X-Cache"); got != string(cacheStale) {
+		t.Errorf("X-Cache = %q, want %q", got, cacheStale)
+	}
+	notionicaltest.AssertGolden(t, "testdata/team.ics", w.Body.Bytes())
+
+	w = serveTest(rt, http.MethodGet, "/team.json", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	notionicaltest.AssertGolden(t, "testdata/team.json", w.Body.Bytes())
+}
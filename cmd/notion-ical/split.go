@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+const (
+	SplitMonth = "month"
+	SplitYear  = "year"
+	SplitEvent = "event"
+)
+
+// periodLayouts are the layouts of the period of an event, which name the
+// file it is saved in.
+var periodLayouts = map[string]string{
+	SplitMonth: "2006-01",
+	SplitYear:  "2006",
+}
+
+// periodFile is a file of the events of a month or year.
+type periodFile struct {
+	Period   string
+	Filename string
+	Events   int
+}
+
+// savePeriods saves the events of each month or year into its own file in
+// dir, with an index.html that links to each file, or each event into its own
+// file with SplitEvent.
+func savePeriods(ctx context.Context, source notion_ical.Source, dir, split string, validate bool, opts []notion_ical.ConvertOption) error {
+	if split == SplitEvent {
+		return saveObjects(ctx, source, dir, validate, opts)
+	}
+	layout, ok := periodLayouts[split]
+	if !ok {
+		return configError(fmt.Errorf("unknown split %q: expected %q, %q or %q", split, SplitMonth, SplitYear, SplitEvent))
+	}
+
+	events, err := notion_ical.ReadAll(ctx, source)
+	if err != nil {
+		return conversionError(err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create output directory: %w", err)
+	}
+
+	periods := make(map[string][]notion_ical.Event)
+	for _, event := range groupSeries(events) {
+		period := event[0].Start.Format(layout)
+		periods[period] = append(periods[period], event...)
+	}
+
+	var files []periodFile
+	for period, events := range periods {
+		name := source.Name() + " " + period
+		file := periodFile{
+			Period:   period,
+			Filename: calendarFilename(source.Name(), " "+period),
+			Events:   len(events),
+		}
+
+		f, err := os.Create(filepath.Join(dir, file.Filename))
+		if err != nil {
+			return fmt.Errorf("unable to open output file: %w", err)
+		}
+		err = saveEvents(name, events, f, validate, append(append([]notion_ical.ConvertOption{}, opts...), notion_ical.WithCalendarName(name)))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", period, err)
+		}
+
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Period < files[j].Period
+	})
+
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return fmt.Errorf("unable to open index file: %w", err)
+	}
+	defer f.Close()
+	return periodIndexTemplate.Execute(f, struct {
+		Name  string
+		Files []periodFile
+	}{source.Name(), files})
+}
+
+// saveObjects saves each event into its own file in dir, named after its
+// UID, such as to attach a single event to an invitation.
+func saveObjects(ctx context.Context, source notion_ical.Source, dir string, validate bool, opts []notion_ical.ConvertOption) error {
+	f, err := convertFeed(ctx, source, opts...)
+	if err != nil {
+		return conversionError(err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create output directory: %w", err)
+	}
+
+	for _, object := range f.caldavObjects("") {
+		if validate {
+			if err := validateCalendar(object.uid, object.data); err != nil {
+				return conversionError(err)
+			}
+		}
+		path := filepath.Join(dir, sanitizeFilename(object.uid)+".ics")
+		if err := os.WriteFile(path, object.data, 0o644); err != nil {
+			return fmt.Errorf("unable to write output file: %w", err)
+		}
+	}
+	return nil
+}
+
+// groupSeries groups the pages of each recurring series, in the order of
+// their first page, so that a series is saved with its first occurrence.
+// Other events are in groups of their own.
+func groupSeries(events []notion_ical.Event) [][]notion_ical.Event {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	var groups [][]notion_ical.Event
+	series := make(map[[2]string]int)
+	for _, event := range events {
+		if event.Recurrence == "" {
+			groups = append(groups, []notion_ical.Event{event})
+			continue
+		}
+		key := [2]string{event.Title, event.Recurrence}
+		if i, ok := series[key]; ok {
+			groups[i] = append(groups[i], event)
+			continue
+		}
+		series[key] = len(groups)
+		groups = append(groups, []notion_ical.Event{event})
+	}
+	return groups
+}
+
+// saveEvents converts events that were already read into w, and checks the
+// calendar when validate is set.
+func saveEvents(name string, events []notion_ical.Event, w io.Writer, validate bool, opts []notion_ical.ConvertOption) error {
+	var buf bytes.Buffer
+	if err := notion_ical.ConvertEvents(events, &buf, opts...); err != nil {
+		return conversionError(err)
+	}
+	if validate {
+		if err := validateCalendar(name, buf.Bytes()); err != nil {
+			return conversionError(err)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var periodIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<ul>
+{{range .Files}}
+<li><a href="{{.Filename}}">{{.Period}}</a> ({{.Events}} event{{if ne .Events 1}}s{{end}})</li>
+{{end}}
+</ul>
+</body>
+</html>
+`))
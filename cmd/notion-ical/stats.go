@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// maxSkippedRows is how many skipped rows are listed in stats.
+const maxSkippedRows = 20
+
+// eventStats counts the converted events for save --stats.
+type eventStats struct {
+	events    int
+	allDay    int
+	timed     int
+	recurring int
+	// properties counts the events with a value for each property
+	properties map[string]int
+}
+
+func newEventStats() *eventStats {
+	return &eventStats{properties: make(map[string]int)}
+}
+
+// observe counts an event, as the last mapper before conversion, so that
+// dropped events are not counted.
+func (s *eventStats) observe(event notion_ical.Event) (notion_ical.Event, bool) {
+	s.events += 1
+	switch {
+	case event.Start.IsZero():
+	case event.AllDay:
+		s.allDay += 1
+	default:
+		s.timed += 1
+	}
+	if event.Recurrence != "" {
+		s.recurring += 1
+	}
+	for _, property := range event.Properties {
+		if _, ok := s.properties[property.NameString()]; !ok {
+			s.properties[property.NameString()] = 0
+		}
+		if strings.TrimSpace(property.ValueString()) != "" {
+			s.properties[property.NameString()] += 1
+		}
+	}
+	return event, true
+}
+
+// writeStats writes the report of save --stats.
+func writeStats(w io.Writer, read *notion_ical.ReadStats, events *eventStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Rows read:\t%d\n", read.Rows)
+	fmt.Fprintf(tw, "Hidden rows:\t%d\n", read.Hidden)
+	fmt.Fprintf(tw, "Rows without date:\t%d\n", read.Undated)
+	fmt.Fprintf(tw, "Skipped rows:\t%d\n", len(read.Skipped))
+	fmt.Fprintf(tw, "Date parse failures:\t%d\n", read.DateErrors())
+	fmt.Fprintf(tw, "Events:\t%d\n", events.events)
+	fmt.Fprintf(tw, "  All-day:\t%d\n", events.allDay)
+	fmt.Fprintf(tw, "  Timed:\t%d\n", events.timed)
+	fmt.Fprintf(tw, "  Recurring:\t%d\n", events.recurring)
+
+	if len(events.properties) > 0 {
+		names := make([]string, 0, len(events.properties))
+		for name := range events.properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(tw, "\nPROPERTY\tSET\tCOVERAGE\n")
+		for _, name := range names {
+			n := events.properties[name]
+			fmt.Fprintf(tw, "%s\t%d/%d\t%d%%\n", name, n, events.events, n*100/events.events)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(read.Skipped) > 0 {
+		fmt.Fprintf(w, "\nSkipped rows:\n")
+		for i, row := range read.Skipped {
+			if i == maxSkippedRows {
+				fmt.Fprintf(w, "  and %d more\n", len(read.Skipped)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %v\n", row.Row, row.Err)
+		}
+	}
+	return nil
+}
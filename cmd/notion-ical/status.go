@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// feedStats records the refresh history of a feed for the status page.
+type feedStats struct {
+	Refreshes       int           `json:"refreshes"`
+	Failures        int           `json:"failures"`
+	LastRefresh     time.Time     `json:"last_refresh"`
+	LastDuration    time.Duration `json:"last_duration"`
+	TotalDuration   time.Duration `json:"total_duration"`
+	LastError       string        `json:"last_error,omitempty"`
+	LastErrorTime   time.Time     `json:"last_error_time"`
+	Events          int           `json:"events"`
+	CacheAgeSeconds float64       `json:"cache_age_seconds"`
+	CacheHits       int           `json:"cache_hits"`
+	CacheMisses     int           `json:"cache_misses"`
+	CacheStale      int           `json:"cache_stale"`
+	// WarningCount counts the warnings of the last refresh, of which the
+	// first maxWarnings are in Warnings
+	WarningCount int      `json:"warning_count"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// recordCacheResult counts how requests were served from the cache.
+func (s *server) recordCacheResult(result cacheResult) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	switch result {
+	case cacheHit:
+		s.stats.CacheHits += 1
+	case cacheMiss:
+		s.stats.CacheMisses += 1
+	case cacheStale:
+		s.stats.CacheStale += 1
+	}
+}
+
+func (s *server) recordRefresh(f *feed, err error, duration time.Duration) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	s.stats.Refreshes += 1
+	s.stats.LastDuration = duration
+	s.stats.TotalDuration += duration
+	if err != nil {
+		s.stats.Failures += 1
+		s.stats.LastError = err.Error()
+		s.stats.LastErrorTime = time.Now()
+		return
+	}
+	s.stats.LastRefresh = f.refreshed
+	s.stats.Events = f.events
+	s.stats.WarningCount = len(f.warnings)
+	s.stats.Warnings = nil
+	for i, warning := range f.warnings {
+		if i == maxWarnings {
+			break
+		}
+		s.stats.Warnings = append(s.stats.Warnings, warning.String())
+	}
+}
+
+// feedStatus is a snapshot of a feed's state.
+type feedStatus struct {
+	Name string `json:"name"`
+	feedStats
+}
+
+func (s *server) status() feedStatus {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	stats := s.stats
+	if !stats.LastRefresh.IsZero() {
+		stats.CacheAgeSeconds = time.Since(stats.LastRefresh).Seconds()
+	}
+	return feedStatus{
+		Name:      s.name,
+		feedStats: stats,
+	}
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"sub": func(a, b int) int {
+		return a - b
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>notion-ical status</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 0.25em 0.75em; border-bottom: 1px solid #ddd; text-align: left; }
+.error { color: #b00; }
+.warning { color: #a60; }
+</style>
+</head>
+<body>
+<h1>notion-ical status</h1>
+<table>
+<tr><th>Feed</th><th>Events</th><th>Last refresh</th><th>Refresh time</th><th>Refreshes</th><th>Failures</th><th>Cache hits</th><th>Misses</th><th>Stale</th><th>Warnings</th><th>Last error</th></tr>
+{{range .}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{.Events}}</td>
+<td>{{ago .LastRefresh}}</td>
+<td>{{.LastDuration}}</td>
+<td>{{.Refreshes}}</td>
+<td>{{.Failures}}</td>
+<td>{{.CacheHits}}</td>
+<td>{{.CacheMisses}}</td>
+<td>{{.CacheStale}}</td>
+<td class="warning">{{if .WarningCount}}{{.WarningCount}}{{end}}</td>
+<td class="error">{{if .LastError}}{{.LastError}} ({{ago .LastErrorTime}}){{end}}</td>
+</tr>
+{{end}}
+</table>
+{{range .}}{{if .Warnings}}
+<h2>Warnings of {{.Name}}</h2>
+<ul class="warning">
+{{range .Warnings}}<li>{{.}}</li>
+{{end}}{{if gt .WarningCount (len .Warnings)}}<li>and {{sub .WarningCount (len .Warnings)}} more</li>
+{{end}}</ul>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// handleStatus serves the status of all feeds as HTML, or as JSON when
+// requested with the Accept header.
+func (rt *router) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var statuses []feedStatus
+	for _, s := range rt.servers() {
+		statuses = append(statuses, s.status())
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			log.Printf("failed to write status: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, statuses); err != nil {
+		log.Printf("failed to write status: %v", err)
+	}
+}
+
+// requirePassword protects a handler with HTTP basic authentication,
+// accepting any username.
+func requirePassword(password string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, given, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="notion-ical"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arran4/golang-ical"
+	"golang.org/x/net/websocket"
+)
+
+// streamPath serves changes of the events of feeds as they are refreshed.
+const streamPath = "/events/stream"
+
+// streamPing is how often idle streams send a comment, so that proxies do
+// not close them.
+const streamPing = 30 * time.Second
+
+// streamBuffer is how many patches a client can fall behind by before it is
+// disconnected. Clients receive the events again when they reconnect.
+const streamBuffer = 16
+
+// streamEvent is an event or task sent to stream clients, with dates without
+// times for all-day events like the JSON Feed.
+type streamEvent struct {
+	UID         string `json:"uid"`
+	Component   string `json:"component"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Start       string `json:"start,omitempty"`
+	End         string `json:"end,omitempty"`
+	AllDay      bool   `json:"all_day"`
+	Status      string `json:"status,omitempty"`
+	Recurrence  string `json:"recurrence,omitempty"`
+}
+
+// patchOperation is an operation of a JSON Patch (RFC 6902).
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// changeStream sends the changes of the events of feeds to stream clients,
+// as JSON Patches of a document of the events of each feed by key:
+//
+//	{"calendar": {"<uid>": {"title": ...}}}
+//
+// Clients first receive a patch replacing the whole document.
+type changeStream struct {
+	mu      sync.Mutex
+	feeds   map[string]map[string]streamEvent
+	clients map[*streamClient]bool
+}
+
+// streamClient is a connected client, receiving patches of feeds.
+type streamClient struct {
+	// feeds are the names of the feeds the client follows
+	feeds   map[string]bool
+	patches chan []byte
+}
+
+func (c *streamClient) wants(name string) bool {
+	return c.feeds[name]
+}
+
+func newChangeStream() *changeStream {
+	return &changeStream{
+		feeds:   make(map[string]map[string]streamEvent),
+		clients: make(map[*streamClient]bool),
+	}
+}
+
+// publish sends the changes of the events of a refreshed feed.
+func (cs *changeStream) publish(name string, f *feed) {
+	events := streamEvents(f.calendar)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	previous, ok := cs.feeds[name]
+	cs.feeds[name] = events
+	if !ok {
+		cs.send(name, []patchOperation{{Op: "add", Path: "/" + jsonPointerEscape(name), Value: events}})
+		return
+	}
+	cs.send(name, diffEvents("/"+jsonPointerEscape(name), previous, events))
+}
+
+// remove sends the removal of a feed that is no longer served.
+func (cs *changeStream) remove(name string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, ok := cs.feeds[name]; !ok {
+		return
+	}
+	delete(cs.feeds, name)
+	cs.send(name, []patchOperation{{Op: "remove", Path: "/" + jsonPointerEscape(name)}})
+}
+
+// send sends a patch to the clients of a feed, disconnecting clients that
+// fell behind. cs.mu must be held.
+func (cs *changeStream) send(name string, patch []patchOperation) {
+	if len(patch) == 0 {
+		return
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		log.Printf("failed to encode changes of feed %s: %v", name, err)
+		return
+	}
+	for c := range cs.clients {
+		if !c.wants(name) {
+			continue
+		}
+		select {
+		case c.patches <- b:
+		default:
+			delete(cs.clients, c)
+			close(c.patches)
+		}
+	}
+}
+
+// subscribe connects a client, which first receives the current events.
+func (cs *changeStream) subscribe(feeds map[string]bool) *streamClient {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c := &streamClient{feeds: feeds, patches: make(chan []byte, streamBuffer)}
+	document := make(map[string]map[string]streamEvent)
+	for name, events := range cs.feeds {
+		if c.wants(name) {
+			document[name] = events
+		}
+	}
+	b, err := json.Marshal([]patchOperation{{Op: "replace", Path: "", Value: document}})
+	if err == nil {
+		c.patches <- b
+	}
+	cs.clients[c] = true
+	return c
+}
+
+// unsubscribe disconnects a client.
+func (cs *changeStream) unsubscribe(c *streamClient) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.clients[c] {
+		delete(cs.clients, c)
+		close(c.patches)
+	}
+}
+
+// diffEvents returns the operations that change the events at path from
+// previous to events.
+func diffEvents(path string, previous, events map[string]streamEvent) []patchOperation {
+	keys := make([]string, 0, len(events))
+	for key := range events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var patch []patchOperation
+	for key := range previous {
+		if _, ok := events[key]; !ok {
+			patch = append(patch, patchOperation{Op: "remove", Path: path + "/" + jsonPointerEscape(key)})
+		}
+	}
+	sort.Slice(patch, func(i, j int) bool {
+		return patch[i].Path < patch[j].Path
+	})
+	for _, key := range keys {
+		event := events[key]
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			patch = append(patch, patchOperation{Op: "add", Path: path + "/" + jsonPointerEscape(key), Value: event})
+		case !reflect.DeepEqual(old, event):
+			patch = append(patch, patchOperation{Op: "replace", Path: path + "/" + jsonPointerEscape(key), Value: event})
+		}
+	}
+	return patch
+}
+
+// jsonPointerEscape escapes a key as a reference token of a JSON Pointer.
+func jsonPointerEscape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// streamEvents reads the events and tasks of a converted calendar by key,
+// which is their UID, followed by their RECURRENCE-ID for modified
+// occurrences.
+func streamEvents(calendar *ics.Calendar) map[string]streamEvent {
+	zone := calendarZone(calendar)
+	events := make(map[string]streamEvent)
+	for _, component := range calendar.Components {
+		var base *ics.ComponentBase
+		var componentType ics.ComponentType
+		switch c := component.(type) {
+		case *ics.VEvent:
+			base, componentType = &c.ComponentBase, ics.ComponentVEvent
+		case *ics.VTodo:
+			base, componentType = &c.ComponentBase, ics.ComponentVTodo
+		default:
+			continue
+		}
+
+		event := streamEvent{Component: string(componentType)}
+		text := func(property ics.ComponentProperty) string {
+			if p := base.GetProperty(property); p != nil {
+				return icsText(p.Value)
+			}
+			return ""
+		}
+		event.UID = text(ics.ComponentPropertyUniqueId)
+		event.Title = text(ics.ComponentPropertySummary)
+		event.Description = text(ics.ComponentPropertyDescription)
+		event.URL = text(ics.ComponentPropertyUrl)
+		event.Status = text(ics.ComponentPropertyStatus)
+		event.Recurrence = text(ics.ComponentPropertyRrule)
+
+		start, allDay, ok := htmlEventTime(base, ics.ComponentPropertyDtStart, zone)
+		if ok {
+			event.Start = formatStreamTime(start, allDay)
+			event.AllDay = allDay
+		}
+		end, allDay, ok := htmlEventTime(base, ics.ComponentPropertyDtEnd, zone)
+		if !ok {
+			end, allDay, ok = htmlEventTime(base, ics.ComponentProperty(ics.PropertyDue), zone)
+		}
+		if ok {
+			event.End = formatStreamTime(end, allDay)
+		}
+
+		key := event.UID
+		if recurrenceID := text(ics.ComponentProperty(ics.PropertyRecurrenceId)); recurrenceID != "" {
+			key += "/" + recurrenceID
+		}
+		events[key] = event
+	}
+	return events
+}
+
+func formatStreamTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// handleStream serves the changes of the events of feeds with Server-Sent
+// Events, or WebSocket when requested. The feed query parameter, which can
+// be repeated, names the feeds to follow. Streams do not refresh feeds, so
+// feeds that were never refreshed are sent once they are.
+func (rt *router) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	names := r.URL.Query()["feed"]
+	if len(names) == 0 {
+		http.Error(w, "feed parameter required", http.StatusBadRequest)
+		return
+	}
+	feeds := make(map[string]bool)
+	for _, name := range names {
+		feeds[name] = true
+	}
+
+	// Send the events of feeds refreshed before the stream was requested
+	found := 0
+	for _, s := range rt.servers() {
+		if !feeds[s.name] {
+			continue
+		}
+		found += 1
+		s.mu.Lock()
+		if s.feed.feed != nil {
+			rt.stream.publish(s.name, s.feed.feed)
+		}
+		s.mu.Unlock()
+	}
+	if found < len(feeds) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{
+			Handshake: func(_ *websocket.Config, r *http.Request) error {
+				if !streamOriginAllowed(r, rt.streamOrigins) {
+					return fmt.Errorf("origin %s not allowed", r.Header.Get("Origin"))
+				}
+				return nil
+			},
+			Handler: func(ws *websocket.Conn) {
+				rt.serveWebSocketStream(ws, feeds)
+			},
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	c := rt.stream.subscribe(feeds)
+	defer rt.stream.unsubscribe(c)
+
+	ping := time.NewTicker(streamPing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case patch, ok := <-c.patches:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: patch\ndata: %s\n\n", patch); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// serveWebSocketStream sends each patch as a text message, until the client
+// disconnects.
+func (rt *router) serveWebSocketStream(ws *websocket.Conn, feeds map[string]bool) {
+	c := rt.stream.subscribe(feeds)
+	defer rt.stream.unsubscribe(c)
+
+	// Messages from the client are ignored, and reading them notices when
+	// it disconnects
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case patch, ok := <-c.patches:
+			if !ok {
+				return
+			}
+			if err := websocket.Message.Send(ws, string(patch)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamOriginAllowed checks the origin of a WebSocket request, so that
+// other sites cannot follow feeds with the cookies or network of visitors.
+// Requests without an origin are from clients other than browsers, and the
+// same origin and origins allowed with --cors-origin are allowed.
+func streamOriginAllowed(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range origins {
+		if allowed == allowAnyOrigin || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+		target string
+		want   int
+	}{
+		{"disabled", false, "/events/stream?feed=team", http.StatusNotFound},
+		{"no feed", true, "/events/stream", http.StatusBadRequest},
+		{"unknown feed", true, "/events/stream?feed=team&feed=other", http.StatusNotFound},
+		{"feed", true, "/events/stream?feed=team", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := testSource()
+			rt := newRouter(time.Hour, false)
+			if test.stream {
+				rt.stream = newChangeStream()
+			}
+			rt.feeds["team"] = rt.newServer("team", feedConfig{Name: "team"}, source, nil)
+
+			// The stream ends when the request is canceled
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.target, nil).WithContext(ctx))
+			if w.Code != test.want {
+				t.Errorf("status = %d, want %d", w.Code, test.want)
+			}
+			// Feeds are not refreshed for stream clients
+			if source.Reads != 0 {
+				t.Errorf("source read %d times, want 0", source.Reads)
+			}
+		})
+	}
+}
+
+func TestStreamOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		origins []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"same origin", "https://calendar.example.com", nil, true},
+		{"other origin", "https://evil.example", nil, false},
+		{"allowed origin", "https://dashboard.example", []string{"https://dashboard.example"}, true},
+		{"any origin", "https://dashboard.example", []string{allowAnyOrigin}, true},
+		{"other allowed origin", "https://evil.example", []string{"https://dashboard.example"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://calendar.example.com/events/stream?feed=team", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if got := streamOriginAllowed(r, test.origins); got != test.want {
+				t.Errorf("streamOriginAllowed(%q) = %v, want %v", test.origin, got, test.want)
+			}
+		})
+	}
+}
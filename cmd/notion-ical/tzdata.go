@@ -0,0 +1,7 @@
+//go:build tzdata
+
+package main
+
+// Embed the timezone database, for containers such as scratch or Alpine
+// images that have none
+import _ "time/tzdata"
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// validateCalendar logs the RFC 5545 violations of the calendar b converted
+// from the source name, and fails when there are any.
+func validateCalendar(name string, b []byte) error {
+	violations, err := notion_ical.Validate(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for _, violation := range violations {
+		log.Printf("%s: %s", name, violation)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%w, violations: %d", notion_ical.ErrInvalidCalendar, len(violations))
+	}
+	return nil
+}
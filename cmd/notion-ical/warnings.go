@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// maxWarnings is how many warnings are logged, or kept for the status page.
+const maxWarnings = 20
+
+// logWarnings logs the warnings of a read, after the first maxWarnings
+// only counting them.
+func logWarnings(warnings []notion_ical.Warning) {
+	for i, warning := range warnings {
+		if i == maxWarnings {
+			log.Printf("warning: and %d more", len(warnings)-i)
+			break
+		}
+		log.Printf("warning: %s", warning)
+	}
+}
+
+// warningsHeader counts warnings by kind for the X-Warnings header, such as
+// "content=1, date=2".
+func warningsHeader(warnings []notion_ical.Warning) string {
+	counts := make(map[notion_ical.WarningKind]int)
+	for _, warning := range warnings {
+		counts[warning.Kind] += 1
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind, n := range counts {
+		kinds = append(kinds, fmt.Sprintf("%s=%d", kind, n))
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds, ", ")
+}
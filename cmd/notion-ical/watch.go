@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// watcher polls a source and notifies about changed events.
+type watcher struct {
+	source   notion_ical.Source
+	interval time.Duration
+	webhooks []string
+	commands []string
+	mappers  []notion_ical.EventMapper
+
+	client *http.Client
+}
+
+// eventDelta describes events that changed between two polls.
+type eventDelta struct {
+	Calendar string          `json:"calendar"`
+	Text     string          `json:"text"`
+	Added    []eventSnapshot `json:"added"`
+	Changed  []eventSnapshot `json:"changed"`
+	Removed  []eventSnapshot `json:"removed"`
+}
+
+func (d eventDelta) empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// eventSnapshot is the notified representation of an event.
+type eventSnapshot struct {
+	ID     string    `json:"id"`
+	Title  string    `json:"title"`
+	URL    string    `json:"url,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	AllDay bool      `json:"all_day"`
+
+	hash string
+}
+
+func snapshotEvent(event notion_ical.Event) eventSnapshot {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%t\x00%s", event.Title, event.URL, event.Start, event.End, event.AllDay, event.Description())
+	return eventSnapshot{
+		ID:     event.ID,
+		Title:  event.Title,
+		URL:    event.URL,
+		Start:  event.Start,
+		End:    event.End,
+		AllDay: event.AllDay,
+		hash:   hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// run polls forever. The first poll only records the current events.
+func (w *watcher) run() error {
+	var previous map[string]eventSnapshot
+
+	for {
+		current, err := w.poll()
+		if err != nil {
+			log.Printf("failed to poll events: %v", err)
+		} else {
+			if previous != nil {
+				delta := diffSnapshots(previous, current)
+				if !delta.empty() {
+					delta.Calendar = w.source.Name()
+					delta.Text = delta.summary()
+					w.notify(delta)
+				}
+			}
+			previous = current
+		}
+
+		time.Sleep(w.interval)
+	}
+}
+
+func (w *watcher) poll() (map[string]eventSnapshot, error) {
+	events, err := w.source.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	events = notion_ical.MapEvents(events, w.mappers...)
+
+	snapshots := make(map[string]eventSnapshot, len(events))
+	for _, event := range events {
+		snapshots[event.ID] = snapshotEvent(event)
+	}
+	return snapshots, nil
+}
+
+func diffSnapshots(previous, current map[string]eventSnapshot) eventDelta {
+	delta := eventDelta{
+		Added:   []eventSnapshot{},
+		Changed: []eventSnapshot{},
+		Removed: []eventSnapshot{},
+	}
+
+	for id, snapshot := range current {
+		old, ok := previous[id]
+		if !ok {
+			delta.Added = append(delta.Added, snapshot)
+		} else if old.hash != snapshot.hash {
+			delta.Changed = append(delta.Changed, snapshot)
+		}
+	}
+	for id, snapshot := range previous {
+		if _, ok := current[id]; !ok {
+			delta.Removed = append(delta.Removed, snapshot)
+		}
+	}
+
+	for _, list := range [][]eventSnapshot{delta.Added, delta.Changed, delta.Removed} {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Start.Before(list[j].Start)
+		})
+	}
+
+	return delta
+}
+
+// summary describes the delta in text, suitable for chat webhooks.
+func (d eventDelta) summary() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("%s: %d added, %d changed, %d removed", d.Calendar, len(d.Added), len(d.Changed), len(d.Removed)))
+	for _, e := range d.Added {
+		lines = append(lines, "+ "+e.Title+" ("+e.Start.Format("2006-01-02 15:04")+")")
+	}
+	for _, e := range d.Changed {
+		lines = append(lines, "~ "+e.Title+" ("+e.Start.Format("2006-01-02 15:04")+")")
+	}
+	for _, e := range d.Removed {
+		lines = append(lines, "- "+e.Title+" ("+e.Start.Format("2006-01-02 15:04")+")")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notify posts the delta as JSON to each webhook, and runs each command with
+// the JSON on stdin.
+func (w *watcher) notify(delta eventDelta) {
+	payload, err := json.Marshal(delta)
+	if err != nil {
+		log.Printf("failed to encode changes: %v", err)
+		return
+	}
+
+	log.Print(delta.Text)
+
+	for _, webhook := range w.webhooks {
+		res, err := w.client.Post(webhook, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("failed to call webhook: %v", err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			log.Printf("webhook returned %s", res.Status)
+		}
+	}
+
+	for _, command := range w.commands {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("failed to run command %q: %v", command, err)
+		}
+	}
+}
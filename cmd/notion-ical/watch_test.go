@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	monday := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	review := notion_ical.Event{ID: "review", Title: "Review", Start: monday, End: monday.Add(time.Hour)}
+	standup := notion_ical.Event{ID: "standup", Title: "Standup", Start: monday.Add(-time.Hour), End: monday}
+	offsite := notion_ical.Event{ID: "offsite", Title: "Offsite", Start: monday.AddDate(0, 0, 2), End: monday.AddDate(0, 0, 3), AllDay: true}
+	moved := review
+	moved.Start, moved.End = moved.Start.Add(time.Hour), moved.End.Add(time.Hour)
+
+	snapshots := func(events ...notion_ical.Event) map[string]eventSnapshot {
+		m := make(map[string]eventSnapshot)
+		for _, event := range events {
+			m[event.ID] = snapshotEvent(event)
+		}
+		return m
+	}
+	ids := func(list []eventSnapshot) []string {
+		ids := []string{}
+		for _, snapshot := range list {
+			ids = append(ids, snapshot.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name                    string
+		previous, current       map[string]eventSnapshot
+		added, changed, removed []string
+	}{
+		{"unchanged", snapshots(review, standup), snapshots(review, standup), []string{}, []string{}, []string{}},
+		{"added in start order", snapshots(), snapshots(offsite, review, standup), []string{"standup", "review", "offsite"}, []string{}, []string{}},
+		{"changed", snapshots(review, standup), snapshots(moved, standup), []string{}, []string{"review"}, []string{}},
+		{"removed", snapshots(review, offsite), snapshots(offsite), []string{}, []string{}, []string{"review"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delta := diffSnapshots(test.previous, test.current)
+			if got := ids(delta.Added); !reflect.DeepEqual(got, test.added) {
+				t.Errorf("added = %v, want %v", got, test.added)
+			}
+			if got := ids(delta.Changed); !reflect.DeepEqual(got, test.changed) {
+				t.Errorf("changed = %v, want %v", got, test.changed)
+			}
+			if got := ids(delta.Removed); !reflect.DeepEqual(got, test.removed) {
+				t.Errorf("removed = %v, want %v", got, test.removed)
+			}
+			if empty := len(test.added)+len(test.changed)+len(test.removed) == 0; delta.empty() != empty {
+				t.Errorf("empty() = %v, want %v", delta.empty(), empty)
+			}
+		})
+	}
+}
+
+func TestEventDeltaSummary(t *testing.T) {
+	monday := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	delta := eventDelta{
+		Calendar: "Team",
+		Added:    []eventSnapshot{{Title: "Review", Start: monday}},
+		Removed:  []eventSnapshot{{Title: "Standup", Start: monday.Add(-time.Hour)}},
+	}
+	want := "Team: 1 added, 0 changed, 1 removed\n+ Review (2024-01-08 09:00)\n- Standup (2024-01-08 08:00)"
+	if got := delta.summary(); got != want {
+		t.Errorf("summary() = %q, want %q", got, want)
+	}
+}
+
+func TestWatcherNotify(t *testing.T) {
+	var received []byte
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer webhook.Close()
+
+	out := filepath.Join(t.TempDir(), "delta.json")
+	w := &watcher{
+		source:   testCalDAVSource(),
+		webhooks: []string{webhook.URL},
+		commands: []string{"cat > " + out},
+		client:   http.DefaultClient,
+	}
+
+	current, err := w.poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := diffSnapshots(nil, current)
+	delta.Calendar = w.source.Name()
+	delta.Text = delta.summary()
+	w.notify(delta)
+
+	ran, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, payload := range map[string][]byte{"webhook": received, "command": ran} {
+		var got eventDelta
+		if err := json.Unmarshal(payload, &got); err != nil {
+			t.Fatalf("%s: invalid payload %q: %v", name, payload, err)
+		}
+		if got.Calendar != "Team" || got.Text != delta.Text || len(got.Added) != 2 || got.Added[0].ID != "review@notion-ical" {
+			t.Errorf("%s: payload = %+v, want %+v", name, got, delta)
+		}
+	}
+}
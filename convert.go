@@ -1,36 +1,332 @@
 package notion_ical
 
 import (
+	"bytes"
+	"context"
 	"io"
-	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/arran4/golang-ical"
 )
 
-func Convert(source Source, ical io.Writer) error {
-	events, err := source.ReadAll()
+// ConvertOption configures Convert, ConvertEvents and ConvertCSV.
+type ConvertOption func(*convertOptions)
+
+type convertOptions struct {
+	// name is the name of the calendar
+	name            string
+	productID       string
+	refreshInterval string
+	color           string
+	method          string
+	calendarScale   string
+
+	mappers []EventMapper
+	dtstamp func(Event) time.Time
+	limit   int
+	zone    *time.Location
+	todos   bool
+	// freeBusy replaces events with their busy periods
+	freeBusy bool
+	logger   Logger
+	// compat is the client to adjust output for
+	compat Client
+	// htmlDescription adds descriptions as HTML in X-ALT-DESC
+	htmlDescription bool
+}
+
+func newConvertOptions(opts []ConvertOption) convertOptions {
+	o := convertOptions{
+		productID:       defaultProductID,
+		refreshInterval: defaultRefreshInterval,
+		method:          defaultMethod,
+		calendarScale:   defaultCalendarScale,
+		dtstamp: func(event Event) time.Time {
+			return event.Start
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.logger = loggerOrDefault(o.logger)
+	return o
+}
+
+// WithCalendarName sets the name of the calendar, instead of the name of
+// the source.
+func WithCalendarName(name string) ConvertOption {
+	return func(o *convertOptions) {
+		o.name = name
+	}
+}
+
+// WithDTStampNow sets DTSTAMP to the time of conversion, instead of the
+// start of the event.
+func WithDTStampNow() ConvertOption {
+	return func(o *convertOptions) {
+		now := time.Now()
+		o.dtstamp = func(Event) time.Time {
+			return now
+		}
+	}
+}
+
+// WithDTStampLastEdited sets DTSTAMP to when the page was last edited,
+// falling back to the start of the event when it is unknown.
+func WithDTStampLastEdited() ConvertOption {
+	return func(o *convertOptions) {
+		o.dtstamp = func(event Event) time.Time {
+			if event.LastEdited.IsZero() {
+				return event.Start
+			}
+			return event.LastEdited
+		}
+	}
+}
+
+// WithDTStamp sets DTSTAMP to a fixed time, for reproducible output.
+func WithDTStamp(t time.Time) ConvertOption {
+	return func(o *convertOptions) {
+		o.dtstamp = func(Event) time.Time {
+			return t
+		}
+	}
+}
+
+// WithLimit emits at most n of the earliest events, after events are mapped.
+// Zero means no limit.
+func WithLimit(n int) ConvertOption {
+	return func(o *convertOptions) {
+		o.limit = n
+	}
+}
+
+// WithHTMLDescription adds the description of events as HTML in X-ALT-DESC,
+// which clients such as Outlook show instead of DESCRIPTION. Only the API
+// source renders page content as HTML.
+func WithHTMLDescription() ConvertOption {
+	return func(o *convertOptions) {
+		o.htmlDescription = true
+	}
+}
+
+// limitEvents keeps at most limit of the earliest events, in their original
+// order.
+func limitEvents(events []Event, limit int) []Event {
+	if limit <= 0 || len(events) <= limit {
+		return events
+	}
+
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return events[order[i]].Start.Before(events[order[j]].Start)
+	})
+	order = order[:limit]
+	sort.Ints(order)
+
+	limited := make([]Event, 0, limit)
+	for _, i := range order {
+		limited = append(limited, events[i])
+	}
+	return limited
+}
+
+func Convert(source Source, ical io.Writer, opts ...ConvertOption) error {
+	return ConvertContext(context.Background(), source, ical, opts...)
+}
+
+// ConvertContext is Convert with a context for cancellation and tracing.
+// Events of a StreamSource are written as they are read, unless an option
+// such as WithLimit, WithFreeBusy or WithTimezone needs all events first.
+func ConvertContext(ctx context.Context, source Source, ical io.Writer, opts ...ConvertOption) (err error) {
+	ctx, span := tracer.Start(ctx, "Convert")
+	defer func() { endSpan(span, err) }()
+
+	o := newConvertOptions(append([]ConvertOption{WithCalendarName(source.Name())}, opts...))
+
+	if stream, ok := source.(StreamSource); ok && o.streams() {
+		return convertStream(ctx, stream, ical, o)
+	}
+
+	events, err := ReadAll(ctx, source)
 	if err != nil {
 		return err
 	}
+	return convertEvents(ctx, events, ical, o)
+}
+
+// ConvertEvents writes events that were already read, such as with ReadAll,
+// as a calendar. The calendar is named with WithCalendarName.
+func ConvertEvents(events []Event, ical io.Writer, opts ...ConvertOption) error {
+	return convertEvents(context.Background(), events, ical, newConvertOptions(opts))
+}
+
+func convertEvents(ctx context.Context, events []Event, ical io.Writer, o convertOptions) (err error) {
+	events = MapEvents(events, o.mappers...)
+	events = collapseRecurring(events)
+	events = limitEvents(events, o.limit)
 
 	// Create calendar
 	cal := ics.NewCalendar()
-	// Set calendar properties
-	cal.SetName(source.Name())
-	cal.SetProductId("-//Ambrose Chua//serverwentdown notion-ical//EN")
-	cal.SetRefreshInterval("P12H")
+	setCalendarProperties(cal, o)
+	if o.zone != nil && !o.freeBusy {
+		if from, to, ok := timedRange(events); ok {
+			cal.Components = append(cal.Components, newVTimezone(o.zone, from, to))
+		}
+	}
 
 	// Add events to calendar
-	for _, event := range events {
-		calEvent := cal.AddEvent(event.ID)
-		calEvent.SetSummary(event.Title)
-		calEvent.SetDtStampTime(event.Start)
-		calEvent.SetStartAt(event.Start)
-		calEvent.SetEndAt(event.End)
-		calEvent.SetDescription(event.Description())
+	if o.freeBusy {
+		addFreeBusy(cal, o.name, events, o)
+	} else {
+		for _, event := range events {
+			if o.todos {
+				addTodo(cal, event, o)
+			} else {
+				addEvent(cal, event, o)
+			}
+		}
 	}
 
-	log.Printf("Processed %d events", len(events))
+	o.logger.Printf("Processed %d events", len(events))
 
-	return cal.SerializeTo(ical)
+	_, serializeSpan := tracer.Start(ctx, "SerializeICS")
+	defer func() { endSpan(serializeSpan, err) }()
+	if !o.refoldsLines() {
+		return cal.SerializeTo(ical)
+	}
+	var buf bytes.Buffer
+	if err := cal.SerializeTo(&buf); err != nil {
+		return err
+	}
+	_, err = ical.Write(refoldLines(buf.Bytes()))
+	return err
+}
+
+// addEvent adds the event to the calendar as a VEVENT.
+func addEvent(cal *ics.Calendar, event Event, o convertOptions) {
+	calEvent := cal.AddEvent(o.uid(event))
+	calEvent.SetSummary(event.Title)
+	calEvent.SetDtStampTime(o.dtstamp(event))
+	if !event.Created.IsZero() {
+		calEvent.SetCreatedTime(event.Created)
+	}
+	if event.AllDay {
+		setAllDayDate(&calEvent.ComponentBase, ics.ComponentPropertyDtStart, event.Start)
+		if end, ok := o.allDayEnd(event); ok {
+			setAllDayDate(&calEvent.ComponentBase, ics.ComponentPropertyDtEnd, end)
+		}
+		setCompatAllDay(calEvent, o)
+	} else {
+		setZonedTime(&calEvent.ComponentBase, ics.ComponentPropertyDtStart, event.Start, o.zone)
+		setZonedTime(&calEvent.ComponentBase, ics.ComponentPropertyDtEnd, event.End, o.zone)
+	}
+	if event.Recurrence != "" {
+		calEvent.AddRrule(event.Recurrence)
+		addExceptions(calEvent, event, o.zone)
+	}
+	if status, ok := eventStatus(event.Status); ok {
+		calEvent.SetStatus(status)
+	}
+	calEvent.SetDescription(event.Description())
+	setHTMLDescription(&calEvent.ComponentBase, event, o)
+	setEventDetails(&calEvent.ComponentBase, event)
+}
+
+// eventStatus returns the VEVENT status of a status property, ignoring case.
+// Other statuses, such as those of tasks, are not statuses of events.
+func eventStatus(status string) (ics.ObjectStatus, bool) {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "tentative":
+		return ics.ObjectStatusTentative, true
+	case "confirmed":
+		return ics.ObjectStatusConfirmed, true
+	case "cancelled", "canceled":
+		return ics.ObjectStatusCancelled, true
+	}
+	return "", false
+}
+
+// setEventDetails sets the properties shared by events and tasks: location,
+// categories, attendees, LAST-MODIFIED and alarms.
+func setEventDetails(component *ics.ComponentBase, event Event) {
+	if event.Location != "" {
+		component.SetProperty(ics.ComponentPropertyLocation, ics.ToText(event.Location))
+	}
+	if len(event.Categories) > 0 {
+		// Commas separate categories, so each category is escaped alone
+		categories := make([]string, len(event.Categories))
+		for i, category := range event.Categories {
+			categories[i] = ics.ToText(category)
+		}
+		component.SetProperty(ics.ComponentPropertyCategories, strings.Join(categories, ","))
+	}
+	for _, attendee := range event.Attendees {
+		if attendee.Email == "" {
+			continue
+		}
+		var params []ics.PropertyParameter
+		if attendee.Name != "" {
+			params = append(params, ics.WithCN(attendee.Name))
+		}
+		component.AddProperty(ics.ComponentPropertyAttendee, "mailto:"+attendee.Email, params...)
+	}
+	if !event.LastEdited.IsZero() {
+		component.SetProperty(ics.ComponentPropertyLastModified, event.LastEdited.UTC().Format("20060102T150405Z"))
+	}
+	for _, alarm := range event.Alarms {
+		component.Components = append(component.Components, newAlarm(event, alarm))
+	}
+}
+
+// newAlarm is a VALARM that displays the title of the event.
+func newAlarm(event Event, alarm Alarm) *ics.VAlarm {
+	trigger := "PT0S"
+	if alarm.Before > 0 {
+		trigger = "-" + formatDuration(alarm.Before)
+	}
+	valarm := &ics.VAlarm{}
+	valarm.SetProperty(ics.ComponentPropertyAction, string(ics.ActionDisplay))
+	valarm.SetProperty(ics.ComponentPropertyTrigger, trigger)
+	valarm.SetProperty(ics.ComponentPropertyDescription, ics.ToText(event.Title))
+	return valarm
+}
+
+// setHTMLDescription sets X-ALT-DESC to the description as HTML, when
+// enabled with WithHTMLDescription.
+func setHTMLDescription(component *ics.ComponentBase, event Event, o convertOptions) {
+	if !o.htmlDescription {
+		return
+	}
+	component.SetProperty(ics.ComponentProperty("X-ALT-DESC"), ics.ToText(event.HTMLDescription()), ics.WithFmtType("text/html"))
+}
+
+// setAllDayDate sets a DATE value in the event's own timezone, because
+// SetAllDayStartAt converts to UTC and produces an invalid "Z" suffixed date.
+func setAllDayDate(component *ics.ComponentBase, property ics.ComponentProperty, t time.Time) {
+	component.SetProperty(property, t.Format("20060102"), ics.WithValue(string(ics.ValueDataTypeDate)))
+}
+
+// addExceptions adds an EXDATE for each exception, at the same time of day as
+// the start of the event so that it matches an occurrence.
+func addExceptions(calEvent *ics.VEvent, event Event, zone *time.Location) {
+	for _, exception := range event.Exceptions {
+		if event.AllDay {
+			calEvent.AddExdate(exception.Format("20060102"), ics.WithValue(string(ics.ValueDataTypeDate)))
+			continue
+		}
+		year, month, day := exception.Date()
+		start := event.Start
+		t := time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		if zone == nil {
+			calEvent.AddExdate(t.UTC().Format("20060102T150405Z"))
+		} else {
+			calEvent.AddExdate(t.In(zone).Format("20060102T150405"), withTZID(zone))
+		}
+	}
 }
@@ -0,0 +1,117 @@
+package notion_ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arran4/golang-ical"
+)
+
+const (
+	defaultProductID       = "-//Ambrose Chua//serverwentdown notion-ical//EN"
+	defaultRefreshInterval = "P12H"
+	// defaultMethod marks calendars as published for subscribers, because
+	// older versions of Outlook treat calendars without a METHOD as
+	// invitations
+	defaultMethod        = string(ics.MethodPublish)
+	defaultCalendarScale = "GREGORIAN"
+)
+
+// WithProductID sets the PRODID of the calendar, such as
+// "-//Example Inc//Team Calendar//EN".
+func WithProductID(id string) ConvertOption {
+	return func(o *convertOptions) {
+		o.productID = id
+	}
+}
+
+// WithRefreshInterval sets how often calendar apps should refresh the
+// calendar. Zero omits the refresh interval.
+func WithRefreshInterval(d time.Duration) ConvertOption {
+	return func(o *convertOptions) {
+		o.refreshInterval = ""
+		if d > 0 {
+			o.refreshInterval = formatDuration(d)
+		}
+	}
+}
+
+// WithColor sets the colour of the calendar, as a CSS colour name such as
+// "teal" for COLOR, or a hex colour such as "#008080" for Apple Calendar.
+func WithColor(color string) ConvertOption {
+	return func(o *convertOptions) {
+		o.color = color
+	}
+}
+
+// WithMethod sets the METHOD of the calendar, which is "PUBLISH" by
+// default. An empty method omits METHOD.
+func WithMethod(method string) ConvertOption {
+	return func(o *convertOptions) {
+		o.method = method
+	}
+}
+
+// WithCalendarScale sets the CALSCALE of the calendar, which is "GREGORIAN"
+// by default. An empty scale omits CALSCALE.
+func WithCalendarScale(scale string) ConvertOption {
+	return func(o *convertOptions) {
+		o.calendarScale = scale
+	}
+}
+
+// setCalendarProperties sets the properties of the calendar from the
+// options.
+func setCalendarProperties(cal *ics.Calendar, o convertOptions) {
+	cal.SetName(o.name)
+	cal.SetProductId(o.productID)
+	if o.calendarScale != "" {
+		cal.SetCalscale(o.calendarScale)
+	}
+	if o.method != "" {
+		cal.SetMethod(ics.Method(o.method))
+	}
+	if o.refreshInterval != "" {
+		cal.SetRefreshInterval(o.refreshInterval)
+	}
+	if strings.HasPrefix(o.color, "#") {
+		// COLOR only accepts CSS colour names
+		cal.CalendarProperties = append(cal.CalendarProperties, ics.CalendarProperty{
+			BaseProperty: ics.BaseProperty{IANAToken: "X-APPLE-CALENDAR-COLOR", Value: o.color},
+		})
+	} else if o.color != "" {
+		cal.SetColor(o.color)
+	}
+	if o.zone != nil && !o.freeBusy {
+		cal.SetXWRTimezone(o.zone.String())
+	}
+	setCompatProperties(cal, o)
+}
+
+// formatDuration formats a duration as an iCalendar DURATION, such as
+// "P1DT12H".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+
+	var b strings.Builder
+	b.WriteString("P")
+	if days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+	}
+	if d > 0 {
+		b.WriteString("T")
+		if h := d / time.Hour; h > 0 {
+			fmt.Fprintf(&b, "%dH", h)
+		}
+		if m := d / time.Minute % 60; m > 0 {
+			fmt.Fprintf(&b, "%dM", m)
+		}
+		if s := d / time.Second % 60; s > 0 {
+			fmt.Fprintf(&b, "%dS", s)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package notion_ical
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arran4/golang-ical"
+)
+
+var ErrUnknownClient = errors.New("unknown client")
+
+// Client is a calendar client with parsing quirks that output can be
+// adjusted for.
+type Client string
+
+const (
+	ClientGoogle  Client = "google"
+	ClientOutlook Client = "outlook"
+	ClientApple   Client = "apple"
+)
+
+// ParseClient parses the name of a client, such as "google".
+func ParseClient(name string) (Client, error) {
+	switch client := Client(strings.ToLower(name)); client {
+	case ClientGoogle, ClientOutlook, ClientApple:
+		return client, nil
+	}
+	return "", fmt.Errorf("%w %q: expected %q, %q or %q", ErrUnknownClient, name, ClientGoogle, ClientOutlook, ClientApple)
+}
+
+// WithCompat adjusts the output for the quirks of a client:
+//
+//   - Google Calendar merges events with the same UID across every
+//     calendar, so UIDs are made unique to the calendar name.
+//   - Google Calendar and Outlook ignore REFRESH-INTERVAL, so
+//     X-PUBLISHED-TTL is also set.
+//   - Google Calendar and Outlook drop the space at the start of
+//     continuation lines, so lines are never folded before a space.
+//   - Google Calendar and Outlook hide all-day events that end when they
+//     start, so they end a day later. Outlook also marks them with
+//     X-MICROSOFT-CDO-ALLDAYEVENT.
+//   - Apple Calendar shows single day all-day events with an end as
+//     spanning two days in some views, so DTEND is left out.
+func WithCompat(client Client) ConvertOption {
+	return func(o *convertOptions) {
+		o.compat = client
+	}
+}
+
+// uid returns the UID of an event.
+func (o convertOptions) uid(event Event) string {
+	if o.compat != ClientGoogle || o.name == "" {
+		return event.ID
+	}
+	hash := sha256.Sum256([]byte(o.name))
+	suffix := "-" + hex.EncodeToString(hash[:4])
+	if local, domain, ok := strings.Cut(event.ID, "@"); ok {
+		return local + suffix + "@" + domain
+	}
+	return event.ID + suffix
+}
+
+// allDayEnd returns the DTEND of an all-day event, and false when DTEND is
+// left out.
+func (o convertOptions) allDayEnd(event Event) (time.Time, bool) {
+	switch o.compat {
+	case ClientGoogle, ClientOutlook:
+		if !event.End.After(event.Start) {
+			return event.Start.AddDate(0, 0, 1), true
+		}
+	case ClientApple:
+		if !event.End.After(event.Start.AddDate(0, 0, 1)) {
+			return time.Time{}, false
+		}
+	}
+	return event.End, true
+}
+
+// setCompatProperties sets the calendar properties of the client.
+func setCompatProperties(cal *ics.Calendar, o convertOptions) {
+	switch o.compat {
+	case ClientGoogle, ClientOutlook:
+		if o.refreshInterval != "" {
+			cal.SetXPublishedTTL(o.refreshInterval)
+		}
+	}
+}
+
+// setCompatAllDay marks an all-day event for the client.
+func setCompatAllDay(calEvent *ics.VEvent, o convertOptions) {
+	if o.compat == ClientOutlook {
+		calEvent.SetProperty(ics.ComponentProperty("X-MICROSOFT-CDO-ALLDAYEVENT"), "TRUE")
+	}
+}
+
+// refoldsLines reports whether serialized lines are folded again for the
+// client.
+func (o convertOptions) refoldsLines() bool {
+	return o.compat == ClientGoogle || o.compat == ClientOutlook
+}
+
+// refoldLines folds the lines of a serialized calendar at 75 octets, without
+// splitting characters or starting continuation lines with whitespace.
+func refoldLines(b []byte) []byte {
+	var out bytes.Buffer
+	var line []byte
+	flush := func() {
+		if line == nil {
+			return
+		}
+		foldLine(&out, line)
+		line = nil
+	}
+
+	for _, physical := range bytes.Split(b, []byte("\r\n")) {
+		if len(physical) > 0 && (physical[0] == ' ' || physical[0] == '\t') && line != nil {
+			line = append(line, physical[1:]...)
+			continue
+		}
+		flush()
+		if len(physical) > 0 {
+			line = append([]byte{}, physical...)
+		}
+	}
+	flush()
+	return out.Bytes()
+}
+
+// foldLine writes an unfolded line, folded at 75 octets.
+func foldLine(out *bytes.Buffer, line []byte) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := 0
+		for cut < len(line) {
+			_, size := utf8.DecodeRune(line[cut:])
+			if cut+size > limit {
+				break
+			}
+			cut += size
+		}
+		// Move the fold before any whitespace, which would be dropped
+		for cut > 1 && (line[cut] == ' ' || line[cut] == '\t') {
+			_, size := utf8.DecodeLastRune(line[:cut])
+			cut -= size
+		}
+		out.Write(line[:cut])
+		out.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		limit = maxLineOctets - 1
+	}
+	out.Write(line)
+	out.WriteString("\r\n")
+}
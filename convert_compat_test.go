@@ -0,0 +1,132 @@
+package notion_ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// unfoldLines joins continuation lines, as a client would.
+func unfoldLines(b []byte) string {
+	return strings.ReplaceAll(strings.ReplaceAll(string(b), "\r\n ", ""), "\r\n\t", "")
+}
+
+func TestFoldLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "SUMMARY:Standup", "SUMMARY:Standup\r\n"},
+		{"exactly 75 octets", "X:" + strings.Repeat("a", 73), "X:" + strings.Repeat("a", 73) + "\r\n"},
+		{"76 octets", "X:" + strings.Repeat("a", 74), "X:" + strings.Repeat("a", 73) + "\r\n a\r\n"},
+		{
+			"continuation lines hold 74 octets",
+			"X:" + strings.Repeat("a", 73+74+1),
+			"X:" + strings.Repeat("a", 73) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n",
+		},
+		{"fold after a space", "X:" + strings.Repeat("a", 72) + " b", "X:" + strings.Repeat("a", 72) + " \r\n b\r\n"},
+		{"fold before spaces", "X:" + strings.Repeat("a", 71) + "   b", "X:" + strings.Repeat("a", 70) + "\r\n a   b\r\n"},
+		{"multibyte characters", "X:" + strings.Repeat("a", 72) + "é", "X:" + strings.Repeat("a", 72) + "\r\n é\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			foldLine(&out, []byte(test.line))
+			if got := out.String(); got != test.want {
+				t.Errorf("foldLine() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFoldLineLimits(t *testing.T) {
+	lines := []string{
+		"DESCRIPTION:" + strings.Repeat("Notion → iCal ☕ ", 30),
+		"DESCRIPTION:" + strings.Repeat("日本語", 60),
+		"DESCRIPTION:" + strings.Repeat("a ", 100),
+		"DESCRIPTION:" + strings.Repeat("🗓", 50),
+	}
+	for _, line := range lines {
+		var out bytes.Buffer
+		foldLine(&out, []byte(line))
+		if got := unfoldLines(out.Bytes()); got != line+"\r\n" {
+			t.Errorf("unfolded %q, want %q", got, line)
+		}
+		physical := strings.Split(strings.TrimSuffix(out.String(), "\r\n"), "\r\n")
+		for i, p := range physical {
+			if len(p) > maxLineOctets {
+				t.Errorf("line %d is %d octets: %q", i, len(p), p)
+			}
+			if !utf8.ValidString(p) {
+				t.Errorf("line %d splits a character: %q", i, p)
+			}
+			if i > 0 && (len(p) < 2 || p[1] == ' ' || p[1] == '\t') {
+				t.Errorf("continuation line %d starts with whitespace: %q", i, p)
+			}
+		}
+	}
+}
+
+func TestRefoldLines(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("a", 63) + " " + strings.Repeat("b", 20)
+	var folded bytes.Buffer
+	foldLine(&folded, []byte(long))
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"short lines", "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"},
+		{
+			"folded before a space",
+			"DESCRIPTION:" + strings.Repeat("a", 63) + "\r\n  " + strings.Repeat("b", 20) + "\r\n",
+			folded.String(),
+		},
+		{
+			"folded with a tab",
+			"SUMMARY:Long\r\n\ttitle\r\n",
+			"SUMMARY:Longtitle\r\n",
+		},
+		{
+			"folded in the middle of a character",
+			"SUMMARY:caf\xc3\r\n \xa9\r\n",
+			"SUMMARY:café\r\n",
+		},
+		{
+			"no trailing line break",
+			"BEGIN:VEVENT\r\nEND:VEVENT",
+			"BEGIN:VEVENT\r\nEND:VEVENT\r\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(refoldLines([]byte(test.input))); got != test.want {
+				t.Errorf("refoldLines() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Client
+		wantErr bool
+	}{
+		{"google", ClientGoogle, false},
+		{"Outlook", ClientOutlook, false},
+		{"APPLE", ClientApple, false},
+		{"thunderbird", "", true},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		got, err := ParseClient(test.name)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("ParseClient(%q) = %q, %v, want %q, error %v", test.name, got, err, test.want, test.wantErr)
+		}
+	}
+}
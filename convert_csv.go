@@ -0,0 +1,55 @@
+package notion_ical
+
+import (
+	"encoding/csv"
+	"io"
+	"time"
+)
+
+// ConvertCSV writes events from the source as a flat CSV file with title,
+// start, end and URL columns, followed by a column for each of properties.
+func ConvertCSV(source Source, w io.Writer, properties []string, opts ...ConvertOption) error {
+	o := newConvertOptions(opts)
+
+	events, err := source.ReadAll()
+	if err != nil {
+		return err
+	}
+	events = MapEvents(events, o.mappers...)
+	events = limitEvents(events, o.limit)
+
+	csvWriter := csv.NewWriter(w)
+
+	headers := append([]string{"Title", "Start", "End", "URL"}, properties...)
+	if err := csvWriter.Write(headers); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		values := make(map[string]string)
+		for _, property := range event.Properties {
+			values[property.NameString()] = property.ValueString()
+		}
+
+		record := []string{event.Title, formatCSVTime(event.Start, event.AllDay), formatCSVTime(event.End, event.AllDay), event.URL}
+		for _, name := range properties {
+			record = append(record, values[name])
+		}
+
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	o.logger.Printf("Processed %d events", len(events))
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func formatCSVTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339)
+}
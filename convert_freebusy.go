@@ -0,0 +1,81 @@
+package notion_ical
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/arran4/golang-ical"
+)
+
+// WithFreeBusy replaces events with a single VFREEBUSY component listing
+// when events are busy, without titles or other details. Only the first
+// occurrence of recurring events is included.
+func WithFreeBusy() ConvertOption {
+	return func(o *convertOptions) {
+		o.freeBusy = true
+	}
+}
+
+// busyPeriod is a period of time in UTC.
+type busyPeriod struct {
+	start time.Time
+	end   time.Time
+}
+
+// busyPeriods merges the times of events into sorted, non-overlapping
+// periods. All-day events are busy for the whole day in their timezone.
+func busyPeriods(events []Event) []busyPeriod {
+	var periods []busyPeriod
+	for _, event := range events {
+		if !event.End.After(event.Start) {
+			continue
+		}
+		periods = append(periods, busyPeriod{event.Start.UTC(), event.End.UTC()})
+	}
+
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].start.Before(periods[j].start)
+	})
+
+	var merged []busyPeriod
+	for _, period := range periods {
+		if n := len(merged); n > 0 && !period.start.After(merged[n-1].end) {
+			if period.end.After(merged[n-1].end) {
+				merged[n-1].end = period.end
+			}
+			continue
+		}
+		merged = append(merged, period)
+	}
+	return merged
+}
+
+// addFreeBusy adds a VFREEBUSY component with the busy periods of events.
+func addFreeBusy(cal *ics.Calendar, name string, events []Event, o convertOptions) {
+	periods := busyPeriods(events)
+
+	fb := &ics.GeneralComponent{Token: string(ics.ComponentVFreeBusy)}
+	sum := sha256.Sum256([]byte(name))
+	fb.SetProperty(ics.ComponentPropertyUniqueId, hex.EncodeToString(sum[:16])+"@notion-ical-freebusy")
+
+	var start time.Time
+	if len(periods) > 0 {
+		start = periods[0].start
+	}
+	fb.SetProperty(ics.ComponentPropertyDtstamp, o.dtstamp(Event{Start: start}).UTC().Format("20060102T150405Z"))
+
+	if len(periods) > 0 {
+		fb.SetProperty(ics.ComponentPropertyDtStart, periods[0].start.Format("20060102T150405Z"))
+		fb.SetProperty(ics.ComponentPropertyDtEnd, periods[len(periods)-1].end.Format("20060102T150405Z"))
+	}
+	for _, period := range periods {
+		fb.AddProperty(ics.ComponentPropertyFreebusy, period.start.Format("20060102T150405Z")+"/"+period.end.Format("20060102T150405Z"), &ics.KeyValues{
+			Key:   string(ics.ParameterFbtype),
+			Value: []string{string(ics.FreeBusyTimeTypeBusy)},
+		})
+	}
+
+	cal.Components = append(cal.Components, fb)
+}
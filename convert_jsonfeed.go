@@ -0,0 +1,117 @@
+package notion_ical
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonFeedVersion is the version of JSON Feed that is written.
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url,omitempty"`
+	Title         string `json:"title"`
+	ContentText   string `json:"content_text"`
+	ContentHTML   string `json:"content_html,omitempty"`
+	DatePublished string `json:"date_published,omitempty"`
+	DateModified  string `json:"date_modified,omitempty"`
+	// Tags are the categories of the event
+	Tags []string `json:"tags,omitempty"`
+	// Event is the time of the event, as an extension of JSON Feed
+	Event jsonFeedEvent `json:"_event"`
+}
+
+// jsonFeedEvent is the time of an event, with dates without times for
+// all-day events. End is exclusive for all-day events.
+type jsonFeedEvent struct {
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	AllDay     bool   `json:"all_day"`
+	Recurrence string `json:"recurrence,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Location   string `json:"location,omitempty"`
+}
+
+// ConvertJSONFeed writes events from the source as a JSON Feed, which is
+// simpler to read than iCalendar for web pages and automations. Each event is
+// an item with its time in the "_event" extension.
+func ConvertJSONFeed(source Source, w io.Writer, opts ...ConvertOption) error {
+	return ConvertJSONFeedContext(context.Background(), source, w, opts...)
+}
+
+// ConvertJSONFeedContext is ConvertJSONFeed with a context for cancellation
+// and tracing.
+func ConvertJSONFeedContext(ctx context.Context, source Source, w io.Writer, opts ...ConvertOption) (err error) {
+	ctx, span := tracer.Start(ctx, "ConvertJSONFeed")
+	defer func() { endSpan(span, err) }()
+
+	o := newConvertOptions(append([]ConvertOption{WithCalendarName(source.Name())}, opts...))
+
+	events, err := ReadAll(ctx, source)
+	if err != nil {
+		return err
+	}
+	return convertJSONFeedEvents(events, w, o)
+}
+
+// ConvertJSONFeedEvents writes events that were already read, such as with
+// ReadAll, as a JSON Feed. The feed is named with WithCalendarName.
+func ConvertJSONFeedEvents(events []Event, w io.Writer, opts ...ConvertOption) error {
+	return convertJSONFeedEvents(events, w, newConvertOptions(opts))
+}
+
+func convertJSONFeedEvents(events []Event, w io.Writer, o convertOptions) error {
+	events = MapEvents(events, o.mappers...)
+	events = collapseRecurring(events)
+	events = limitEvents(events, o.limit)
+
+	feed := jsonFeed{
+		Version: jsonFeedVersion,
+		Title:   o.name,
+		Items:   make([]jsonFeedItem, 0, len(events)),
+	}
+	for _, event := range events {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            o.uid(event),
+			URL:           event.URL,
+			Title:         event.Emoji + event.Title,
+			ContentText:   event.Description(),
+			ContentHTML:   event.HTMLDescription(),
+			DatePublished: formatJSONFeedDate(event.Created),
+			DateModified:  formatJSONFeedDate(event.LastEdited),
+			Tags:          event.Categories,
+			Event: jsonFeedEvent{
+				Start:      formatCSVTime(event.Start, event.AllDay),
+				End:        formatCSVTime(event.End, event.AllDay),
+				AllDay:     event.AllDay,
+				Recurrence: event.Recurrence,
+				Status:     event.Status,
+				Location:   event.Location,
+			},
+		})
+	}
+
+	o.logger.Printf("Processed %d events", len(events))
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(feed)
+}
+
+// formatJSONFeedDate formats a time as RFC 3339, or an empty string when it
+// is unknown.
+func formatJSONFeedDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
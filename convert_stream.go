@@ -0,0 +1,92 @@
+package notion_ical
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/arran4/golang-ical"
+)
+
+// streams reports whether events can be written as they are read, which
+// needs no option that looks at all events together.
+func (o convertOptions) streams() bool {
+	return o.limit <= 0 && !o.freeBusy && o.zone == nil
+}
+
+// convertStream writes each event of source as it is read, so that neither
+// the events nor the calendar are held in memory as a whole. Recurring
+// events are held back until the end, to be collapsed into their series.
+func convertStream(ctx context.Context, source StreamSource, ical io.Writer, o convertOptions) (err error) {
+	_, serializeSpan := tracer.Start(ctx, "SerializeICS")
+	defer func() { endSpan(serializeSpan, err) }()
+
+	w := icsWriter{w: ical, refold: o.refoldsLines()}
+
+	cal := ics.NewCalendar()
+	setCalendarProperties(cal, o)
+	if err := w.write(strings.TrimSuffix(cal.Serialize(), "END:VCALENDAR\r\n")); err != nil {
+		return err
+	}
+
+	count := 0
+	var recurring []Event
+	add := func(event Event) error {
+		count++
+		cal.Components = nil
+		if o.todos {
+			addTodo(cal, event, o)
+		} else {
+			addEvent(cal, event, o)
+		}
+		return w.write(serializeComponents(cal))
+	}
+
+	err = source.StreamContext(ctx, func(event Event) error {
+		event, ok := mapEvent(event, o.mappers)
+		if !ok {
+			return nil
+		}
+		if event.Recurrence != "" {
+			recurring = append(recurring, event)
+			return nil
+		}
+		return add(event)
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range collapseRecurring(recurring) {
+		if err := add(event); err != nil {
+			return err
+		}
+	}
+
+	o.logger.Printf("Processed %d events", count)
+
+	return w.write("END:VCALENDAR\r\n")
+}
+
+// icsWriter writes parts of a serialized calendar, folding their lines
+// again for the client when refold is set.
+type icsWriter struct {
+	w      io.Writer
+	refold bool
+}
+
+func (w icsWriter) write(s string) error {
+	b := []byte(s)
+	if w.refold {
+		b = refoldLines(b)
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// serializeComponents serializes the components of cal without the
+// calendar around them.
+func serializeComponents(cal *ics.Calendar) string {
+	s := (&ics.Calendar{Components: cal.Components}).Serialize()
+	s = strings.TrimPrefix(s, "BEGIN:VCALENDAR\r\n")
+	return strings.TrimSuffix(s, "END:VCALENDAR\r\n")
+}
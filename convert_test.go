@@ -0,0 +1,113 @@
+package notion_ical_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/serverwentdown/notion-ical"
+	"github.com/serverwentdown/notion-ical/notionicaltest"
+)
+
+func TestConvertGolden(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standup := notionicaltest.TimedEvent("Standup", time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC), 15*time.Minute)
+	standup.Recurrence = "FREQ=WEEKLY;BYDAY=MO"
+	standup.Exceptions = []time.Time{time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)}
+
+	holiday := notionicaltest.AllDayEvent("Holiday", 2024, time.January, 1, 1)
+	holiday.Recurrence = "FREQ=YEARLY"
+	holiday.Exceptions = []time.Time{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	review := notionicaltest.WithProperties(
+		notionicaltest.TimedEvent("Review", time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Hour),
+		notionicaltest.Property{Name: "Owner", Value: "Ann"},
+	)
+
+	doneTask := notionicaltest.AllDayEvent("Send invoices", 2024, time.February, 1, 1)
+	doneTask.Status = "Done"
+	doneTask.LastEdited = time.Date(2024, 2, 1, 17, 0, 0, 0, time.UTC)
+	openTask := notionicaltest.TimedEvent("Call supplier", time.Date(2024, 2, 2, 10, 0, 0, 0, time.UTC), 0)
+	openTask.Status = "Not started"
+
+	tests := []struct {
+		name   string
+		golden string
+		events []notion_ical.Event
+		opts   []notion_ical.ConvertOption
+	}{
+		{
+			name:   "all-day",
+			golden: "testdata/all_day.ics",
+			events: []notion_ical.Event{
+				notionicaltest.AllDayEvent("Offsite", 2024, time.April, 10, 3),
+				notionicaltest.AllDayEvent("Launch", 2024, time.April, 15, 1),
+			},
+		},
+		{
+			name:   "recurrence with exceptions",
+			golden: "testdata/recurrence.ics",
+			events: []notion_ical.Event{standup, holiday},
+		},
+		{
+			name:   "timezone",
+			golden: "testdata/timezone.ics",
+			events: []notion_ical.Event{standup, review},
+			opts:   []notion_ical.ConvertOption{notion_ical.WithTimezone(berlin)},
+		},
+		{
+			name:   "todos",
+			golden: "testdata/todos.ics",
+			events: []notion_ical.Event{doneTask, openTask},
+			opts:   []notion_ical.ConvertOption{notion_ical.WithTodos()},
+		},
+		{
+			name:   "free/busy",
+			golden: "testdata/free_busy.ics",
+			events: []notion_ical.Event{
+				review,
+				notionicaltest.TimedEvent("Overlapping", time.Date(2024, 3, 5, 15, 0, 0, 0, time.UTC), time.Hour),
+				notionicaltest.AllDayEvent("Offsite", 2024, time.April, 10, 3),
+			},
+			opts: []notion_ical.ConvertOption{notion_ical.WithFreeBusy()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := notionicaltest.NewSource("Team", test.events...)
+			got := notionicaltest.Convert(t, source, test.opts...)
+			notionicaltest.AssertGolden(t, test.golden, got)
+
+			// Events that were already read convert the same
+			var buf bytes.Buffer
+			opts := append([]notion_ical.ConvertOption{notion_ical.WithCalendarName("Team")}, test.opts...)
+			if err := notion_ical.ConvertEvents(test.events, &buf, opts...); err != nil {
+				t.Fatalf("ConvertEvents: %v", err)
+			}
+			notionicaltest.AssertGolden(t, test.golden, buf.Bytes())
+
+			violations, err := notion_ical.Validate(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			for _, violation := range violations {
+				t.Errorf("violation: %v", violation)
+			}
+		})
+	}
+}
+
+func TestConvertSourceError(t *testing.T) {
+	source := notionicaltest.NewSource("Team")
+	source.Err = notion_ical.ErrNoDateProperty
+
+	var buf bytes.Buffer
+	if err := notion_ical.Convert(source, &buf); err != notion_ical.ErrNoDateProperty {
+		t.Errorf("Convert() = %v, want %v", err, notion_ical.ErrNoDateProperty)
+	}
+}
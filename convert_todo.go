@@ -0,0 +1,92 @@
+package notion_ical
+
+import (
+	"strings"
+
+	"github.com/arran4/golang-ical"
+)
+
+// WithTodos converts events into VTODO components for task apps, due at the
+// end of the event, with a status from Event.Status.
+func WithTodos() ConvertOption {
+	return func(o *convertOptions) {
+		o.todos = true
+	}
+}
+
+// notionTodoStatuses maps status, select and checkbox values of task
+// databases to VTODO statuses, ignoring case.
+var notionTodoStatuses = map[string]ics.ObjectStatus{
+	"done":        ics.ObjectStatusCompleted,
+	"complete":    ics.ObjectStatusCompleted,
+	"completed":   ics.ObjectStatusCompleted,
+	"yes":         ics.ObjectStatusCompleted,
+	"true":        ics.ObjectStatusCompleted,
+	"checked":     ics.ObjectStatusCompleted,
+	"in progress": ics.ObjectStatusInProcess,
+	"doing":       ics.ObjectStatusInProcess,
+	"started":     ics.ObjectStatusInProcess,
+	"cancelled":   ics.ObjectStatusCancelled,
+	"canceled":    ics.ObjectStatusCancelled,
+}
+
+// todoStatus maps the status of an event to a VTODO status. Unknown
+// statuses need action.
+func todoStatus(status string) ics.ObjectStatus {
+	if s, ok := notionTodoStatuses[strings.ToLower(strings.TrimSpace(status))]; ok {
+		return s
+	}
+	return ics.ObjectStatusNeedsAction
+}
+
+// addTodo adds the event to the calendar as a VTODO. Tasks with a date range
+// start at the start of the event.
+func addTodo(cal *ics.Calendar, event Event, o convertOptions) {
+	todo := &ics.VTodo{}
+	todo.SetProperty(ics.ComponentPropertyUniqueId, o.uid(event))
+	todo.SetProperty(ics.ComponentPropertySummary, ics.ToText(event.Title))
+	todo.SetProperty(ics.ComponentPropertyDtstamp, o.dtstamp(event).UTC().Format("20060102T150405Z"))
+	if !event.Created.IsZero() {
+		todo.SetProperty(ics.ComponentPropertyCreated, event.Created.UTC().Format("20060102T150405Z"))
+	}
+
+	if event.AllDay {
+		// End is exclusive, so the last day is the day before
+		due := event.End.AddDate(0, 0, -1)
+		if due.After(event.Start) {
+			setAllDayDate(&todo.ComponentBase, ics.ComponentPropertyDtStart, event.Start)
+		} else {
+			due = event.Start
+		}
+		setAllDayDate(&todo.ComponentBase, ics.ComponentProperty(ics.PropertyDue), due)
+	} else {
+		due := event.End
+		if due.After(event.Start) {
+			setZonedTime(&todo.ComponentBase, ics.ComponentPropertyDtStart, event.Start, o.zone)
+		} else {
+			due = event.Start
+		}
+		setZonedTime(&todo.ComponentBase, ics.ComponentProperty(ics.PropertyDue), due, o.zone)
+	}
+
+	status := todoStatus(event.Status)
+	todo.SetProperty(ics.ComponentPropertyStatus, string(status))
+	switch status {
+	case ics.ObjectStatusCompleted:
+		todo.SetProperty(ics.ComponentProperty(ics.PropertyPercentComplete), "100")
+		if !event.LastEdited.IsZero() {
+			todo.SetProperty(ics.ComponentProperty(ics.PropertyCompleted), event.LastEdited.UTC().Format("20060102T150405Z"))
+		}
+	case ics.ObjectStatusNeedsAction:
+		todo.SetProperty(ics.ComponentProperty(ics.PropertyPercentComplete), "0")
+	}
+
+	if event.Recurrence != "" {
+		todo.AddProperty(ics.ComponentPropertyRrule, event.Recurrence)
+	}
+	todo.SetProperty(ics.ComponentPropertyDescription, ics.ToText(event.Description()))
+	setHTMLDescription(&todo.ComponentBase, event, o)
+	setEventDetails(&todo.ComponentBase, event)
+
+	cal.Components = append(cal.Components, todo)
+}
@@ -0,0 +1,77 @@
+package notion_ical
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxDebugBody is how much of each body DebugTransport logs.
+const maxDebugBody = 16 << 10
+
+// DebugTransport logs each request to the Notion API with the status and
+// timing of its response, such as to diagnose schema mismatches and empty
+// fields without a proxy. Set it as the transport of
+// ConfigSourceAPI.HTTPClient. Headers, including the API key in the
+// Authorization header, are not logged.
+type DebugTransport struct {
+	// Transport sends the requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	// Logger receives the requests, instead of the standard logger.
+	Logger Logger
+	// Bodies logs the bodies of requests and responses as well, up to
+	// 16 KiB each. Bodies contain the content of pages.
+	Bodies bool
+}
+
+func (t *DebugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := loggerOrDefault(t.Logger)
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if t.Bodies {
+		var b []byte
+		var err error
+		req, b, err = readRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			logger.Printf("%s %s request body: %s", req.Method, req.URL, debugBody(b))
+		}
+	}
+
+	start := time.Now()
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		logger.Printf("%s %s failed after %v: %v", req.Method, req.URL, time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+
+	if !t.Bodies {
+		logger.Printf("%s %s: %s in %v", req.Method, req.URL, res.Status, time.Since(start).Round(time.Millisecond))
+		return res, nil
+	}
+
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		logger.Printf("%s %s: %s, failed reading body after %v: %v", req.Method, req.URL, res.Status, duration, err)
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	logger.Printf("%s %s: %s in %v, body: %s", req.Method, req.URL, res.Status, duration, debugBody(b))
+	return res, nil
+}
+
+// debugBody returns the start of a body for logs.
+func debugBody(b []byte) string {
+	if len(b) <= maxDebugBody {
+		return string(b)
+	}
+	return string(b[:maxDebugBody]) + "... (truncated)"
+}
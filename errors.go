@@ -0,0 +1,87 @@
+package notion_ical
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// Errors of the Notion API. They wrap the error of the client, so that
+// errors.As still finds the *notion.APIError.
+var (
+	// ErrUnauthorized is an invalid or revoked API key, or an integration
+	// without access to the database.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited is a request rejected because too many requests were
+	// made with the API key.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrDatabaseNotFound is a database that does not exist, or that is not
+	// shared with the integration.
+	ErrDatabaseNotFound = errors.New("database not found")
+)
+
+// ErrSchemaMismatch is a property with a type that cannot be read as
+// configured, such as a date property that is a text property, or a filter
+// or sort the API rejected for the properties of the database.
+var ErrSchemaMismatch = errors.New("property has the wrong type")
+
+// ErrParse is a value that could not be parsed. ErrParseDate, ErrCSVRead
+// and ErrInvalidRecurrence are also ErrParse.
+var ErrParse = errors.New("parse error")
+
+// kindError is a sentinel error that is also the error of its kind, such as
+// ErrParseDate being an ErrParse.
+type kindError struct {
+	message string
+	kind    error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind || errors.Is(e.kind, target)
+}
+
+// apiError is an error of the Notion API together with its cause.
+type apiError struct {
+	err   error
+	cause error
+}
+
+func (e apiError) Error() string {
+	return e.err.Error()
+}
+
+func (e apiError) Unwrap() []error {
+	return []error{e.err, e.cause}
+}
+
+// notionAPIError wraps errors of the Notion API with the error of their
+// cause: notFound for missing objects, and invalid for requests that failed
+// validation, when they are not nil.
+func notionAPIError(err, notFound, invalid error) error {
+	var e *notion.APIError
+	if !errors.As(err, &e) {
+		return err
+	}
+
+	var cause error
+	switch {
+	case e.Status == http.StatusUnauthorized, e.Status == http.StatusForbidden,
+		e.Code == "unauthorized", e.Code == "restricted_resource":
+		cause = ErrUnauthorized
+	case e.Status == http.StatusTooManyRequests, e.Code == "rate_limited":
+		cause = ErrRateLimited
+	case e.Status == http.StatusNotFound, e.Code == "object_not_found":
+		cause = notFound
+	case e.Status == http.StatusBadRequest:
+		cause = invalid
+	}
+	if cause == nil {
+		return err
+	}
+	return apiError{err, cause}
+}
@@ -1,6 +1,7 @@
 package notion_ical
 
 import (
+	"html"
 	"strings"
 	"time"
 )
@@ -13,34 +14,150 @@ type Event struct {
 
 	Start time.Time
 	End   time.Time
+	// AllDay is set when the event has dates without times. End is
+	// exclusive for all-day events.
+	AllDay bool
+	// Recurrence is an RFC 5545 RRULE value, such as "FREQ=WEEKLY", when
+	// the event repeats.
+	Recurrence string
+	// Exceptions are the dates of skipped occurrences of a recurring event.
+	// Only the date is used, the time of day is taken from Start.
+	Exceptions []time.Time
 
+	// Status is the value of the status property of a task, such as
+	// "Done", or "Yes" for a checkbox. Events with a status of "Tentative",
+	// "Confirmed" or "Cancelled" have that status.
+	Status string
+
+	// Location is where the event takes place, such as an address or the
+	// link of a call.
+	Location string
+	// Attendees are the people taking part in the event.
+	Attendees []Attendee
+	// Categories are the tags of the event, such as the options of a
+	// multi-select property.
+	Categories []string
+	// Alarms remind of the event before it starts.
+	Alarms []Alarm
+
+	// Created is when the page was created, if known.
+	Created time.Time
+	// LastEdited is when the page was last edited, if known, and the
+	// LAST-MODIFIED time of the event.
+	LastEdited time.Time
+
+	// Content is page content as Markdown, in blocks separated by blank
+	// lines.
 	Content []string
-	Properties []EventProperty
+	// ContentHTML is page content as HTML, if the source renders it.
+	ContentHTML string
+	Properties  []EventProperty
+}
+
+// Attendee is a person taking part in an event. Attendees without an email
+// address are left out of iCal output, which identifies them by address.
+type Attendee struct {
+	Name  string
+	Email string
+}
+
+// Alarm reminds of an event Before it starts, or at its start when zero.
+type Alarm struct {
+	Before time.Duration
+}
+
+// splitList splits a value separated by commas, such as the options of a
+// multi-select property, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listAttendees reads attendees from a list of email addresses or names.
+func listAttendees(items []string) []Attendee {
+	attendees := make([]Attendee, 0, len(items))
+	for _, item := range items {
+		if strings.Contains(item, "@") {
+			attendees = append(attendees, Attendee{Email: strings.TrimPrefix(item, "mailto:")})
+		} else {
+			attendees = append(attendees, Attendee{Name: item})
+		}
+	}
+	return attendees
 }
 
 func (e Event) Description() string {
-	var s []string
+	// Property values are usually short, while content can be long
+	n := len(e.Properties) * descriptionLineLen
+	for _, content := range e.Content {
+		n += len(content) + 2
+	}
+
+	var b strings.Builder
+	b.Grow(n)
 	for _, property := range e.Properties {
-		line := property.NameString() + ":"
+		b.WriteString(property.NameString())
+		b.WriteString(":")
 
 		value := property.ValueString()
 		if strings.Contains(value, "\n") {
-			line += "\n" + value
+			b.WriteString("\n")
 		} else {
-			line += " " + value
+			b.WriteString(" ")
 		}
-
-		s = append(s, line, "\n")
+		b.WriteString(value)
+		b.WriteString("\n")
 	}
 
 	for _, content := range e.Content {
-		s = append(s, content, "\n\n")
+		b.WriteString(content)
+		b.WriteString("\n\n")
 	}
 
-	return strings.Join(s, "")
+	return b.String()
+}
+
+// descriptionLineLen is the expected length of a property in descriptions.
+const descriptionLineLen = 32
+
+// HTMLDescription is Description as HTML, with page content from
+// ContentHTML.
+func (e Event) HTMLDescription() string {
+	var b strings.Builder
+	b.Grow(len(e.Properties)*(descriptionLineLen+16) + len(e.ContentHTML))
+	for _, property := range e.Properties {
+		var value string
+		if p, ok := property.(EventPropertyHTML); ok {
+			value = p.ValueHTML()
+		} else {
+			value = html.EscapeString(property.ValueString())
+			value = strings.ReplaceAll(value, "\n", "<br>")
+		}
+		b.WriteString("<p><b>")
+		b.WriteString(html.EscapeString(property.NameString()))
+		b.WriteString(":</b> ")
+		b.WriteString(value)
+		b.WriteString("</p>")
+	}
+
+	b.WriteString(e.ContentHTML)
+
+	return b.String()
 }
 
 type EventProperty interface {
 	NameString() string
 	ValueString() string
 }
+
+// EventPropertyHTML is implemented by properties with values that keep
+// links when rendered as HTML, for HTMLDescription.
+type EventPropertyHTML interface {
+	EventProperty
+	ValueHTML() string
+}
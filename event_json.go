@@ -0,0 +1,94 @@
+package notion_ical
+
+import "encoding/json"
+
+// MarshalEvents encodes events as JSON, such as to keep events that were
+// read across restarts. Properties are kept as their text, and as HTML when
+// they have links, because properties of different sources cannot be
+// decoded.
+func MarshalEvents(events []Event) ([]byte, error) {
+	encoded := make([]jsonEvent, len(events))
+	for i, event := range events {
+		encoded[i] = newJSONEvent(event)
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalEvents decodes events encoded by MarshalEvents.
+func UnmarshalEvents(b []byte) ([]Event, error) {
+	var encoded []jsonEvent
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(encoded))
+	for i, event := range encoded {
+		events[i] = event.event()
+	}
+	return events, nil
+}
+
+// jsonEvent is an event with its properties rendered as text and HTML.
+type jsonEvent struct {
+	Event
+	Properties []jsonProperty `json:"Properties"`
+}
+
+func newJSONEvent(event Event) jsonEvent {
+	properties := make([]jsonProperty, len(event.Properties))
+	for i, property := range event.Properties {
+		properties[i] = jsonProperty{
+			Name:  property.NameString(),
+			Value: property.ValueString(),
+		}
+		if p, ok := property.(EventPropertyHTML); ok {
+			properties[i].HTML = p.ValueHTML()
+		}
+	}
+	event.Properties = nil
+	return jsonEvent{Event: event, Properties: properties}
+}
+
+func (e jsonEvent) event() Event {
+	event := e.Event
+	event.Properties = make([]EventProperty, len(e.Properties))
+	for i, property := range e.Properties {
+		if property.HTML != "" {
+			event.Properties[i] = property
+		} else {
+			event.Properties[i] = jsonTextProperty(property)
+		}
+	}
+	return event
+}
+
+// jsonProperty is a property rendered as text, and as HTML when the
+// property had links.
+type jsonProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	HTML  string `json:"html,omitempty"`
+}
+
+func (p jsonProperty) NameString() string {
+	return p.Name
+}
+
+func (p jsonProperty) ValueString() string {
+	return p.Value
+}
+
+func (p jsonProperty) ValueHTML() string {
+	return p.HTML
+}
+
+// jsonTextProperty is a jsonProperty without HTML, which is escaped like
+// other text properties.
+type jsonTextProperty jsonProperty
+
+func (p jsonTextProperty) NameString() string {
+	return p.Name
+}
+
+func (p jsonTextProperty) ValueString() string {
+	return p.Value
+}
@@ -0,0 +1,77 @@
+package notion_ical
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshalEvents(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []Event{
+		{
+			ID:         "standup@notion-ical",
+			Title:      "Standup",
+			Emoji:      "☕",
+			Start:      time.Date(2024, 1, 8, 9, 0, 0, 0, berlin),
+			End:        time.Date(2024, 1, 8, 9, 15, 0, 0, berlin),
+			Recurrence: "FREQ=WEEKLY",
+			Exceptions: []time.Time{time.Date(2024, 1, 22, 0, 0, 0, 0, berlin)},
+			LastEdited: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC),
+			Attendees:  []Attendee{{Name: "Ann", Email: "ann@example.com"}},
+			Categories: []string{"Team"},
+			Alarms:     []Alarm{{Before: 10 * time.Minute}},
+			Content:    []string{"# Agenda", "- Updates"},
+			Properties: []EventProperty{
+				exportProperty{"Where", "Room <1>"},
+				jsonProperty{Name: "Link", Value: "Docs", HTML: `<a href="https://example.com">Docs</a>`},
+			},
+		},
+		{
+			ID:     "offsite@notion-ical",
+			Title:  "Offsite",
+			Start:  time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC),
+			End:    time.Date(2024, 4, 13, 0, 0, 0, 0, time.UTC),
+			AllDay: true,
+		},
+	}
+
+	b, err := MarshalEvents(events)
+	if err != nil {
+		t.Fatalf("MarshalEvents() = %v", err)
+	}
+	got, err := UnmarshalEvents(b)
+	if err != nil {
+		t.Fatalf("UnmarshalEvents() = %v", err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("decoded %d events, want %d", len(got), len(events))
+	}
+
+	for i, want := range events {
+		event := got[i]
+		if !event.Start.Equal(want.Start) || !event.End.Equal(want.End) {
+			t.Errorf("event %d: times = %v to %v, want %v to %v", i, event.Start, event.End, want.Start, want.End)
+		}
+		if event.Description() != want.Description() {
+			t.Errorf("event %d: description = %q, want %q", i, event.Description(), want.Description())
+		}
+		if event.HTMLDescription() != want.HTMLDescription() {
+			t.Errorf("event %d: HTML description = %q, want %q", i, event.HTMLDescription(), want.HTMLDescription())
+		}
+		event.Start, event.End, event.Exceptions, event.LastEdited = want.Start, want.End, want.Exceptions, want.LastEdited
+		event.Properties = want.Properties
+		if !reflect.DeepEqual(event, want) {
+			t.Errorf("event %d = %+v, want %+v", i, event, want)
+		}
+	}
+}
+
+func TestUnmarshalEventsInvalid(t *testing.T) {
+	if _, err := UnmarshalEvents([]byte(`{"events":`)); err == nil {
+		t.Error("UnmarshalEvents() succeeded, want an error")
+	}
+}
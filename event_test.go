@@ -0,0 +1,79 @@
+package notion_ical
+
+import "testing"
+
+func TestEventHTMLDescription(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "no properties",
+			event: Event{ContentHTML: "<p>Agenda</p>"},
+			want:  "<p>Agenda</p>",
+		},
+		{
+			name: "export properties",
+			event: Event{
+				Properties: []EventProperty{
+					exportProperty{"Where", "Room <1>"},
+					exportProperty{"Notes", "first\nsecond"},
+				},
+				ContentHTML: "<p>Body</p>",
+			},
+			want: "<p><b>Where:</b> Room &lt;1&gt;</p><p><b>Notes:</b> first<br>second</p><p>Body</p>",
+		},
+		{
+			name: "properties with HTML",
+			event: Event{
+				Properties: []EventProperty{
+					jsonProperty{Name: "Link", Value: "Docs", HTML: `<a href="https://example.com">Docs</a>`},
+					exportProperty{"A & B", "x"},
+				},
+			},
+			want: `<p><b>Link:</b> <a href="https://example.com">Docs</a></p><p><b>A &amp; B:</b> x</p>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.event.HTMLDescription(); got != test.want {
+				t.Errorf("HTMLDescription() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// benchmarkEvent is an event with a few properties and paragraphs, like
+// most pages of a calendar database.
+func benchmarkEvent() Event {
+	return Event{
+		Title: "Planning",
+		Properties: []EventProperty{
+			exportProperty{"Status", "Confirmed"},
+			exportProperty{"Tags", "Team, Quarterly"},
+			exportProperty{"Notes", "Bring the roadmap\nand last quarter's numbers"},
+		},
+		Content: []string{
+			"Review the goals of the quarter and agree on the next milestones.",
+			"- Roadmap\n- Hiring\n- Budget",
+		},
+		ContentHTML: "<p>Review the goals of the quarter and agree on the next milestones.</p><ul><li>Roadmap</li><li>Hiring</li><li>Budget</li></ul>",
+	}
+}
+
+func BenchmarkEventDescription(b *testing.B) {
+	event := benchmarkEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = event.Description()
+	}
+}
+
+func BenchmarkEventHTMLDescription(b *testing.B) {
+	event := benchmarkEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = event.HTMLDescription()
+	}
+}
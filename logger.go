@@ -0,0 +1,29 @@
+package notion_ical
+
+import (
+	"log"
+)
+
+// Logger receives progress messages of sources and conversions. It is
+// satisfied by *log.Logger, including loggers of log/slog created with
+// slog.NewLogLogger. Messages are discarded by a Logger writing to
+// io.Discard.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// loggerOrDefault returns the standard logger when l is nil.
+func loggerOrDefault(l Logger) Logger {
+	if l == nil {
+		return log.Default()
+	}
+	return l
+}
+
+// WithLogger writes progress messages of the conversion to l instead of
+// the standard logger.
+func WithLogger(l Logger) ConvertOption {
+	return func(o *convertOptions) {
+		o.logger = l
+	}
+}
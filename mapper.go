@@ -0,0 +1,42 @@
+package notion_ical
+
+// EventMapper rewrites an event before it is converted. Returning false
+// drops the event.
+type EventMapper func(Event) (Event, bool)
+
+// MapEvents applies each mapper in order to every event, leaving out events
+// that any mapper drops.
+func MapEvents(events []Event, mappers ...EventMapper) []Event {
+	if len(mappers) == 0 {
+		return events
+	}
+
+	mapped := make([]Event, 0, len(events))
+	for _, event := range events {
+		if event, ok := mapEvent(event, mappers); ok {
+			mapped = append(mapped, event)
+		}
+	}
+	return mapped
+}
+
+// mapEvent applies each mapper in order to an event, reporting false when
+// any mapper drops it.
+func mapEvent(event Event, mappers []EventMapper) (Event, bool) {
+	for _, mapper := range mappers {
+		var ok bool
+		event, ok = mapper(event)
+		if !ok {
+			return event, false
+		}
+	}
+	return event, true
+}
+
+// WithEventMapper applies mapper to each event before conversion. Mappers
+// are applied in the order they are given.
+func WithEventMapper(mapper EventMapper) ConvertOption {
+	return func(o *convertOptions) {
+		o.mappers = append(o.mappers, mapper)
+	}
+}
@@ -0,0 +1,566 @@
+package notionicaltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// notionHost is the host of the Notion API, which the client of a
+// NotionServer sends to the server instead.
+const notionHost = "api.notion.com"
+
+// NotionServer is a fake of the Notion API for the requests made by
+// notion_ical.SourceAPI: finding, searching and querying databases, finding
+// pages, page properties and users, and finding blocks and their children.
+// Objects are stored as the JSON returned by the API, such as built by
+// DatabaseJSON and PageJSON.
+type NotionServer struct {
+	*httptest.Server
+
+	// PageSize limits the results of each response, to test pagination.
+	// Zero uses the page size of the request.
+	PageSize int
+
+	mu        sync.Mutex
+	databases map[string]json.RawMessage
+	pages     map[string][]json.RawMessage
+	blocks    map[string]json.RawMessage
+	children  map[string][]json.RawMessage
+	users     map[string]json.RawMessage
+	queries   []json.RawMessage
+	failures  []notionError
+}
+
+// notionError is an error response of the Notion API.
+type notionError struct {
+	Object  string `json:"object"`
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewNotionServer starts a fake Notion API, which is closed when the test
+// ends.
+func NewNotionServer(t testing.TB) *NotionServer {
+	s := &NotionServer{
+		databases: make(map[string]json.RawMessage),
+		pages:     make(map[string][]json.RawMessage),
+		blocks:    make(map[string]json.RawMessage),
+		children:  make(map[string][]json.RawMessage),
+		users:     make(map[string]json.RawMessage),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// HTTPClient returns a client that sends requests for the Notion API to the
+// server, for notion_ical.ConfigSourceAPI.HTTPClient.
+func (s *NotionServer) HTTPClient() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{
+		Transport: rewriteTransport{target: target, next: s.Client().Transport},
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host != notionHost {
+		return nil, fmt.Errorf("notionicaltest: unexpected request to %s", r.URL.Host)
+	}
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = t.target.Host
+	return t.next.RoundTrip(r)
+}
+
+// AddDatabase stores a database.
+func (s *NotionServer) AddDatabase(id string, database []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.databases[normalizeID(id)] = database
+}
+
+// AddPage stores a page in a database, returned by queries in the order
+// pages are added.
+func (s *NotionServer) AddPage(databaseID string, page []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := normalizeID(databaseID)
+	s.pages[id] = append(s.pages[id], page)
+}
+
+// AddBlock stores a block, replacing the child_page block returned for
+// pages by default.
+func (s *NotionServer) AddBlock(id string, block []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[normalizeID(id)] = block
+}
+
+// AddChildren appends child blocks to a page or block.
+func (s *NotionServer) AddChildren(parentID string, blocks ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := normalizeID(parentID)
+	for _, block := range blocks {
+		s.children[id] = append(s.children[id], block)
+	}
+}
+
+// AddUser adds a user with a name, for mentions of users.
+func (s *NotionServer) AddUser(id, name string) {
+	b, _ := json.Marshal(map[string]any{
+		"object": "user",
+		"id":     id,
+		"type":   "person",
+		"name":   name,
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[normalizeID(id)] = b
+}
+
+// FailNext makes the next n requests fail with an error response, such as
+// 429 with code "rate_limited".
+func (s *NotionServer) FailNext(n int, status int, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, notionError{
+			Object:  "error",
+			Status:  status,
+			Code:    code,
+			Message: "notionicaltest: " + code,
+		})
+	}
+}
+
+// Queries returns the body of each database query, such as to check the
+// filter that was sent.
+func (s *NotionServer) Queries() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]json.RawMessage(nil), s.queries...)
+}
+
+func (s *NotionServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failures) > 0 {
+		failure := s.failures[0]
+		s.failures = s.failures[1:]
+		writeJSON(w, failure.Status, failure)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1"), "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "databases" && r.Method == http.MethodGet:
+		database, ok := s.databases[normalizeID(parts[1])]
+		if !ok {
+			writeNotFound(w, "database", parts[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, database)
+
+	case len(parts) == 3 && parts[0] == "databases" && parts[2] == "query" && r.Method == http.MethodPost:
+		id := normalizeID(parts[1])
+		if _, ok := s.databases[id]; !ok {
+			writeNotFound(w, "database", parts[1])
+			return
+		}
+		var query notion.DatabaseQuery
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			writeJSON(w, http.StatusBadRequest, notionError{"error", http.StatusBadRequest, "invalid_json", err.Error()})
+			return
+		}
+		s.queries = append(s.queries, raw)
+		if err := json.Unmarshal(raw, &query); err != nil {
+			writeJSON(w, http.StatusBadRequest, notionError{"error", http.StatusBadRequest, "validation_error", err.Error()})
+			return
+		}
+
+		var pages []json.RawMessage
+		for _, page := range s.pages[id] {
+			if matchesFilter(page, query.Filter) {
+				pages = append(pages, page)
+			}
+		}
+		s.writeList(w, pages, query.StartCursor, query.PageSize)
+
+	case len(parts) == 1 && parts[0] == "search" && r.Method == http.MethodPost:
+		var opts notion.SearchOpts
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeJSON(w, http.StatusBadRequest, notionError{"error", http.StatusBadRequest, "invalid_json", err.Error()})
+			return
+		}
+		// Only databases are searched, in the order of their IDs
+		ids := make([]string, 0, len(s.databases))
+		for id := range s.databases {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		databases := make([]json.RawMessage, len(ids))
+		for i, id := range ids {
+			databases[i] = s.databases[id]
+		}
+		s.writeList(w, databases, opts.StartCursor, opts.PageSize)
+
+	case len(parts) == 2 && parts[0] == "pages" && r.Method == http.MethodGet:
+		page, ok := s.findPage(normalizeID(parts[1]))
+		if !ok {
+			writeNotFound(w, "page", parts[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+
+	case len(parts) == 2 && parts[0] == "users" && r.Method == http.MethodGet:
+		user, ok := s.users[normalizeID(parts[1])]
+		if !ok {
+			writeNotFound(w, "user", parts[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, user)
+
+	case len(parts) == 4 && parts[0] == "pages" && parts[2] == "properties" && r.Method == http.MethodGet:
+		property, ok := s.pageProperty(normalizeID(parts[1]), parts[3])
+		if !ok {
+			writeNotFound(w, "page property", parts[3])
+			return
+		}
+		writeJSON(w, http.StatusOK, property)
+
+	case len(parts) == 2 && parts[0] == "blocks" && r.Method == http.MethodGet:
+		id := normalizeID(parts[1])
+		if block, ok := s.blocks[id]; ok {
+			writeJSON(w, http.StatusOK, block)
+			return
+		}
+		if !s.hasPage(id) {
+			writeNotFound(w, "block", parts[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"object":       "block",
+			"id":           parts[1],
+			"type":         "child_page",
+			"child_page":   map[string]string{"title": ""},
+			"has_children": len(s.children[id]) > 0,
+		})
+
+	case len(parts) == 3 && parts[0] == "blocks" && parts[2] == "children" && r.Method == http.MethodGet:
+		id := normalizeID(parts[1])
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		s.writeList(w, s.children[id], r.URL.Query().Get("start_cursor"), pageSize)
+
+	default:
+		writeJSON(w, http.StatusBadRequest, notionError{"error", http.StatusBadRequest, "invalid_request_url", "notionicaltest: unsupported request " + r.Method + " " + r.URL.Path})
+	}
+}
+
+// hasPage reports whether a page with the ID was added to any database.
+func (s *NotionServer) hasPage(id string) bool {
+	_, ok := s.findPage(id)
+	return ok
+}
+
+// findPage finds a page with the ID in any database.
+func (s *NotionServer) findPage(id string) (json.RawMessage, bool) {
+	for _, pages := range s.pages {
+		for _, page := range pages {
+			var p struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(page, &p) == nil && normalizeID(p.ID) == id {
+				return page, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// pageProperty finds a property of a page by its ID, which is its name in
+// databases built by DatabaseJSON, as a property item.
+func (s *NotionServer) pageProperty(pageID, propertyID string) (map[string]any, bool) {
+	for _, pages := range s.pages {
+		for _, page := range pages {
+			var p struct {
+				ID         string                    `json:"id"`
+				Properties map[string]map[string]any `json:"properties"`
+			}
+			if json.Unmarshal(page, &p) != nil || normalizeID(p.ID) != pageID {
+				continue
+			}
+			for name, property := range p.Properties {
+				if name == propertyID || property["id"] == propertyID {
+					item := map[string]any{"object": "property_item", "id": propertyID}
+					for k, v := range property {
+						item[k] = v
+					}
+					return item, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// writeList writes a paginated list, where cursors are offsets.
+func (s *NotionServer) writeList(w http.ResponseWriter, results []json.RawMessage, cursor string, pageSize int) {
+	start, _ := strconv.Atoi(cursor)
+	if start > len(results) {
+		start = len(results)
+	}
+	if s.PageSize > 0 && (pageSize == 0 || s.PageSize < pageSize) {
+		pageSize = s.PageSize
+	}
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	end := start + pageSize
+	if end > len(results) {
+		end = len(results)
+	}
+
+	var next *string
+	if end < len(results) {
+		cursor := strconv.Itoa(end)
+		next = &cursor
+	}
+	page := results[start:end]
+	if page == nil {
+		page = []json.RawMessage{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object":      "list",
+		"results":     page,
+		"has_more":    next != nil,
+		"next_cursor": next,
+	})
+}
+
+// matchesFilter evaluates compound and/or filters, checkbox filters,
+// including checkboxes of formulas as sent for hidden pages, and select
+// filters. Other property filters match every page.
+func matchesFilter(page json.RawMessage, filter *notion.DatabaseQueryFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if len(filter.And) > 0 {
+		for i := range filter.And {
+			if !matchesFilter(page, &filter.And[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(filter.Or) > 0 {
+		for i := range filter.Or {
+			if matchesFilter(page, &filter.Or[i]) {
+				return true
+			}
+		}
+		return false
+	}
+	if filter.Property == "" {
+		return true
+	}
+
+	var p struct {
+		Properties map[string]struct {
+			Checkbox bool `json:"checkbox"`
+			Formula  struct {
+				Boolean bool `json:"boolean"`
+			} `json:"formula"`
+			Select *struct {
+				Name string `json:"name"`
+			} `json:"select"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(page, &p); err != nil {
+		return false
+	}
+	property := p.Properties[filter.Property]
+
+	if filter.Select != nil {
+		var value string
+		if property.Select != nil {
+			value = property.Select.Name
+		}
+		return matchesSelect(value, filter.Select)
+	}
+
+	checkbox := filter.Checkbox
+	if filter.Formula != nil {
+		checkbox = filter.Formula.Checkbox
+	}
+	if checkbox == nil {
+		return true
+	}
+	value := property.Checkbox || property.Formula.Boolean
+	if checkbox.Equals != nil {
+		return value == *checkbox.Equals
+	}
+	if checkbox.DoesNotEqual != nil {
+		return value != *checkbox.DoesNotEqual
+	}
+	return true
+}
+
+// matchesSelect evaluates a select filter on the name of the selected
+// option, which is empty when none is selected.
+func matchesSelect(value string, filter *notion.SelectDatabaseQueryFilter) bool {
+	switch {
+	case filter.Equals != "":
+		return value == filter.Equals
+	case filter.DoesNotEqual != "":
+		return value != filter.DoesNotEqual
+	case filter.IsEmpty:
+		return value == ""
+	case filter.IsNotEmpty:
+		return value != ""
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeNotFound(w http.ResponseWriter, object, id string) {
+	writeJSON(w, http.StatusNotFound, notionError{"error", http.StatusNotFound, "object_not_found", "Could not find " + object + " with ID: " + id + "."})
+}
+
+// normalizeID removes dashes from IDs, which the API accepts either way.
+func normalizeID(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+// DatabaseJSON builds a database with the title and properties, given by
+// name and type. A title property "Name" is added when none is given.
+func DatabaseJSON(id, title string, properties map[string]notion.DatabasePropertyType) []byte {
+	props := make(map[string]any)
+	hasTitle := false
+	for name, typ := range properties {
+		hasTitle = hasTitle || typ == notion.DBPropTypeTitle
+		props[name] = map[string]any{
+			"id":        name,
+			"name":      name,
+			"type":      typ,
+			string(typ): map[string]any{},
+		}
+	}
+	if !hasTitle {
+		props["Name"] = map[string]any{"id": "title", "name": "Name", "type": "title", "title": map[string]any{}}
+	}
+
+	b, _ := json.Marshal(map[string]any{
+		"object":     "database",
+		"id":         id,
+		"title":      []any{richText(title)},
+		"properties": props,
+	})
+	return b
+}
+
+// PageJSON builds a page in a database with property values as returned by
+// the API, such as built by TitleValue and DateValue.
+func PageJSON(databaseID, id string, created time.Time, properties map[string]any) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"object":           "page",
+		"id":               id,
+		"created_time":     created.UTC().Format(time.RFC3339),
+		"last_edited_time": created.UTC().Format(time.RFC3339),
+		"parent":           map[string]any{"type": "database_id", "database_id": databaseID},
+		"url":              "https://www.notion.so/" + normalizeID(id),
+		"properties":       properties,
+	})
+	return b
+}
+
+// TitleValue is the value of a title property.
+func TitleValue(title string) any {
+	return map[string]any{"type": "title", "title": []any{richText(title)}}
+}
+
+// DateValue is the value of a date property, with dates such as
+// "2024-01-02" or times with milliseconds as returned by the API, such as
+// "2024-01-02T09:00:00.000+00:00". An empty end is omitted.
+func DateValue(start, end string) any {
+	date := map[string]any{"start": start}
+	if end != "" {
+		date["end"] = end
+	}
+	return map[string]any{"type": "date", "date": date}
+}
+
+// CheckboxValue is the value of a checkbox property.
+func CheckboxValue(checked bool) any {
+	return map[string]any{"type": "checkbox", "checkbox": checked}
+}
+
+// FormulaValue is the value of a formula property with a result such as
+// true, "Done" or 3. Booleans are checkbox results.
+func FormulaValue(result any) any {
+	var typ string
+	switch result.(type) {
+	case bool:
+		typ = "boolean"
+	case string:
+		typ = "string"
+	default:
+		typ = "number"
+	}
+	return map[string]any{"type": "formula", "formula": map[string]any{"type": typ, typ: result}}
+}
+
+// UniqueIDValue is the value of a unique ID property, such as "TASK-123"
+// for the prefix "TASK" and number 123. An empty prefix is null.
+func UniqueIDValue(prefix string, number int) any {
+	var p any
+	if prefix != "" {
+		p = prefix
+	}
+	return map[string]any{"type": "unique_id", "unique_id": map[string]any{"prefix": p, "number": number}}
+}
+
+// ParagraphJSON builds a paragraph block with text.
+func ParagraphJSON(id, text string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"object":       "block",
+		"id":           id,
+		"type":         "paragraph",
+		"has_children": false,
+		"paragraph":    map[string]any{"rich_text": []any{richText(text)}},
+	})
+	return b
+}
+
+func richText(text string) map[string]any {
+	return map[string]any{
+		"type":       "text",
+		"plain_text": text,
+		"text":       map[string]any{"content": text},
+	}
+}
@@ -0,0 +1,105 @@
+package notionicaltest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestMatchesFilter(t *testing.T) {
+	yes, no := true, false
+	hidden := &notion.DatabaseQueryFilter{
+		Property: "Hidden",
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+			Checkbox: &notion.CheckboxDatabaseQueryFilter{DoesNotEqual: &yes},
+		},
+	}
+	hiddenFormula := &notion.DatabaseQueryFilter{
+		Property: "Done",
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+			Formula: &notion.FormulaDatabaseQueryFilter{
+				Checkbox: &notion.CheckboxDatabaseQueryFilter{Equals: &no},
+			},
+		},
+	}
+	confirmed := &notion.DatabaseQueryFilter{
+		Property: "Status",
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+			Select: &notion.SelectDatabaseQueryFilter{Equals: "Confirmed"},
+		},
+	}
+
+	page := func(hidden, done bool, status string) []byte {
+		properties := map[string]any{
+			"Hidden": CheckboxValue(hidden),
+			"Done":   FormulaValue(done),
+		}
+		if status != "" {
+			properties["Status"] = map[string]any{"type": "select", "select": map[string]any{"name": status}}
+		}
+		return PageJSON("db", "page", time.Time{}, properties)
+	}
+
+	tests := []struct {
+		name   string
+		page   []byte
+		filter *notion.DatabaseQueryFilter
+		want   bool
+	}{
+		{"no filter", page(true, true, ""), nil, true},
+		{"visible", page(false, false, ""), hidden, true},
+		{"hidden", page(true, false, ""), hidden, false},
+		{"formula false", page(false, false, ""), hiddenFormula, true},
+		{"formula true", page(false, true, ""), hiddenFormula, false},
+		{"select", page(false, false, "Confirmed"), confirmed, true},
+		{"other select", page(false, false, "Tentative"), confirmed, false},
+		{"no select", page(false, false, ""), confirmed, false},
+		{
+			"and, all match",
+			page(false, false, "Confirmed"),
+			&notion.DatabaseQueryFilter{And: []notion.DatabaseQueryFilter{*hidden, *confirmed}},
+			true,
+		},
+		{
+			"and, hidden",
+			page(true, false, "Confirmed"),
+			&notion.DatabaseQueryFilter{And: []notion.DatabaseQueryFilter{*hidden, *confirmed}},
+			false,
+		},
+		{
+			"and, filtered out",
+			page(false, false, "Tentative"),
+			&notion.DatabaseQueryFilter{And: []notion.DatabaseQueryFilter{*hidden, *confirmed}},
+			false,
+		},
+		{
+			"or, one matches",
+			page(true, false, "Confirmed"),
+			&notion.DatabaseQueryFilter{Or: []notion.DatabaseQueryFilter{*hidden, *confirmed}},
+			true,
+		},
+		{
+			"or, none match",
+			page(true, false, "Tentative"),
+			&notion.DatabaseQueryFilter{Or: []notion.DatabaseQueryFilter{*hidden, *confirmed}},
+			false,
+		},
+		{
+			"nested",
+			page(false, true, "Confirmed"),
+			&notion.DatabaseQueryFilter{And: []notion.DatabaseQueryFilter{
+				*hidden,
+				{Or: []notion.DatabaseQueryFilter{*hiddenFormula, *confirmed}},
+			}},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchesFilter(test.page, test.filter); got != test.want {
+				t.Errorf("matchesFilter() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
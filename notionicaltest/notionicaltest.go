@@ -0,0 +1,153 @@
+// Package notionicaltest provides a fake source, event builders and golden
+// file helpers for testing conversions without access to Notion.
+package notionicaltest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden write
+// golden files instead of comparing them, when set to any value.
+const UpdateEnv = "NOTIONICALTEST_UPDATE"
+
+// Source is an in-memory source of events.
+type Source struct {
+	CalendarName string
+	Events       []notion_ical.Event
+	// Err is returned by ReadAll instead of the events when set.
+	Err error
+	// Reads counts calls to ReadAll.
+	Reads int
+}
+
+// NewSource returns a source of events named name.
+func NewSource(name string, events ...notion_ical.Event) *Source {
+	return &Source{
+		CalendarName: name,
+		Events:       events,
+	}
+}
+
+func (s *Source) Name() string {
+	return s.CalendarName
+}
+
+func (s *Source) ReadAll() ([]notion_ical.Event, error) {
+	return s.ReadAllContext(context.Background())
+}
+
+func (s *Source) ReadAllContext(ctx context.Context) ([]notion_ical.Event, error) {
+	s.Reads += 1
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return append([]notion_ical.Event(nil), s.Events...), nil
+}
+
+// Property is a property of an event.
+type Property struct {
+	Name  string
+	Value string
+}
+
+func (p Property) NameString() string {
+	return p.Name
+}
+
+func (p Property) ValueString() string {
+	return p.Value
+}
+
+// eventID derives a stable ID from the title and start of an event.
+func eventID(title string, start time.Time) string {
+	sum := sha256.Sum256([]byte(title + "\x00" + start.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(sum[:16]) + "@notionicaltest"
+}
+
+// TimedEvent builds an event from start lasting duration.
+func TimedEvent(title string, start time.Time, duration time.Duration) notion_ical.Event {
+	return notion_ical.Event{
+		ID:    eventID(title, start),
+		Title: title,
+		Start: start,
+		End:   start.Add(duration),
+	}
+}
+
+// AllDayEvent builds an event lasting days whole days from the date in
+// UTC.
+func AllDayEvent(title string, year int, month time.Month, day, days int) notion_ical.Event {
+	start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return notion_ical.Event{
+		ID:     eventID(title, start),
+		Title:  title,
+		Start:  start,
+		End:    start.AddDate(0, 0, days),
+		AllDay: true,
+	}
+}
+
+// WithProperties returns the event with properties added.
+func WithProperties(event notion_ical.Event, properties ...Property) notion_ical.Event {
+	event.Properties = append([]notion_ical.EventProperty(nil), event.Properties...)
+	for _, property := range properties {
+		event.Properties = append(event.Properties, property)
+	}
+	return event
+}
+
+// Convert converts the source into iCalendar, failing the test on errors.
+// DTSTAMP is the start of each event by default, so the output is
+// reproducible.
+func Convert(t testing.TB, source notion_ical.Source, opts ...notion_ical.ConvertOption) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := notion_ical.Convert(source, &buf, opts...); err != nil {
+		t.Fatalf("convert %s: %v", source.Name(), err)
+	}
+	return buf.Bytes()
+}
+
+// AssertGolden compares got with the golden file at path, such as
+// "testdata/weekly.ics". When UpdateEnv is set, the golden file is written
+// instead.
+func AssertGolden(t testing.TB, path string, got []byte) {
+	t.Helper()
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file, set %s=1 to create it: %v", UpdateEnv, err)
+	}
+	if !bytes.Equal(normalizeNewlines(got), normalizeNewlines(want)) {
+		t.Errorf("output does not match %s, set %s=1 to update it\ngot:\n%s\nwant:\n%s", path, UpdateEnv, got, want)
+	}
+}
+
+// normalizeNewlines compares CRLF output with golden files checked out with
+// LF line endings.
+func normalizeNewlines(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+}
@@ -0,0 +1,193 @@
+package notion_ical
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrNotRecorded is a request to the Notion API missing from a recording.
+var ErrNotRecorded = errors.New("request not recorded")
+
+// recordedResponse is a response of the Notion API with its request, stored
+// as a JSON file in a recording.
+type recordedResponse struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	RequestBody json.RawMessage `json:"request_body,omitempty"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	// Body is the body of the response when it is JSON, and Text when it is
+	// not, such as error pages of proxies
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// recordingKey is the name of the file of a request, which is the same for
+// requests with the same method, URL and body.
+func recordingKey(method, url string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+url+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
+
+// readRequestBody reads the body of a request, and replaces it so that the
+// request can still be sent.
+func readRequestBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return req, b, nil
+}
+
+// RecordTransport stores each response of the Notion API in a directory,
+// such as for bug reports, offline development and tests against real data
+// with ReplayTransport. Set it as the transport of
+// ConfigSourceAPI.HTTPClient. Headers, including the API key, are not
+// stored, but responses contain the content of pages.
+type RecordTransport struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+// NewRecordTransport records the responses of requests sent with transport,
+// or http.DefaultTransport when nil, in dir, which is created if needed.
+func NewRecordTransport(dir string, transport http.RoundTripper) (*RecordTransport, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create recording directory: %w", err)
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &RecordTransport{dir: dir, transport: transport}, nil
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+
+	recorded := recordedResponse{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Status:      res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	if json.Valid(requestBody) {
+		recorded.RequestBody = requestBody
+	}
+	if json.Valid(b) {
+		recorded.Body = b
+	} else {
+		recorded.Text = string(b)
+	}
+	if err := t.write(recordingKey(req.Method, recorded.URL, requestBody), recorded); err != nil {
+		return nil, fmt.Errorf("failed recording %s %s: %w", req.Method, req.URL, err)
+	}
+	return res, nil
+}
+
+func (t *RecordTransport) write(key string, recorded recordedResponse) error {
+	b, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write through a temporary file, so that replays never read a partial
+	// file
+	tmp, err := os.CreateTemp(t.dir, key+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, key+".json"))
+}
+
+// ReplayTransport responds to requests to the Notion API with the responses
+// recorded by RecordTransport, without sending them, so that conversions
+// run offline and give the same results. Requests that were not recorded
+// fail with ErrNotRecorded.
+type ReplayTransport struct {
+	dir string
+}
+
+// NewReplayTransport replays the recording in dir.
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{dir: dir}
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	b, err := os.ReadFile(filepath.Join(t.dir, recordingKey(req.Method, req.URL.String(), requestBody)+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL)
+	} else if err != nil {
+		return nil, err
+	}
+	var recorded recordedResponse
+	if err := json.Unmarshal(b, &recorded); err != nil {
+		return nil, fmt.Errorf("invalid recording of %s %s: %w", req.Method, req.URL, err)
+	}
+
+	body := []byte(recorded.Body)
+	if recorded.Body == nil {
+		body = []byte(recorded.Text)
+	}
+	header := make(http.Header)
+	if recorded.ContentType != "" {
+		header.Set("Content-Type", recorded.ContentType)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package notion_ical_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serverwentdown/notion-ical"
+)
+
+func readEventTitles(client *http.Client, opts ...notion_ical.SourceOption) ([]string, error) {
+	opts = append([]notion_ical.SourceOption{notion_ical.WithHTTPClient(client)}, opts...)
+	source, err := notion_ical.NewAPISource("secret_test", testDatabaseID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	events, err := notion_ical.ReadAll(context.Background(), source)
+	if err != nil {
+		return nil, err
+	}
+	titles := make([]string, len(events))
+	for i, event := range events {
+		titles[i] = event.Title
+	}
+	return titles, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := newTestDatabase(t,
+		testPage{title: "Planning", day: 2},
+		testPage{title: "Review", day: 3},
+		testPage{title: "Offsite", day: 4},
+	)
+	srv.PageSize = 2
+	dir := filepath.Join(t.TempDir(), "recording")
+
+	record, err := notion_ical.NewRecordTransport(dir, srv.HTTPClient().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := readEventTitles(&http.Client{Transport: record})
+	if err != nil {
+		t.Fatalf("read while recording: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The database, two responses of the query, and the content of each page
+	if len(files) != 6 {
+		t.Errorf("recorded %d responses, want 6", len(files))
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "secret_test") {
+			t.Errorf("%s contains the API key:\n%s", file.Name(), b)
+		}
+	}
+
+	// Replays send nothing to the server
+	srv.Close()
+	got, err := readEventTitles(&http.Client{Transport: notion_ical.NewReplayTransport(dir)})
+	if err != nil {
+		t.Fatalf("read while replaying: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("replayed events = %v, want %v", got, want)
+	}
+
+	// Other queries were not recorded
+	_, err = readEventTitles(&http.Client{Transport: notion_ical.NewReplayTransport(dir)}, notion_ical.WithHideProperty("Hidden"))
+	if !errors.Is(err, notion_ical.ErrNotRecorded) {
+		t.Errorf("read of another query = %v, want %v", err, notion_ical.ErrNotRecorded)
+	}
+}
+
+func TestRecordReplayText(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "<h1>502 Bad Gateway</h1>")
+	}))
+	defer proxy.Close()
+	dir := t.TempDir()
+
+	record, err := notion_ical.NewRecordTransport(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&http.Client{Transport: record}).Get(proxy.URL + "/v1/databases/x"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := (&http.Client{Transport: notion_ical.NewReplayTransport(dir)}).Get(proxy.URL + "/v1/databases/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadGateway || res.Header.Get("Content-Type") != "text/html" || string(body) != "<h1>502 Bad Gateway</h1>" {
+		t.Errorf("replayed %d %q %q, want the recorded error page", res.StatusCode, res.Header.Get("Content-Type"), body)
+	}
+}
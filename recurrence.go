@@ -0,0 +1,183 @@
+package notion_ical
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence error = &kindError{"invalid recurrence rule", ErrParse}
+
+// notionRecurrenceNames maps the repeat settings of Notion recurring
+// templates to recurrence rules, for databases that copy the setting into a
+// select property.
+var notionRecurrenceNames = map[string]string{
+	"daily":     "FREQ=DAILY",
+	"weekdays":  "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+	"weekly":    "FREQ=WEEKLY",
+	"biweekly":  "FREQ=WEEKLY;INTERVAL=2",
+	"monthly":   "FREQ=MONTHLY",
+	"quarterly": "FREQ=MONTHLY;INTERVAL=3",
+	"yearly":    "FREQ=YEARLY",
+	"annually":  "FREQ=YEARLY",
+}
+
+// parseRecurrence parses a recurrence property value, either a repeat
+// setting such as "Weekly" or an RFC 5545 RRULE value such as
+// "FREQ=WEEKLY;BYDAY=MO". An empty value is no recurrence.
+func parseRecurrence(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	if rule, ok := notionRecurrenceNames[strings.ToLower(value)]; ok {
+		return rule, nil
+	}
+
+	rule := strings.TrimPrefix(strings.ToUpper(value), "RRULE:")
+	hasFreq := false
+	for _, part := range strings.Split(rule, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok || key == "" || val == "" {
+			return "", fmt.Errorf("%w: %q", ErrInvalidRecurrence, value)
+		}
+		if key == "FREQ" {
+			hasFreq = true
+		}
+	}
+	if !hasFreq {
+		return "", fmt.Errorf("%w: %q has no FREQ", ErrInvalidRecurrence, value)
+	}
+	return rule, nil
+}
+
+// recurringSeries identifies the pages that Notion materialized from one
+// recurring template. Occurrences of a template share its title, rule,
+// time of day and duration, and the day its rule is anchored to, so pages
+// that only share a title and rule are kept apart.
+type recurringSeries struct {
+	title      string
+	recurrence string
+	allDay     bool
+	clock      time.Duration
+	duration   time.Duration
+	anchor     string
+}
+
+// seriesOf returns the series of a recurring event.
+func seriesOf(event Event) recurringSeries {
+	hour, min, sec := event.Start.Clock()
+	return recurringSeries{
+		title:      event.Title,
+		recurrence: event.Recurrence,
+		allDay:     event.AllDay,
+		clock:      time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second,
+		duration:   event.End.Sub(event.Start),
+		anchor:     recurrenceAnchor(event.Recurrence, event.Start),
+	}
+}
+
+// recurrenceAnchor returns the day that occurrences of a rule without BY
+// parts fall on, taken from the start of the series: the weekday of weekly
+// rules, the day of the month of monthly rules and the date of yearly
+// rules. Occurrences of rules such as "FREQ=WEEKLY;BYDAY=MO,TH" fall on
+// several days, so they have no anchor.
+func recurrenceAnchor(rule string, start time.Time) string {
+	var freq string
+	for _, part := range strings.Split(rule, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		switch {
+		case key == "FREQ":
+			freq = val
+		case strings.HasPrefix(key, "BY"):
+			return ""
+		}
+	}
+	switch freq {
+	case "WEEKLY":
+		return start.Weekday().String()
+	case "MONTHLY":
+		return fmt.Sprint(start.Day())
+	case "YEARLY":
+		return start.Format("01-02")
+	}
+	return ""
+}
+
+// collapseRecurring keeps only the first of the events of each recurring
+// series, because Notion materializes a page for each occurrence of a
+// recurring template and the rule already covers the rest. Exceptions from
+// the collapsed events are merged into the first.
+func collapseRecurring(events []Event) []Event {
+	sorted := make([]int, len(events))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return events[sorted[i]].Start.Before(events[sorted[j]].Start)
+	})
+
+	first := make(map[recurringSeries]int)
+	for _, i := range sorted {
+		if events[i].Recurrence == "" {
+			continue
+		}
+		key := seriesOf(events[i])
+		if _, ok := first[key]; !ok {
+			first[key] = i
+		}
+	}
+
+	exceptions := make(map[int][]time.Time)
+	for _, event := range events {
+		if event.Recurrence != "" {
+			j := first[seriesOf(event)]
+			exceptions[j] = append(exceptions[j], event.Exceptions...)
+		}
+	}
+
+	collapsed := make([]Event, 0, len(events))
+	for i, event := range events {
+		if event.Recurrence != "" {
+			if first[seriesOf(event)] != i {
+				continue
+			}
+			event.Exceptions = uniqueDates(exceptions[i])
+		}
+		collapsed = append(collapsed, event)
+	}
+	return collapsed
+}
+
+// uniqueDates sorts dates and removes those on the same day.
+func uniqueDates(dates []time.Time) []time.Time {
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	var unique []time.Time
+	for _, date := range dates {
+		if len(unique) > 0 && sameDate(unique[len(unique)-1], date) {
+			continue
+		}
+		unique = append(unique, date)
+	}
+	return unique
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// datesBetween lists each date from start until end, inclusive.
+func datesBetween(start, end time.Time) []time.Time {
+	var dates []time.Time
+	for d := start; !d.After(end) || sameDate(d, end); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+	return dates
+}
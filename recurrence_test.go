@@ -0,0 +1,145 @@
+package notion_ical
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCollapseRecurring(t *testing.T) {
+	event := func(title, rule string, start time.Time, d time.Duration, exceptions ...time.Time) Event {
+		return Event{
+			ID:         fmt.Sprintf("%s-%s", title, start.Format(time.RFC3339)),
+			Title:      title,
+			Start:      start,
+			End:        start.Add(d),
+			Recurrence: rule,
+			Exceptions: exceptions,
+		}
+	}
+	at := func(day, hour int) time.Time {
+		// January 8, 2024 is a Monday
+		return time.Date(2024, time.January, day, hour, 0, 0, 0, time.UTC)
+	}
+	weekly := "FREQ=WEEKLY"
+
+	tests := []struct {
+		name       string
+		events     []Event
+		want       []string
+		exceptions []int
+	}{
+		{
+			name: "occurrences of a template",
+			events: []Event{
+				event("Standup", weekly, at(15, 9), time.Hour, at(29, 0)),
+				event("Standup", weekly, at(8, 9), time.Hour, at(22, 0)),
+				event("Standup", weekly, at(22, 9), time.Hour, at(29, 0)),
+			},
+			want:       []string{"Standup-2024-01-08T09:00:00Z"},
+			exceptions: []int{22, 29},
+		},
+		{
+			name: "other time of day",
+			events: []Event{
+				event("Standup", weekly, at(8, 9), time.Hour),
+				event("Standup", weekly, at(15, 16), time.Hour),
+			},
+			want: []string{"Standup-2024-01-08T09:00:00Z", "Standup-2024-01-15T16:00:00Z"},
+		},
+		{
+			name: "other weekday",
+			events: []Event{
+				event("Standup", weekly, at(8, 9), time.Hour),
+				event("Standup", weekly, at(11, 9), time.Hour),
+				event("Standup", weekly, at(15, 9), time.Hour),
+			},
+			want: []string{"Standup-2024-01-08T09:00:00Z", "Standup-2024-01-11T09:00:00Z"},
+		},
+		{
+			name: "other duration",
+			events: []Event{
+				event("Standup", weekly, at(8, 9), time.Hour),
+				event("Standup", weekly, at(15, 9), 15*time.Minute),
+			},
+			want: []string{"Standup-2024-01-08T09:00:00Z", "Standup-2024-01-15T09:00:00Z"},
+		},
+		{
+			name: "several days of the week",
+			events: []Event{
+				event("Standup", "FREQ=WEEKLY;BYDAY=MO,TH", at(8, 9), time.Hour),
+				event("Standup", "FREQ=WEEKLY;BYDAY=MO,TH", at(11, 9), time.Hour),
+			},
+			want: []string{"Standup-2024-01-08T09:00:00Z"},
+		},
+		{
+			name: "other day of the month",
+			events: []Event{
+				event("Invoices", "FREQ=MONTHLY", at(1, 9), time.Hour),
+				event("Invoices", "FREQ=MONTHLY", at(15, 9), time.Hour),
+				event("Invoices", "FREQ=MONTHLY", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC), time.Hour),
+			},
+			want: []string{"Invoices-2024-01-01T09:00:00Z", "Invoices-2024-01-15T09:00:00Z"},
+		},
+		{
+			name: "other title or rule",
+			events: []Event{
+				event("Standup", weekly, at(8, 9), time.Hour),
+				event("Retro", weekly, at(15, 9), time.Hour),
+				event("Standup", "FREQ=DAILY", at(9, 9), time.Hour),
+			},
+			want: []string{"Standup-2024-01-08T09:00:00Z", "Retro-2024-01-15T09:00:00Z", "Standup-2024-01-09T09:00:00Z"},
+		},
+		{
+			name: "events without recurrence",
+			events: []Event{
+				event("Standup", "", at(8, 9), time.Hour),
+				event("Standup", "", at(15, 9), time.Hour),
+			},
+			want: []string{"Standup-2024-01-08T09:00:00Z", "Standup-2024-01-15T09:00:00Z"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			collapsed := collapseRecurring(test.events)
+			var ids []string
+			for _, event := range collapsed {
+				ids = append(ids, event.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(test.want) {
+				t.Fatalf("collapsed to %v, want %v", ids, test.want)
+			}
+			if test.exceptions != nil {
+				var days []int
+				for _, exception := range collapsed[0].Exceptions {
+					days = append(days, exception.Day())
+				}
+				if fmt.Sprint(days) != fmt.Sprint(test.exceptions) {
+					t.Errorf("exceptions on days %v, want %v", days, test.exceptions)
+				}
+			}
+		})
+	}
+}
+
+func TestRecurrenceAnchor(t *testing.T) {
+	// A Wednesday
+	start := time.Date(2024, time.March, 6, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"FREQ=DAILY", ""},
+		{"FREQ=WEEKLY", "Wednesday"},
+		{"FREQ=WEEKLY;INTERVAL=2", "Wednesday"},
+		{"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", ""},
+		{"FREQ=MONTHLY", "6"},
+		{"FREQ=MONTHLY;BYDAY=1MO", ""},
+		{"FREQ=YEARLY", "03-06"},
+	}
+	for _, test := range tests {
+		if got := recurrenceAnchor(test.rule, start); got != test.want {
+			t.Errorf("recurrenceAnchor(%q) = %q, want %q", test.rule, got, test.want)
+		}
+	}
+}
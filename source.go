@@ -1,6 +1,7 @@
 package notion_ical
 
 import (
+	"context"
 	"errors"
 )
 
@@ -12,3 +13,61 @@ type Source interface {
 	Name() string
 	ReadAll() ([]Event, error)
 }
+
+// SourceProperty describes a property of the database behind a source.
+type SourceProperty struct {
+	Name string
+	Type string
+}
+
+// PropertyLister is implemented by sources that can describe the
+// properties of their database.
+type PropertyLister interface {
+	Properties() ([]SourceProperty, error)
+}
+
+// ContextSource is implemented by sources that accept a context for
+// cancellation and tracing.
+type ContextSource interface {
+	Source
+	ReadAllContext(ctx context.Context) ([]Event, error)
+}
+
+// StreamSource is implemented by sources that can pass on each event as it
+// is read, instead of holding all events until the last is read.
+type StreamSource interface {
+	Source
+	// StreamContext passes each event to yield as it is read. An error from
+	// yield stops reading and is returned.
+	StreamContext(ctx context.Context, yield func(Event) error) error
+}
+
+// Stream passes each event of the source to yield, as it is read when the
+// source is a StreamSource, or after reading all events otherwise.
+func Stream(ctx context.Context, source Source, yield func(Event) error) error {
+	if s, ok := source.(StreamSource); ok {
+		return s.StreamContext(ctx, yield)
+	}
+
+	events, err := ReadAll(ctx, source)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := yield(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadAll reads all events from the source, passing ctx when supported.
+func ReadAll(ctx context.Context, source Source) (events []Event, err error) {
+	if s, ok := source.(ContextSource); ok {
+		return s.ReadAllContext(ctx)
+	}
+
+	_, span := tracer.Start(ctx, "Source.ReadAll")
+	defer func() { endSpan(span, err) }()
+	return source.ReadAll()
+}
@@ -4,16 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"html"
+	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dstotijn/go-notion"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var ErrPropertyNotFound = errors.New("property not found in database")
 
+const (
+	// maxPageSize is the most results the API returns for each request.
+	maxPageSize = 100
+	// defaultMaxBlockDepth limits reading nested blocks, which takes a
+	// request for each block with children.
+	defaultMaxBlockDepth = 5
+	// defaultRequestTimeout limits each request to the API.
+	defaultRequestTimeout = 30 * time.Second
+)
+
 // ConfigSourceAPI represents configuration for importing from the Notion API.
 type ConfigSourceAPI struct {
 	// APIKey is the Notion API key to use.
@@ -23,25 +37,106 @@ type ConfigSourceAPI struct {
 	// DateProperty is the property name of the date field that will be used
 	// as the event date.
 	DateProperty string
-	// HideProperty is the property name of a checkbox that will cause
-	// events to be hidden.
+	// HideProperty is the property name of a checkbox, or a formula that
+	// evaluates to a checkbox, that will cause events to be hidden.
 	HideProperty string
+	// RecurrenceProperty is the property name of a text, select or formula
+	// field with a repeat setting or RRULE that makes events recur.
+	RecurrenceProperty string
+	// ExceptionsProperty is the property name of a date, rollup or text
+	// field with dates that are skipped by the recurrence.
+	ExceptionsProperty string
+	// StatusProperty is the property name of a status, select or checkbox
+	// field with the status of tasks.
+	StatusProperty string
+	// LocationProperty is the property name of the location of events.
+	LocationProperty string
+	// AttendeesProperty is the property name of a people, email or text
+	// field with the attendees of events. Text contains email addresses
+	// separated by commas.
+	AttendeesProperty string
+	// CategoriesProperty is the property name of a multi-select, select or
+	// text field with the categories of events. Text contains categories
+	// separated by commas.
+	CategoriesProperty string
+	// IDProperty is the property name of a unique ID property, with IDs
+	// such as "TASK-123" that are used for event UIDs. Unique IDs are read
+	// from the results of queries, which the Notion client drops, so
+	// IDProperty cannot be used with Client.
+	IDProperty string
+	// IDInTitle prefixes event titles with the ID from IDProperty.
+	IDInTitle bool
+	// Filter limits events to the pages that match it, combined with
+	// HideProperty. The Notion API does not expose the filters of database
+	// views, so a view is matched by repeating its filter here.
+	Filter *notion.DatabaseQueryFilter
+	// Sorts orders the pages of the database, such as to match a view,
+	// which matters with limits and for the order of events in output.
+	Sorts []notion.DatabaseQuerySort
+	// PageSize is the number of pages and blocks fetched by each request,
+	// up to the maximum of 100. Smaller pages help with proxies that limit
+	// response sizes. Defaults to 100.
+	PageSize int
+	// MaxBlockDepth is how deeply nested blocks, such as toggles and synced
+	// blocks, are read into the content of events. Blocks of the page are
+	// at depth 1. Defaults to 5.
+	MaxBlockDepth int
+	// SkipBlockTypes are types of blocks left out of the content of events,
+	// with their children, such as notion.BlockTypeImage for images with
+	// expiring URLs.
+	SkipBlockTypes []notion.BlockType
+	// RequestTimeout limits each request to the Notion API, such as for
+	// pages with large blocks that take longer. Defaults to 30s.
+	RequestTimeout time.Duration
+	// ReadTimeout limits a whole read of the database, including the
+	// content of its pages, such as to fail fast in CI. Reads are not
+	// limited by default.
+	ReadTimeout time.Duration
+	// ChildDatabases is how databases inside pages, such as agendas, are
+	// added to the content of events. Defaults to ChildDatabasesNone.
+	ChildDatabases ChildDatabases
+	// ContentCache stores the content of pages, so that only pages edited
+	// since are read again, such as a NewMemoryContentCache for a source
+	// that is read repeatedly.
+	ContentCache ContentCache
+	// Formatters overrides how property values are rendered in the event
+	// description.
+	Formatters PropertyFormatters
+	// Logger receives messages about fetched pages and blocks, instead of
+	// the standard logger.
+	Logger Logger
+	// Client is used instead of a client created with APIKey, such as a
+	// client with instrumentation or custom authentication.
+	Client *notion.Client
+	// HTTPClient is used by the client created with APIKey when set, such as
+	// to add a caching transport.
+	HTTPClient *http.Client
+	// Stats counts the pages read when set.
+	Stats *ReadStats
+	// Warnings collects non-fatal issues of pages when set, such as pages
+	// without a date and blocks left out of their content, and pages with
+	// values that cannot be parsed are skipped with a warning. Content
+	// read from the ContentCache is not checked again.
+	Warnings *Warnings
+	// Checkpoint stores the progress of reads when set, so that a read that
+	// failed resumes after the pages already read, such as with a
+	// NewDirReadCheckpoint across runs. Progress older than an hour is
+	// discarded. Stats and Warnings only count the pages read after
+	// resuming.
+	Checkpoint ReadCheckpoint
 }
 
 type SourceAPI struct {
 	config   ConfigSourceAPI
 	client   *notion.Client
 	database notion.Database
+	mentions *mentionCache
+	// uniqueIDs collects the values of IDProperty when it is set
+	uniqueIDs *uniqueIDs
 }
 
 func NewSourceAPI(config ConfigSourceAPI) (SourceAPI, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	client := notion.NewClient(config.APIKey)
-
-	// Checks that the database exists, and also fetches the database name
-	database, err := client.FindDatabaseByID(ctx, config.DatabaseID)
+	s, err := OpenSourceAPI(config)
 	if err != nil {
 		return SourceAPI{}, err
 	}
@@ -49,11 +144,39 @@ func NewSourceAPI(config ConfigSourceAPI) (SourceAPI, error) {
 	// Check that DateProperty and HideProperty exists
 	datePropertyMatches := 0
 	hidePropertyMatches := 0
+	recurrencePropertyMatches := 0
+	exceptionsPropertyMatches := 0
+	statusPropertyMatches := 0
+	locationPropertyMatches := 0
+	attendeesPropertyMatches := 0
+	categoriesPropertyMatches := 0
+	idPropertyMatches := 0
 	var propertyNames []string
 
 	// Loop through each property and find any matching ones
-	for name, property := range database.Properties {
+	for name, property := range s.database.Properties {
 		propertyNames = append(propertyNames, name)
+		if name == config.RecurrenceProperty {
+			recurrencePropertyMatches += 1
+		}
+		if name == config.ExceptionsProperty {
+			exceptionsPropertyMatches += 1
+		}
+		if name == config.StatusProperty {
+			statusPropertyMatches += 1
+		}
+		if name == config.LocationProperty {
+			locationPropertyMatches += 1
+		}
+		if name == config.AttendeesProperty {
+			attendeesPropertyMatches += 1
+		}
+		if name == config.CategoriesProperty {
+			categoriesPropertyMatches += 1
+		}
+		if name == config.IDProperty && property.Type == DBPropTypeUniqueID {
+			idPropertyMatches += 1
+		}
 		switch property.Type {
 		case "date":
 			if config.DateProperty == "" {
@@ -61,7 +184,7 @@ func NewSourceAPI(config ConfigSourceAPI) (SourceAPI, error) {
 			} else if name == config.DateProperty {
 				datePropertyMatches += 1
 			}
-		case "checkbox":
+		case "checkbox", "formula":
 			if config.HideProperty == "" {
 				continue
 			} else if name == config.HideProperty {
@@ -71,58 +194,351 @@ func NewSourceAPI(config ConfigSourceAPI) (SourceAPI, error) {
 	}
 
 	if datePropertyMatches != 1 {
-		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrNoDateProperty, config.DateProperty, propertyNames)
+		return SourceAPI{}, s.propertyError(ErrNoDateProperty, config.DateProperty, propertyNames)
 	}
 	if config.HideProperty != "" && hidePropertyMatches != 1 {
-		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrNoHideProperty, config.DateProperty, propertyNames)
+		return SourceAPI{}, s.propertyError(ErrNoHideProperty, config.HideProperty, propertyNames)
+	}
+	if err := s.checkHideFormula(); err != nil {
+		return SourceAPI{}, err
+	}
+	if config.RecurrenceProperty != "" && recurrencePropertyMatches != 1 {
+		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, config.RecurrenceProperty, propertyNames)
+	}
+	if config.ExceptionsProperty != "" && exceptionsPropertyMatches != 1 {
+		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, config.ExceptionsProperty, propertyNames)
+	}
+	if config.StatusProperty != "" && statusPropertyMatches != 1 {
+		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, config.StatusProperty, propertyNames)
+	}
+	if config.LocationProperty != "" && locationPropertyMatches != 1 {
+		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, config.LocationProperty, propertyNames)
+	}
+	if config.AttendeesProperty != "" && attendeesPropertyMatches != 1 {
+		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, config.AttendeesProperty, propertyNames)
+	}
+	if config.CategoriesProperty != "" && categoriesPropertyMatches != 1 {
+		return SourceAPI{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, config.CategoriesProperty, propertyNames)
+	}
+	if config.IDProperty != "" && idPropertyMatches != 1 {
+		return SourceAPI{}, s.propertyError(ErrPropertyNotFound, config.IDProperty, propertyNames)
 	}
 
 	// Titles are guaranteed to exist
 
+	return s, nil
+}
+
+// checkHideFormula checks that a formula hide property has a checkbox
+// result. The database schema does not include the result type of formulas,
+// so it is read from a page, and databases without pages pass.
+func (s SourceAPI) checkHideFormula() error {
+	if s.database.Properties[s.config.HideProperty].Type != notion.DBPropTypeFormula {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.requestTimeout())
+	defer cancel()
+	response, err := s.queryDatabase(ctx, &notion.DatabaseQuery{PageSize: 1})
+	if err != nil {
+		return err
+	}
+	if len(response.Results) == 0 {
+		return nil
+	}
+	return checkHideFormulaResult(response.Results[0], s.config.HideProperty)
+}
+
+// checkHideFormulaResult checks that the formula property name of page has
+// a checkbox result.
+func checkHideFormulaResult(page notion.Page, name string) error {
+	properties, _ := page.Properties.(notion.DatabasePageProperties)
+	formula := properties[name].Formula
+	if formula != nil && formula.Type != notion.FormulaResultTypeBoolean {
+		return fmt.Errorf("%w: %w: %s is a formula of %s, not a checkbox", ErrNoHideProperty, ErrSchemaMismatch, name, formula.Type)
+	}
+	return nil
+}
+
+// propertyError is the error of a property that is missing from the
+// database, or that has the wrong type.
+func (s SourceAPI) propertyError(missing error, name string, propertyNames []string) error {
+	if property, ok := s.database.Properties[name]; ok && name != "" {
+		return fmt.Errorf("%w: %w: %s is %s", missing, ErrSchemaMismatch, name, property.Type)
+	}
+	return fmt.Errorf("%w: %s not in %v", missing, name, propertyNames)
+}
+
+// OpenSourceAPI fetches the database like NewSourceAPI, but does not check
+// that the date and hide properties exist. It is useful for inspecting
+// databases with Properties.
+func OpenSourceAPI(config ConfigSourceAPI) (SourceAPI, error) {
+	if config.PageSize < 0 || config.PageSize > maxPageSize {
+		return SourceAPI{}, fmt.Errorf("page size %d is not between 1 and %d", config.PageSize, maxPageSize)
+	}
+	if config.MaxBlockDepth < 0 {
+		return SourceAPI{}, fmt.Errorf("invalid block depth %d", config.MaxBlockDepth)
+	}
+	if config.RequestTimeout < 0 || config.ReadTimeout < 0 {
+		return SourceAPI{}, fmt.Errorf("invalid timeout")
+	}
+	if err := checkBlockTypes(config.SkipBlockTypes); err != nil {
+		return SourceAPI{}, err
+	}
+	if err := checkChildDatabases(config.ChildDatabases); err != nil {
+		return SourceAPI{}, err
+	}
+	if config.IDProperty != "" && config.Client != nil {
+		return SourceAPI{}, errors.New("unique ID properties cannot be read with a prebuilt client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.requestTimeout())
+	defer cancel()
+
+	// Query responses pass through ids to read unique IDs
+	var ids *uniqueIDs
+	clientConfig := config
+	if config.IDProperty != "" {
+		ids, clientConfig.HTTPClient = newUniqueIDs(config.IDProperty, config.HTTPClient)
+	}
+	client := clientConfig.client()
+
+	// Checks that the database exists, and also fetches the database name
+	database, err := client.FindDatabaseByID(ctx, config.DatabaseID)
+	if err != nil {
+		return SourceAPI{}, notionAPIError(err, ErrDatabaseNotFound, ErrDatabaseNotFound)
+	}
+
 	return SourceAPI{
-		config:   config,
-		client:   client,
-		database: database,
+		config:    config,
+		client:    client,
+		database:  database,
+		mentions:  newMentionCache(),
+		uniqueIDs: ids,
 	}, nil
 }
 
+// client is Client, or a client for APIKey.
+func (config ConfigSourceAPI) client() *notion.Client {
+	if config.Client != nil {
+		return config.Client
+	}
+	var opts []notion.ClientOption
+	if config.HTTPClient != nil {
+		opts = append(opts, notion.WithHTTPClient(config.HTTPClient))
+	}
+	return notion.NewClient(config.APIKey, opts...)
+}
+
+// requestTimeout is RequestTimeout, or the default timeout.
+func (config ConfigSourceAPI) requestTimeout() time.Duration {
+	if config.RequestTimeout == 0 {
+		return defaultRequestTimeout
+	}
+	return config.RequestTimeout
+}
+
+// requestContext limits a request to the API to RequestTimeout.
+func (s SourceAPI) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.config.requestTimeout())
+}
+
+func (s SourceAPI) logger() Logger {
+	return loggerOrDefault(s.config.Logger)
+}
+
+// warn logs a non-fatal issue of item, and collects it into the warnings
+// when set.
+func (s SourceAPI) warn(kind WarningKind, item string, format string, v ...any) {
+	s.logger().Printf("%s: %s", item, fmt.Sprintf(format, v...))
+	s.config.Warnings.add(kind, item, format, v...)
+}
+
 func (s SourceAPI) Name() string {
 	return richTextToString(s.database.Title)
 }
 
+// Properties lists the properties of the database, sorted by name.
+func (s SourceAPI) Properties() ([]SourceProperty, error) {
+	return databaseProperties(s.database.Properties), nil
+}
+
+// databaseProperties lists the properties of a database, sorted by name.
+func databaseProperties(databaseProperties notion.DatabaseProperties) []SourceProperty {
+	properties := make([]SourceProperty, 0, len(databaseProperties))
+	for name, property := range databaseProperties {
+		properties = append(properties, SourceProperty{
+			Name: name,
+			Type: string(property.Type),
+		})
+	}
+
+	sort.Slice(properties, func(i, j int) bool {
+		return properties[i].Name < properties[j].Name
+	})
+
+	return properties
+}
+
 func (s SourceAPI) ReadAll() ([]Event, error) {
+	return s.ReadAllContext(context.Background())
+}
+
+// ReadAllContext is ReadAll with a context for cancellation and tracing.
+func (s SourceAPI) ReadAllContext(ctx context.Context) ([]Event, error) {
 	events := make([]Event, 0)
+	err := s.StreamContext(ctx, func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// StreamContext passes each event to yield once its page is read, so that
+// events can be written while later pages are read. The next pages of the
+// database are queried while the content of pages is read.
+func (s SourceAPI) StreamContext(ctx context.Context, yield func(Event) error) (err error) {
+	ctx, span := tracer.Start(ctx, "SourceAPI.ReadAll", trace.WithAttributes(attribute.String("notion.database_id", s.database.ID)))
+	defer func() { endSpan(span, err) }()
+
+	if s.config.ReadTimeout > 0 {
+		parent := ctx
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ReadTimeout)
+		defer cancel()
+		defer func() {
+			if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+				err = fmt.Errorf("read of database took longer than %v: %w", s.config.ReadTimeout, err)
+			}
+		}()
+	}
+
+	s.mentions.reset()
+	s.config.Warnings.reset()
+
+	// Events of the pages read before an interrupted read are yielded
+	// again, and the query continues after them
 	query := s.initialQuery()
+	key := s.checkpointKey(query)
+	progress, resumed := s.loadProgress(key)
+	if resumed {
+		s.logger().Printf("resuming read of %v after %d events", s.database.ID, len(progress.Events))
+		for _, event := range progress.Events {
+			if err := yield(event.event()); err != nil {
+				return err
+			}
+		}
+		query.StartCursor = progress.Cursor
+	}
 
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		response, err := s.client.QueryDatabase(ctx, s.database.ID, query)
+	ctx, cancel := context.WithCancel(ctx)
+	results := s.queryPages(ctx, query)
+	defer func() {
+		// Stop querying when returning early, and wait for the query in
+		// progress to end
 		cancel()
-		if err != nil {
-			return nil, err
+		for range results {
 		}
+	}()
 
-		for _, page := range response.Results {
-			event, err := s.eventFromPage(page)
+	for result := range results {
+		if result.err != nil {
+			return result.err
+		}
+
+		for _, page := range result.pages {
+			s.config.Stats.row()
+			event, err := s.eventFromPage(ctx, page)
 			if err != nil {
-				return nil, err
+				if skipRow(s.config.Stats, s.config.Warnings, page.URL, err) {
+					continue
+				}
+				return err
+			}
+			if event.Start.IsZero() {
+				s.config.Stats.undated()
+				s.config.Warnings.add(WarningDate, page.URL, "has no date")
+			}
+			if event.Title == "" {
+				s.config.Warnings.add(WarningProperty, page.URL, "has no title")
 			}
 
-			events = append(events, event)
+			if err := yield(event); err != nil {
+				return err
+			}
+			if s.config.Checkpoint != nil {
+				progress.Events = append(progress.Events, newJSONEvent(event))
+			}
 		}
 
-		if !response.HasMore {
-			break
+		if result.next != "" {
+			progress.Cursor = result.next
+			s.saveProgress(key, progress)
 		}
-		query.StartCursor = *response.NextCursor
 	}
 
-	return events, nil
+	// Queries stop without a result when cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.clearProgress(key)
+	return nil
 }
 
-func (s SourceAPI) eventFromPage(page notion.Page) (Event, error) {
-	var title, emoji string
+// queryResult is a response of a database query, or the error of the query.
+type queryResult struct {
+	pages []notion.Page
+	// next is the cursor of the next response, when there is one
+	next string
+	err  error
+}
+
+// queryPages queries the pages of the database in the background, one
+// response ahead of the pages being read, until ctx is cancelled.
+func (s SourceAPI) queryPages(ctx context.Context, query *notion.DatabaseQuery) <-chan queryResult {
+	results := make(chan queryResult, 1)
+	go func() {
+		defer close(results)
+		for {
+			response, err := s.queryDatabase(ctx, query)
+			result := queryResult{pages: response.Results, err: err}
+			if response.HasMore && response.NextCursor != nil {
+				result.next = *response.NextCursor
+			}
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil || !response.HasMore || response.NextCursor == nil {
+				return
+			}
+			query.StartCursor = *response.NextCursor
+		}
+	}()
+	return results
+}
+
+func (s SourceAPI) queryDatabase(ctx context.Context, query *notion.DatabaseQuery) (response notion.DatabaseQueryResponse, err error) {
+	ctx, span := tracer.Start(ctx, "notion.QueryDatabase", trace.WithAttributes(attribute.String("notion.start_cursor", query.StartCursor)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.requestContext(ctx)
+	defer cancel()
+	response, err = s.client.QueryDatabase(ctx, s.database.ID, query)
+	return response, notionAPIError(err, ErrDatabaseNotFound, ErrSchemaMismatch)
+}
+
+func (s SourceAPI) eventFromPage(ctx context.Context, page notion.Page) (Event, error) {
+	var title, emoji, recurrence, status, location string
 	var start, end time.Time
+	var allDay bool
+	var exceptions []time.Time
+	var attendees []Attendee
+	var categories []string
 
 	if page.Icon != nil && page.Icon.Emoji != nil {
 		emoji = *page.Icon.Emoji
@@ -138,22 +554,42 @@ func (s SourceAPI) eventFromPage(page notion.Page) (Event, error) {
 			title = richTextToString(property.Title)
 			continue
 		case notion.DBPropTypeDate:
-			if s.config.DateProperty == "" {
-				start = property.Date.Start.Time
-				end = property.Date.End.Time
-				continue
-			} else if name == s.config.DateProperty {
-				start = property.Date.Start.Time
-				end = property.Date.End.Time
+			if s.config.DateProperty == "" || name == s.config.DateProperty {
+				start, end, allDay = notionDateRange(property.Date)
 				continue
 			}
 		case notion.DBPropTypeRelation:
 			continue
 		}
+		if name == s.config.IDProperty {
+			continue
+		}
 		// Because QueryDatabase does not populate Name, manually populate it
 		if property.Name == "" {
 			property.Name = name
 		}
+		if name == s.config.RecurrenceProperty {
+			recurrence = FormatProperty(property)
+		}
+		if name == s.config.ExceptionsProperty {
+			exceptions = exceptionDates(property)
+		}
+		if name == s.config.StatusProperty {
+			status = FormatProperty(property)
+		}
+		if name == s.config.LocationProperty {
+			location = FormatProperty(property)
+		}
+		if name == s.config.AttendeesProperty {
+			attendees = propertyAttendees(property)
+		}
+		if name == s.config.CategoriesProperty {
+			categories = propertyCategories(property)
+		}
+		if format := s.config.Formatters.lookup(property); format != nil {
+			propertiesList = append(propertiesList, formattedProperty{property, format})
+			continue
+		}
 		propertiesList = append(propertiesList, apiProperty(property))
 	}
 
@@ -162,45 +598,81 @@ func (s SourceAPI) eventFromPage(page notion.Page) (Event, error) {
 		return strings.Compare(propertiesList[i].NameString(), propertiesList[j].NameString()) < 0
 	})
 
+	rule, err := parseRecurrence(recurrence)
+	if err != nil {
+		return Event{}, err
+	}
+
 	// Get page content
-	content, err := s.getPageContentPlain(page.ID)
+	content, err := s.pageContent(ctx, page)
 	if err != nil {
 		return Event{}, err
 	}
 
+	id := page.ID + "@notion-ical"
+	if s.config.IDProperty != "" {
+		uniqueID, err := s.uniqueID(page.ID)
+		if err != nil {
+			return Event{}, err
+		}
+		id = uniqueIDUID(uniqueID)
+		if s.config.IDInTitle {
+			title = titleWithID(uniqueID, title)
+		}
+	}
+
 	return Event{
-		ID:         page.ID + "@notion-ical",
-		Title:      title,
-		Emoji:      emoji,
-		URL:        page.URL,
-		Start:      start,
-		End:        end,
-		Properties: propertiesList,
-		Content:    content,
+		ID:          id,
+		Title:       title,
+		Emoji:       emoji,
+		URL:         page.URL,
+		Start:       start,
+		End:         end,
+		AllDay:      allDay,
+		Recurrence:  rule,
+		Exceptions:  exceptions,
+		Status:      status,
+		Location:    location,
+		Attendees:   attendees,
+		Categories:  categories,
+		Created:     page.CreatedTime,
+		LastEdited:  page.LastEditedTime,
+		Properties:  propertiesList,
+		Content:     content.Content,
+		ContentHTML: content.ContentHTML,
 	}, nil
 }
 
-func (s SourceAPI) getPageContentPlain(id string) ([]string, error) {
-	var content []string
+// blockNode is a block of page content with the children read below it.
+type blockNode struct {
+	block    notion.Block
+	children []blockNode
+	// database is the rows of a child database, with ChildDatabasesTable
+	database *childDatabase
+}
+
+func (s SourceAPI) getPageContent(ctx context.Context, id string) (content []blockNode, err error) {
+	ctx, span := tracer.Start(ctx, "SourceAPI.getPageContent", trace.WithAttributes(attribute.String("notion.page_id", id)))
+	defer func() { endSpan(span, err) }()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	block, err := s.client.FindBlockByID(ctx, id)
+	blockCtx, cancel := s.requestContext(ctx)
+	block, err := s.client.FindBlockByID(blockCtx, id)
 	cancel()
 	if err != nil {
-			return content, fmt.Errorf("failed fetching block %v: %w", id, err)
+		return content, fmt.Errorf("failed fetching block %v: %w", id, notionAPIError(err, nil, nil))
 	}
 
-	log.Printf("fetched block %v", id)
+	s.logger().Printf("fetched block %v", id)
 
 	switch b := block.(type) {
 	case notion.ChildPageBlock:
 		// Most page blocks should be this type
 	default:
-		content = append(content, s.convertBlockContentPlain(b))
+		content = append(content, blockNode{block: b})
 	}
 
 	if block.HasChildren() {
-		childrenContent, err := s.getBlockChildrenContentPlain(id)
+		childrenContent, err := s.getBlockChildrenContent(ctx, id, 1)
 		if err != nil {
 			return content, err
 		}
@@ -211,35 +683,66 @@ func (s SourceAPI) getPageContentPlain(id string) ([]string, error) {
 	return content, nil
 }
 
-func (s SourceAPI) getBlockChildrenContentPlain(id string) ([]string, error) {
-	var content []string
+// getBlockChildrenContent reads the children of a block at depth, and their
+// children up to MaxBlockDepth.
+func (s SourceAPI) getBlockChildrenContent(ctx context.Context, id string, depth int) ([]blockNode, error) {
+	var content []blockNode
 
 	query := &notion.PaginationQuery{
 		StartCursor: "",
-		PageSize:    100,
+		PageSize:    s.pageSize(),
 	}
 
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		response, err := s.client.FindBlockChildrenByID(ctx, id, query)
-		cancel()
+		response, err := s.findBlockChildren(ctx, id, query)
 		if err != nil {
 			return content, fmt.Errorf("failed fetching child blocks for %v with query %#v: %w", id, query, err)
 		}
 
-		log.Printf("fetched child blocks for %v with query %#v and found %d child blocks", id, query, len(response.Results))
+		s.logger().Printf("fetched child blocks for %v with query %#v and found %d child blocks", id, query, len(response.Results))
 
 		for _, block := range response.Results {
-			content = append(content, s.convertBlockContentPlain(block))
+			if s.skipsBlock(block) {
+				continue
+			}
+			node := blockNode{block: block}
 
-			if block.HasChildren() {
-				childrenContent, err := s.getBlockChildrenContentPlain(block.ID())
+			if _, ok := block.(*notion.ChildDatabaseBlock); ok && s.config.ChildDatabases == ChildDatabasesTable {
+				node.database, err = s.getChildDatabase(ctx, block.ID())
 				if err != nil {
 					return content, err
 				}
+			}
+
+			// Children of synced blocks are read from the original
+			childrenID, hasChildren := block.ID(), block.HasChildren()
+			if originalID, ok := syncedFromID(block); ok {
+				childrenID, hasChildren = originalID, true
+			}
+
+			// Rows are part of tables, so are read at any depth. Columns only
+			// lay out their children, which are read at the depth of the
+			// column list.
+			_, isTable := block.(*notion.TableBlock)
+			childDepth := depth + 1
+			if isLayoutBlock(block) {
+				childDepth = depth
+			}
 
-				content = append(content, childrenContent...)
+			if hasChildren && depth >= s.maxBlockDepth() && !isTable && !isLayoutBlock(block) {
+				s.warn(WarningContent, block.ID(), "skipped child blocks deeper than %d", s.maxBlockDepth())
+			} else if hasChildren {
+				node.children, err = s.getBlockChildrenContent(ctx, childrenID, childDepth)
+				var apiErr *notion.APIError
+				if childrenID != block.ID() && errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+					// The integration may not have access to the original
+					s.warn(WarningContent, block.ID(), "skipped synced block with original %v not found", childrenID)
+				} else if err != nil {
+					return content, err
+				}
 			}
+
+			content = append(content, node)
 		}
 
 		if !response.HasMore {
@@ -251,107 +754,70 @@ func (s SourceAPI) getBlockChildrenContentPlain(id string) ([]string, error) {
 	return content, nil
 }
 
-func (s SourceAPI) convertBlockContentPlain(block notion.Block) string {
-	switch b := block.(type) {
-	case *notion.ParagraphBlock:
-		return richTextToString(b.RichText)
-	case *notion.Heading1Block:
-		return "# " + richTextToString(b.RichText)
-	case *notion.Heading2Block:
-		return "## " + richTextToString(b.RichText)
-	case *notion.Heading3Block:
-		return "### " + richTextToString(b.RichText)
-	case *notion.BulletedListItemBlock:
-		return "- " + richTextToString(b.RichText)
-	case *notion.NumberedListItemBlock:
-		return "* " + richTextToString(b.RichText)
-	case *notion.ToDoBlock:
-		prefix := "[ ] "
-		if b.Checked != nil && *b.Checked == true {
-			prefix = "[x] "
-		}
-		return prefix + richTextToString(b.RichText)
-	case *notion.ToggleBlock:
-		return "^ " + richTextToString(b.RichText)
-	case *notion.CalloutBlock:
-		return "! " + richTextToString(b.RichText)
-	case *notion.QuoteBlock:
-		return "> " + richTextToString(b.RichText)
-	case *notion.CodeBlock:
-		return "```\n" + richTextToString(b.RichText) + "\n```"
-	case *notion.EmbedBlock:
-		return "Embed: " + b.URL
-	case *notion.ImageBlock:
-		return "Image: " + fileToString(b.Type, b.File, b.External)
-	case *notion.AudioBlock:
-		return "Audio: " + fileToString(b.Type, b.File, b.External)
-	case *notion.VideoBlock:
-		return "Video: " + fileToString(b.Type, b.File, b.External)
-	case *notion.FileBlock:
-		return "File: " + fileToString(b.Type, b.File, b.External)
-	case *notion.PDFBlock:
-		return "PDF: " + fileToString(b.Type, b.File, b.External)
-	case *notion.BookmarkBlock:
-		return "Bookmark: " + b.URL
-	case *notion.EquationBlock:
-		return "Expression: " + b.Expression
-	case *notion.DividerBlock:
-		return "--------------------------"
-	case *notion.TableOfContentsBlock:
-		return ""
-	case *notion.BreadcrumbBlock:
-		return ""
-	case *notion.ColumnListBlock:
-		return ""
-	case *notion.ColumnBlock:
-		return ""
-	case *notion.TableBlock:
-		var st []string
-		for _, block := range b.Children {
-			st = append(st, s.convertBlockContentPlain(block))
-		}
-		return strings.Join(st, "\n")
-	case *notion.TableRowBlock:
-		var s []string
-		for _, cell := range b.Cells {
-			s = append(s, richTextToString(cell))
-		}
-		return strings.Join(s, ", ")
-	case *notion.LinkPreviewBlock:
-		return "Preview: " + b.URL
-	case *notion.LinkToPageBlock:
-		switch b.Type {
-		case notion.LinkToPageTypePageID:
-			return "Link: " + b.PageID
-		case notion.LinkToPageTypeDatabaseID:
-			return "Link: " + b.DatabaseID
-		}
-	case *notion.SyncedBlock:
-		var sy []string
-		for _, block := range b.Children {
-			log.Printf("synced child block %v", block.ID())
-			sy = append(sy, s.convertBlockContentPlain(block))
-		}
-		return strings.Join(sy, "\n\n")
-	case *notion.TemplateBlock:
-		return "Template: " + richTextToString(b.RichText)
-	}
-	return ""
+func (s SourceAPI) findBlockChildren(ctx context.Context, id string, query *notion.PaginationQuery) (response notion.BlockChildrenResponse, err error) {
+	ctx, span := tracer.Start(ctx, "notion.FindBlockChildrenByID", trace.WithAttributes(attribute.String("notion.block_id", id)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.requestContext(ctx)
+	defer cancel()
+	response, err = s.client.FindBlockChildrenByID(ctx, id, query)
+	return response, notionAPIError(err, nil, nil)
 }
 
 func (s SourceAPI) initialQuery() *notion.DatabaseQuery {
 	return &notion.DatabaseQuery{
 		Filter:   s.filter(),
-		PageSize: 100,
+		Sorts:    s.config.Sorts,
+		PageSize: s.pageSize(),
+	}
+}
+
+func (s SourceAPI) maxBlockDepth() int {
+	if s.config.MaxBlockDepth == 0 {
+		return defaultMaxBlockDepth
+	}
+	return s.config.MaxBlockDepth
+}
+
+func (s SourceAPI) pageSize() int {
+	if s.config.PageSize == 0 {
+		return maxPageSize
 	}
+	return s.config.PageSize
 }
 
 var filterTrue = true
 
+// filter combines the filter that hides events with HideProperty and Filter.
 func (s SourceAPI) filter() *notion.DatabaseQueryFilter {
+	hide := s.hideFilter()
+	switch {
+	case hide == nil:
+		return s.config.Filter
+	case s.config.Filter == nil:
+		return hide
+	}
+	return &notion.DatabaseQueryFilter{
+		And: []notion.DatabaseQueryFilter{*hide, *s.config.Filter},
+	}
+}
+
+func (s SourceAPI) hideFilter() *notion.DatabaseQueryFilter {
 	if s.config.HideProperty == "" {
 		return nil
 	}
+	if s.database.Properties[s.config.HideProperty].Type == notion.DBPropTypeFormula {
+		return &notion.DatabaseQueryFilter{
+			Property: s.config.HideProperty,
+			DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+				Formula: &notion.FormulaDatabaseQueryFilter{
+					Checkbox: &notion.CheckboxDatabaseQueryFilter{
+						DoesNotEqual: &filterTrue,
+					},
+				},
+			},
+		}
+	}
 	return &notion.DatabaseQueryFilter{
 		Property: s.config.HideProperty,
 		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
@@ -369,25 +835,42 @@ func (p apiProperty) NameString() string {
 }
 
 func (p apiProperty) ValueString() string {
+	return FormatProperty(notion.DatabasePageProperty(p))
+}
+
+// ValueHTML renders the value with links from rich text and URLs.
+func (p apiProperty) ValueHTML() string {
+	switch p.Type {
+	case notion.DBPropTypeRichText:
+		return richTextToHTML(p.RichText)
+	case notion.DBPropTypeURL:
+		if p.URL != nil {
+			return linkHTML(*p.URL, *p.URL)
+		}
+	}
+	return strings.ReplaceAll(html.EscapeString(p.ValueString()), "\n", "<br>")
+}
+
+// FormatProperty renders a property value as a string, as done when no
+// PropertyFormatter overrides it.
+func FormatProperty(p notion.DatabasePageProperty) string {
 	switch p.Type {
 	case notion.DBPropTypeTitle:
 		return richTextToString(p.Title)
 	case notion.DBPropTypeRichText:
-		return richTextToString(p.RichText)
+		return richTextWithLinks(p.RichText)
 	case notion.DBPropTypeNumber:
 		if p.Number != nil {
-			return fmt.Sprintf("%f", *p.Number)
+			return strconv.FormatFloat(*p.Number, 'f', 6, 64)
 		}
 	case notion.DBPropTypeSelect:
 		if p.Select != nil {
 			return p.Select.Name
 		}
 	case notion.DBPropTypeMultiSelect:
-		var s []string
-		for _, opt := range p.MultiSelect {
-			s = append(s, opt.Name)
-		}
-		return strings.Join(s, ", ")
+		return joinValues(len(p.MultiSelect), func(i int) string {
+			return p.MultiSelect[i].Name
+		})
 	case notion.DBPropTypeDate:
 		if p.Date != nil {
 			if p.Date.End != nil {
@@ -400,27 +883,22 @@ func (p apiProperty) ValueString() string {
 			return fmt.Sprintf("%v", p.Formula.Value())
 		}
 	case notion.DBPropTypeRelation:
-		var s []string
-		for _, rel := range p.Relation {
-			s = append(s, rel.ID)
-		}
-		return strings.Join(s, ", ")
+		return joinValues(len(p.Relation), func(i int) string {
+			return p.Relation[i].ID
+		})
 	case notion.DBPropTypeRollup:
 		if p.Rollup != nil {
 			return fmt.Sprintf("%v", p.Rollup.Value())
 		}
 	case notion.DBPropTypePeople:
-		var s []string
-		for _, person := range p.People {
-			s = append(s, person.Name)
-		}
-		return strings.Join(s, ", ")
+		return joinValues(len(p.People), func(i int) string {
+			return p.People[i].Name
+		})
 	case notion.DBPropTypeFiles:
-		var s []string
-		for _, file := range p.Files {
-			s = append(s, fileToString(file.Type, file.File, file.External))
-		}
-		return strings.Join(s, ", ")
+		return joinValues(len(p.Files), func(i int) string {
+			file := p.Files[i]
+			return fileToString(file.Type, file.File, file.External)
+		})
 	case notion.DBPropTypeCheckbox:
 		if p.Checkbox != nil {
 			if *p.Checkbox {
@@ -465,13 +943,169 @@ func (p apiProperty) ValueString() string {
 	return ""
 }
 
+// joinValues joins n values with commas, without collecting them in a slice
+// first.
+func joinValues(n int, value func(i int) string) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return value(0)
+	}
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(value(i))
+	}
+	return b.String()
+}
+
+// exceptionDates reads the dates of a date, rollup or text property. Text
+// contains ISO dates separated by commas, semicolons or new lines.
+func exceptionDates(p notion.DatabasePageProperty) []time.Time {
+	var dates []time.Time
+	switch p.Type {
+	case notion.DBPropTypeDate:
+		if p.Date != nil {
+			dates = append(dates, notionDateDates(*p.Date)...)
+		}
+	case notion.DBPropTypeRollup:
+		if p.Rollup != nil {
+			if p.Rollup.Date != nil {
+				dates = append(dates, notionDateDates(*p.Rollup.Date)...)
+			}
+			for _, item := range p.Rollup.Array {
+				dates = append(dates, exceptionDates(item)...)
+			}
+		}
+	case notion.DBPropTypeRichText, notion.DBPropTypeFormula:
+		fields := strings.FieldsFunc(FormatProperty(p), func(r rune) bool {
+			return r == ',' || r == ';' || r == '\n'
+		})
+		for _, field := range fields {
+			if t, err := time.Parse(time.DateOnly, strings.TrimSpace(field)); err == nil {
+				dates = append(dates, t)
+			}
+		}
+	}
+	return dates
+}
+
+// propertyAttendees reads the attendees of a people, email or text
+// property. People without an email address are attendees by name.
+func propertyAttendees(p notion.DatabasePageProperty) []Attendee {
+	switch p.Type {
+	case notion.DBPropTypePeople:
+		attendees := make([]Attendee, 0, len(p.People))
+		for _, user := range p.People {
+			attendee := Attendee{Name: user.Name}
+			if user.Person != nil {
+				attendee.Email = user.Person.Email
+			}
+			attendees = append(attendees, attendee)
+		}
+		return attendees
+	}
+	return listAttendees(splitList(FormatProperty(p)))
+}
+
+// propertyCategories reads the categories of a multi-select, select or text
+// property.
+func propertyCategories(p notion.DatabasePageProperty) []string {
+	switch p.Type {
+	case notion.DBPropTypeMultiSelect:
+		categories := make([]string, 0, len(p.MultiSelect))
+		for _, option := range p.MultiSelect {
+			categories = append(categories, option.Name)
+		}
+		return categories
+	}
+	return splitList(FormatProperty(p))
+}
+
+// notionDateRange returns the start and end of an event on a date value.
+// allDay is true when neither side of the value has a time. Notion includes
+// the end date of ranges of dates, while End is exclusive for all-day events.
+func notionDateRange(date *notion.Date) (start, end time.Time, allDay bool) {
+	if date == nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start = date.Start.Time
+	allDay = !date.Start.HasTime() && (date.End == nil || !date.End.HasTime())
+	switch {
+	case date.End != nil && allDay:
+		end = date.End.Time.AddDate(0, 0, 1)
+	case date.End != nil:
+		end = date.End.Time
+	case allDay:
+		end = start.AddDate(0, 0, 1)
+	default:
+		end = start
+	}
+	return start, end, allDay
+}
+
+// notionDateDates lists each date in a date value, including each day of a
+// range.
+func notionDateDates(date notion.Date) []time.Time {
+	if date.End == nil {
+		return []time.Time{date.Start.Time}
+	}
+	return datesBetween(date.Start.Time, date.End.Time)
+}
+
+// richTextWithLinks renders rich text as plain text, with the URL of each
+// link in parentheses after its text, such as "agenda (https://...)".
+func richTextWithLinks(rt []notion.RichText) string {
+	var b strings.Builder
+	b.Grow(richTextLen(rt))
+	for i, rts := range rt {
+		b.WriteString(rts.PlainText)
+		if rts.HRef == nil || *rts.HRef == "" {
+			continue
+		}
+		// Spans of a link with different annotations share the URL
+		if i+1 < len(rt) && rt[i+1].HRef != nil && *rt[i+1].HRef == *rts.HRef {
+			continue
+		}
+		if strings.TrimSpace(rts.PlainText) != *rts.HRef {
+			b.WriteString(" (")
+			b.WriteString(*rts.HRef)
+			b.WriteString(")")
+		}
+	}
+
+	return b.String()
+}
+
 func richTextToString(rt []notion.RichText) string {
-	var s []string
+	switch len(rt) {
+	case 0:
+		return ""
+	case 1:
+		return rt[0].PlainText
+	}
+
+	var b strings.Builder
+	b.Grow(richTextLen(rt))
 	for _, rts := range rt {
-		s = append(s, rts.PlainText)
+		b.WriteString(rts.PlainText)
 	}
 
-	return strings.Join(s, "")
+	return b.String()
+}
+
+// richTextLen is the length of the plain text of rich text, to preallocate
+// strings built from it.
+func richTextLen(rt []notion.RichText) int {
+	n := 0
+	for _, rts := range rt {
+		n += len(rts.PlainText)
+	}
+	return n
 }
 
 func fileToString(t notion.FileType, f *notion.FileFile, e *notion.FileExternal) string {
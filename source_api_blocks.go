@@ -0,0 +1,187 @@
+package notion_ical
+
+import (
+	"fmt"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// blockTypes are the types of blocks known to the Notion client.
+var blockTypes = map[notion.BlockType]bool{
+	notion.BlockTypeParagraph: true, notion.BlockTypeHeading1: true,
+	notion.BlockTypeHeading2: true, notion.BlockTypeHeading3: true,
+	notion.BlockTypeBulletedListItem: true, notion.BlockTypeNumberedListItem: true,
+	notion.BlockTypeToDo: true, notion.BlockTypeToggle: true,
+	notion.BlockTypeChildPage: true, notion.BlockTypeChildDatabase: true,
+	notion.BlockTypeCallout: true, notion.BlockTypeQuote: true,
+	notion.BlockTypeCode: true, notion.BlockTypeEmbed: true,
+	notion.BlockTypeImage: true, notion.BlockTypeAudio: true,
+	notion.BlockTypeVideo: true, notion.BlockTypeFile: true,
+	notion.BlockTypePDF: true, notion.BlockTypeBookmark: true,
+	notion.BlockTypeEquation: true, notion.BlockTypeDivider: true,
+	notion.BlockTypeTableOfContents: true, notion.BlockTypeBreadCrumb: true,
+	notion.BlockTypeColumnList: true, notion.BlockTypeColumn: true,
+	notion.BlockTypeTable: true, notion.BlockTypeTableRow: true,
+	notion.BlockTypeLinkPreview: true, notion.BlockTypeLinkToPage: true,
+	notion.BlockTypeSyncedBlock: true, notion.BlockTypeTemplate: true,
+	notion.BlockTypeUnsupported: true,
+}
+
+// checkBlockTypes checks that types are known block types.
+func checkBlockTypes(types []notion.BlockType) error {
+	for _, t := range types {
+		if !blockTypes[t] {
+			return fmt.Errorf("unknown block type %q", t)
+		}
+	}
+	return nil
+}
+
+// blockType returns the type of a block returned by the Notion client.
+func blockType(block notion.Block) notion.BlockType {
+	switch block.(type) {
+	case *notion.ParagraphBlock:
+		return notion.BlockTypeParagraph
+	case *notion.Heading1Block:
+		return notion.BlockTypeHeading1
+	case *notion.Heading2Block:
+		return notion.BlockTypeHeading2
+	case *notion.Heading3Block:
+		return notion.BlockTypeHeading3
+	case *notion.BulletedListItemBlock:
+		return notion.BlockTypeBulletedListItem
+	case *notion.NumberedListItemBlock:
+		return notion.BlockTypeNumberedListItem
+	case *notion.ToDoBlock:
+		return notion.BlockTypeToDo
+	case *notion.ToggleBlock:
+		return notion.BlockTypeToggle
+	case *notion.ChildPageBlock:
+		return notion.BlockTypeChildPage
+	case *notion.ChildDatabaseBlock:
+		return notion.BlockTypeChildDatabase
+	case *notion.CalloutBlock:
+		return notion.BlockTypeCallout
+	case *notion.QuoteBlock:
+		return notion.BlockTypeQuote
+	case *notion.CodeBlock:
+		return notion.BlockTypeCode
+	case *notion.EmbedBlock:
+		return notion.BlockTypeEmbed
+	case *notion.ImageBlock:
+		return notion.BlockTypeImage
+	case *notion.AudioBlock:
+		return notion.BlockTypeAudio
+	case *notion.VideoBlock:
+		return notion.BlockTypeVideo
+	case *notion.FileBlock:
+		return notion.BlockTypeFile
+	case *notion.PDFBlock:
+		return notion.BlockTypePDF
+	case *notion.BookmarkBlock:
+		return notion.BlockTypeBookmark
+	case *notion.EquationBlock:
+		return notion.BlockTypeEquation
+	case *notion.DividerBlock:
+		return notion.BlockTypeDivider
+	case *notion.TableOfContentsBlock:
+		return notion.BlockTypeTableOfContents
+	case *notion.BreadcrumbBlock:
+		return notion.BlockTypeBreadCrumb
+	case *notion.ColumnListBlock:
+		return notion.BlockTypeColumnList
+	case *notion.ColumnBlock:
+		return notion.BlockTypeColumn
+	case *notion.TableBlock:
+		return notion.BlockTypeTable
+	case *notion.TableRowBlock:
+		return notion.BlockTypeTableRow
+	case *notion.LinkPreviewBlock:
+		return notion.BlockTypeLinkPreview
+	case *notion.LinkToPageBlock:
+		return notion.BlockTypeLinkToPage
+	case *notion.SyncedBlock:
+		return notion.BlockTypeSyncedBlock
+	case *notion.TemplateBlock:
+		return notion.BlockTypeTemplate
+	}
+	return notion.BlockTypeUnsupported
+}
+
+// skipsBlock reports whether a block, and its children, are left out of
+// content.
+func (s SourceAPI) skipsBlock(block notion.Block) bool {
+	t := blockType(block)
+	for _, skipped := range s.config.SkipBlockTypes {
+		if t == skipped {
+			return true
+		}
+	}
+	return false
+}
+
+// syncedFromID returns the ID of the original block of a synced block, which
+// has the content of the synced block as its children.
+func syncedFromID(block notion.Block) (string, bool) {
+	synced, ok := block.(*notion.SyncedBlock)
+	if !ok || synced.SyncedFrom == nil || synced.SyncedFrom.BlockID == "" {
+		return "", false
+	}
+	return synced.SyncedFrom.BlockID, true
+}
+
+// blockRichText returns the rich text of a block, such as its text, captions
+// or table cells.
+func blockRichText(block notion.Block) [][]notion.RichText {
+	switch b := block.(type) {
+	case *notion.ParagraphBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.Heading1Block:
+		return [][]notion.RichText{b.RichText}
+	case *notion.Heading2Block:
+		return [][]notion.RichText{b.RichText}
+	case *notion.Heading3Block:
+		return [][]notion.RichText{b.RichText}
+	case *notion.BulletedListItemBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.NumberedListItemBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.ToDoBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.ToggleBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.CalloutBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.QuoteBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.TemplateBlock:
+		return [][]notion.RichText{b.RichText}
+	case *notion.CodeBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.ImageBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.AudioBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.VideoBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.FileBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.PDFBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.BookmarkBlock:
+		return [][]notion.RichText{b.Caption}
+	case *notion.TableRowBlock:
+		return b.Cells
+	}
+	return nil
+}
+
+// isLayoutBlock reports whether a block only lays out its children, such as
+// column lists and columns.
+func isLayoutBlock(block notion.Block) bool {
+	switch block.(type) {
+	case *notion.ColumnListBlock, *notion.ColumnBlock:
+		return true
+	}
+	return false
+}
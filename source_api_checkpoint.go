@@ -0,0 +1,203 @@
+package notion_ical
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// maxCheckpointAge is how long the progress of an interrupted read is
+// resumed. Pages edited since are not read again, so older progress is
+// discarded.
+const maxCheckpointAge = time.Hour
+
+// ReadCheckpoint stores the progress of reads of databases, so that a read
+// interrupted by a network or rate limit failure resumes after the pages
+// already read, instead of reading the whole database again. Progress is
+// encoded by the source.
+type ReadCheckpoint interface {
+	// Load returns the progress stored for key.
+	Load(key string) ([]byte, bool)
+	// Save stores the progress of a read, replacing progress stored for key
+	// before.
+	Save(key string, progress []byte) error
+	// Clear removes the progress stored for key, once a read completes.
+	Clear(key string) error
+}
+
+// MemoryReadCheckpoint is a ReadCheckpoint in memory, for sources that are
+// read again in the same process.
+type MemoryReadCheckpoint struct {
+	mu       sync.Mutex
+	progress map[string][]byte
+}
+
+func NewMemoryReadCheckpoint() *MemoryReadCheckpoint {
+	return &MemoryReadCheckpoint{
+		progress: make(map[string][]byte),
+	}
+}
+
+func (c *MemoryReadCheckpoint) Load(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	progress, ok := c.progress[key]
+	return progress, ok
+}
+
+func (c *MemoryReadCheckpoint) Save(key string, progress []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress[key] = progress
+	return nil
+}
+
+func (c *MemoryReadCheckpoint) Clear(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.progress, key)
+	return nil
+}
+
+// DirReadCheckpoint is a ReadCheckpoint in a directory, with a JSON file for
+// each database, which persists across runs.
+type DirReadCheckpoint struct {
+	dir string
+}
+
+// NewDirReadCheckpoint stores progress in dir, which is created if needed.
+func NewDirReadCheckpoint(dir string) (*DirReadCheckpoint, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create checkpoint directory: %w", err)
+	}
+	return &DirReadCheckpoint{dir: dir}, nil
+}
+
+func (c *DirReadCheckpoint) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *DirReadCheckpoint) Load(key string) ([]byte, bool) {
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+func (c *DirReadCheckpoint) Save(key string, progress []byte) error {
+	// Write through a temporary file, so that an interrupted write leaves
+	// the previous progress
+	tmp, err := os.CreateTemp(c.dir, key+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(progress); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *DirReadCheckpoint) Clear(key string) error {
+	err := os.Remove(c.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readProgress is the progress of a read: the events of the responses of
+// the query read so far, encoded like MarshalEvents, and the cursor of the
+// next response.
+type readProgress struct {
+	Saved  time.Time   `json:"saved"`
+	Cursor string      `json:"cursor"`
+	Events []jsonEvent `json:"events"`
+}
+
+// checkpointKey is the key of the progress of reads of query, which changes
+// with the options that change the events read.
+func (s SourceAPI) checkpointKey(query *notion.DatabaseQuery) string {
+	options, _ := json.Marshal(struct {
+		Query              *notion.DatabaseQuery
+		Content            string
+		DateProperty       string
+		RecurrenceProperty string
+		ExceptionsProperty string
+		StatusProperty     string
+		LocationProperty   string
+		AttendeesProperty  string
+		CategoriesProperty string
+		IDProperty         string
+		IDInTitle          bool
+	}{
+		query,
+		s.contentCacheKey(""),
+		s.config.DateProperty,
+		s.config.RecurrenceProperty,
+		s.config.ExceptionsProperty,
+		s.config.StatusProperty,
+		s.config.LocationProperty,
+		s.config.AttendeesProperty,
+		s.config.CategoriesProperty,
+		s.config.IDProperty,
+		s.config.IDInTitle,
+	})
+	hash := sha256.Sum256(options)
+	return s.database.ID + "-" + hex.EncodeToString(hash[:4])
+}
+
+// loadProgress returns the progress of an interrupted read, if it is recent
+// enough to resume.
+func (s SourceAPI) loadProgress(key string) (readProgress, bool) {
+	var progress readProgress
+	if s.config.Checkpoint == nil {
+		return progress, false
+	}
+	b, ok := s.config.Checkpoint.Load(key)
+	if !ok {
+		return progress, false
+	}
+	if err := json.Unmarshal(b, &progress); err != nil || progress.Cursor == "" || time.Since(progress.Saved) > maxCheckpointAge {
+		return readProgress{}, false
+	}
+	return progress, true
+}
+
+// saveProgress stores the progress of a read, logging failures because the
+// read itself can continue.
+func (s SourceAPI) saveProgress(key string, progress readProgress) {
+	if s.config.Checkpoint == nil {
+		return
+	}
+	progress.Saved = time.Now()
+	b, err := json.Marshal(progress)
+	if err == nil {
+		err = s.config.Checkpoint.Save(key, b)
+	}
+	if err != nil {
+		s.logger().Printf("failed saving progress of %v: %v", s.database.ID, err)
+	}
+}
+
+// clearProgress removes the progress of a completed read.
+func (s SourceAPI) clearProgress(key string) {
+	if s.config.Checkpoint == nil {
+		return
+	}
+	if err := s.config.Checkpoint.Clear(key); err != nil {
+		s.logger().Printf("failed clearing progress of %v: %v", s.database.ID, err)
+	}
+}
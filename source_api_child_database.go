@@ -0,0 +1,150 @@
+package notion_ical
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ChildDatabases is how databases inside the page of an event, such as
+// agendas, are added to its content.
+type ChildDatabases string
+
+const (
+	// ChildDatabasesNone leaves databases out of content.
+	ChildDatabasesNone ChildDatabases = ""
+	// ChildDatabasesTitle adds the title of each database.
+	ChildDatabasesTitle ChildDatabases = "title"
+	// ChildDatabasesTable adds each database as a table of its rows, which
+	// takes requests to query each database.
+	ChildDatabasesTable ChildDatabases = "table"
+)
+
+// checkChildDatabases checks that c is a known way to add databases.
+func checkChildDatabases(c ChildDatabases) error {
+	switch c {
+	case ChildDatabasesNone, ChildDatabasesTitle, ChildDatabasesTable:
+		return nil
+	}
+	return fmt.Errorf("unknown child databases %q: expected %q or %q", c, ChildDatabasesTitle, ChildDatabasesTable)
+}
+
+// childDatabase is the rows of a database inside page content, with the
+// title column first.
+type childDatabase struct {
+	columns []string
+	rows    [][]string
+}
+
+// getChildDatabase queries the rows of a database inside page content.
+func (s SourceAPI) getChildDatabase(ctx context.Context, id string) (*childDatabase, error) {
+	var pages []notion.Page
+
+	query := &notion.DatabaseQuery{
+		PageSize: s.pageSize(),
+	}
+
+	for {
+		response, err := s.queryChildDatabase(ctx, id, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed querying child database %v with query %#v: %w", id, query, err)
+		}
+
+		s.logger().Printf("queried child database %v and found %d pages", id, len(response.Results))
+
+		pages = append(pages, response.Results...)
+
+		if !response.HasMore {
+			break
+		}
+		query.StartCursor = *response.NextCursor
+	}
+
+	database := &childDatabase{}
+	if len(pages) == 0 {
+		return database, nil
+	}
+
+	// Columns are the properties of the first row, with the title first
+	for name, property := range pages[0].Properties.(notion.DatabasePageProperties) {
+		if property.Type == notion.DBPropTypeTitle {
+			database.columns = append([]string{name}, database.columns...)
+			continue
+		}
+		database.columns = append(database.columns, name)
+	}
+	if len(database.columns) > 1 {
+		sort.Strings(database.columns[1:])
+	}
+
+	for _, page := range pages {
+		properties := page.Properties.(notion.DatabasePageProperties)
+		row := make([]string, len(database.columns))
+		for i, name := range database.columns {
+			property, ok := properties[name]
+			if !ok {
+				continue
+			}
+			property.Name = name
+			if format := s.config.Formatters.lookup(property); format != nil {
+				row[i] = format(property)
+			} else {
+				row[i] = FormatProperty(property)
+			}
+		}
+		database.rows = append(database.rows, row)
+	}
+
+	return database, nil
+}
+
+func (s SourceAPI) queryChildDatabase(ctx context.Context, id string, query *notion.DatabaseQuery) (response notion.DatabaseQueryResponse, err error) {
+	ctx, span := tracer.Start(ctx, "notion.QueryDatabase", trace.WithAttributes(attribute.String("notion.database_id", id), attribute.String("notion.start_cursor", query.StartCursor)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.requestContext(ctx)
+	defer cancel()
+	response, err = s.client.QueryDatabase(ctx, id, query)
+	return response, notionAPIError(err, nil, nil)
+}
+
+// markdownTable renders the database as a Markdown table.
+func (d childDatabase) markdownTable() string {
+	if len(d.columns) == 0 {
+		return ""
+	}
+	rows := [][]string{append([]string{}, d.columns...)}
+	for _, row := range d.rows {
+		rows = append(rows, append([]string{}, row...))
+	}
+	return markdownTable(rows)
+}
+
+// htmlTable renders the database as an HTML table.
+func (d childDatabase) htmlTable() string {
+	if len(d.columns) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<table><tr>")
+	for _, column := range d.columns {
+		b.WriteString("<th>" + html.EscapeString(column) + "</th>")
+	}
+	b.WriteString("</tr>")
+	for _, row := range d.rows {
+		b.WriteString("<tr>")
+		for _, value := range row {
+			b.WriteString("<td>" + strings.ReplaceAll(html.EscapeString(value), "\n", "<br>") + "</td>")
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
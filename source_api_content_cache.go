@@ -0,0 +1,160 @@
+package notion_ical
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// PageContent is the content of a page, as read into events.
+type PageContent struct {
+	Content     []string `json:"content"`
+	ContentHTML string   `json:"content_html,omitempty"`
+}
+
+// ContentCache stores the content of pages, so that the blocks of a page are
+// only read again after the page is edited. Changes to databases inside a
+// page, and to the titles of mentioned pages, do not edit the page.
+type ContentCache interface {
+	// Get returns the content stored for key, if it was stored for a page
+	// last edited at lastEdited.
+	Get(key string, lastEdited time.Time) (PageContent, bool)
+	// Put stores the content of a page last edited at lastEdited, replacing
+	// content stored for key before.
+	Put(key string, lastEdited time.Time, content PageContent) error
+}
+
+type contentCacheEntry struct {
+	LastEdited time.Time   `json:"last_edited"`
+	Content    PageContent `json:"content"`
+}
+
+// MemoryContentCache is a ContentCache in memory, which keeps the content
+// of each page as last stored.
+type MemoryContentCache struct {
+	mu      sync.Mutex
+	entries map[string]contentCacheEntry
+}
+
+func NewMemoryContentCache() *MemoryContentCache {
+	return &MemoryContentCache{
+		entries: make(map[string]contentCacheEntry),
+	}
+}
+
+func (c *MemoryContentCache) Get(key string, lastEdited time.Time) (PageContent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !entry.LastEdited.Equal(lastEdited) {
+		return PageContent{}, false
+	}
+	return entry.Content, true
+}
+
+func (c *MemoryContentCache) Put(key string, lastEdited time.Time, content PageContent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = contentCacheEntry{lastEdited, content}
+	return nil
+}
+
+// DirContentCache is a ContentCache in a directory, with a JSON file for
+// each page, which persists across runs.
+type DirContentCache struct {
+	dir string
+}
+
+// NewDirContentCache stores content in dir, which is created if needed.
+func NewDirContentCache(dir string) (*DirContentCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create content cache directory: %w", err)
+	}
+	return &DirContentCache{dir: dir}, nil
+}
+
+func (c *DirContentCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *DirContentCache) Get(key string, lastEdited time.Time) (PageContent, bool) {
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return PageContent{}, false
+	}
+	var entry contentCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil || !entry.LastEdited.Equal(lastEdited) {
+		return PageContent{}, false
+	}
+	return entry.Content, true
+}
+
+func (c *DirContentCache) Put(key string, lastEdited time.Time, content PageContent) error {
+	b, err := json.Marshal(contentCacheEntry{lastEdited, content})
+	if err != nil {
+		return err
+	}
+
+	// Write through a temporary file, so that readers never see a partial
+	// file
+	tmp, err := os.CreateTemp(c.dir, key+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// contentCacheKey is the key of the content of a page, which changes with
+// the options that change how content is read.
+func (s SourceAPI) contentCacheKey(pageID string) string {
+	options := fmt.Sprintf("%d %v %s", s.maxBlockDepth(), s.config.SkipBlockTypes, s.config.ChildDatabases)
+	hash := sha256.Sum256([]byte(options))
+	return pageID + "-" + hex.EncodeToString(hash[:4])
+}
+
+// pageContent reads the content of a page, or returns it from ContentCache
+// when the page was not edited since.
+func (s SourceAPI) pageContent(ctx context.Context, page notion.Page) (PageContent, error) {
+	key := s.contentCacheKey(page.ID)
+	if s.config.ContentCache != nil {
+		if content, ok := s.config.ContentCache.Get(key, page.LastEditedTime); ok {
+			s.logger().Printf("using cached content of %v", page.ID)
+			return content, nil
+		}
+	}
+
+	blocks, err := s.getPageContent(ctx, page.ID)
+	if err != nil {
+		return PageContent{}, err
+	}
+	s.resolveMentions(ctx, blocks)
+	content := PageContent{
+		Content:     s.contentMarkdown(blocks, ""),
+		ContentHTML: s.contentHTML(blocks),
+	}
+
+	// Edits in the minute of the last edited time, which Notion rounds to
+	// the minute, would be missed
+	if s.config.ContentCache != nil && time.Since(page.LastEditedTime) > 2*time.Minute {
+		if err := s.config.ContentCache.Put(key, page.LastEditedTime, content); err != nil {
+			s.logger().Printf("failed caching content of %v: %v", page.ID, err)
+		}
+	}
+	return content, nil
+}
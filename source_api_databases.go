@@ -0,0 +1,85 @@
+package notion_ical
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Database is a database shared with an integration, such as to choose the
+// DatabaseID of a source.
+type Database struct {
+	ID             string
+	Title          string
+	URL            string
+	LastEditedTime time.Time
+	// Properties are the properties of the database, sorted by name.
+	Properties []SourceProperty
+}
+
+// ListDatabases searches for the databases shared with the integration of
+// the API key in config, most recently edited first. Databases that are
+// not shared with the integration, even in shared pages, are not found.
+func ListDatabases(ctx context.Context, config ConfigSourceAPI) ([]Database, error) {
+	client := config.client()
+	s := SourceAPI{config: config, client: client}
+
+	opts := &notion.SearchOpts{
+		Filter: &notion.SearchFilter{
+			Property: "object",
+			Value:    "database",
+		},
+		Sort: &notion.SearchSort{
+			Direction: notion.SortDirDesc,
+			Timestamp: notion.SearchSortTimestampLastEditedTime,
+		},
+		PageSize: s.pageSize(),
+	}
+
+	var databases []Database
+	for {
+		response, err := s.search(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed searching for databases: %w", err)
+		}
+
+		for _, result := range response.Results {
+			database, ok := result.(notion.Database)
+			if !ok {
+				continue
+			}
+			databases = append(databases, Database{
+				ID:             database.ID,
+				Title:          richTextToString(database.Title),
+				URL:            database.URL,
+				LastEditedTime: database.LastEditedTime,
+				Properties:     databaseProperties(database.Properties),
+			})
+		}
+
+		if !response.HasMore || response.NextCursor == nil {
+			break
+		}
+		opts.StartCursor = *response.NextCursor
+	}
+
+	sort.SliceStable(databases, func(i, j int) bool {
+		return databases[i].LastEditedTime.After(databases[j].LastEditedTime)
+	})
+	return databases, nil
+}
+
+func (s SourceAPI) search(ctx context.Context, opts *notion.SearchOpts) (response notion.SearchResponse, err error) {
+	ctx, span := tracer.Start(ctx, "notion.Search", trace.WithAttributes(attribute.String("notion.start_cursor", opts.StartCursor)))
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.requestContext(ctx)
+	defer cancel()
+	response, err = s.client.Search(ctx, opts)
+	return response, notionAPIError(err, nil, nil)
+}
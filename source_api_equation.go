@@ -0,0 +1,260 @@
+package notion_ical
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// latexSymbols are the Unicode characters of LaTeX commands for symbols.
+var latexSymbols = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ",
+	"varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ",
+	"chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω",
+
+	"infty": "∞", "partial": "∂", "nabla": "∇", "hbar": "ℏ", "ell": "ℓ",
+	"Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "angle": "∠", "degree": "°",
+	"prime": "′", "dots": "…", "ldots": "…", "cdots": "⋯", "vdots": "⋮",
+	"ddots": "⋱", "therefore": "∴", "because": "∵", "emptyset": "∅",
+	"varnothing": "∅", "forall": "∀", "exists": "∃", "nexists": "∄",
+	"neg": "¬", "lnot": "¬",
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬",
+	"iiint": "∭", "oint": "∮", "bigcup": "⋃", "bigcap": "⋂",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "vert": "|", "mid": "|", "Vert": "‖",
+	"lbrace": "{", "rbrace": "}",
+	"sin": "sin", "cos": "cos", "tan": "tan", "cot": "cot", "sec": "sec",
+	"csc": "csc", "arcsin": "arcsin", "arccos": "arccos", "arctan": "arctan",
+	"sinh": "sinh", "cosh": "cosh", "tanh": "tanh", "log": "log", "ln": "ln",
+	"lg": "lg", "exp": "exp", "lim": "lim", "max": "max", "min": "min",
+	"sup": "sup", "inf": "inf", "det": "det", "gcd": "gcd", "mod": "mod",
+	"bmod": "mod", "deg": "deg", "dim": "dim", "ker": "ker", "arg": "arg",
+
+	// Spacing and sizing
+	"quad": " ", "qquad": "  ", "left": "", "right": "", "big": "",
+	"Big": "", "bigg": "", "Bigg": "", "displaystyle": "", "limits": "",
+	"nolimits": "",
+}
+
+// latexOperators are the Unicode characters of LaTeX commands for operators
+// and relations, which are written with spaces around them.
+var latexOperators = map[string]string{
+	"times": "×", "cdot": "·", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗",
+	"circ": "∘", "bullet": "•", "star": "⋆", "oplus": "⊕", "otimes": "⊗",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "perp": "⊥", "parallel": "∥",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "supset": "⊃",
+	"subseteq": "⊆", "supseteq": "⊇", "cup": "∪", "cap": "∩",
+	"setminus": "∖", "land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "implies": "⇒",
+	"Leftarrow": "⇐", "Leftrightarrow": "⇔", "iff": "⇔", "mapsto": "↦",
+	"uparrow": "↑", "downarrow": "↓",
+}
+
+// latexTextCommands are LaTeX commands that only style their argument.
+var latexTextCommands = map[string]bool{
+	"text": true, "textrm": true, "textbf": true, "textit": true,
+	"mathrm": true, "mathbf": true, "mathit": true, "mathsf": true,
+	"mathtt": true, "mathcal": true, "mathbb": true, "boldsymbol": true,
+	"operatorname": true, "mbox": true,
+}
+
+var (
+	superscripts = scriptRunes("0⁰1¹2²3³4⁴5⁵6⁶7⁷8⁸9⁹+⁺-⁻=⁼(⁽)⁾nⁿiⁱxˣyʸaᵃbᵇcᶜdᵈeᵉkᵏmᵐoᵒpᵖtᵗTᵀ′′")
+	subscripts   = scriptRunes("0₀1₁2₂3₃4₄5₅6₆7₇8₈9₉+₊-₋=₌(₍)₎aₐeₑhₕiᵢjⱼkₖlₗmₘnₙoₒpₚrᵣsₛtₜuᵤvᵥxₓ")
+)
+
+// scriptRunes maps each character to the character after it in pairs.
+func scriptRunes(pairs string) map[rune]rune {
+	r := []rune(pairs)
+	m := make(map[rune]rune, len(r)/2)
+	for i := 0; i+1 < len(r); i += 2 {
+		m[r[i]] = r[i+1]
+	}
+	return m
+}
+
+// equationText approximates a LaTeX expression with Unicode, such as
+// "x² + y²" for "x^2 + y^2". It reports false for expressions it cannot
+// approximate, such as with unknown commands or environments.
+func equationText(expression string) (string, bool) {
+	p := latexParser{r: []rune(expression), ok: true}
+	text := p.parse(false)
+	if !p.ok || p.i < len(p.r) {
+		return "", false
+	}
+	return strings.Join(strings.Fields(text), " "), true
+}
+
+// equationMarkdown renders an inline equation as Unicode, or as LaTeX in
+// dollar signs when it cannot be approximated.
+func equationMarkdown(expression string) string {
+	if text, ok := equationText(expression); ok {
+		return text
+	}
+	return wrapMarkdown(expression, "$", "$")
+}
+
+// latexParser converts LaTeX math to Unicode.
+type latexParser struct {
+	r  []rune
+	i  int
+	ok bool
+}
+
+// parse converts until the end of the expression, or the closing brace of
+// a group.
+func (p *latexParser) parse(group bool) string {
+	var b strings.Builder
+	for p.ok && p.i < len(p.r) {
+		c := p.r[p.i]
+		switch c {
+		case '}':
+			if group {
+				return b.String()
+			}
+			p.ok = false
+		case '^', '_':
+			p.i++
+			b.WriteString(script(p.argument(), c == '^'))
+		case '~':
+			p.i++
+			b.WriteRune(' ')
+		case '&':
+			p.i++
+			b.WriteRune(' ')
+		default:
+			b.WriteString(p.token())
+		}
+	}
+	if group {
+		// Unclosed group
+		p.ok = false
+	}
+	return b.String()
+}
+
+// token converts the next command, group or character.
+func (p *latexParser) token() string {
+	c := p.r[p.i]
+	switch {
+	case c == '{':
+		p.i++
+		text := p.parse(true)
+		p.i++
+		return text
+	case c == '\\':
+		return p.command()
+	}
+	p.i++
+	return string(c)
+}
+
+// argument converts the argument of a command, which is a group or a single
+// token.
+func (p *latexParser) argument() string {
+	for p.i < len(p.r) && unicode.IsSpace(p.r[p.i]) {
+		p.i++
+	}
+	if p.i >= len(p.r) || p.r[p.i] == '}' {
+		p.ok = false
+		return ""
+	}
+	return p.token()
+}
+
+func (p *latexParser) command() string {
+	p.i++
+	if p.i >= len(p.r) {
+		p.ok = false
+		return ""
+	}
+	start := p.i
+	for p.i < len(p.r) && unicode.IsLetter(p.r[p.i]) {
+		p.i++
+	}
+	if p.i == start {
+		// A command of one symbol, such as "\," or "\{"
+		c := p.r[p.i]
+		p.i++
+		switch c {
+		case ',', ';', ':', ' ':
+			return " "
+		case '!':
+			return ""
+		case '\\':
+			return "; "
+		}
+		return string(c)
+	}
+	name := string(p.r[start:p.i])
+
+	switch {
+	case name == "frac" || name == "dfrac" || name == "tfrac":
+		numerator := p.argument()
+		denominator := p.argument()
+		return parenthesize(numerator) + "/" + parenthesize(denominator)
+	case name == "sqrt":
+		return "√" + parenthesize(p.argument())
+	case latexTextCommands[name]:
+		return p.argument()
+	}
+	if symbol, ok := latexSymbols[name]; ok {
+		return symbol
+	}
+	if operator, ok := latexOperators[name]; ok {
+		return " " + operator + " "
+	}
+	p.ok = false
+	return ""
+}
+
+// parenthesize wraps text in parentheses, unless it is a single term.
+func parenthesize(text string) string {
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) == 1 {
+		return text
+	}
+	for _, c := range text {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '.' {
+			return "(" + text + ")"
+		}
+	}
+	return text
+}
+
+// script writes text as a superscript or subscript, or after a caret or
+// underscore when some characters have no Unicode script.
+func script(text string, super bool) string {
+	runes, marker := subscripts, "_"
+	if super {
+		runes, marker = superscripts, "^"
+	}
+	text = strings.TrimSpace(text)
+	var b strings.Builder
+	for _, c := range text {
+		scripted, ok := runes[c]
+		if !ok {
+			return marker + parenthesize(text)
+		}
+		b.WriteRune(scripted)
+	}
+	return b.String()
+}
+
+// equationHTML renders an equation as Unicode, or as LaTeX in code when it
+// cannot be approximated.
+func equationHTML(expression string) string {
+	if text, ok := equationText(expression); ok {
+		return html.EscapeString(text)
+	}
+	return "<code>" + html.EscapeString(expression) + "</code>"
+}
@@ -0,0 +1,59 @@
+package notion_ical
+
+import (
+	"github.com/dstotijn/go-notion"
+)
+
+// PropertyFormatter renders a property value from the Notion API as a
+// string.
+type PropertyFormatter func(notion.DatabasePageProperty) string
+
+// PropertyFormatters is a registry of formatters that override how property
+// values are rendered. Formatters for named properties take precedence over
+// formatters for property types. Properties without a formatter are
+// rendered with FormatProperty.
+type PropertyFormatters struct {
+	Types map[notion.DatabasePropertyType]PropertyFormatter
+	Names map[string]PropertyFormatter
+}
+
+// RegisterType overrides the formatter for all properties of a type.
+func (f *PropertyFormatters) RegisterType(t notion.DatabasePropertyType, formatter PropertyFormatter) {
+	if f.Types == nil {
+		f.Types = make(map[notion.DatabasePropertyType]PropertyFormatter)
+	}
+	f.Types[t] = formatter
+}
+
+// RegisterName overrides the formatter for the property with this name.
+func (f *PropertyFormatters) RegisterName(name string, formatter PropertyFormatter) {
+	if f.Names == nil {
+		f.Names = make(map[string]PropertyFormatter)
+	}
+	f.Names[name] = formatter
+}
+
+// lookup finds the formatter that overrides the property, or nil.
+func (f PropertyFormatters) lookup(p notion.DatabasePageProperty) PropertyFormatter {
+	if formatter, ok := f.Names[p.Name]; ok {
+		return formatter
+	}
+	if formatter, ok := f.Types[p.Type]; ok {
+		return formatter
+	}
+	return nil
+}
+
+// formattedProperty is a property rendered by a PropertyFormatter.
+type formattedProperty struct {
+	property notion.DatabasePageProperty
+	format   PropertyFormatter
+}
+
+func (p formattedProperty) NameString() string {
+	return p.property.Name
+}
+
+func (p formattedProperty) ValueString() string {
+	return p.format(p.property)
+}
@@ -0,0 +1,205 @@
+package notion_ical
+
+import (
+	"html"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// contentHTML renders blocks and their children as HTML. Consecutive list
+// items are grouped into lists.
+func (s SourceAPI) contentHTML(blocks []blockNode) string {
+	var b strings.Builder
+	list := ""
+	for _, node := range blocks {
+		tag := listTagHTML(node.block)
+		if tag != list {
+			if list != "" {
+				b.WriteString("</" + list + ">")
+			}
+			if tag != "" {
+				b.WriteString("<" + tag + ">")
+			}
+			list = tag
+		}
+		b.WriteString(s.convertBlockContentHTML(node))
+	}
+	if list != "" {
+		b.WriteString("</" + list + ">")
+	}
+	return b.String()
+}
+
+// listTagHTML returns the tag of the list that contains a block, or an empty
+// string when the block is not a list item.
+func listTagHTML(block notion.Block) string {
+	switch block.(type) {
+	case *notion.BulletedListItemBlock, *notion.ToDoBlock, *notion.ToggleBlock:
+		return "ul"
+	case *notion.NumberedListItemBlock:
+		return "ol"
+	}
+	return ""
+}
+
+// convertBlockContentHTML renders a block and its children as HTML.
+func (s SourceAPI) convertBlockContentHTML(node blockNode) string {
+	children := s.contentHTML(node.children)
+	switch b := node.block.(type) {
+	case *notion.ParagraphBlock:
+		return "<p>" + richTextToHTML(b.RichText) + "</p>" + children
+	case *notion.Heading1Block:
+		return "<h1>" + richTextToHTML(b.RichText) + "</h1>" + children
+	case *notion.Heading2Block:
+		return "<h2>" + richTextToHTML(b.RichText) + "</h2>" + children
+	case *notion.Heading3Block:
+		return "<h3>" + richTextToHTML(b.RichText) + "</h3>" + children
+	case *notion.BulletedListItemBlock:
+		return "<li>" + richTextToHTML(b.RichText) + children + "</li>"
+	case *notion.NumberedListItemBlock:
+		return "<li>" + richTextToHTML(b.RichText) + children + "</li>"
+	case *notion.ToDoBlock:
+		prefix := "&#9744; "
+		if b.Checked != nil && *b.Checked == true {
+			prefix = "&#9745; "
+		}
+		return "<li>" + prefix + richTextToHTML(b.RichText) + children + "</li>"
+	case *notion.ToggleBlock:
+		return "<li>" + richTextToHTML(b.RichText) + children + "</li>"
+	case *notion.CalloutBlock:
+		text := richTextToHTML(b.RichText)
+		if b.Icon != nil && b.Icon.Emoji != nil {
+			text = html.EscapeString(*b.Icon.Emoji) + " " + text
+		}
+		return "<blockquote><p>" + text + "</p>" + children + "</blockquote>"
+	case *notion.QuoteBlock:
+		return "<blockquote><p>" + richTextToHTML(b.RichText) + "</p>" + children + "</blockquote>"
+	case *notion.CodeBlock:
+		return "<pre><code>" + html.EscapeString(richTextToString(b.RichText)) + "</code></pre>"
+	case *notion.EmbedBlock:
+		return "<p>" + linkHTML("Embed", b.URL) + "</p>"
+	case *notion.ImageBlock:
+		url := fileToString(b.Type, b.File, b.External)
+		return `<p><img src="` + html.EscapeString(url) + `" alt="` + html.EscapeString(richTextToString(b.Caption)) + `"></p>`
+	case *notion.AudioBlock:
+		return "<p>" + captionLinkHTML(b.Caption, "Audio", fileToString(b.Type, b.File, b.External)) + "</p>"
+	case *notion.VideoBlock:
+		return "<p>" + captionLinkHTML(b.Caption, "Video", fileToString(b.Type, b.File, b.External)) + "</p>"
+	case *notion.FileBlock:
+		return "<p>" + captionLinkHTML(b.Caption, "File", fileToString(b.Type, b.File, b.External)) + "</p>"
+	case *notion.PDFBlock:
+		return "<p>" + captionLinkHTML(b.Caption, "PDF", fileToString(b.Type, b.File, b.External)) + "</p>"
+	case *notion.BookmarkBlock:
+		return "<p>" + captionLinkHTML(b.Caption, "Bookmark", b.URL) + "</p>"
+	case *notion.EquationBlock:
+		return "<p>" + equationHTML(b.Expression) + "</p>"
+	case *notion.DividerBlock:
+		return "<hr>"
+	case *notion.ChildDatabaseBlock:
+		if s.config.ChildDatabases == ChildDatabasesNone {
+			return ""
+		}
+		table := ""
+		if node.database != nil {
+			table = node.database.htmlTable()
+		}
+		return "<p><strong>" + html.EscapeString(b.Title) + "</strong></p>" + table
+	case *notion.TableBlock:
+		rows := node.children
+		if len(rows) == 0 {
+			for _, block := range b.Children {
+				rows = append(rows, blockNode{block: block})
+			}
+		}
+		var t strings.Builder
+		t.WriteString("<table>")
+		for i, row := range rows {
+			r, ok := row.block.(*notion.TableRowBlock)
+			if !ok {
+				continue
+			}
+			t.WriteString("<tr>")
+			for j, cell := range r.Cells {
+				tag := "td"
+				if (i == 0 && b.HasColumnHeader) || (j == 0 && b.HasRowHeader) {
+					tag = "th"
+				}
+				t.WriteString("<" + tag + ">" + richTextToHTML(cell) + "</" + tag + ">")
+			}
+			t.WriteString("</tr>")
+		}
+		t.WriteString("</table>")
+		return t.String()
+	case *notion.LinkPreviewBlock:
+		return "<p>" + linkHTML("Preview", b.URL) + "</p>"
+	case *notion.LinkToPageBlock:
+		switch b.Type {
+		case notion.LinkToPageTypePageID:
+			return "<p>" + linkHTML("Link", notionURL(b.PageID)) + "</p>"
+		case notion.LinkToPageTypeDatabaseID:
+			return "<p>" + linkHTML("Link", notionURL(b.DatabaseID)) + "</p>"
+		}
+	case *notion.SyncedBlock:
+		var sy []blockNode
+		for _, block := range b.Children {
+			s.logger().Printf("synced child block %v", block.ID())
+			sy = append(sy, blockNode{block: block})
+		}
+		return s.contentHTML(sy) + children
+	case *notion.TemplateBlock:
+		return "<p>Template: " + richTextToHTML(b.RichText) + "</p>" + children
+	}
+	// Blocks without content of their own, such as columns
+	return children
+}
+
+// richTextToHTML renders rich text as HTML, keeping links and annotations.
+func richTextToHTML(rt []notion.RichText) string {
+	var b strings.Builder
+	b.Grow(richTextLen(rt))
+	for _, rts := range rt {
+		text := html.EscapeString(rts.PlainText)
+		text = strings.ReplaceAll(text, "\n", "<br>")
+		if rts.Type == notion.RichTextTypeEquation {
+			text = equationHTML(rts.PlainText)
+		}
+		if a := rts.Annotations; a != nil {
+			if a.Code {
+				text = "<code>" + text + "</code>"
+			}
+			if a.Strikethrough {
+				text = "<s>" + text + "</s>"
+			}
+			if a.Underline {
+				text = "<u>" + text + "</u>"
+			}
+			if a.Italic {
+				text = "<em>" + text + "</em>"
+			}
+			if a.Bold {
+				text = "<strong>" + text + "</strong>"
+			}
+		}
+		if rts.HRef != nil && *rts.HRef != "" {
+			text = `<a href="` + html.EscapeString(*rts.HRef) + `">` + text + "</a>"
+		}
+		b.WriteString(text)
+	}
+
+	return b.String()
+}
+
+// linkHTML renders a link to url with text.
+func linkHTML(text, url string) string {
+	return `<a href="` + html.EscapeString(url) + `">` + html.EscapeString(text) + "</a>"
+}
+
+// captionLinkHTML renders a link to url with the caption, or text when there
+// is no caption.
+func captionLinkHTML(caption []notion.RichText, text, url string) string {
+	if len(caption) == 0 {
+		return linkHTML(text, url)
+	}
+	return `<a href="` + html.EscapeString(url) + `">` + richTextToHTML(caption) + "</a>"
+}
@@ -0,0 +1,11 @@
+package notion_ical
+
+import "testing"
+
+func BenchmarkRichTextToHTML(b *testing.B) {
+	rt := benchmarkRichText()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = richTextToHTML(rt)
+	}
+}
@@ -0,0 +1,307 @@
+package notion_ical
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// contentMarkdown renders blocks and their children as Markdown, with each
+// line prefixed by indent.
+func (s SourceAPI) contentMarkdown(blocks []blockNode, indent string) []string {
+	var content []string
+	// number counts the items of a numbered list
+	number := 0
+	for _, node := range blocks {
+		if _, ok := node.block.(*notion.NumberedListItemBlock); ok {
+			number++
+		} else {
+			number = 0
+		}
+		if isLayoutBlock(node.block) {
+			// Columns are read in order, one after another
+			content = append(content, s.contentMarkdown(node.children, indent)...)
+			continue
+		}
+		if table, ok := node.block.(*notion.TableBlock); ok {
+			// Rows are read as children of the table
+			var rows []notion.Block
+			for _, row := range node.children {
+				rows = append(rows, row.block)
+			}
+			content = append(content, indentMarkdown(tableMarkdown(table, rows), indent))
+			continue
+		}
+		content = append(content, indentMarkdown(s.convertBlockContentMarkdown(node.block, number), indent))
+		if node.database != nil {
+			content = append(content, indentMarkdown(node.database.markdownTable(), indent))
+		}
+		content = append(content, s.contentMarkdown(node.children, indent+childIndentMarkdown(node.block, number))...)
+	}
+	return content
+}
+
+// convertBlockContentMarkdown renders a block as Markdown. number is the
+// position of a numbered list item in its list, starting at 1.
+func (s SourceAPI) convertBlockContentMarkdown(block notion.Block, number int) string {
+	switch b := block.(type) {
+	case *notion.ParagraphBlock:
+		return richTextToMarkdown(b.RichText)
+	case *notion.Heading1Block:
+		return "# " + richTextToMarkdown(b.RichText)
+	case *notion.Heading2Block:
+		return "## " + richTextToMarkdown(b.RichText)
+	case *notion.Heading3Block:
+		return "### " + richTextToMarkdown(b.RichText)
+	case *notion.BulletedListItemBlock:
+		return "- " + richTextToMarkdown(b.RichText)
+	case *notion.NumberedListItemBlock:
+		return strconv.Itoa(number) + ". " + richTextToMarkdown(b.RichText)
+	case *notion.ToDoBlock:
+		prefix := "- [ ] "
+		if b.Checked != nil && *b.Checked == true {
+			prefix = "- [x] "
+		}
+		return prefix + richTextToMarkdown(b.RichText)
+	case *notion.ToggleBlock:
+		return "- " + richTextToMarkdown(b.RichText)
+	case *notion.CalloutBlock:
+		text := richTextToMarkdown(b.RichText)
+		if b.Icon != nil && b.Icon.Emoji != nil {
+			text = *b.Icon.Emoji + " " + text
+		}
+		return indentMarkdown(text, "> ")
+	case *notion.QuoteBlock:
+		return indentMarkdown(richTextToMarkdown(b.RichText), "> ")
+	case *notion.CodeBlock:
+		language := ""
+		if b.Language != nil && *b.Language != "plain text" {
+			language = *b.Language
+		}
+		return "```" + language + "\n" + richTextToString(b.RichText) + "\n```"
+	case *notion.EmbedBlock:
+		return linkMarkdown("Embed", b.URL)
+	case *notion.ImageBlock:
+		return "!" + linkMarkdown(captionOr(b.Caption, "Image"), fileToString(b.Type, b.File, b.External))
+	case *notion.AudioBlock:
+		return linkMarkdown(captionOr(b.Caption, "Audio"), fileToString(b.Type, b.File, b.External))
+	case *notion.VideoBlock:
+		return linkMarkdown(captionOr(b.Caption, "Video"), fileToString(b.Type, b.File, b.External))
+	case *notion.FileBlock:
+		return linkMarkdown(captionOr(b.Caption, "File"), fileToString(b.Type, b.File, b.External))
+	case *notion.PDFBlock:
+		return linkMarkdown(captionOr(b.Caption, "PDF"), fileToString(b.Type, b.File, b.External))
+	case *notion.BookmarkBlock:
+		return linkMarkdown(captionOr(b.Caption, "Bookmark"), b.URL)
+	case *notion.EquationBlock:
+		if text, ok := equationText(b.Expression); ok {
+			return text
+		}
+		return "$$\n" + b.Expression + "\n$$"
+	case *notion.DividerBlock:
+		return "---"
+	case *notion.TableOfContentsBlock:
+		return ""
+	case *notion.BreadcrumbBlock:
+		return ""
+	case *notion.ChildDatabaseBlock:
+		if s.config.ChildDatabases == ChildDatabasesNone {
+			return ""
+		}
+		return "**" + b.Title + "**"
+	case *notion.ColumnListBlock:
+		return ""
+	case *notion.ColumnBlock:
+		return ""
+	case *notion.TableBlock:
+		return tableMarkdown(b, b.Children)
+	case *notion.TableRowBlock:
+		var s []string
+		for _, cell := range b.Cells {
+			s = append(s, strings.ReplaceAll(richTextToMarkdown(cell), "|", `\|`))
+		}
+		return "| " + strings.Join(s, " | ") + " |"
+	case *notion.LinkPreviewBlock:
+		return linkMarkdown("Preview", b.URL)
+	case *notion.LinkToPageBlock:
+		switch b.Type {
+		case notion.LinkToPageTypePageID:
+			return linkMarkdown("Link", notionURL(b.PageID))
+		case notion.LinkToPageTypeDatabaseID:
+			return linkMarkdown("Link", notionURL(b.DatabaseID))
+		}
+	case *notion.SyncedBlock:
+		var sy []string
+		for _, block := range b.Children {
+			s.logger().Printf("synced child block %v", block.ID())
+			sy = append(sy, s.convertBlockContentMarkdown(block, 0))
+		}
+		return strings.Join(sy, "\n\n")
+	case *notion.TemplateBlock:
+		return "Template: " + richTextToMarkdown(b.RichText)
+	}
+	return ""
+}
+
+// tableMarkdown renders the rows of a table as a Markdown table.
+func tableMarkdown(table *notion.TableBlock, rows []notion.Block) string {
+	var cells [][]string
+	for _, block := range rows {
+		row, ok := block.(*notion.TableRowBlock)
+		if !ok {
+			continue
+		}
+		var r []string
+		for _, cell := range row.Cells {
+			r = append(r, richTextToMarkdown(cell))
+		}
+		cells = append(cells, r)
+	}
+	if !table.HasColumnHeader && len(cells) > 0 {
+		// Markdown tables have a header, so an empty one is added
+		cells = append([][]string{make([]string, len(cells[0]))}, cells...)
+	}
+	return markdownTable(cells)
+}
+
+// markdownTable renders rows as a Markdown table with the first row as the
+// header, padding cells so that columns are aligned as plain text too.
+func markdownTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var widths []int
+	for i, row := range rows {
+		for j, cell := range row {
+			cell = strings.ReplaceAll(cell, "|", `\|`)
+			cell = strings.ReplaceAll(cell, "\n", " ")
+			rows[i][j] = cell
+			if j >= len(widths) {
+				widths = append(widths, 3)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	line := func(row []string, pad string) string {
+		var cells []string
+		for j, width := range widths {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			cells = append(cells, cell+strings.Repeat(pad, width-utf8.RuneCountInString(cell)))
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	lines := []string{line(rows[0], " "), line(nil, "-")}
+	for _, row := range rows[1:] {
+		lines = append(lines, line(row, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// childIndentMarkdown returns the indent of the children of a block, so that
+// they nest under list items and quotes.
+func childIndentMarkdown(block notion.Block, number int) string {
+	switch block.(type) {
+	case *notion.BulletedListItemBlock, *notion.ToDoBlock, *notion.ToggleBlock:
+		return "  "
+	case *notion.NumberedListItemBlock:
+		return strings.Repeat(" ", len(strconv.Itoa(number))+len(". "))
+	case *notion.CalloutBlock, *notion.QuoteBlock:
+		return "> "
+	}
+	return ""
+}
+
+// indentMarkdown prefixes each line of text with indent.
+func indentMarkdown(text, indent string) string {
+	if indent == "" {
+		return text
+	}
+	return indent + strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// richTextToMarkdown renders rich text as Markdown, keeping links and the
+// bold, italic, strikethrough and code annotations.
+func richTextToMarkdown(rt []notion.RichText) string {
+	var b strings.Builder
+	b.Grow(richTextLen(rt))
+	for _, rts := range rt {
+		text := rts.PlainText
+		if rts.Type == notion.RichTextTypeEquation {
+			text = equationMarkdown(text)
+		}
+		if a := rts.Annotations; a != nil {
+			if a.Code {
+				text = codeMarkdown(text)
+			}
+			if a.Strikethrough {
+				text = wrapMarkdown(text, "~~", "~~")
+			}
+			if a.Italic {
+				text = wrapMarkdown(text, "*", "*")
+			}
+			if a.Bold {
+				text = wrapMarkdown(text, "**", "**")
+			}
+		}
+		// Links without text of their own are left bare
+		if rts.HRef != nil && *rts.HRef != "" && strings.TrimSpace(rts.PlainText) != *rts.HRef {
+			text = wrapMarkdown(text, "[", "]("+*rts.HRef+")")
+		}
+		b.WriteString(text)
+	}
+
+	return b.String()
+}
+
+// wrapMarkdown surrounds text with open and close, leaving whitespace at
+// either end outside, because Markdown does not allow emphasis next to
+// whitespace.
+func wrapMarkdown(text, open, close string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + open + trimmed + close + text[start+len(trimmed):]
+}
+
+// codeMarkdown renders text as inline code, with enough backticks to
+// contain backticks in the text.
+func codeMarkdown(text string) string {
+	if !strings.Contains(text, "`") {
+		return wrapMarkdown(text, "`", "`")
+	}
+	return "`` " + text + " ``"
+}
+
+// linkMarkdown renders a link to url with text.
+func linkMarkdown(text, url string) string {
+	if text == "" {
+		text = url
+	}
+	return "[" + text + "](" + url + ")"
+}
+
+// captionOr returns the caption as Markdown, or text when there is no
+// caption.
+func captionOr(caption []notion.RichText, text string) string {
+	if markdown := richTextToMarkdown(caption); markdown != "" {
+		return markdown
+	}
+	return text
+}
+
+// notionURL returns the URL of a page or database in Notion.
+func notionURL(id string) string {
+	return "https://www.notion.so/" + strings.ReplaceAll(id, "-", "")
+}
@@ -0,0 +1,19 @@
+package notion_ical
+
+import "testing"
+
+func BenchmarkRichTextToMarkdown(b *testing.B) {
+	rt := benchmarkRichText()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = richTextToMarkdown(rt)
+	}
+}
+
+func BenchmarkIndentMarkdown(b *testing.B) {
+	text := "- Roadmap\n- Hiring\n  - Interviews\n- Budget"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = indentMarkdown(text, "  ")
+	}
+}
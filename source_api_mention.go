@@ -0,0 +1,175 @@
+package notion_ical
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mentionCache holds the titles of pages and databases, and the names of
+// users, mentioned in page content, so that each is fetched once for each
+// ReadAll. Mentions that could not be resolved are cached as empty strings.
+type mentionCache struct {
+	mu     sync.Mutex
+	titles map[string]string
+	users  map[string]string
+}
+
+func newMentionCache() *mentionCache {
+	return &mentionCache{
+		titles: make(map[string]string),
+		users:  make(map[string]string),
+	}
+}
+
+// reset forgets resolved mentions, such as pages that were renamed.
+func (c *mentionCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.titles = make(map[string]string)
+	c.users = make(map[string]string)
+}
+
+// resolveMentions replaces the text of mentions in blocks and their children
+// with the current titles of pages and databases, the names of users and
+// formatted dates, and links mentions of pages and databases.
+func (s SourceAPI) resolveMentions(ctx context.Context, blocks []blockNode) {
+	for _, node := range blocks {
+		for _, rt := range blockRichText(node.block) {
+			for i := range rt {
+				s.resolveMention(ctx, &rt[i])
+			}
+		}
+		s.resolveMentions(ctx, node.children)
+	}
+}
+
+func (s SourceAPI) resolveMention(ctx context.Context, rt *notion.RichText) {
+	if rt.Type != notion.RichTextTypeMention || rt.Mention == nil {
+		return
+	}
+	m := rt.Mention
+
+	var id string
+	switch {
+	case m.Type == notion.MentionTypePage && m.Page != nil:
+		id = m.Page.ID
+	case m.Type == notion.MentionTypeDatabase && m.Database != nil:
+		id = m.Database.ID
+	case m.Type == notion.MentionTypeUser && m.User != nil:
+		if name := s.userName(ctx, *m.User); name != "" {
+			rt.PlainText = "@" + name
+		}
+		return
+	case m.Type == notion.MentionTypeDate && m.Date != nil:
+		rt.PlainText = formatMentionDate(*m.Date)
+		return
+	default:
+		return
+	}
+
+	if title := s.mentionTitle(ctx, id, m.Type); title != "" {
+		rt.PlainText = title
+	}
+	if rt.HRef == nil || *rt.HRef == "" {
+		url := notionURL(id)
+		rt.HRef = &url
+	}
+}
+
+// mentionTitle returns the title of a mentioned page or database, or an empty
+// string when it cannot be fetched, such as without access to it.
+func (s SourceAPI) mentionTitle(ctx context.Context, id string, t notion.MentionType) string {
+	s.mentions.mu.Lock()
+	title, ok := s.mentions.titles[id]
+	s.mentions.mu.Unlock()
+	if ok {
+		return title
+	}
+
+	ctx, span := tracer.Start(ctx, "SourceAPI.mentionTitle", trace.WithAttributes(attribute.String("notion.id", id)))
+	ctx, cancel := s.requestContext(ctx)
+	var err error
+	if t == notion.MentionTypeDatabase {
+		var database notion.Database
+		database, err = s.client.FindDatabaseByID(ctx, id)
+		title = richTextToString(database.Title)
+	} else {
+		var page notion.Page
+		page, err = s.client.FindPageByID(ctx, id)
+		title = pageTitle(page)
+	}
+	cancel()
+	endSpan(span, err)
+	if err != nil {
+		s.warn(WarningContent, id, "failed resolving mention of %v: %v", t, err)
+	}
+
+	s.mentions.mu.Lock()
+	s.mentions.titles[id] = title
+	s.mentions.mu.Unlock()
+	return title
+}
+
+// userName returns the name of a mentioned user, or an empty string when it
+// cannot be fetched, such as without the capability to read users.
+func (s SourceAPI) userName(ctx context.Context, user notion.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+
+	s.mentions.mu.Lock()
+	name, ok := s.mentions.users[user.ID]
+	s.mentions.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	ctx, span := tracer.Start(ctx, "notion.FindUserByID", trace.WithAttributes(attribute.String("notion.user_id", user.ID)))
+	ctx, cancel := s.requestContext(ctx)
+	found, err := s.client.FindUserByID(ctx, user.ID)
+	cancel()
+	endSpan(span, err)
+	if err != nil {
+		s.warn(WarningContent, user.ID, "failed resolving mention of user: %v", err)
+	}
+	name = found.Name
+
+	s.mentions.mu.Lock()
+	s.mentions.users[user.ID] = name
+	s.mentions.mu.Unlock()
+	return name
+}
+
+// pageTitle returns the title of a page in a database or workspace.
+func pageTitle(page notion.Page) string {
+	switch properties := page.Properties.(type) {
+	case notion.DatabasePageProperties:
+		for _, property := range properties {
+			if property.Type == notion.DBPropTypeTitle {
+				return richTextToString(property.Title)
+			}
+		}
+	case notion.PageProperties:
+		return richTextToString(properties.Title.Title)
+	}
+	return ""
+}
+
+// formatMentionDate formats a mentioned date like date properties.
+func formatMentionDate(d notion.Date) string {
+	format := func(dt notion.DateTime) string {
+		if dt.HasTime() {
+			return dt.Format(time.DateTime)
+		}
+		return dt.Format(time.DateOnly)
+	}
+	if d.End != nil {
+		return format(d.Start) + " → " + format(*d.End)
+	}
+	return format(d.Start)
+}
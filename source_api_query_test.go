@@ -0,0 +1,279 @@
+package notion_ical_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+	"github.com/serverwentdown/notion-ical"
+	"github.com/serverwentdown/notion-ical/notionicaltest"
+)
+
+const testDatabaseID = "0f1e2d3c4b5a69788796a5b4c3d2e1f0"
+
+// testPage is a page of the test database on day of January 2024.
+type testPage struct {
+	title  string
+	day    int
+	hidden bool
+	status string
+}
+
+// newTestDatabase serves a database of pages with a date, a hidden
+// checkbox and a status select.
+func newTestDatabase(t *testing.T, pages ...testPage) *notionicaltest.NotionServer {
+	t.Helper()
+	srv := notionicaltest.NewNotionServer(t)
+	srv.AddDatabase(testDatabaseID, notionicaltest.DatabaseJSON(testDatabaseID, "Events", map[string]notion.DatabasePropertyType{
+		"Name":   notion.DBPropTypeTitle,
+		"Date":   notion.DBPropTypeDate,
+		"Hidden": notion.DBPropTypeCheckbox,
+		"Status": notion.DBPropTypeSelect,
+	}))
+	for i, page := range pages {
+		properties := map[string]any{
+			"Name":   notionicaltest.TitleValue(page.title),
+			"Date":   notionicaltest.DateValue(fmt.Sprintf("2024-01-%02d", page.day), ""),
+			"Hidden": notionicaltest.CheckboxValue(page.hidden),
+		}
+		if page.status != "" {
+			properties["Status"] = map[string]any{"type": "select", "select": map[string]any{"name": page.status}}
+		}
+		id := fmt.Sprintf("%032x", i+1)
+		srv.AddPage(testDatabaseID, notionicaltest.PageJSON(testDatabaseID, id, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), properties))
+	}
+	return srv
+}
+
+func readTitles(t *testing.T, srv *notionicaltest.NotionServer, opts ...notion_ical.SourceOption) []string {
+	t.Helper()
+	opts = append([]notion_ical.SourceOption{notion_ical.WithHTTPClient(srv.HTTPClient())}, opts...)
+	source, err := notion_ical.NewAPISource("secret_test", testDatabaseID, opts...)
+	if err != nil {
+		t.Fatalf("NewAPISource: %v", err)
+	}
+	events, err := notion_ical.ReadAll(context.Background(), source)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	titles := make([]string, len(events))
+	for i, event := range events {
+		titles[i] = event.Title
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestSourceAPIPagination(t *testing.T) {
+	var pages []testPage
+	for day := 1; day <= 7; day++ {
+		pages = append(pages, testPage{title: fmt.Sprintf("Day %d", day), day: day})
+	}
+	srv := newTestDatabase(t, pages...)
+	srv.PageSize = 3
+
+	titles := readTitles(t, srv)
+	if len(titles) != len(pages) {
+		t.Fatalf("read %d events, want %d: %v", len(titles), len(pages), titles)
+	}
+
+	queries := srv.Queries()
+	if len(queries) != 3 {
+		t.Fatalf("sent %d queries, want 3", len(queries))
+	}
+	for i, want := range []string{"", "3", "6"} {
+		var query notion.DatabaseQuery
+		if err := json.Unmarshal(queries[i], &query); err != nil {
+			t.Fatal(err)
+		}
+		if query.StartCursor != want {
+			t.Errorf("query %d start cursor = %q, want %q", i, query.StartCursor, want)
+		}
+	}
+}
+
+func TestSourceAPIHideProperty(t *testing.T) {
+	pages := []testPage{
+		{title: "Planning", day: 2, status: "Confirmed"},
+		{title: "Draft", day: 3, hidden: true, status: "Confirmed"},
+		{title: "Maybe", day: 4, status: "Tentative"},
+		{title: "Secret", day: 5, hidden: true, status: "Tentative"},
+	}
+	confirmed := notion.DatabaseQueryFilter{
+		Property: "Status",
+		DatabaseQueryPropertyFilter: notion.DatabaseQueryPropertyFilter{
+			Select: &notion.SelectDatabaseQueryFilter{Equals: "Confirmed"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		opts []notion_ical.SourceOption
+		want []string
+	}{
+		{
+			name: "no hide property",
+			want: []string{"Draft", "Maybe", "Planning", "Secret"},
+		},
+		{
+			name: "hide property",
+			opts: []notion_ical.SourceOption{notion_ical.WithHideProperty("Hidden")},
+			want: []string{"Maybe", "Planning"},
+		},
+		{
+			name: "filter",
+			opts: []notion_ical.SourceOption{notion_ical.WithFilter(confirmed)},
+			want: []string{"Draft", "Planning"},
+		},
+		{
+			name: "hide property and filter",
+			opts: []notion_ical.SourceOption{notion_ical.WithHideProperty("Hidden"), notion_ical.WithFilter(confirmed)},
+			want: []string{"Planning"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newTestDatabase(t, pages...)
+			got := readTitles(t, srv, test.opts...)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("events = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSourceAPISorts(t *testing.T) {
+	srv := newTestDatabase(t, testPage{title: "Planning", day: 2})
+	readTitles(t, srv, notion_ical.WithSorts(
+		notion.DatabaseQuerySort{Property: "Status", Direction: notion.SortDirDesc},
+		notion.DatabaseQuerySort{Property: "Date", Direction: notion.SortDirAsc},
+	))
+
+	var query notion.DatabaseQuery
+	if err := json.Unmarshal(srv.Queries()[0], &query); err != nil {
+		t.Fatal(err)
+	}
+	want := []notion.DatabaseQuerySort{
+		{Property: "Status", Direction: notion.SortDirDesc},
+		{Property: "Date", Direction: notion.SortDirAsc},
+	}
+	if fmt.Sprint(query.Sorts) != fmt.Sprint(want) {
+		t.Errorf("sorts = %v, want %v", query.Sorts, want)
+	}
+}
+
+func TestSourceAPIHideFormula(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []any
+		want    []string
+		wantErr bool
+	}{
+		{name: "checkbox result", results: []any{false, true}, want: []string{"Day 1"}},
+		{name: "no pages", want: nil},
+		{name: "text result", results: []any{"no", "yes"}, wantErr: true},
+		{name: "number result", results: []any{0, 1}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := notionicaltest.NewNotionServer(t)
+			srv.AddDatabase(testDatabaseID, notionicaltest.DatabaseJSON(testDatabaseID, "Events", map[string]notion.DatabasePropertyType{
+				"Name":   notion.DBPropTypeTitle,
+				"Date":   notion.DBPropTypeDate,
+				"Hidden": notion.DBPropTypeFormula,
+			}))
+			for i, result := range test.results {
+				srv.AddPage(testDatabaseID, notionicaltest.PageJSON(testDatabaseID, fmt.Sprintf("%032x", i+1), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), map[string]any{
+					"Name":   notionicaltest.TitleValue(fmt.Sprintf("Day %d", i+1)),
+					"Date":   notionicaltest.DateValue(fmt.Sprintf("2024-01-%02d", i+1), ""),
+					"Hidden": notionicaltest.FormulaValue(result),
+				}))
+			}
+
+			_, err := notion_ical.NewAPISource("secret_test", testDatabaseID,
+				notion_ical.WithHTTPClient(srv.HTTPClient()),
+				notion_ical.WithHideProperty("Hidden"),
+			)
+			if test.wantErr {
+				if !errors.Is(err, notion_ical.ErrNoHideProperty) || !errors.Is(err, notion_ical.ErrSchemaMismatch) {
+					t.Fatalf("NewAPISource() = %v, want %v and %v", err, notion_ical.ErrNoHideProperty, notion_ical.ErrSchemaMismatch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewAPISource() = %v", err)
+			}
+			if got := readTitles(t, srv, notion_ical.WithHideProperty("Hidden")); fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("events = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSourceAPIUniqueID(t *testing.T) {
+	srv := notionicaltest.NewNotionServer(t)
+	srv.AddDatabase(testDatabaseID, notionicaltest.DatabaseJSON(testDatabaseID, "Events", map[string]notion.DatabasePropertyType{
+		"Name": notion.DBPropTypeTitle,
+		"Date": notion.DBPropTypeDate,
+		"ID":   notion_ical.DBPropTypeUniqueID,
+	}))
+	for i, prefix := range []string{"TASK", ""} {
+		srv.AddPage(testDatabaseID, notionicaltest.PageJSON(testDatabaseID, fmt.Sprintf("%032x", i+1), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), map[string]any{
+			"Name": notionicaltest.TitleValue(fmt.Sprintf("Day %d", i+1)),
+			"Date": notionicaltest.DateValue(fmt.Sprintf("2024-01-%02d", i+1), ""),
+			"ID":   notionicaltest.UniqueIDValue(prefix, i+1),
+		}))
+	}
+	// Unique IDs are read from the query, through the HTTP client
+	var requests []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		return srv.HTTPClient().Transport.RoundTrip(r)
+	})}
+
+	source, err := notion_ical.NewAPISource("secret_test", testDatabaseID,
+		notion_ical.WithHTTPClient(client),
+		notion_ical.WithIDProperty("ID", true),
+	)
+	if err != nil {
+		t.Fatalf("NewAPISource() = %v", err)
+	}
+	events, err := notion_ical.ReadAll(context.Background(), source)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.ID+" "+event.Title)
+	}
+	sort.Strings(got)
+	if want := []string{"2@notion-ical 2 Day 2", "TASK-1@notion-ical TASK-1 Day 1"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	for _, request := range requests {
+		if strings.Contains(request, "/properties/") {
+			t.Errorf("unexpected request %s", request)
+		}
+	}
+
+	_, err = notion_ical.NewAPISource("secret_test", testDatabaseID,
+		notion_ical.WithClient(notion.NewClient("secret_test", notion.WithHTTPClient(client))),
+		notion_ical.WithIDProperty("ID", false),
+	)
+	if err == nil {
+		t.Errorf("NewAPISource() with a client = nil, want an error")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,84 @@
+package notion_ical
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestCheckHideFormulaResult(t *testing.T) {
+	page := func(result notion.FormulaResult) notion.Page {
+		return notion.Page{Properties: notion.DatabasePageProperties{
+			"Hidden": notion.DatabasePageProperty{Type: notion.DBPropTypeFormula, Formula: &result},
+		}}
+	}
+	checked := true
+	text := "Done"
+
+	tests := []struct {
+		name    string
+		page    notion.Page
+		wantErr bool
+	}{
+		{"checkbox", page(notion.FormulaResult{Type: notion.FormulaResultTypeBoolean, Boolean: &checked}), false},
+		{"text", page(notion.FormulaResult{Type: notion.FormulaResultTypeString, String: &text}), true},
+		{"number", page(notion.FormulaResult{Type: notion.FormulaResultTypeNumber}), true},
+		{"other property", notion.Page{Properties: notion.DatabasePageProperties{}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkHideFormulaResult(test.page, "Hidden")
+			if test.wantErr != (err != nil) {
+				t.Fatalf("checkHideFormulaResult() = %v, want an error: %v", err, test.wantErr)
+			}
+			if err != nil && (!errors.Is(err, ErrNoHideProperty) || !errors.Is(err, ErrSchemaMismatch)) {
+				t.Errorf("checkHideFormulaResult() = %v, want ErrNoHideProperty and ErrSchemaMismatch", err)
+			}
+		})
+	}
+}
+
+// benchmarkRichText is a sentence with a bold span and a link, split into
+// spans like the Notion API returns it.
+func benchmarkRichText() []notion.RichText {
+	href := "https://example.com/roadmap"
+	return []notion.RichText{
+		{Type: notion.RichTextTypeText, PlainText: "Review the "},
+		{Type: notion.RichTextTypeText, PlainText: "roadmap", Annotations: &notion.Annotations{Bold: true}, HRef: &href},
+		{Type: notion.RichTextTypeText, PlainText: " before the meeting,\nand bring "},
+		{Type: notion.RichTextTypeText, PlainText: "questions", Annotations: &notion.Annotations{Italic: true}},
+		{Type: notion.RichTextTypeText, PlainText: "."},
+	}
+}
+
+func BenchmarkRichTextToString(b *testing.B) {
+	rt := benchmarkRichText()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = richTextToString(rt)
+	}
+}
+
+func BenchmarkRichTextWithLinks(b *testing.B) {
+	rt := benchmarkRichText()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = richTextWithLinks(rt)
+	}
+}
+
+func BenchmarkFormatPropertyMultiSelect(b *testing.B) {
+	property := notion.DatabasePageProperty{
+		Type: notion.DBPropTypeMultiSelect,
+		MultiSelect: []notion.SelectOptions{
+			{Name: "Team"},
+			{Name: "Quarterly"},
+			{Name: "Planning"},
+		},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = FormatProperty(property)
+	}
+}
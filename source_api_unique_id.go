@@ -0,0 +1,115 @@
+package notion_ical
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// DBPropTypeUniqueID is the type of unique ID properties, such as with IDs
+// like "TASK-123", which the Notion client does not know.
+const DBPropTypeUniqueID notion.DatabasePropertyType = "unique_id"
+
+// uniqueIDPattern matches the values of unique ID properties, with an
+// optional prefix.
+var uniqueIDPattern = regexp.MustCompile(`^(?:[A-Za-z0-9]+-)?[0-9]+$`)
+
+// uniqueIDUID returns the UID of an event with a unique ID, which is the
+// same for the API and export sources.
+func uniqueIDUID(id string) string {
+	return id + "@notion-ical"
+}
+
+// titleWithID prefixes the title of an event with its ID, such as
+// "TASK-123 Fix login".
+func titleWithID(id, title string) string {
+	return id + " " + title
+}
+
+// uniqueIDs collects the values of a unique ID property from the results of
+// database queries, by page ID. The Notion client drops the values of unique
+// ID properties, so query responses are read again as they pass through the
+// transport of the client.
+type uniqueIDs struct {
+	property string
+	next     http.RoundTripper
+
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newUniqueIDs(property string, client *http.Client) (*uniqueIDs, *http.Client) {
+	u := &uniqueIDs{property: property, next: http.DefaultTransport, ids: make(map[string]string)}
+	wrapped := &http.Client{}
+	if client != nil {
+		*wrapped = *client
+		if client.Transport != nil {
+			u.next = client.Transport
+		}
+	}
+	wrapped.Transport = u
+	return u, wrapped
+}
+
+func (u *uniqueIDs) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := u.next.RoundTrip(r)
+	if err != nil || r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/query") || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	var response struct {
+		Results []struct {
+			ID         string `json:"id"`
+			Properties map[string]struct {
+				UniqueID *struct {
+					Prefix *string `json:"prefix"`
+					Number *int    `json:"number"`
+				} `json:"unique_id"`
+			} `json:"properties"`
+		} `json:"results"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		// The client reports invalid responses
+		return res, nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, page := range response.Results {
+		value := page.Properties[u.property].UniqueID
+		if value == nil || value.Number == nil {
+			continue
+		}
+		id := strconv.Itoa(*value.Number)
+		if value.Prefix != nil && *value.Prefix != "" {
+			id = *value.Prefix + "-" + id
+		}
+		u.ids[page.ID] = id
+	}
+	return res, nil
+}
+
+// uniqueID returns the value of the unique ID property of a page, such as
+// "TASK-123", from the query that returned the page.
+func (s SourceAPI) uniqueID(pageID string) (string, error) {
+	s.uniqueIDs.mu.Lock()
+	defer s.uniqueIDs.mu.Unlock()
+	id, ok := s.uniqueIDs.ids[pageID]
+	if !ok {
+		return "", fmt.Errorf("%w: property %s of page %s is not a unique ID", ErrSchemaMismatch, s.config.IDProperty, pageID)
+	}
+	return id, nil
+}
@@ -0,0 +1,98 @@
+package notion_ical
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CachedSource remembers the events of a source for a duration, so that
+// several conversions of the same source read it once. Concurrent reads of
+// an expired source wait for a single read. Failed reads are not
+// remembered.
+type CachedSource struct {
+	source Source
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	events []Event
+	read   time.Time
+	// pending is closed when the read in progress completes
+	pending chan struct{}
+	err     error
+}
+
+// NewCachedSource remembers the events of source for ttl.
+func NewCachedSource(source Source, ttl time.Duration) *CachedSource {
+	return &CachedSource{
+		source: source,
+		ttl:    ttl,
+	}
+}
+
+func (s *CachedSource) Name() string {
+	return s.source.Name()
+}
+
+func (s *CachedSource) ReadAll() ([]Event, error) {
+	return s.ReadAllContext(context.Background())
+}
+
+// ReadAllContext returns the remembered events, or reads the source when
+// they have expired. Waiting reads share the context of the first read.
+func (s *CachedSource) ReadAllContext(ctx context.Context) ([]Event, error) {
+	s.mu.Lock()
+	if s.events != nil && time.Since(s.read) < s.ttl {
+		events := s.events
+		s.mu.Unlock()
+		return append([]Event(nil), events...), nil
+	}
+
+	if pending := s.pending; pending != nil {
+		s.mu.Unlock()
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.err != nil {
+			return nil, s.err
+		}
+		return append([]Event(nil), s.events...), nil
+	}
+
+	pending := make(chan struct{})
+	s.pending = pending
+	s.mu.Unlock()
+
+	events, err := ReadAll(ctx, s.source)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = nil
+	s.err = err
+	if err == nil {
+		if events == nil {
+			events = []Event{}
+		}
+		s.events = events
+		s.read = time.Now()
+	}
+	close(pending)
+
+	if err != nil {
+		return nil, err
+	}
+	return append([]Event(nil), events...), nil
+}
+
+// Expire forgets the remembered events, so that the next read reads the
+// source.
+func (s *CachedSource) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+}
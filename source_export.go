@@ -2,6 +2,7 @@ package notion_ical
 
 import (
 	"archive/zip"
+	"bytes"
 	"crypto/sha256"
 	"encoding/csv"
 	"encoding/hex"
@@ -9,11 +10,13 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
-var ErrCSVRead = errors.New("failed to read CSV")
+var ErrCSVRead error = &kindError{"failed to read CSV", ErrParse}
 
 type ReaderAtSeeker interface {
 	io.ReaderAt
@@ -22,54 +25,132 @@ type ReaderAtSeeker interface {
 
 // ConfigSourceExport represents configuration for importing from a Notion export.
 type ConfigSourceExport struct {
-	// Archive is a file handle to a ZIP file of the exported Notion data.
+	// Archive is a file handle to a ZIP file of the exported Notion data, or
+	// to a bare CSV file extracted from it.
 	Archive ReaderAtSeeker
+	// Filename is the name of the archive file. It is used to detect bare
+	// CSV files and as the calendar name for them.
+	Filename string
 	// Zone is the timezone for parsing dates.
 	Zone *time.Location
+	// Locale is the language of the exporting workspace, such as "de", used
+	// to parse localized month names. Defaults to English.
+	Locale string
+	// DateFormats are additional Go time layouts for dates, tried before the
+	// default layouts.
+	DateFormats []string
+	// TimeFormats are additional Go time layouts for times, tried before the
+	// default layouts.
+	TimeFormats []string
 	// DateProperty is the property name of the date field that will be used
 	// as the event date.
 	DateProperty string
 	// HideProperty is the property name of a checkbox that will cause
 	// events to be hidden.
 	HideProperty string
+	// TitleProperty is the column name that will be used as the event
+	// title. Defaults to the first column that looks like a name or title.
+	TitleProperty string
+	// RecurrenceProperty is the column name of a repeat setting or RRULE
+	// that makes events recur.
+	RecurrenceProperty string
+	// ExceptionsProperty is the column name of dates that are skipped by
+	// the recurrence, separated by semicolons or new lines.
+	ExceptionsProperty string
+	// StatusProperty is the column name of the status of tasks.
+	StatusProperty string
+	// LocationProperty is the column name of the location of events.
+	LocationProperty string
+	// AttendeesProperty is the column name of the attendees of events,
+	// separated by commas. Attendees with an @ are email addresses, and
+	// others are names, such as those of a people column.
+	AttendeesProperty string
+	// CategoriesProperty is the column name of the categories of events,
+	// separated by commas, such as those of a multi-select column.
+	CategoriesProperty string
+	// IDProperty is the column name of a stable ID of each page, such as a
+	// formula of id(), used for UIDs that survive renaming and rescheduling
+	// events, or a unique ID column with IDs such as "TASK-123". Defaults
+	// to a column named "Page ID" or "ID" when present.
+	IDProperty string
+	// IDInTitle prefixes event titles with the ID from IDProperty.
+	IDInTitle bool
+	// AllDatabases merges events from every CSV file in the archive,
+	// including nested sub-databases, instead of only the top-level one.
+	AllDatabases bool
+	// Stats counts the rows read when set, and rows with values that cannot
+	// be parsed are skipped instead of failing the read.
+	Stats *ReadStats
+	// Warnings collects non-fatal issues of rows when set, and rows with
+	// values that cannot be parsed are skipped with a warning.
+	Warnings *Warnings
 }
 
 type SourceExport struct {
 	config  ConfigSourceExport
 	archive fs.FS
+	csv     *io.SectionReader
 	name    string
+	// databases are the names of all CSV files in the archive
+	databases []string
 }
 
+var zipMagic = []byte("PK\x03\x04")
+
 func NewSourceExport(config ConfigSourceExport) (SourceExport, error) {
+	if !isKnownNotionLocale(config.Locale) {
+		return SourceExport{}, fmt.Errorf("unsupported export locale %q", config.Locale)
+	}
+
 	// Find the length of the archive
 	length, err := config.Archive.Seek(0, io.SeekEnd)
 	if err != nil {
 		return SourceExport{}, fmt.Errorf("unable to obtain file size: %w", err)
 	}
 
+	// Accept bare CSV files that have already been extracted
+	if isBareCSV(config.Archive, config.Filename) {
+		name := filepath.Base(config.Filename)
+		if config.Filename == "" {
+			name = "export.csv"
+		}
+		return SourceExport{
+			config:    config,
+			csv:       io.NewSectionReader(config.Archive, 0, length),
+			name:      name,
+			databases: []string{name},
+		}, nil
+	}
+
 	// Open the ZIP file
 	archive, err := zip.NewReader(config.Archive, length)
 	if err != nil {
 		return SourceExport{}, fmt.Errorf("unable to open ZIP file: %w", err)
 	}
 
-	var name string
-
-	// Find the first CSV file
+	// Find all CSV files
+	var databases []string
 	for _, file := range archive.File {
 		if strings.HasSuffix(file.Name, ".csv") {
-			name = file.Name
+			databases = append(databases, file.Name)
 		}
 	}
 
-	if name == "" {
+	if len(databases) == 0 {
 		return SourceExport{}, fmt.Errorf("cannot find CSV file in ZIP file")
 	}
 
+	// Sort top-level CSV files first, because nested sub-databases are
+	// exported into subfolders
+	sort.SliceStable(databases, func(i, j int) bool {
+		return strings.Count(databases[i], "/") < strings.Count(databases[j], "/")
+	})
+
 	return SourceExport{
-		config:  config,
-		archive: archive,
-		name:    name,
+		config:    config,
+		archive:   archive,
+		name:      databases[0],
+		databases: databases,
 	}, nil
 }
 
@@ -77,24 +158,107 @@ func (s SourceExport) Name() string {
 	return s.name
 }
 
+// Databases returns a source for each CSV file in the archive, so that
+// nested sub-databases can be converted into separate calendars.
+func (s SourceExport) Databases() []SourceExport {
+	sources := make([]SourceExport, 0, len(s.databases))
+	for _, name := range s.databases {
+		source := s
+		source.name = name
+		source.databases = []string{name}
+		source.config.AllDatabases = false
+		sources = append(sources, source)
+	}
+	return sources
+}
+
 func (s SourceExport) ReadAll() ([]Event, error) {
-	// Open CSV file
-	f, err := s.archive.Open(s.name)
+	s.config.Warnings.reset()
+
+	if !s.config.AllDatabases {
+		return s.readDatabase(s.name)
+	}
+
+	events := make([]Event, 0)
+	for _, name := range s.databases {
+		databaseEvents, err := s.readDatabase(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		events = append(events, databaseEvents...)
+	}
+	return events, nil
+}
+
+// Properties lists the columns of the CSV file, with types guessed from
+// their values.
+func (s SourceExport) Properties() ([]SourceProperty, error) {
+	csvReader, headers, err := s.openCSV(s.name)
 	if err != nil {
-		return nil, fmt.Errorf("%w: failed open: %w", ErrCSVRead, err)
+		return nil, err
 	}
-	defer f.Close()
 
-	// Open CSV reader
-	csvReader := csv.NewReader(f)
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCSVRead, err)
+	}
 
-	// Read the first row as headers
-	headers, err := csvReader.Read()
+	parser := newNotionDateParser(s.config)
+	properties := make([]SourceProperty, 0, len(headers))
+	for i, name := range headers {
+		isDate, isCheckbox, empty := true, true, true
+		for _, record := range records {
+			if i >= len(record) || record[i] == "" {
+				continue
+			}
+			empty = false
+			if _, _, _, err := parser.parseRange(record[i]); err != nil {
+				isDate = false
+			}
+			switch strings.ToLower(record[i]) {
+			case "yes", "no":
+			default:
+				isCheckbox = false
+			}
+		}
+
+		propertyType := "text"
+		if !empty && isDate {
+			propertyType = "date"
+		} else if !empty && isCheckbox {
+			propertyType = "checkbox"
+		}
+
+		properties = append(properties, SourceProperty{
+			Name: name,
+			Type: propertyType,
+		})
+	}
+
+	return properties, nil
+}
+
+func (s SourceExport) readDatabase(name string) ([]Event, error) {
+	csvReader, headers, err := s.openCSV(name)
 	if err != nil {
-		return nil, fmt.Errorf("%w: headers: %v", ErrCSVRead, err)
+		return nil, err
+	}
+
+	// Find the hide column
+	hideIndex := -1
+	if s.config.HideProperty != "" {
+		for i, key := range headers {
+			if key == s.config.HideProperty {
+				hideIndex = i
+			}
+		}
+		if hideIndex < 0 {
+			return nil, fmt.Errorf("%w: %s not in %v", ErrNoHideProperty, s.config.HideProperty, headers)
+		}
 	}
 
 	events := make([]Event, 0)
+	parser := newNotionDateParser(s.config)
 
 	for {
 		// Read one row
@@ -105,9 +269,22 @@ func (s SourceExport) ReadAll() ([]Event, error) {
 			return nil, fmt.Errorf("%w: %v", ErrCSVRead, err)
 		}
 
+		s.config.Stats.row()
+
+		// Skip hidden rows
+		if hideIndex >= 0 && hideIndex < len(record) && isExportChecked(record[hideIndex]) {
+			s.config.Stats.hidden()
+			continue
+		}
+
 		// Convert it to an event
-		event, err := s.eventFromCSVRow(headers, record)
+		line, _ := csvReader.FieldPos(0)
+		row := fmt.Sprintf("%s:%d", name, line)
+		event, err := s.eventFromCSVRow(parser, row, headers, record)
 		if err != nil {
+			if skipRow(s.config.Stats, s.config.Warnings, row, err) {
+				continue
+			}
 			return nil, err
 		}
 
@@ -117,7 +294,43 @@ func (s SourceExport) ReadAll() ([]Event, error) {
 	return events, nil
 }
 
-func (s SourceExport) eventFromCSVRow(headers []string, record []string) (Event, error) {
+// openCSV opens a CSV file in the archive and reads its headers.
+func (s SourceExport) openCSV(name string) (*csv.Reader, []string, error) {
+	// Open CSV file
+	f, err := s.open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed open: %w", ErrCSVRead, err)
+	}
+	defer f.Close()
+
+	// Remove byte order marks and decode UTF-16
+	decoded, err := decodeExportCSV(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed decode: %w", ErrCSVRead, err)
+	}
+
+	// Open CSV reader
+	csvReader := csv.NewReader(decoded)
+
+	// Read the first row as headers
+	headers, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: headers: %v", ErrCSVRead, err)
+	}
+
+	return csvReader, headers, nil
+}
+
+func (s SourceExport) open(name string) (io.ReadCloser, error) {
+	if s.csv != nil {
+		return io.NopCloser(io.NewSectionReader(s.csv, 0, s.csv.Size())), nil
+	}
+	return s.archive.Open(name)
+}
+
+// eventFromCSVRow converts a row, identified by row in warnings, parsing
+// its dates with parser.
+func (s SourceExport) eventFromCSVRow(parser notionDateParser, row string, headers []string, record []string) (Event, error) {
 	m, err := headersAndRecordToMap(headers, record)
 	if err != nil {
 		return Event{}, err
@@ -126,7 +339,7 @@ func (s SourceExport) eventFromCSVRow(headers []string, record []string) (Event,
 	var dateKey, date string
 	if s.config.DateProperty == "" {
 		// Find first date column
-		dateKey, date = findFirstColumn([]string{"date", "when", "period"}, m)
+		dateKey, date = findFirstColumn([]string{"date", "when", "period", "due"}, headers, m)
 		if dateKey == "" {
 			return Event{}, ErrNoDateProperty
 		}
@@ -139,20 +352,107 @@ func (s SourceExport) eventFromCSVRow(headers []string, record []string) (Event,
 		}
 	}
 
+	if isBlankDate(date) {
+		return Event{}, fmt.Errorf("%w: %s is empty", errNoDate, dateKey)
+	}
+
 	// Parse date range
-	start, end, err := parseNotionDateRange(date, s.config.Zone)
+	start, end, allDay, err := parser.parseRange(date)
 	if err != nil {
 		return Event{}, err
 	}
 
-	// Find first title column
-	titleKey, title := findFirstColumn([]string{"name", "title"}, m)
-	if titleKey == "" {
-		return Event{}, ErrNoTitleProperty
+	var titleKey, title string
+	if s.config.TitleProperty == "" {
+		// Find first title column
+		titleKey, title = findFirstColumn([]string{"name", "title"}, headers, m)
+		if titleKey == "" {
+			return Event{}, ErrNoTitleProperty
+		}
+	} else {
+		titleKey = s.config.TitleProperty
+		var ok bool
+		title, ok = m[titleKey]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrNoTitleProperty, titleKey, headers)
+		}
 	}
 
 	properties := []EventProperty{}
 
+	var recurrence string
+	if s.config.RecurrenceProperty != "" {
+		value, ok := m[s.config.RecurrenceProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.RecurrenceProperty, headers)
+		}
+		recurrence, err = parseRecurrence(value)
+		if err != nil {
+			return Event{}, err
+		}
+	}
+
+	var exceptions []time.Time
+	if s.config.ExceptionsProperty != "" {
+		value, ok := m[s.config.ExceptionsProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.ExceptionsProperty, headers)
+		}
+		exceptions, err = parser.exceptionDates(value)
+		if err != nil {
+			return Event{}, err
+		}
+	}
+
+	var status string
+	if s.config.StatusProperty != "" {
+		var ok bool
+		status, ok = m[s.config.StatusProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.StatusProperty, headers)
+		}
+	}
+
+	var location string
+	if s.config.LocationProperty != "" {
+		var ok bool
+		location, ok = m[s.config.LocationProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.LocationProperty, headers)
+		}
+	}
+
+	var attendees []Attendee
+	if s.config.AttendeesProperty != "" {
+		value, ok := m[s.config.AttendeesProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.AttendeesProperty, headers)
+		}
+		attendees = listAttendees(splitList(value))
+	}
+
+	var categories []string
+	if s.config.CategoriesProperty != "" {
+		value, ok := m[s.config.CategoriesProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.CategoriesProperty, headers)
+		}
+		categories = splitList(value)
+	}
+
+	// Unparseable metadata is ignored rather than failing the row
+	var created, lastEdited time.Time
+	if key, value := findExactColumn([]string{"created time", "created"}, headers, m); value != "" {
+		if created, _, err = parser.parseDate(value); err != nil {
+			s.config.Warnings.add(WarningDate, row, "ignored %s: %v", key, err)
+		}
+	}
+	if key, value := findExactColumn([]string{"last edited time", "last edited"}, headers, m); value != "" {
+		if lastEdited, _, err = parser.parseDate(value); err != nil {
+			s.config.Warnings.add(WarningDate, row, "ignored %s: %v", key, err)
+		}
+	}
+
 	// Generate properties list
 	for i, key := range headers {
 		if key == dateKey || key == titleKey {
@@ -163,26 +463,83 @@ func (s SourceExport) eventFromCSVRow(headers []string, record []string) (Event,
 		properties = append(properties, property)
 	}
 
-	// Generate a ID based on the title and date
-	titleBytes := []byte(title)
-	dateBytes, err := start.MarshalText()
-	if err != nil {
-		return Event{}, err
+	var idValue string
+	if s.config.IDProperty == "" {
+		_, idValue = findExactColumn([]string{"page id", "id"}, headers, m)
+	} else {
+		var ok bool
+		idValue, ok = m[s.config.IDProperty]
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %s not in %v", ErrPropertyNotFound, s.config.IDProperty, headers)
+		}
+	}
+
+	// Use the stable ID of the page, or generate an ID based on the title
+	// and date
+	var id string
+	if idValue = strings.TrimSpace(idValue); idValue != "" {
+		id = exportUID(idValue)
+		if s.config.IDInTitle {
+			title = titleWithID(idValue, title)
+		}
+	} else {
+		titleBytes := []byte(title)
+		dateBytes, err := start.MarshalText()
+		if err != nil {
+			return Event{}, err
+		}
+		idBytes := append(titleBytes, dateBytes...)
+		titleHash := sha256.Sum256(idBytes)
+		titleHashHex := hex.EncodeToString(titleHash[:])
+		id = titleHashHex + "@notion-ical-export"
 	}
-	idBytes := append(titleBytes, dateBytes...)
-	titleHash := sha256.Sum256(idBytes)
-	titleHashHex := hex.EncodeToString(titleHash[:])
-	id := titleHashHex + "@notion-ical-export"
 
 	return Event{
 		ID:         id,
 		Title:      title,
 		Start:      start,
 		End:        end,
+		AllDay:     allDay,
+		Recurrence: recurrence,
+		Exceptions: exceptions,
+		Status:     status,
+		Location:   location,
+		Attendees:  attendees,
+		Categories: categories,
+		Created:    created,
+		LastEdited: lastEdited,
 		Properties: properties,
 	}, nil
 }
 
+// exportUID returns the UID of an event with a stable ID. Page IDs, such as
+// from a formula of id(), and unique IDs give the same UIDs as the API
+// source, so that calendars keep their events when switching sources. Other
+// IDs are hashed.
+func exportUID(id string) string {
+	if pageID, ok := parsePageID(id); ok {
+		return pageID + "@notion-ical"
+	}
+	if uniqueIDPattern.MatchString(id) {
+		return uniqueIDUID(id)
+	}
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:]) + "@notion-ical-export"
+}
+
+// parsePageID parses a page ID with or without dashes into the dashed form
+// used by the API.
+func parsePageID(id string) (string, bool) {
+	hexID := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if len(hexID) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hexID); err != nil {
+		return "", false
+	}
+	return hexID[0:8] + "-" + hexID[8:12] + "-" + hexID[12:16] + "-" + hexID[16:20] + "-" + hexID[20:32], true
+}
+
 type exportProperty struct {
 	name  string
 	value string
@@ -196,6 +553,30 @@ func (p exportProperty) ValueString() string {
 	return p.value
 }
 
+// isBareCSV detects whether the archive is a CSV file instead of a ZIP file,
+// first by extension and then by sniffing for the ZIP file signature.
+func isBareCSV(archive io.ReaderAt, filename string) bool {
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return true
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".zip") {
+		return false
+	}
+
+	magic := make([]byte, len(zipMagic))
+	n, _ := archive.ReadAt(magic, 0)
+	return !bytes.Equal(magic[:n], zipMagic)
+}
+
+// isExportChecked interprets the value of an exported checkbox column.
+func isExportChecked(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true", "checked", "x", "1":
+		return true
+	}
+	return false
+}
+
 func headersAndRecordToMap(headers []string, record []string) (map[string]string, error) {
 	m := make(map[string]string)
 
@@ -211,8 +592,23 @@ func headersAndRecordToMap(headers []string, record []string) (map[string]string
 	return m, nil
 }
 
-func findFirstColumn(names []string, m map[string]string) (string, string) {
-	for key, value := range m {
+// findFirstColumn finds the first column in header order that matches one of
+// names exactly, or otherwise contains one of names.
+// findExactColumn finds the first column named one of names, ignoring case.
+func findExactColumn(names []string, headers []string, m map[string]string) (string, string) {
+	for _, key := range headers {
+		for _, q := range names {
+			if strings.EqualFold(key, q) {
+				return key, m[key]
+			}
+		}
+	}
+	return "", ""
+}
+
+func findFirstColumn(names []string, headers []string, m map[string]string) (string, string) {
+	for _, key := range headers {
+		value := m[key]
 		keyLower := strings.ToLower(key)
 		for _, q := range names {
 			qLower := strings.ToLower(q)
@@ -222,7 +618,8 @@ func findFirstColumn(names []string, m map[string]string) (string, string) {
 		}
 	}
 
-	for key, value := range m {
+	for _, key := range headers {
+		value := m[key]
 		keyLower := strings.ToLower(key)
 		for _, q := range names {
 			qLower := strings.ToLower(q)
@@ -1,69 +1,133 @@
 package notion_ical
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
-var ErrParseDate = errors.New("date parsing error")
+var ErrParseDate error = &kindError{"date parsing error", ErrParse}
 
-func parseNotionDateRange(r string, zone *time.Location) (time.Time, time.Time, error) {
-	parts := strings.SplitN(r, "\u2192", 2)
+var notionTimeFormats = []string{"15:04", "3:04 PM", "3:04PM", "15:04:05"}
+var notionDateFormats = []string{"January 2, 2006", "2 January 2006", "2006/01/02", "2006-01-02", "2006/1/2", "2006-1-2", "2006年1月2日", "2006년 1월 2일"}
 
-	t1, err := parseNotionDate(parts[0], zone)
+// notionRangeSeparators separate the start and end of date ranges, as
+// written by Notion or by hand, in the order they are tried. Hyphens only
+// separate ranges with spaces around them, because dates contain hyphens.
+var notionRangeSeparators = []string{"\u2192", "\u2013", "\u2014", " - ", " to "}
+
+// notionDateTimeFormats are complete layouts that are tried before combining
+// date formats and time formats.
+var notionDateTimeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// notionDateParser parses dates in exports.
+type notionDateParser struct {
+	zone        *time.Location
+	locale      string
+	dateFormats []string
+	timeFormats []string
+}
+
+// newNotionDateParser creates a parser that tries the configured formats
+// before the default formats.
+func newNotionDateParser(config ConfigSourceExport) notionDateParser {
+	return notionDateParser{
+		zone:        config.Zone,
+		locale:      config.Locale,
+		dateFormats: append(append([]string{}, config.DateFormats...), notionDateFormats...),
+		timeFormats: append(append([]string{}, config.TimeFormats...), notionTimeFormats...),
+	}
+}
+
+// parseRange parses a date or date range from an export. allDay is true when
+// neither side of the range has a time component, and end is then the day
+// after the end date of the range, which Notion includes.
+func (p notionDateParser) parseRange(r string) (start time.Time, end time.Time, allDay bool, err error) {
+	from, to, isRange := splitNotionRange(r)
+
+	t1, hasTime1, err := p.parseDate(from)
 	if err != nil {
-		return time.Time{}, time.Time{}, err
+		return time.Time{}, time.Time{}, false, err
 	}
 
-	if len(parts) == 2 {
-		t2, err := parseNotionDate(parts[1], zone)
+	if isRange {
+		t2, hasTime2, err := p.parseDate(to)
 		if err != nil {
-			t2, err = parseNotionTime(parts[1], zone)
+			t2, err = p.parseTime(to)
 			t2 = mergeNotionDateTime(t1, t2)
+			hasTime2 = true
 		}
 
 		if err != nil {
-			return time.Time{}, time.Time{}, err
+			return time.Time{}, time.Time{}, false, err
 		}
 
-		return t1, t2, nil
+		if !hasTime1 && !hasTime2 {
+			return t1, t2.AddDate(0, 0, 1), true, nil
+		}
+		return t1, t2, false, nil
 	}
 
-	return t1, t1, nil
-}
+	if !hasTime1 {
+		return t1, t1.AddDate(0, 0, 1), true, nil
+	}
 
-var notionTimeFormats = []string{"15:04", "3:00 PM"}
-var notionDateFormats = []string{"January 2, 2006", "2006/01/02"}
+	return t1, t1, false, nil
+}
 
-func parseNotionDate(d string, zone *time.Location) (time.Time, error) {
-	var t time.Time
-	var err error
+// splitNotionRange splits a date range at the first separator found. Ranges
+// without an end, such as "January 2, 2006 →", are single dates.
+func splitNotionRange(r string) (from, to string, isRange bool) {
+	for _, separator := range notionRangeSeparators {
+		if from, to, ok := strings.Cut(r, separator); ok {
+			return from, to, strings.TrimSpace(to) != ""
+		}
+	}
+	return r, "", false
+}
 
+// parseDate parses a date with an optional time. hasTime is false when only
+// a date was present. Month names in the parser's locale are accepted.
+func (p notionDateParser) parseDate(d string) (t time.Time, hasTime bool, err error) {
 	d = strings.TrimSpace(d)
+	original := d
+	d = delocalizeNotionDate(d, p.locale)
 
-	for _, fd := range notionDateFormats {
-		for _, ft := range notionTimeFormats {
+	for _, f := range notionDateTimeFormats {
+		t, err = time.ParseInLocation(f, d, p.zone)
+		if err == nil {
+			return t, true, nil
+		}
+	}
+
+	for _, fd := range p.dateFormats {
+		for _, ft := range p.timeFormats {
 			f := fd + " " + ft
-			t, err = time.ParseInLocation(f, d, zone)
+			t, err = time.ParseInLocation(f, d, p.zone)
 			if err == nil {
-				return t, nil
+				return t, true, nil
 			}
 		}
 	}
 
-	return t, fmt.Errorf("%w: %s is not a valid date", ErrParseDate, d)
+	for _, fd := range p.dateFormats {
+		t, err = time.ParseInLocation(fd, d, p.zone)
+		if err == nil {
+			return t, false, nil
+		}
+	}
+
+	return t, false, fmt.Errorf("%w: %s is not a valid date", ErrParseDate, original)
 }
 
-func parseNotionTime(d string, zone *time.Location) (time.Time, error) {
+func (p notionDateParser) parseTime(d string) (time.Time, error) {
 	var t time.Time
 	var err error
 
 	d = strings.TrimSpace(d)
 
-	for _, f := range notionTimeFormats {
-		t, err = time.ParseInLocation(f, d, zone)
+	for _, f := range p.timeFormats {
+		t, err = time.ParseInLocation(f, d, p.zone)
 		if err == nil {
 			return t, nil
 		}
@@ -75,3 +139,32 @@ func parseNotionTime(d string, zone *time.Location) (time.Time, error) {
 func mergeNotionDateTime(date time.Time, t time.Time) time.Time {
 	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), t.Second(), 0, t.Location())
 }
+
+// exceptionDates parses dates and date ranges separated by semicolons or new
+// lines, listing each day of a range.
+func (p notionDateParser) exceptionDates(value string) ([]time.Time, error) {
+	var dates []time.Time
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ';' || r == '\n'
+	})
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		from, to, isRange := splitNotionRange(field)
+		start, _, err := p.parseDate(from)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			end, _, err = p.parseDate(to)
+			if err != nil {
+				return nil, err
+			}
+		}
+		dates = append(dates, datesBetween(start, end)...)
+	}
+	return dates, nil
+}
@@ -0,0 +1,121 @@
+package notion_ical
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitNotionRange(t *testing.T) {
+	tests := []struct {
+		r       string
+		from    string
+		to      string
+		isRange bool
+	}{
+		{"January 2, 2024", "January 2, 2024", "", false},
+		{"2024-01-02", "2024-01-02", "", false},
+		{"January 2, 2024 → January 4, 2024", "January 2, 2024 ", " January 4, 2024", true},
+		{"January 2, 2024 10:00 → 11:30", "January 2, 2024 10:00 ", " 11:30", true},
+		{"January 2, 2024 →", "January 2, 2024 ", "", false},
+		{"2024-01-02 – 2024-01-04", "2024-01-02 ", " 2024-01-04", true},
+		{"2024-01-02—2024-01-04", "2024-01-02", "2024-01-04", true},
+		{"2024-01-02 - 2024-01-04", "2024-01-02", "2024-01-04", true},
+		{"2024-01-02 to 2024-01-04", "2024-01-02", "2024-01-04", true},
+		{"2024/01/02 → 2024-01-04 - x", "2024/01/02 ", " 2024-01-04 - x", true},
+	}
+	for _, test := range tests {
+		t.Run(test.r, func(t *testing.T) {
+			from, to, isRange := splitNotionRange(test.r)
+			if from != test.from || to != test.to || isRange != test.isRange {
+				t.Errorf("splitNotionRange(%q) = %q, %q, %v, want %q, %q, %v", test.r, from, to, isRange, test.from, test.to, test.isRange)
+			}
+		})
+	}
+}
+
+func TestNotionDateParserParseRange(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2024, time.January, day, hour, min, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		name       string
+		r          string
+		config     ConfigSourceExport
+		start, end time.Time
+		allDay     bool
+		wantErr    bool
+	}{
+		{name: "date", r: "January 2, 2024", start: date(2, 0, 0), end: date(3, 0, 0), allDay: true},
+		{name: "date range", r: "January 2, 2024 → January 4, 2024", start: date(2, 0, 0), end: date(5, 0, 0), allDay: true},
+		{name: "date time", r: "January 2, 2024 10:00", start: date(2, 10, 0), end: date(2, 10, 0)},
+		{name: "time range", r: "January 2, 2024 10:00 → 11:30", start: date(2, 10, 0), end: date(2, 11, 30)},
+		{name: "date time range", r: "2024/01/02 23:00 → 2024/01/03 01:00", start: date(2, 23, 0), end: date(3, 1, 0)},
+		{name: "date to date time", r: "2024-01-02 → 2024-01-03 09:00", start: date(2, 0, 0), end: date(3, 9, 0)},
+		{name: "iso", r: "2024-01-02T10:15", start: date(2, 10, 15), end: date(2, 10, 15)},
+		{name: "open end", r: "January 2, 2024 →", start: date(2, 0, 0), end: date(3, 0, 0), allDay: true},
+		{name: "localized", r: "2. Januar 2024", config: ConfigSourceExport{Locale: "de"}, start: date(2, 0, 0), end: date(3, 0, 0), allDay: true},
+		{name: "configured date format", r: "02.01.2024 → 04.01.2024", config: ConfigSourceExport{DateFormats: []string{"02.01.2006"}}, start: date(2, 0, 0), end: date(5, 0, 0), allDay: true},
+		{name: "configured time format", r: "2024-01-02 10h15", config: ConfigSourceExport{TimeFormats: []string{"15h04"}}, start: date(2, 10, 15), end: date(2, 10, 15)},
+		{name: "invalid start", r: "someday", wantErr: true},
+		{name: "invalid end", r: "January 2, 2024 → later", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.Zone = berlin
+			start, end, allDay, err := newNotionDateParser(test.config).parseRange(test.r)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseRange(%q) succeeded, want an error", test.r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRange(%q) = %v", test.r, err)
+			}
+			if !start.Equal(test.start) || !end.Equal(test.end) || allDay != test.allDay {
+				t.Errorf("parseRange(%q) = %v, %v, %v, want %v, %v, %v", test.r, start, end, allDay, test.start, test.end, test.allDay)
+			}
+		})
+	}
+}
+
+func TestNotionDateParserTwelveHour(t *testing.T) {
+	parser := newNotionDateParser(ConfigSourceExport{Zone: time.UTC})
+	tests := []struct {
+		d    string
+		want time.Time
+	}{
+		{"January 2, 2024 9:00 AM", time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"January 2, 2024 9:30 AM", time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"January 2, 2024 12:45 PM", time.Date(2024, 1, 2, 12, 45, 0, 0, time.UTC)},
+		{"January 2, 2024 3:05PM", time.Date(2024, 1, 2, 15, 5, 0, 0, time.UTC)},
+		{"January 2, 2024 11:59 PM", time.Date(2024, 1, 2, 23, 59, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.d, func(t *testing.T) {
+			got, hasTime, err := parser.parseDate(test.d)
+			if err != nil {
+				t.Fatalf("parseDate(%q) = %v", test.d, err)
+			}
+			if !hasTime || !got.Equal(test.want) {
+				t.Errorf("parseDate(%q) = %v, %v, want %v, true", test.d, got, hasTime, test.want)
+			}
+		})
+	}
+
+	start, end, _, err := parser.parseRange("January 2, 2024 9:15 AM → 10:45 AM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start, want)
+	}
+	if want := time.Date(2024, 1, 2, 10, 45, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end, want)
+	}
+}
@@ -0,0 +1,49 @@
+package notion_ical
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decodeExportCSV returns a UTF-8 reader for a CSV file that may have a
+// byte order mark or be encoded in UTF-16, which happens when an export has
+// been opened and saved in Excel.
+func decodeExportCSV(r io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return bytes.NewReader(b[len(bomUTF8):]), nil
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return bytes.NewReader(decodeUTF16(b[len(bomUTF16LE):], binary.LittleEndian)), nil
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return bytes.NewReader(decodeUTF16(b[len(bomUTF16BE):], binary.BigEndian)), nil
+	case len(b) >= 2 && b[0] != 0 && b[1] == 0:
+		// UTF-16LE without a byte order mark
+		return bytes.NewReader(decodeUTF16(b, binary.LittleEndian)), nil
+	case len(b) >= 2 && b[0] == 0 && b[1] != 0:
+		// UTF-16BE without a byte order mark
+		return bytes.NewReader(decodeUTF16(b, binary.BigEndian)), nil
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) []byte {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	return []byte(string(utf16.Decode(u)))
+}
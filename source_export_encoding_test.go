@@ -0,0 +1,66 @@
+package notion_ical
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes encodes s as UTF-16 in the given byte order.
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+func TestDecodeExportCSV(t *testing.T) {
+	const csv = "Name,Date\nCafé ☕,\"March 15, 2024\"\n"
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"utf-8", []byte(csv), csv},
+		{"utf-8 with bom", append(append([]byte{}, bomUTF8...), csv...), csv},
+		{"utf-16le with bom", append(append([]byte{}, bomUTF16LE...), utf16Bytes(csv, false)...), csv},
+		{"utf-16be with bom", append(append([]byte{}, bomUTF16BE...), utf16Bytes(csv, true)...), csv},
+		{"utf-16le", utf16Bytes(csv, false), csv},
+		{"utf-16be", utf16Bytes(csv, true), csv},
+		{"surrogate pair", utf16Bytes("Name\n🗓\n", false), "Name\n🗓\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := decodeExportCSV(strings.NewReader(string(test.input)))
+			if err != nil {
+				t.Fatalf("decodeExportCSV() = %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("decoded %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeExportCSVShort(t *testing.T) {
+	for _, input := range []string{"", "a"} {
+		r, err := decodeExportCSV(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("decodeExportCSV(%q) = %v", input, err)
+		}
+		if got, _ := io.ReadAll(r); string(got) != input {
+			t.Errorf("decodeExportCSV(%q) decoded %q", input, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package notion_ical
+
+import (
+	"strings"
+	"unicode"
+)
+
+var englishMonths = []string{
+	"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December",
+}
+
+// notionLocaleMonths holds lowercase month names for workspace languages
+// that Notion exports with localized dates.
+var notionLocaleMonths = map[string][]string{
+	"en": {"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"},
+	"de": {"januar", "februar", "märz", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "dezember"},
+	"fr": {"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+	"es": {"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+	"pt": {"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+	"it": {"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+	"nl": {"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+}
+
+// notionLocaleFillers are words that appear between date parts in some
+// languages, such as "15 de marzo de 2024".
+var notionLocaleFillers = map[string]bool{
+	"de":  true,
+	"del": true,
+}
+
+// notionLocaleLanguage reduces a locale like "de-DE" to its language.
+func notionLocaleLanguage(locale string) string {
+	language, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	language, _, _ = strings.Cut(language, "_")
+	return language
+}
+
+// isKnownNotionLocale reports whether dates in the locale can be parsed.
+func isKnownNotionLocale(locale string) bool {
+	switch language := notionLocaleLanguage(locale); language {
+	case "", "ja", "zh", "ko":
+		return true
+	default:
+		_, ok := notionLocaleMonths[language]
+		return ok
+	}
+}
+
+// delocalizeNotionDate rewrites localized month names into English, so that
+// the date can be parsed with the usual notionDateFormats.
+func delocalizeNotionDate(d string, locale string) string {
+	months, ok := notionLocaleMonths[notionLocaleLanguage(locale)]
+	if !ok {
+		return d
+	}
+
+	words := strings.Fields(d)
+	var out []string
+	for _, word := range words {
+		w := strings.ToLower(strings.TrimRight(word, ".,"))
+
+		if notionLocaleFillers[w] && notionLocaleLanguage(locale) != "en" {
+			continue
+		}
+
+		// Day numbers such as "15." in German
+		if w != "" && strings.IndexFunc(w, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			out = append(out, strings.TrimSuffix(word, "."))
+			continue
+		}
+
+		// Full or abbreviated month names
+		month := -1
+		if len([]rune(w)) >= 3 {
+			for i, name := range months {
+				if strings.HasPrefix(name, w) {
+					month = i
+					break
+				}
+			}
+		}
+		if month >= 0 {
+			replaced := englishMonths[month]
+			if strings.HasSuffix(word, ",") {
+				replaced += ","
+			}
+			out = append(out, replaced)
+			continue
+		}
+
+		out = append(out, word)
+	}
+
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,53 @@
+package notion_ical
+
+import "testing"
+
+func TestDelocalizeNotionDate(t *testing.T) {
+	tests := []struct {
+		date   string
+		locale string
+		want   string
+	}{
+		{"January 2, 2024", "", "January 2, 2024"},
+		{"January 2, 2024", "en", "January 2, 2024"},
+		{"15. März 2024", "de", "15 March 2024"},
+		{"15. März 2024", "de-DE", "15 March 2024"},
+		{"15. Mär. 2024 14:30", "de_AT", "15 March 2024 14:30"},
+		{"15 mars 2024", "fr", "15 March 2024"},
+		{"1 août 2024 09:00", "fr-CA", "1 August 2024 09:00"},
+		{"15 de marzo de 2024", "es", "15 March 2024"},
+		{"15 de março de 2024", "pt-BR", "15 March 2024"},
+		{"3 maggio 2024", "it", "3 May 2024"},
+		{"3 mei 2024", "nl", "3 May 2024"},
+		{"2024年3月15日", "ja", "2024年3月15日"},
+		{"15. März 2024", "sv", "15. März 2024"},
+		{"", "de", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.locale+"/"+test.date, func(t *testing.T) {
+			if got := delocalizeNotionDate(test.date, test.locale); got != test.want {
+				t.Errorf("delocalizeNotionDate(%q, %q) = %q, want %q", test.date, test.locale, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsKnownNotionLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   bool
+	}{
+		{"", true},
+		{"en-US", true},
+		{"de", true},
+		{"ja", true},
+		{"zh-TW", true},
+		{"sv", false},
+		{"xx-YY", false},
+	}
+	for _, test := range tests {
+		if got := isKnownNotionLocale(test.locale); got != test.want {
+			t.Errorf("isKnownNotionLocale(%q) = %v, want %v", test.locale, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package notion_ical
+
+import (
+	"context"
+	"time"
+)
+
+// EventFilter reports whether an event is kept.
+type EventFilter func(Event) bool
+
+// FilteredSource keeps the events of a source that match a filter, so that
+// filters can be shared between conversions of the source.
+type FilteredSource struct {
+	source Source
+	filter EventFilter
+}
+
+// NewFilteredSource keeps the events of source for which filter returns
+// true.
+func NewFilteredSource(source Source, filter EventFilter) *FilteredSource {
+	return &FilteredSource{
+		source: source,
+		filter: filter,
+	}
+}
+
+func (s *FilteredSource) Name() string {
+	return s.source.Name()
+}
+
+func (s *FilteredSource) ReadAll() ([]Event, error) {
+	return s.ReadAllContext(context.Background())
+}
+
+func (s *FilteredSource) ReadAllContext(ctx context.Context) ([]Event, error) {
+	events, err := ReadAll(ctx, s.source)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]Event, 0, len(events))
+	for _, event := range events {
+		if s.filter(event) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered, nil
+}
+
+func (s *FilteredSource) StreamContext(ctx context.Context, yield func(Event) error) error {
+	return Stream(ctx, s.source, func(event Event) error {
+		if !s.filter(event) {
+			return nil
+		}
+		return yield(event)
+	})
+}
+
+// EventsBetween keeps events that overlap the window from from to to.
+// Recurring events are kept when they start before to. A zero time leaves
+// that side of the window open.
+func EventsBetween(from, to time.Time) EventFilter {
+	return func(event Event) bool {
+		if !to.IsZero() && !event.Start.Before(to) {
+			return false
+		}
+		if !from.IsZero() && event.Recurrence == "" && event.End.Before(from) {
+			return false
+		}
+		return true
+	}
+}
+
+// PropertyEquals keeps events with a property named name whose value, as
+// written in the description, is value.
+func PropertyEquals(name, value string) EventFilter {
+	return func(event Event) bool {
+		for _, property := range event.Properties {
+			if property.NameString() == name {
+				return property.ValueString() == value
+			}
+		}
+		return false
+	}
+}
+
+// AllFilters keeps events that every filter keeps.
+func AllFilters(filters ...EventFilter) EventFilter {
+	return func(event Event) bool {
+		for _, filter := range filters {
+			if !filter(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,75 @@
+package notion_ical
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MultiSource merges the events of several sources, such as databases of
+// different teams, into one calendar.
+type MultiSource struct {
+	// Sources are read concurrently, and their events are merged in order.
+	Sources []Source
+	// Prefixes are prepended to the titles of events of the source at the
+	// same index, such as "Work: ". Sources without a prefix are unchanged.
+	Prefixes []string
+	// CalendarName replaces the combined names of the sources when set.
+	CalendarName string
+}
+
+// NewMultiSource merges the events of sources.
+func NewMultiSource(sources ...Source) *MultiSource {
+	return &MultiSource{
+		Sources: sources,
+	}
+}
+
+// Name returns CalendarName, or the names of the sources joined with commas.
+func (s *MultiSource) Name() string {
+	if s.CalendarName != "" {
+		return s.CalendarName
+	}
+	names := make([]string, len(s.Sources))
+	for i, source := range s.Sources {
+		names[i] = source.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (s *MultiSource) ReadAll() ([]Event, error) {
+	return s.ReadAllContext(context.Background())
+}
+
+// ReadAllContext reads every source, failing when any source fails.
+func (s *MultiSource) ReadAllContext(ctx context.Context) ([]Event, error) {
+	results := make([][]Event, len(s.Sources))
+	errs := make([]error, len(s.Sources))
+
+	var wg sync.WaitGroup
+	for i, source := range s.Sources {
+		wg.Add(1)
+		go func(i int, source Source) {
+			defer wg.Done()
+			results[i], errs[i] = ReadAll(ctx, source)
+		}(i, source)
+	}
+	wg.Wait()
+
+	var events []Event
+	for i, source := range s.Sources {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s: %w", source.Name(), errs[i])
+		}
+		prefix := ""
+		if i < len(s.Prefixes) {
+			prefix = s.Prefixes[i]
+		}
+		for _, event := range results[i] {
+			event.Title = prefix + event.Title
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,313 @@
+package notion_ical
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// SourceOption configures NewAPISource, OpenAPISource and NewExportSource.
+// Options set the fields of ConfigSourceAPI and ConfigSourceExport, which
+// remain for compatibility. Options that do not apply to a source, such as
+// WithPageSize for exports, are ignored by it.
+type SourceOption func(*sourceConfig)
+
+type sourceConfig struct {
+	api    ConfigSourceAPI
+	export ConfigSourceExport
+}
+
+func newSourceConfig(opts []SourceOption) sourceConfig {
+	c := sourceConfig{
+		export: ConfigSourceExport{
+			Zone: time.Local,
+		},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// NewAPISource reads events from a database with the Notion API, like
+// NewSourceAPI. It checks that the date property, and the other properties
+// that are set, exist in the database.
+func NewAPISource(apiKey, databaseID string, opts ...SourceOption) (SourceAPI, error) {
+	config := newSourceConfig(opts).api
+	config.APIKey = apiKey
+	config.DatabaseID = databaseID
+	return NewSourceAPI(config)
+}
+
+// OpenAPISource is NewAPISource without checking properties, like
+// OpenSourceAPI, such as to list the properties of a database.
+func OpenAPISource(apiKey, databaseID string, opts ...SourceOption) (SourceAPI, error) {
+	config := newSourceConfig(opts).api
+	config.APIKey = apiKey
+	config.DatabaseID = databaseID
+	return OpenSourceAPI(config)
+}
+
+// NewExportSource reads events from a ZIP or CSV file of a Notion export,
+// like NewSourceExport. Dates are parsed in the local timezone unless set
+// with WithExportZone.
+func NewExportSource(archive ReaderAtSeeker, filename string, opts ...SourceOption) (SourceExport, error) {
+	config := newSourceConfig(opts).export
+	config.Archive = archive
+	config.Filename = filename
+	return NewSourceExport(config)
+}
+
+// WithDateProperty sets the date property of events, instead of the only
+// date property of the database.
+func WithDateProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.DateProperty = name
+		c.export.DateProperty = name
+	}
+}
+
+// WithHideProperty hides events with this checkbox property, or formula
+// evaluating to a checkbox, set.
+func WithHideProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.HideProperty = name
+		c.export.HideProperty = name
+	}
+}
+
+// WithTitleProperty sets the column of the titles of events in exports,
+// instead of the first column that looks like a name or title.
+func WithTitleProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.export.TitleProperty = name
+	}
+}
+
+// WithRecurrenceProperty repeats events with the repeat setting or RRULE
+// in this property.
+func WithRecurrenceProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.RecurrenceProperty = name
+		c.export.RecurrenceProperty = name
+	}
+}
+
+// WithExceptionsProperty skips occurrences of repeating events on the dates
+// in this property.
+func WithExceptionsProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.ExceptionsProperty = name
+		c.export.ExceptionsProperty = name
+	}
+}
+
+// WithStatusProperty reads the status of tasks from this property.
+func WithStatusProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.StatusProperty = name
+		c.export.StatusProperty = name
+	}
+}
+
+// WithLocationProperty reads the location of events from this property.
+func WithLocationProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.LocationProperty = name
+		c.export.LocationProperty = name
+	}
+}
+
+// WithAttendeesProperty reads the attendees of events from this property.
+func WithAttendeesProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.AttendeesProperty = name
+		c.export.AttendeesProperty = name
+	}
+}
+
+// WithCategoriesProperty reads the categories of events from this property.
+func WithCategoriesProperty(name string) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.CategoriesProperty = name
+		c.export.CategoriesProperty = name
+	}
+}
+
+// WithIDProperty uses the IDs in this property for event UIDs, and prefixes
+// titles with them when inTitle is set.
+func WithIDProperty(name string, inTitle bool) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.IDProperty = name
+		c.api.IDInTitle = inTitle
+		c.export.IDProperty = name
+		c.export.IDInTitle = inTitle
+	}
+}
+
+// WithFilter only reads the pages that match a filter of the Notion API,
+// such as the filter of a view.
+func WithFilter(filter notion.DatabaseQueryFilter) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Filter = &filter
+	}
+}
+
+// WithSorts orders the pages of the database, such as to match a view.
+func WithSorts(sorts ...notion.DatabaseQuerySort) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Sorts = sorts
+	}
+}
+
+// WithPageSize sets the number of pages and blocks fetched by each request,
+// up to 100.
+func WithPageSize(n int) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.PageSize = n
+	}
+}
+
+// WithMaxBlockDepth sets how deeply nested blocks are read into the content
+// of events.
+func WithMaxBlockDepth(depth int) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.MaxBlockDepth = depth
+	}
+}
+
+// WithSkipBlockTypes leaves blocks of these types, and their children, out
+// of the content of events.
+func WithSkipBlockTypes(types ...notion.BlockType) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.SkipBlockTypes = types
+	}
+}
+
+// WithRequestTimeout limits each request to the Notion API to timeout,
+// instead of 30s.
+func WithRequestTimeout(timeout time.Duration) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.RequestTimeout = timeout
+	}
+}
+
+// WithReadTimeout limits whole reads of the database to timeout.
+func WithReadTimeout(timeout time.Duration) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.ReadTimeout = timeout
+	}
+}
+
+// WithChildDatabases sets how databases inside pages are added to the
+// content of events.
+func WithChildDatabases(childDatabases ChildDatabases) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.ChildDatabases = childDatabases
+	}
+}
+
+// WithContentCache stores the content of pages in cache, so that only pages
+// edited since are read again.
+func WithContentCache(cache ContentCache) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.ContentCache = cache
+	}
+}
+
+// WithCheckpoint stores the progress of reads in checkpoint, so that a read
+// that failed resumes after the pages already read.
+func WithCheckpoint(checkpoint ReadCheckpoint) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Checkpoint = checkpoint
+	}
+}
+
+// WithFormatters overrides how property values are rendered in the
+// description of events.
+func WithFormatters(formatters PropertyFormatters) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Formatters = formatters
+	}
+}
+
+// WithSourceLogger writes messages about fetched pages and blocks to l
+// instead of the standard logger.
+func WithSourceLogger(l Logger) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Logger = l
+	}
+}
+
+// WithClient uses client instead of a client created with the API key.
+func WithClient(client *notion.Client) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Client = client
+	}
+}
+
+// WithHTTPClient sends the requests of the client created with the API key
+// with client, such as to add a caching transport.
+func WithHTTPClient(client *http.Client) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.HTTPClient = client
+	}
+}
+
+// WithReadStats counts the rows read by the source into stats, and skips
+// rows with values that cannot be parsed instead of failing.
+func WithReadStats(stats *ReadStats) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Stats = stats
+		c.export.Stats = stats
+	}
+}
+
+// WithWarnings collects non-fatal issues found while reading into warnings,
+// and skips rows with values that cannot be parsed instead of failing.
+func WithWarnings(warnings *Warnings) SourceOption {
+	return func(c *sourceConfig) {
+		c.api.Warnings = warnings
+		c.export.Warnings = warnings
+	}
+}
+
+// WithExportZone parses the dates of exports in zone.
+func WithExportZone(zone *time.Location) SourceOption {
+	return func(c *sourceConfig) {
+		c.export.Zone = zone
+	}
+}
+
+// WithExportLocale parses the dates of exports from a workspace in this
+// language, such as "de".
+func WithExportLocale(locale string) SourceOption {
+	return func(c *sourceConfig) {
+		c.export.Locale = locale
+	}
+}
+
+// WithExportDateFormats tries these Go time layouts for the dates of
+// exports before the default layouts.
+func WithExportDateFormats(layouts ...string) SourceOption {
+	return func(c *sourceConfig) {
+		c.export.DateFormats = layouts
+	}
+}
+
+// WithExportTimeFormats tries these Go time layouts for the times of
+// exports before the default layouts.
+func WithExportTimeFormats(layouts ...string) SourceOption {
+	return func(c *sourceConfig) {
+		c.export.TimeFormats = layouts
+	}
+}
+
+// WithAllDatabases merges events from every CSV file of an export,
+// including nested databases.
+func WithAllDatabases() SourceOption {
+	return func(c *sourceConfig) {
+		c.export.AllDatabases = true
+	}
+}
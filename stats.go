@@ -0,0 +1,104 @@
+package notion_ical
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ReadStats counts the rows read by a source, such as to check the data of a
+// database before publishing it. Sources count into it when set with
+// WithReadStats, or the Stats of ConfigSourceAPI and ConfigSourceExport.
+//
+// Sources with stats skip rows whose values cannot be parsed, such as rows
+// of exports without a valid date, instead of failing, and record them in
+// Skipped.
+type ReadStats struct {
+	mu sync.Mutex
+	// Rows is the number of pages or rows read, including skipped rows
+	Rows int
+	// Hidden is the number of rows of exports skipped by the hide property.
+	// Pages hidden in databases are filtered by the Notion API, so they are
+	// not counted.
+	Hidden int
+	// Undated is the number of pages or rows without a date
+	Undated int
+	// Skipped are the rows that could not be parsed
+	Skipped []SkippedRow
+}
+
+// SkippedRow is a row skipped because a value could not be parsed.
+type SkippedRow struct {
+	// Row identifies the row, such as "Events.csv:12" or the URL of a page
+	Row string
+	Err error
+}
+
+// DateErrors counts the skipped rows with a date that could not be parsed.
+func (s *ReadStats) DateErrors() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, row := range s.Skipped {
+		if errors.Is(row.Err, ErrParseDate) {
+			n += 1
+		}
+	}
+	return n
+}
+
+// The methods counting rows do nothing on nil stats, so that sources call
+// them without checking whether stats are set.
+
+func (s *ReadStats) row() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Rows += 1
+}
+
+func (s *ReadStats) hidden() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Hidden += 1
+}
+
+func (s *ReadStats) undated() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Undated += 1
+}
+
+// skip records a row skipped because of err, and reports whether it was
+// recorded. Rows are only skipped when counting stats, and for parse errors.
+// Rows without a date are counted as undated instead.
+func (s *ReadStats) skip(row string, err error) bool {
+	if s == nil || !errors.Is(err, ErrParse) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if errors.Is(err, errNoDate) {
+		s.Undated += 1
+		return true
+	}
+	s.Skipped = append(s.Skipped, SkippedRow{Row: row, Err: err})
+	return true
+}
+
+// errNoDate is a row of an export with an empty date.
+var errNoDate error = &kindError{"date parsing error", ErrParseDate}
+
+// isBlankDate reports whether a date value of an export is empty.
+func isBlankDate(value string) bool {
+	return strings.TrimSpace(value) == ""
+}
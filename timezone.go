@@ -0,0 +1,122 @@
+package notion_ical
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arran4/golang-ical"
+)
+
+// WithTimezone converts the times of events into zone, written with a TZID
+// and a matching VTIMEZONE instead of in UTC. The zone must have an IANA
+// name, such as "Europe/Berlin".
+func WithTimezone(zone *time.Location) ConvertOption {
+	return func(o *convertOptions) {
+		o.zone = zone
+	}
+}
+
+// setZonedTime sets a property to a time in zone, or in UTC when zone is
+// nil.
+func setZonedTime(component *ics.ComponentBase, property ics.ComponentProperty, t time.Time, zone *time.Location) {
+	if zone == nil {
+		component.SetProperty(property, t.UTC().Format("20060102T150405Z"))
+		return
+	}
+	component.SetProperty(property, t.In(zone).Format("20060102T150405"), withTZID(zone))
+}
+
+func withTZID(zone *time.Location) ics.PropertyParameter {
+	return &ics.KeyValues{
+		Key:   string(ics.ParameterTzid),
+		Value: []string{zone.String()},
+	}
+}
+
+// timedRange finds the earliest start and latest end of events that are not
+// all-day.
+func timedRange(events []Event) (from, to time.Time, ok bool) {
+	for _, event := range events {
+		if event.AllDay {
+			continue
+		}
+		if !ok || event.Start.Before(from) {
+			from = event.Start
+		}
+		if !ok || event.End.After(to) {
+			to = event.End
+		}
+		ok = true
+	}
+	return from, to, ok
+}
+
+// newVTimezone describes the offsets of zone between the years of from and
+// to, with an observance for each transition.
+func newVTimezone(zone *time.Location, from, to time.Time) *ics.VTimezone {
+	tz := &ics.VTimezone{}
+	tz.AddProperty(ics.ComponentProperty(ics.PropertyTzid), zone.String())
+
+	start := time.Date(from.In(zone).Year(), time.January, 1, 0, 0, 0, 0, zone)
+	end := time.Date(to.In(zone).Year()+1, time.January, 1, 0, 0, 0, 0, zone)
+
+	_, offset := start.Zone()
+	tz.Components = append(tz.Components, newObservance(start, offset, offset))
+
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		_, nextOffset := next.Zone()
+		if nextOffset == offset {
+			continue
+		}
+
+		// Find the first second with the new offset
+		lo, hi := day.Unix(), next.Unix()
+		for lo+1 < hi {
+			mid := lo + (hi-lo)/2
+			if _, o := time.Unix(mid, 0).In(zone).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		tz.Components = append(tz.Components, newObservance(time.Unix(hi, 0).In(zone), offset, nextOffset))
+		offset = nextOffset
+	}
+
+	return tz
+}
+
+// newObservance creates a STANDARD or DAYLIGHT observance starting at
+// onset, which is written in the local time before the transition.
+func newObservance(onset time.Time, offsetFrom, offsetTo int) ics.Component {
+	base := ics.ComponentBase{}
+	local := onset.UTC().Add(time.Duration(offsetFrom) * time.Second)
+	base.AddProperty(ics.ComponentProperty(ics.PropertyDtstart), local.Format("20060102T150405"))
+	base.AddProperty(ics.ComponentProperty(ics.PropertyTzoffsetfrom), formatUTCOffset(offsetFrom))
+	base.AddProperty(ics.ComponentProperty(ics.PropertyTzoffsetto), formatUTCOffset(offsetTo))
+	if name, _ := onset.Zone(); name != "" {
+		base.AddProperty(ics.ComponentProperty(ics.PropertyTzname), name)
+	}
+
+	if onset.IsDST() {
+		return &ics.Daylight{ComponentBase: base}
+	}
+	return &ics.Standard{ComponentBase: base}
+}
+
+// formatUTCOffset formats an offset in seconds as +HHMM, or +HHMMSS when
+// it has seconds.
+func formatUTCOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+package notion_ical
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans for conversions. It does nothing unless the
+// application configures an OpenTelemetry tracer provider.
+var tracer = otel.Tracer("github.com/serverwentdown/notion-ical")
+
+// endSpan records err on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,428 @@
+package notion_ical
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCalendar = errors.New("invalid calendar")
+
+// maxLineOctets is the length of content lines, excluding the line break,
+// after which RFC 5545 requires lines to be folded.
+const maxLineOctets = 75
+
+// Violation is a part of a calendar that breaks RFC 5545.
+type Violation struct {
+	// Line is the number of the line the violation was found on, starting
+	// at 1
+	Line    int
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d: %s", v.Line, v.Message)
+}
+
+// requiredProperties must occur exactly once in each component.
+var requiredProperties = map[string][]string{
+	"VCALENDAR": {"PRODID", "VERSION"},
+	"VEVENT":    {"UID", "DTSTAMP"},
+	"VTODO":     {"UID", "DTSTAMP"},
+	"VFREEBUSY": {"UID", "DTSTAMP"},
+	"VTIMEZONE": {"TZID"},
+	"STANDARD":  {"DTSTART", "TZOFFSETFROM", "TZOFFSETTO"},
+	"DAYLIGHT":  {"DTSTART", "TZOFFSETFROM", "TZOFFSETTO"},
+	"VALARM":    {"ACTION", "TRIGGER"},
+}
+
+// singleProperties must not occur more than once in a component.
+var singleProperties = map[string]bool{
+	"UID": true, "DTSTAMP": true, "DTSTART": true, "DTEND": true, "DUE": true,
+	"DURATION": true, "SUMMARY": true, "DESCRIPTION": true, "LOCATION": true,
+	"STATUS": true, "URL": true, "CLASS": true, "SEQUENCE": true,
+	"RECURRENCE-ID": true, "CREATED": true, "LAST-MODIFIED": true,
+	"COMPLETED": true, "TRANSP": true, "PRIORITY": true, "TZID": true,
+	"TZOFFSETFROM": true, "TZOFFSETTO": true, "ACTION": true, "TRIGGER": true,
+	"PRODID": true, "VERSION": true, "CALSCALE": true, "METHOD": true,
+}
+
+// dateProperties have DATE or DATE-TIME values. utcProperties must be UTC
+// DATE-TIME values.
+var (
+	dateProperties = map[string]bool{
+		"DTSTART": true, "DTEND": true, "DUE": true, "RECURRENCE-ID": true,
+		"EXDATE": true, "RDATE": true,
+	}
+	utcProperties = map[string]bool{
+		"DTSTAMP": true, "CREATED": true, "LAST-MODIFIED": true, "COMPLETED": true,
+	}
+)
+
+// contentLine is an unfolded content line.
+type contentLine struct {
+	line   int
+	name   string
+	params map[string]string
+	value  string
+}
+
+// component is a component being validated.
+type component struct {
+	name       string
+	line       int
+	properties map[string][]contentLine
+	// children counts the components that ended in the component by name
+	children map[string]int
+}
+
+func (c *component) first(name string) (contentLine, bool) {
+	lines := c.properties[name]
+	if len(lines) == 0 {
+		return contentLine{}, false
+	}
+	return lines[0], true
+}
+
+// validator collects violations while reading a calendar.
+type validator struct {
+	violations []Violation
+	stack      []*component
+	uids       map[string]int
+	method     bool
+	ended      bool
+}
+
+func (v *validator) violate(line int, format string, args ...any) {
+	v.violations = append(v.violations, Violation{line, fmt.Sprintf(format, args...)})
+}
+
+// Validate checks a calendar against the constraints of RFC 5545 that
+// clients commonly enforce: line folding, the nesting of components, their
+// required properties, date formats and the uniqueness of UIDs. It returns
+// the violations found, in the order of the lines they were found on.
+func Validate(r io.Reader) ([]Violation, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{uids: make(map[string]int)}
+	for _, line := range v.unfold(string(b)) {
+		v.content(line)
+	}
+	for i := len(v.stack) - 1; i >= 0; i-- {
+		v.violate(v.stack[i].line, "%s is not ended", v.stack[i].name)
+	}
+	if !v.ended && len(v.stack) == 0 {
+		v.violate(1, "no VCALENDAR")
+	}
+
+	sort.SliceStable(v.violations, func(i, j int) bool {
+		return v.violations[i].Line < v.violations[j].Line
+	})
+	return v.violations, nil
+}
+
+// unfold checks line breaks and lengths, and joins folded lines.
+func (v *validator) unfold(s string) []contentLine {
+	var lines []contentLine
+	physical := strings.Split(s, "\n")
+	for i, text := range physical {
+		n := i + 1
+		if i == len(physical)-1 {
+			if text == "" {
+				break
+			}
+			v.violate(n, "last line does not end with CRLF")
+		} else if strings.HasSuffix(text, "\r") {
+			text = strings.TrimSuffix(text, "\r")
+		} else {
+			v.violate(n, "line ends with LF instead of CRLF")
+		}
+		if len(text) > maxLineOctets {
+			v.violate(n, "line is %d octets long, longer than %d", len(text), maxLineOctets)
+		}
+
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			if len(lines) == 0 {
+				v.violate(n, "folded line without a line to continue")
+				continue
+			}
+			lines[len(lines)-1].value += text[1:]
+			continue
+		}
+		if text == "" {
+			v.violate(n, "empty line")
+			continue
+		}
+		lines = append(lines, contentLine{line: n, value: text})
+	}
+
+	for i := range lines {
+		lines[i] = v.parse(lines[i])
+	}
+	return lines
+}
+
+// parse splits an unfolded line, held in value, into its name, parameters
+// and value. Lines that cannot be parsed have no name.
+func (v *validator) parse(line contentLine) contentLine {
+	text := line.value
+	parsed := contentLine{line: line.line, params: make(map[string]string)}
+
+	end := strings.IndexAny(text, ";:")
+	if end < 0 {
+		v.violate(line.line, "no colon separating the property value")
+		return parsed
+	}
+	name := strings.ToUpper(text[:end])
+	if !isName(name) {
+		v.violate(line.line, "invalid property name %q", text[:end])
+		return parsed
+	}
+
+	rest := text[end:]
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 || !isName(strings.ToUpper(rest[:eq])) {
+			v.violate(line.line, "invalid parameter in %s", name)
+			return parsed
+		}
+		param := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		quoted := false
+		i := 0
+		for ; i < len(rest); i++ {
+			if rest[i] == '"' {
+				quoted = !quoted
+			} else if !quoted && (rest[i] == ';' || rest[i] == ':') {
+				break
+			}
+		}
+		if quoted || i == len(rest) {
+			v.violate(line.line, "no colon separating the value of %s", name)
+			return parsed
+		}
+		parsed.params[param] = strings.Trim(rest[:i], `"`)
+		rest = rest[i:]
+	}
+
+	parsed.name = name
+	parsed.value = strings.TrimPrefix(rest, ":")
+	return parsed
+}
+
+// isName reports whether name is an IANA token or X-name.
+func isName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// content checks a content line in the component it is in.
+func (v *validator) content(line contentLine) {
+	if line.name == "" {
+		return
+	}
+	if v.ended {
+		v.violate(line.line, "content after the end of VCALENDAR")
+		return
+	}
+
+	switch line.name {
+	case "BEGIN":
+		name := strings.ToUpper(line.value)
+		if len(v.stack) == 0 && name != "VCALENDAR" {
+			v.violate(line.line, "%s outside of VCALENDAR", name)
+		}
+		v.stack = append(v.stack, &component{
+			name:       name,
+			line:       line.line,
+			properties: make(map[string][]contentLine),
+			children:   make(map[string]int),
+		})
+		return
+	case "END":
+		name := strings.ToUpper(line.value)
+		if len(v.stack) == 0 {
+			v.violate(line.line, "END:%s without BEGIN", name)
+			return
+		}
+		c := v.stack[len(v.stack)-1]
+		if c.name != name {
+			v.violate(line.line, "END:%s ends %s begun on line %d", name, c.name, c.line)
+		}
+		v.stack = v.stack[:len(v.stack)-1]
+		if len(v.stack) > 0 {
+			v.stack[len(v.stack)-1].children[c.name]++
+		}
+		v.end(c)
+		if len(v.stack) == 0 {
+			v.ended = true
+		}
+		return
+	}
+
+	if len(v.stack) == 0 {
+		v.violate(line.line, "%s outside of VCALENDAR", line.name)
+		return
+	}
+	c := v.stack[len(v.stack)-1]
+	c.properties[line.name] = append(c.properties[line.name], line)
+
+	if c.name == "VCALENDAR" && line.name == "METHOD" {
+		v.method = true
+	}
+	if dateProperties[line.name] {
+		v.date(line, false)
+	}
+	if utcProperties[line.name] {
+		v.date(line, true)
+	}
+}
+
+// end checks the properties of a component once it has ended.
+func (v *validator) end(c *component) {
+	required := requiredProperties[c.name]
+	if c.name == "VEVENT" && !v.method {
+		// DTSTART may only be left out of events sent with a METHOD
+		required = append([]string{"DTSTART"}, required...)
+	}
+	for _, name := range required {
+		if len(c.properties[name]) == 0 {
+			v.violate(c.line, "%s has no %s", c.name, name)
+		}
+	}
+	for name, lines := range c.properties {
+		if singleProperties[name] && len(lines) > 1 {
+			v.violate(lines[1].line, "%s has more than one %s", c.name, name)
+		}
+	}
+
+	switch c.name {
+	case "VCALENDAR":
+		if version, ok := c.first("VERSION"); ok && version.value != "2.0" {
+			v.violate(version.line, "VERSION is %q instead of \"2.0\"", version.value)
+		}
+	case "VEVENT":
+		v.exclusive(c, "DTEND", "DURATION")
+		v.ordered(c, "DTSTART", "DTEND")
+	case "VTODO":
+		v.exclusive(c, "DUE", "DURATION")
+		v.ordered(c, "DTSTART", "DUE")
+	case "VTIMEZONE":
+		if c.children["STANDARD"] == 0 && c.children["DAYLIGHT"] == 0 {
+			v.violate(c.line, "VTIMEZONE has no STANDARD or DAYLIGHT")
+		}
+	}
+
+	switch c.name {
+	case "VEVENT", "VTODO", "VJOURNAL", "VFREEBUSY":
+		uid, ok := c.first("UID")
+		if !ok {
+			return
+		}
+		key := uid.value
+		if recurrenceID, ok := c.first("RECURRENCE-ID"); ok {
+			key += "\x00" + recurrenceID.value
+		}
+		if line, ok := v.uids[key]; ok {
+			v.violate(uid.line, "UID %q is also used on line %d", uid.value, line)
+			return
+		}
+		v.uids[key] = uid.line
+	}
+}
+
+// exclusive checks that a and b do not both occur in c.
+func (v *validator) exclusive(c *component, a, b string) {
+	if len(c.properties[a]) > 0 && len(c.properties[b]) > 0 {
+		v.violate(c.line, "%s has both %s and %s", c.name, a, b)
+	}
+}
+
+// ordered checks that the date of end is the same kind as and later than
+// the date of start. Date-times may be equal, for events that take no time,
+// which clients accept.
+func (v *validator) ordered(c *component, start, end string) {
+	startLine, ok := c.first(start)
+	if !ok {
+		return
+	}
+	endLine, ok := c.first(end)
+	if !ok {
+		return
+	}
+
+	startTime, startDate, err := parseValidatedDate(startLine)
+	if err != nil {
+		return
+	}
+	endTime, endDate, err := parseValidatedDate(endLine)
+	if err != nil {
+		return
+	}
+	if startDate != endDate {
+		v.violate(endLine.line, "%s and %s are not both dates or both date-times", start, end)
+		return
+	}
+	if endTime.Before(startTime) || startDate && endTime.Equal(startTime) {
+		v.violate(endLine.line, "%s is not later than %s", end, start)
+	}
+}
+
+// date checks the format of each value of a date property.
+func (v *validator) date(line contentLine, utc bool) {
+	if line.params["VALUE"] == "PERIOD" {
+		return
+	}
+	for _, value := range strings.Split(line.value, ",") {
+		value := contentLine{line: line.line, name: line.name, params: line.params, value: value}
+		t, date, err := parseValidatedDate(value)
+		if err != nil {
+			v.violate(line.line, "%s %q is not a valid %s", line.name, value.value, dateKind(line))
+			continue
+		}
+		if utc && (date || t.Location() != time.UTC) {
+			v.violate(line.line, "%s %q is not a UTC date-time", line.name, value.value)
+		}
+		if !date && line.params["TZID"] != "" && strings.HasSuffix(value.value, "Z") {
+			v.violate(line.line, "%s has a TZID and a UTC date-time", line.name)
+		}
+	}
+}
+
+func dateKind(line contentLine) string {
+	if line.params["VALUE"] == "DATE" {
+		return "date"
+	}
+	return "date-time"
+}
+
+// parseValidatedDate parses a DATE or DATE-TIME value, in UTC unless it
+// ends in Z. Date-times with a TZID are compared as if they were UTC, which
+// is enough to order the start and end of a component in the same zone.
+func parseValidatedDate(line contentLine) (time.Time, bool, error) {
+	if line.params["VALUE"] == "DATE" {
+		t, err := time.Parse("20060102", line.value)
+		return t, true, err
+	}
+	if strings.HasSuffix(line.value, "Z") {
+		t, err := time.Parse("20060102T150405Z", line.value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", line.value, time.FixedZone("", 0))
+	return t, false, err
+}
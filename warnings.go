@@ -0,0 +1,109 @@
+package notion_ical
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WarningKind groups warnings by what caused them.
+type WarningKind string
+
+const (
+	// WarningDate is a date that is missing or cannot be parsed
+	WarningDate WarningKind = "date"
+	// WarningProperty is a property that is missing or cannot be parsed
+	WarningProperty WarningKind = "property"
+	// WarningContent is page content left out of an event, such as blocks
+	// nested too deeply or mentions that cannot be resolved
+	WarningContent WarningKind = "content"
+)
+
+// Warning is a non-fatal issue found while reading a source, such as a row
+// that was skipped because its date cannot be parsed.
+type Warning struct {
+	Kind WarningKind
+	// Item identifies the row, page or block, such as "Events.csv:12" or the
+	// URL of a page
+	Item    string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Item == "" {
+		return w.Message
+	}
+	return w.Item + ": " + w.Message
+}
+
+// Warnings collects the warnings of a source, so that issues that do not
+// fail the read are surfaced instead of only logged. Sources collect into
+// it when set with WithWarnings, or the Warnings of ConfigSourceAPI and
+// ConfigSourceExport.
+//
+// Sources with warnings skip rows whose values cannot be parsed, like
+// sources with ReadStats. Sources clear their warnings when they start
+// reading, so that they are the warnings of the latest read, and should
+// not share Warnings.
+type Warnings struct {
+	mu   sync.Mutex
+	list []Warning
+}
+
+// List returns the warnings collected so far.
+func (w *Warnings) List() []Warning {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Warning(nil), w.list...)
+}
+
+// Len counts the warnings collected so far.
+func (w *Warnings) Len() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.list)
+}
+
+// The methods collecting warnings do nothing on nil warnings, so that
+// sources call them without checking whether warnings are set.
+
+func (w *Warnings) add(kind WarningKind, item string, format string, v ...any) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = append(w.list, Warning{Kind: kind, Item: item, Message: fmt.Sprintf(format, v...)})
+}
+
+func (w *Warnings) reset() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = nil
+}
+
+// skipRow records a row that failed with err in stats and warnings, and
+// reports whether it should be skipped instead of failing the read. Only
+// rows with parse errors are skipped, and only when stats or warnings are
+// set.
+func skipRow(stats *ReadStats, warnings *Warnings, row string, err error) bool {
+	skipped := stats.skip(row, err)
+	if warnings != nil && errors.Is(err, ErrParse) {
+		kind := WarningProperty
+		if errors.Is(err, ErrParseDate) {
+			kind = WarningDate
+		}
+		warnings.add(kind, row, "skipped: %v", err)
+		skipped = true
+	}
+	return skipped
+}